@@ -0,0 +1,353 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formats of the lines of an AccessLogHandler, in the notation of
+// Apache's LogFormat.
+const (
+	CommonLogFormat   = `%h %l %u %t "%r" %>s %b`
+	CombinedLogFormat = `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`
+)
+
+// Keys of the attributes of a request, in the group of an
+// AccessLogHandler.
+const (
+	AccessMethodKey    = "method"
+	AccessPathKey      = "path"
+	AccessProtoKey     = "proto"
+	AccessStatusKey    = "status"
+	AccessBytesKey     = "bytes"
+	AccessDurationKey  = "duration"
+	AccessRemoteKey    = "remote_addr"
+	AccessUserKey      = "user"
+	AccessHostKey      = "host"
+	AccessUserAgentKey = "user_agent"
+	AccessRefererKey   = "referer"
+)
+
+// AccessLogOptions are options for an [AccessLogHandler].
+type AccessLogOptions struct {
+	// Group is the key of the group of attributes making a record a
+	// request. If empty, "http" is used.
+	Group string
+
+	// Format is the format of the lines, with the directives of Apache's
+	// LogFormat listed at [AccessLogHandler]. If empty, CombinedLogFormat
+	// is used.
+	Format string
+}
+
+// AccessLogHandler writes the records of HTTP requests as the lines of an
+// access log, in the Common or Combined Log Format of web servers, for
+// tools such as goaccess, and passes the other records to another
+// handler. A record is a request if it has a group of attributes under
+// the key Group, whose keys are the Access*Key constants, from the
+// logging call or from With:
+//
+//	logger.Info("request", log.Group("http",
+//		log.String("method", r.Method), log.String("path", r.URL.RequestURI()),
+//		log.Int("status", status), log.Int("bytes", n), log.Duration("duration", d),
+//		log.String("remote_addr", r.RemoteAddr), log.String("user_agent", r.UserAgent()),
+//		log.String("referer", r.Referer()),
+//	))
+//
+// written as
+//
+//	192.0.2.1 - - [01/Jun/2024:12:00:00 +0000] "GET /index.html HTTP/1.1" 200 512 "-" "curl/8.0"
+//
+// The directives of Format are those of Apache:
+//
+//	%h    remote address, without its port
+//	%l    "-"
+//	%u    user, or "-"
+//	%t    time of the record, as [02/Jan/2006:15:04:05 -0700]
+//	%r    request line: method, path and protocol
+//	%m    method
+//	%U    path
+//	%H    protocol, HTTP/1.1 if unknown
+//	%s    status, also as %>s
+//	%b    bytes sent, or "-" for none
+//	%B    bytes sent
+//	%D    duration, in microseconds
+//	%T    duration, in seconds
+//	%v    host
+//	%{Name}i  request header Name, the attribute of Name in lower case,
+//	          dashes replaced by underscores, as user_agent for User-Agent
+//	%%    "%"
+//
+// Records under groups opened with WithGroup are never requests.
+type AccessLogHandler struct {
+	next  slog.Handler
+	a     *accessLog
+	req   []slog.Attr // of the group, from WithAttrs
+	group bool        // whether a group was opened with WithGroup
+}
+
+// accessLog is the writer and format shared by an AccessLogHandler and
+// the handlers derived from it.
+type accessLog struct {
+	group  string
+	format []accessDirective
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// accessDirective is a directive of the format, or literal text if verb
+// is zero.
+type accessDirective struct {
+	verb byte
+	arg  string // literal text, or the argument of %{arg}i
+}
+
+// NewAccessLogHandler returns an AccessLogHandler writing the lines of
+// the requests to w and passing the other records to next. It returns an
+// error if the format has an unknown directive.
+func NewAccessLogHandler(w io.Writer, next slog.Handler, opts *AccessLogOptions) (*AccessLogHandler, error) {
+	var o AccessLogOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Group == "" {
+		o.Group = "http"
+	}
+	if o.Format == "" {
+		o.Format = CombinedLogFormat
+	}
+	format, err := parseAccessFormat(o.Format)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessLogHandler{next: next, a: &accessLog{group: o.Group, format: format, w: w}}, nil
+}
+
+// parseAccessFormat parses the directives of format.
+func parseAccessFormat(format string) ([]accessDirective, error) {
+	var ds []accessDirective
+	for format != "" {
+		i := strings.IndexByte(format, '%')
+		if i < 0 {
+			ds = append(ds, accessDirective{arg: format})
+			break
+		}
+		if i > 0 {
+			ds = append(ds, accessDirective{arg: format[:i]})
+		}
+		format = format[i+1:]
+		var arg string
+		if strings.HasPrefix(format, "{") {
+			end := strings.IndexByte(format, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("log: access log format: unterminated %%{")
+			}
+			arg, format = format[1:end], format[end+1:]
+		}
+		format = strings.TrimPrefix(format, ">")
+		if format == "" {
+			return nil, fmt.Errorf("log: access log format: trailing %%")
+		}
+		verb := format[0]
+		format = format[1:]
+		switch {
+		case verb == '%':
+			ds = append(ds, accessDirective{arg: "%"})
+		case verb == 'i' && arg != "":
+			ds = append(ds, accessDirective{verb: verb, arg: strings.ReplaceAll(strings.ToLower(arg), "-", "_")})
+		case strings.IndexByte("hlutrmUHsbBDTv", verb) >= 0 && arg == "":
+			ds = append(ds, accessDirective{verb: verb})
+		default:
+			return nil, fmt.Errorf("log: access log format: unknown directive %%%c", verb)
+		}
+	}
+	return ds, nil
+}
+
+func (h *AccessLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *AccessLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.next = h.next.WithAttrs(attrs)
+	if !h.group {
+		h2.req = slices.Clip(h.req)
+		for _, a := range attrs {
+			h2.req = append(h2.req, h.a.request(a)...)
+		}
+	}
+	return &h2
+}
+
+func (h *AccessLogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.next = h.next.WithGroup(name)
+	h2.group = true
+	return &h2
+}
+
+// request returns the attributes of a, if it is the group of the
+// requests.
+func (a *accessLog) request(attr slog.Attr) []slog.Attr {
+	attr.Value = attr.Value.Resolve()
+	if attr.Key != a.group || attr.Value.Kind() != slog.KindGroup {
+		return nil
+	}
+	return attr.Value.Group()
+}
+
+func (h *AccessLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	req := h.req
+	if !h.group {
+		r.Attrs(func(a slog.Attr) bool {
+			req = append(slices.Clip(req), h.a.request(a)...)
+			return true
+		})
+	}
+	if len(req) == 0 {
+		return h.next.Handle(ctx, r)
+	}
+	fields := make(map[string]slog.Value, len(req))
+	for _, a := range req {
+		fields[a.Key] = a.Value.Resolve()
+	}
+	line := h.a.appendLine(nil, r.Time, fields)
+	h.a.mu.Lock()
+	defer h.a.mu.Unlock()
+	_, err := h.a.w.Write(append(line, '\n'))
+	return err
+}
+
+// appendLine appends the line of the request of fields, at t.
+func (a *accessLog) appendLine(buf []byte, t time.Time, fields map[string]slog.Value) []byte {
+	str := func(key string) string {
+		if v, ok := fields[key]; ok {
+			return v.String()
+		}
+		return ""
+	}
+	// field appends s, escaped, or "-" if empty.
+	field := func(buf []byte, s string) []byte {
+		if s == "" {
+			return append(buf, '-')
+		}
+		return appendAccessEscaped(buf, s)
+	}
+	for _, d := range a.format {
+		switch d.verb {
+		case 0:
+			buf = append(buf, d.arg...)
+		case 'h':
+			addr := str(AccessRemoteKey)
+			if host, _, err := net.SplitHostPort(addr); err == nil {
+				addr = host
+			}
+			buf = field(buf, addr)
+		case 'l':
+			buf = append(buf, '-')
+		case 'u':
+			buf = field(buf, str(AccessUserKey))
+		case 't':
+			buf = append(buf, '[')
+			buf = t.AppendFormat(buf, "02/Jan/2006:15:04:05 -0700")
+			buf = append(buf, ']')
+		case 'r':
+			buf = appendAccessEscaped(buf, str(AccessMethodKey)+" "+str(AccessPathKey)+" "+accessProto(str(AccessProtoKey)))
+		case 'm':
+			buf = field(buf, str(AccessMethodKey))
+		case 'U':
+			buf = field(buf, str(AccessPathKey))
+		case 'H':
+			buf = appendAccessEscaped(buf, accessProto(str(AccessProtoKey)))
+		case 's':
+			buf = field(buf, str(AccessStatusKey))
+		case 'b', 'B':
+			n := accessInt(fields[AccessBytesKey])
+			if n == 0 && d.verb == 'b' {
+				buf = append(buf, '-')
+			} else {
+				buf = strconv.AppendInt(buf, n, 10)
+			}
+		case 'D', 'T':
+			v := fields[AccessDurationKey]
+			d2 := time.Duration(accessInt(v))
+			if v.Kind() == slog.KindDuration {
+				d2 = v.Duration()
+			}
+			if d.verb == 'D' {
+				buf = strconv.AppendInt(buf, d2.Microseconds(), 10)
+			} else {
+				buf = strconv.AppendInt(buf, int64(d2/time.Second), 10)
+			}
+		case 'v':
+			buf = field(buf, str(AccessHostKey))
+		case 'i':
+			buf = field(buf, str(d.arg))
+		}
+	}
+	return buf
+}
+
+// accessProto returns proto, or HTTP/1.1 if empty.
+func accessProto(proto string) string {
+	if proto == "" {
+		return "HTTP/1.1"
+	}
+	return proto
+}
+
+// accessInt returns v as an integer, or zero if it isn't one.
+func accessInt(v slog.Value) int64 {
+	switch v.Kind() {
+	case slog.KindInt64:
+		return v.Int64()
+	case slog.KindUint64:
+		return int64(v.Uint64())
+	case slog.KindFloat64:
+		return int64(v.Float64())
+	case slog.KindDuration:
+		return int64(v.Duration())
+	case slog.KindString:
+		n, _ := strconv.ParseInt(v.String(), 10, 64)
+		return n
+	}
+	return 0
+}
+
+// appendAccessEscaped appends s with quotes, backslashes and control
+// characters escaped, as Apache does.
+func appendAccessEscaped(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c < 0x20 || c == 0x7f:
+			buf = append(buf, '\\', 'x', hex[c>>4], hex[c&0xf])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// Unwrap returns the handler of the records other than requests.
+func (h *AccessLogHandler) Unwrap() Handler {
+	return h.next
+}
@@ -0,0 +1,25 @@
+package log
+
+import (
+	"context"
+)
+
+type forcedKey struct{}
+
+// withForced marks ctx as carrying a record logged by Always.
+func withForced(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcedKey{}, true)
+}
+
+// IsForced reports whether ctx was passed to a handler for a record
+// logged by [Logger.Always]. Handlers that filter records by level on
+// their own should let such records through, while still routing them
+// by level like any other.
+func IsForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(forcedKey{}).(bool)
+	return forced
+}
+
+func (l *logger) Always(msg any, args ...any) {
+	l.log(withForced(context.Background()), LevelInfo.Level(), msg, args)
+}
@@ -0,0 +1,67 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+// levelOff is a level above all records, turning a logger off.
+const levelOff = LevelFatal + 1
+
+func TestAlwaysWhenOff(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&Options{Writer: &buf, Deterministic: true})
+	l.SetLevel(levelOff)
+	l.Info("ignored")
+	l.Error("ignored")
+	l.Always("starting", "version", "1.2.0")
+	if got, want := buf.String(), "|  INFO | starting version=\"1.2.0\" \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAlwaysThroughWith(t *testing.T) {
+	l, ring := newRingLogger(&Options{})
+	l.SetLevel(levelOff)
+	l.With("component", "licensing").Always("license accepted")
+	recs := ring.Records()
+	if len(recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(recs))
+	}
+	if v, _ := attrValue(recs[0], "component"); v.String() != "licensing" {
+		t.Errorf("component = %v, want licensing", v)
+	}
+	if got := RecordLevel(recs[0]); got != LevelInfo {
+		t.Errorf("level = %v, want INFO", got)
+	}
+}
+
+func TestAlwaysKeepsRouting(t *testing.T) {
+	errorRing, infoRing := NewRingHandler(10), NewRingHandler(10)
+	router := NewLevelRouterHandler(nil,
+		LevelRoute{Min: LevelError, Max: LevelFatal, Handler: &levelHandler{Handler: errorRing, level: LevelError}},
+		LevelRoute{Min: LevelTrace, Max: LevelInfo, Handler: &levelHandler{Handler: infoRing, level: levelOff}},
+	)
+	l := New(&Options{NewHandler: func(_ io.Writer, _ *slog.HandlerOptions) slog.Handler { return router }})
+	l.SetLevel(levelOff)
+	l.Always("starting")
+	if got := messages(errorRing); len(got) != 0 {
+		t.Errorf("the ERROR route got %q", got)
+	}
+	if got, want := messages(infoRing), []string{"INFO starting"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("the INFO route got %q, want %q", got, want)
+	}
+}
+
+func TestIsForced(t *testing.T) {
+	if IsForced(context.Background()) {
+		t.Error("a plain context is forced")
+	}
+	if !IsForced(withForced(context.Background())) {
+		t.Error("a context of Always isn't forced")
+	}
+}
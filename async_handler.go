@@ -0,0 +1,369 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DropPolicy is what an [AsyncHandler] or a [ChannelHandler] does with a
+// record when its queue is full.
+type DropPolicy int
+
+const (
+	BlockWhenFull DropPolicy = iota // wait for room, until the context is done
+	DropNewest                      // drop the record
+	DropOldest                      // drop the oldest queued record for it
+)
+
+// QueuedForKey is the key of the attribute holding how long a record
+// waited in the queue of an AsyncHandler. See [AsyncOptions.QueuedFor].
+const QueuedForKey = "queued_for"
+
+// asyncQueueSize and asyncCloseTimeout are the defaults of AsyncOptions.
+const (
+	asyncQueueSize    = 1024
+	asyncCloseTimeout = 5 * time.Second
+)
+
+// AsyncOptions are options for an [AsyncHandler].
+type AsyncOptions struct {
+	// QueueSize is the number of records the handler holds before they
+	// are handled. If zero, 1024 is used.
+	QueueSize int
+
+	// Policy is what Handle does when the queue is full.
+	Policy DropPolicy
+
+	// BlockTimeout, if positive, makes Handle wait up to this long for
+	// room in a full queue, before applying a dropping Policy, for the
+	// records at or above BlockLevel: callers logging such records slow
+	// down instead of losing them while the pipeline is saturated. See
+	// also [Logger.Pressure].
+	BlockTimeout time.Duration
+	BlockLevel   Level
+
+	// CloseTimeout bounds how long Close waits for the queue to drain,
+	// and how long a LevelPanic or LevelFatal record waits for the
+	// records queued before it. If zero, five seconds are used.
+	CloseTimeout time.Duration
+
+	// Drops, if set, counts the records dropped from the full queue under
+	// DropQueue, for the next record that gets through the logger sharing
+	// it. See [Drops].
+	Drops *Drops
+
+	// OnError, if set, is called with the errors of the wrapped handler,
+	// which Handle can't return.
+	OnError func(err error)
+
+	// QueuedFor adds a QueuedForKey attribute to the records, holding the
+	// time from their own time to when the worker took them off the
+	// queue, which makes the lag of the pipeline visible. Like the other
+	// attributes of the record, it belongs to the groups of the handler.
+	// Records without a time don't get it.
+	QueuedFor bool
+
+	// Clock returns the current time for QueuedFor and the time of the
+	// last error reported by LogHealth. If nil, time.Now is used.
+	Clock func() time.Time
+}
+
+// AsyncHandler moves the handling of records off the goroutines logging
+// them: Handle queues a copy of the record, and a single worker goroutine
+// passes the queued records to the wrapped handler, in order. A slow
+// terminal or network file then no longer stalls the callers, as long as
+// the queue has room; what happens when it is full is set by the
+// DropPolicy.
+//
+// Records at LevelPanic and above are handled synchronously, once the
+// records queued before them are, so that they are written before the
+// process exits. Records logged with [Logger.Always] are never dropped:
+// they wait for room in the queue.
+//
+// An AsyncHandler is registered with [RegisterFlusher] until closed, and
+// reports the depth of its queue through [HealthReporter].
+type AsyncHandler struct {
+	next slog.Handler
+	a    *asyncQueue
+}
+
+// asyncRecord is a queued record, with the handler to pass it to.
+type asyncRecord struct {
+	ctx context.Context
+	r   slog.Record
+	h   slog.Handler
+}
+
+// asyncQueue is the queue and worker goroutine shared by an AsyncHandler
+// and the handlers derived from it.
+type asyncQueue struct {
+	opts       AsyncOptions
+	queue      chan asyncRecord
+	flushes    chan chan struct{}
+	stop       chan struct{}
+	done       chan struct{}
+	closed     atomic.Bool
+	dropped    atomic.Int64
+	unregister func()
+
+	// Handle holds sendMu for reading while it checks closed and counts
+	// itself in senders, and Close holds it for writing while it sets
+	// closed: the worker is stopped once the records being queued are.
+	sendMu  sync.RWMutex
+	senders sync.WaitGroup
+
+	mu        sync.Mutex
+	lastErr   error
+	lastErrAt time.Time
+}
+
+// NewAsyncHandler returns an AsyncHandler passing records to next through
+// a queue of queueSize records, and starts its worker goroutine.
+func NewAsyncHandler(next slog.Handler, queueSize int, policy DropPolicy) *AsyncHandler {
+	return NewAsyncHandlerWithOptions(next, AsyncOptions{QueueSize: queueSize, Policy: policy})
+}
+
+// NewAsyncHandlerWithOptions returns an AsyncHandler passing records to
+// next, and starts its worker goroutine.
+func NewAsyncHandlerWithOptions(next slog.Handler, opts AsyncOptions) *AsyncHandler {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = asyncQueueSize
+	}
+	if opts.CloseTimeout <= 0 {
+		opts.CloseTimeout = asyncCloseTimeout
+	}
+	a := &asyncQueue{
+		opts:    opts,
+		queue:   make(chan asyncRecord, opts.QueueSize),
+		flushes: make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	h := &AsyncHandler{next: next, a: a}
+	a.unregister = RegisterFlusher(h)
+	go a.run()
+	return h
+}
+
+func (h *AsyncHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *AsyncHandler) Handle(ctx context.Context, r slog.Record) error {
+	a := h.a
+	if r.Level >= LevelPanic.Level() {
+		fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), a.opts.CloseTimeout)
+		h.Flush(fctx)
+		cancel()
+		return h.next.Handle(ctx, r)
+	}
+	a.sendMu.RLock()
+	if a.closed.Load() {
+		a.sendMu.RUnlock()
+		return net.ErrClosed
+	}
+	a.senders.Add(1)
+	a.sendMu.RUnlock()
+	defer a.senders.Done()
+	rec := asyncRecord{ctx: context.WithoutCancel(ctx), r: r.Clone(), h: h.next}
+	select {
+	case a.queue <- rec:
+		return nil
+	default:
+	}
+
+	if IsForced(ctx) || a.opts.Policy == BlockWhenFull {
+		select {
+		case a.queue <- rec:
+			return nil
+		case <-a.stop:
+			return net.ErrClosed
+		case <-ctx.Done():
+		}
+		a.drop(r)
+		return nil
+	}
+	if a.opts.BlockTimeout > 0 && r.Level >= a.opts.BlockLevel.Level() {
+		timer := time.NewTimer(a.opts.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case a.queue <- rec:
+			return nil
+		case <-a.stop:
+			return net.ErrClosed
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+	}
+	if a.opts.Policy == DropNewest {
+		a.drop(r)
+		return nil
+	}
+	for {
+		select {
+		case a.queue <- rec:
+			return nil
+		default:
+		}
+		select {
+		case old := <-a.queue:
+			a.drop(old.r)
+		default:
+		}
+	}
+}
+
+// drop counts r as dropped from the queue.
+func (a *asyncQueue) drop(r slog.Record) {
+	a.dropped.Add(1)
+	a.opts.Drops.Add(DropQueue, 1)
+	a.opts.Drops.restoreFrom(r)
+}
+
+// run handles the queued records until the handler is closed, then those
+// left in the queue.
+func (a *asyncQueue) run() {
+	defer close(a.done)
+	for {
+		select {
+		case rec := <-a.queue:
+			a.handle(rec)
+		case done := <-a.flushes:
+			a.drain()
+			close(done)
+		case <-a.stop:
+			a.drain()
+			return
+		}
+	}
+}
+
+// drain handles the records queued so far.
+func (a *asyncQueue) drain() {
+	for {
+		select {
+		case rec := <-a.queue:
+			a.handle(rec)
+		default:
+			return
+		}
+	}
+}
+
+func (a *asyncQueue) handle(rec asyncRecord) {
+	if a.opts.QueuedFor && !rec.r.Time.IsZero() {
+		rec.r.AddAttrs(slog.Duration(QueuedForKey, a.now().Sub(rec.r.Time)))
+	}
+	err := rec.h.Handle(rec.ctx, rec.r)
+	a.mu.Lock()
+	if err != nil {
+		a.lastErr, a.lastErrAt = err, a.now()
+	} else {
+		a.lastErr = nil
+	}
+	a.mu.Unlock()
+	if err != nil && a.opts.OnError != nil {
+		a.opts.OnError(err)
+	}
+}
+
+// now returns the current time, from Clock if set.
+func (a *asyncQueue) now() time.Time {
+	if a.opts.Clock != nil {
+		return a.opts.Clock()
+	}
+	return time.Now()
+}
+
+// Dropped returns the number of records dropped from the full queue
+// since h was created.
+func (h *AsyncHandler) Dropped() int64 {
+	return h.a.dropped.Load()
+}
+
+// Flush waits until the records queued so far are handled, or ctx is
+// done.
+func (h *AsyncHandler) Flush(ctx context.Context) error {
+	a := h.a
+	done := make(chan struct{})
+	select {
+	case a.flushes <- done:
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close handles the records queued and stops the worker goroutine,
+// waiting until it is done or CloseTimeout elapses. Records handled
+// afterwards return net.ErrClosed, except those at LevelPanic and above,
+// which are still handled synchronously.
+func (h *AsyncHandler) Close() error {
+	a := h.a
+	a.sendMu.Lock()
+	if a.closed.Swap(true) {
+		a.sendMu.Unlock()
+		return nil
+	}
+	a.sendMu.Unlock()
+	a.unregister()
+	go func() {
+		// The records being queued are handled before the worker stops.
+		a.senders.Wait()
+		close(a.stop)
+	}()
+	timer := time.NewTimer(a.opts.CloseTimeout)
+	defer timer.Stop()
+	select {
+	case <-a.done:
+		return nil
+	case <-timer.C:
+		return context.DeadlineExceeded
+	}
+}
+
+// LogHealth reports the state of the queue and of the last record
+// handled.
+func (h *AsyncHandler) LogHealth() ComponentHealth {
+	a := h.a
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return ComponentHealth{
+		Name:          "async",
+		Healthy:       !a.closed.Load() && a.lastErr == nil && len(a.queue) < cap(a.queue),
+		QueueDepth:    len(a.queue),
+		QueueCapacity: cap(a.queue),
+		LastError:     a.lastErr,
+		LastErrorTime: a.lastErrAt,
+	}
+}
+
+func (h *AsyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &AsyncHandler{next: h.next.WithAttrs(attrs), a: h.a}
+}
+
+func (h *AsyncHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &AsyncHandler{next: h.next.WithGroup(name), a: h.a}
+}
+
+// Unwrap returns the handler wrapped by h.
+func (h *AsyncHandler) Unwrap() Handler {
+	return h.next
+}
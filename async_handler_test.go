@@ -0,0 +1,294 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAsyncHandlerQueuedFor(t *testing.T) {
+	clock := newFakeClock()
+	var mu sync.Mutex
+	now := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return clock.now()
+	}
+	ring := NewRingHandler(10)
+	// The worker is held by a first record until the clock has moved, so
+	// that the records queued after it wait for a known time.
+	bh := &blockingHandler{Handler: ring, entered: make(chan struct{}, 1), gate: make(chan struct{})}
+	h := NewAsyncHandlerWithOptions(bh, AsyncOptions{QueuedFor: true, Clock: now})
+	defer h.Close()
+
+	ctx := context.Background()
+	h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelInfo, "hold", 0))
+	<-bh.entered
+	h.Handle(ctx, slog.NewRecord(now(), slog.LevelInfo, "first", 0))
+	mu.Lock()
+	clock.advance(2 * time.Second)
+	mu.Unlock()
+	h.Handle(ctx, slog.NewRecord(now(), slog.LevelInfo, "second", 0))
+	h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelInfo, "no time", 0))
+	mu.Lock()
+	clock.advance(3 * time.Second)
+	mu.Unlock()
+	close(bh.gate)
+	if err := h.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]time.Duration{"first": 5 * time.Second, "second": 3 * time.Second}
+	recs := ring.Records()
+	if len(recs) != 4 {
+		t.Fatalf("got %d records, want 4", len(recs))
+	}
+	for _, r := range recs {
+		v, ok := attrValue(r, QueuedForKey)
+		d, timed := want[r.Message]
+		switch {
+		case !timed && ok:
+			t.Errorf("%q: got %s=%s, want none", r.Message, QueuedForKey, v)
+		case timed && !ok:
+			t.Errorf("%q: no %s attribute", r.Message, QueuedForKey)
+		case timed && v.Duration() != d:
+			t.Errorf("%q: got %s=%s, want %s", r.Message, QueuedForKey, v.Duration(), d)
+		}
+	}
+}
+
+func TestAsyncHandlerQueuedForOff(t *testing.T) {
+	ring := NewRingHandler(1)
+	h := NewAsyncHandler(ring, 1, BlockWhenFull)
+	defer h.Close()
+	h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "msg", 0))
+	h.Flush(context.Background())
+	if _, ok := attrValue(ring.Records()[0], QueuedForKey); ok {
+		t.Errorf("%s added without QueuedFor", QueuedForKey)
+	}
+}
+
+func TestStampHandleTime(t *testing.T) {
+	clock := newFakeClock()
+	var buf bytes.Buffer
+	h := NewJSONHandlerWithOptions(&buf, &HandlerOptions{StampHandleTime: true, Clock: clock.now})
+	recorded := clock.now()
+	clock.advance(time.Minute)
+	h.Handle(context.Background(), slog.NewRecord(recorded, slog.LevelInfo, "msg", 0))
+	want := `"handled_at":"2024-06-01T12:01:00Z"`
+	if got := buf.String(); !strings.Contains(got, want) {
+		t.Errorf("got %s, want it to hold %s", got, want)
+	}
+
+	buf.Reset()
+	h = NewJSONHandlerWithOptions(&buf, &HandlerOptions{StampHandleTime: true, Clock: func() time.Time { return time.Time{} }})
+	h.Handle(context.Background(), slog.NewRecord(recorded, slog.LevelInfo, "msg", 0))
+	if got := buf.String(); strings.Contains(got, HandledAtKey) {
+		t.Errorf("got %s, want no %s for a zero clock", got, HandledAtKey)
+	}
+}
+
+// blockingHandler is a handler whose Handle signals entered, if it has
+// room, then waits until gate is closed.
+type blockingHandler struct {
+	slog.Handler
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func (h *blockingHandler) Handle(ctx context.Context, r slog.Record) error {
+	select {
+	case h.entered <- struct{}{}:
+	default:
+	}
+	<-h.gate
+	return h.Handler.Handle(ctx, r)
+}
+
+// saturatedAsync returns an AsyncHandler with a queue of one record, full,
+// and its worker held until the returned function is called.
+func saturatedAsync(t *testing.T, opts AsyncOptions) (*AsyncHandler, *RingHandler, func()) {
+	t.Helper()
+	ring := NewRingHandler(10)
+	bh := &blockingHandler{Handler: ring, entered: make(chan struct{}, 1), gate: make(chan struct{})}
+	opts.QueueSize = 1
+	h := NewAsyncHandlerWithOptions(bh, opts)
+	ctx := context.Background()
+	h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelInfo, "held", 0))
+	<-bh.entered
+	h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelInfo, "queued", 0))
+	var once sync.Once
+	release := func() { once.Do(func() { close(bh.gate) }) }
+	t.Cleanup(func() {
+		release()
+		h.Close()
+	})
+	return h, ring, release
+}
+
+func TestAsyncHandlerBlockTimeout(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	h, _, _ := saturatedAsync(t, AsyncOptions{Policy: DropNewest, BlockTimeout: timeout, BlockLevel: LevelWarn})
+	ctx := context.Background()
+
+	// Below BlockLevel, the record is dropped at once.
+	start := time.Now()
+	h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelInfo, "info", 0))
+	if d := time.Since(start); d >= timeout {
+		t.Errorf("Info blocked for %v", d)
+	}
+	// At BlockLevel, Handle waits for the timeout, then drops it.
+	start = time.Now()
+	h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelWarn, "warn", 0))
+	if d := time.Since(start); d < timeout || d > 20*timeout {
+		t.Errorf("Warn blocked for %v, want about %v", d, timeout)
+	}
+	if n := h.Dropped(); n != 2 {
+		t.Errorf("Dropped() = %d, want 2", n)
+	}
+}
+
+func TestAsyncHandlerBlockTimeoutRoom(t *testing.T) {
+	h, ring, release := saturatedAsync(t, AsyncOptions{Policy: DropNewest, BlockTimeout: time.Minute, BlockLevel: LevelError})
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	go func() {
+		h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelError, "error", 0))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Error not blocked by a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	// Room in the queue ends the wait, and the record gets through.
+	release()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Error still blocked after the queue was drained")
+	}
+	if err := h.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := messages(ring), []string{"INFO held", "INFO queued", "ERROR error"}; !slices.Equal(got, want) {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+	if n := h.Dropped(); n != 0 {
+		t.Errorf("Dropped() = %d, want 0", n)
+	}
+}
+
+func TestAsyncHandlerBlockTimeoutContext(t *testing.T) {
+	h, _, _ := saturatedAsync(t, AsyncOptions{Policy: DropNewest, BlockTimeout: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelInfo, "info", 0))
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Handle blocked for %v after the context was done", d)
+	}
+	if n := h.Dropped(); n != 1 {
+		t.Errorf("Dropped() = %d, want 1", n)
+	}
+}
+
+func TestPressure(t *testing.T) {
+	l, _ := newRingLogger(&Options{})
+	if p := l.Pressure(); p != 0 {
+		t.Errorf("synchronous pipeline: Pressure() = %v, want 0", p)
+	}
+
+	ring := NewRingHandler(10)
+	bh := &blockingHandler{Handler: ring, entered: make(chan struct{}, 1), gate: make(chan struct{})}
+	h := NewAsyncHandlerWithOptions(bh, AsyncOptions{QueueSize: 4})
+	defer h.Close()
+	l = New(&Options{Writer: io.Discard, NewHandler: func(io.Writer, *slog.HandlerOptions) slog.Handler { return h }})
+	l.Info("held")
+	<-bh.entered
+	l.Info("a")
+	l.Info("b")
+	if p := l.Pressure(); p != 0.5 {
+		t.Errorf("half full: Pressure() = %v, want 0.5", p)
+	}
+	close(bh.gate)
+	h.Flush(context.Background())
+	if p := l.Pressure(); p != 0 {
+		t.Errorf("drained: Pressure() = %v, want 0", p)
+	}
+}
+
+// The records Handle accepts while Close runs are all handled: none is
+// left in the queue after the worker stopped.
+func TestAsyncHandlerCloseRace(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		handled, accepted := new(atomic.Int64), new(atomic.Int64)
+		h := NewAsyncHandlerWithOptions(&failingHandler{Handler: DiscardHandler, handled: handled},
+			AsyncOptions{QueueSize: 8, Policy: BlockWhenFull})
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					if h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelInfo, "m", 0)) == nil {
+						accepted.Add(1)
+					}
+				}
+			}()
+		}
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+		wg.Wait()
+		if handled.Load() != accepted.Load() {
+			t.Fatalf("%d records accepted, %d handled", accepted.Load(), handled.Load())
+		}
+	}
+}
+
+// LogHealth reports the time of the last error from Clock.
+func TestAsyncHandlerLastErrorTime(t *testing.T) {
+	clock := newFakeClock()
+	h := NewAsyncHandlerWithOptions(&failingHandler{Handler: DiscardHandler, handled: new(atomic.Int64), err: errors.New("disk full")},
+		AsyncOptions{Clock: clock.now})
+	defer h.Close()
+	ctx := context.Background()
+	h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelInfo, "m", 0))
+	h.Flush(ctx)
+	health := h.LogHealth()
+	if health.LastError == nil || !health.LastErrorTime.Equal(clock.now()) {
+		t.Errorf("LogHealth() = %v at %v, want the error at %v", health.LastError, health.LastErrorTime, clock.now())
+	}
+}
+
+// A record handled after an error clears it, keeping its time.
+func TestAsyncHandlerErrorCleared(t *testing.T) {
+	clock := newFakeClock()
+	fh := &flakyHandler{Handler: DiscardHandler, fail: true}
+	h := NewAsyncHandlerWithOptions(fh, AsyncOptions{Clock: clock.now})
+	defer h.Close()
+	ctx := context.Background()
+	h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelInfo, "lost", 0))
+	h.Flush(ctx)
+	if health := h.LogHealth(); health.Healthy || health.LastError == nil {
+		t.Fatalf("after the error: %+v", health)
+	}
+	fh.fail = false
+	h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelInfo, "written", 0))
+	h.Flush(ctx)
+	health := h.LogHealth()
+	if !health.Healthy || health.LastError != nil || !health.LastErrorTime.Equal(clock.now()) {
+		t.Errorf("after a success: %+v", health)
+	}
+}
@@ -1,7 +1,12 @@
 package log
 
 import (
+	"fmt"
 	"log/slog"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -67,38 +72,246 @@ func Any(key string, value any) Attr {
 	return slog.Any(key, value)
 }
 
+// Err returns an Attr for an error, under ErrorKey.
+func Err(err error) Attr {
+	return slog.Any(ErrorKey, err)
+}
+
+// namespace is the value of the marker returned by Namespace.
+type namespace struct{}
+
+// Namespace returns a marker that nests all the attributes following it
+// in the same call under a group with the given name, as if they were
+// wrapped by [Group]:
+//
+//	logger.Info("request done", log.Namespace("http"), log.Int("status", 200))
+//
+// is equivalent to
+//
+//	logger.Info("request done", log.Group("http", log.Int("status", 200)))
+//
+// A later Namespace marker switches to a new group; an empty name returns
+// to the top level. A marker with no attributes after it has no effect.
+func Namespace(name string) Attr {
+	return Attr{Key: name, Value: slog.AnyValue(namespace{})}
+}
+
+func isNamespace(a Attr) bool {
+	if a.Value.Kind() != slog.KindAny {
+		return false
+	}
+	_, ok := a.Value.Any().(namespace)
+	return ok
+}
+
+// applyNamespaces wraps the attributes following each Namespace marker
+// into a group named after it, dropping the markers themselves.
+func applyNamespaces(attrs []Attr) []Attr {
+	if !slices.ContainsFunc(attrs, isNamespace) {
+		return attrs
+	}
+	var (
+		res     = make([]Attr, 0, len(attrs))
+		name    string
+		grouped []any
+	)
+	closeGroup := func() {
+		if len(grouped) > 0 {
+			res = append(res, Group(name, grouped...))
+		}
+		grouped = nil
+	}
+	for _, a := range attrs {
+		switch {
+		case isNamespace(a):
+			closeGroup()
+			name = a.Key
+		case name == "":
+			res = append(res, a)
+		default:
+			grouped = append(grouped, a)
+		}
+	}
+	closeGroup()
+	return res
+}
+
 const badKey = "!BADKEY"
 
-// argsToAttr turns a prefix of the nonempty args slice into an Attr
-// and returns the unconsumed portion of the slice.
-// If args[0] is an Attr, it returns it.
-// If args[0] is a string, it treats the first two elements as
-// a key-value pair.
-// Otherwise, it treats args[0] as a value with a missing key.
-func argsToAttr(args []any) (Attr, []any) {
-	switch x := args[0].(type) {
+// messageAndAttrs turns the msg and args of a logging call into the
+// message and attributes of its record, following the rules documented
+// on [Logger.Log]. The args are converted as by argsToAttrSlice, once
+// the format operands of a string msg are taken out, so that With and
+// the logging methods treat the same args the same way.
+func messageAndAttrs(msg any, args []any) (string, []Attr) {
+	switch m := msg.(type) {
+	case Attr:
+		return attrMessage(m), append([]Attr{m}, argsToAttrSlice(args)...)
+	case literal:
+		return string(m), argsToAttrSlice(args)
 	case string:
-		if len(args) == 1 {
-			return String(badKey, x), nil
+		n := formatOperands(m, args)
+		if n == 0 {
+			return m, argsToAttrSlice(args)
 		}
-		return Any(x, args[1]), args[2:]
+		return fmt.Sprintf(m, args[:n]...), argsToAttrSlice(args[n:])
+	default:
+		return fmt.Sprint(msg), argsToAttrSlice(args)
+	}
+}
 
-	case Attr:
-		return x, args[1:]
+// literal is a message logged as is, rather than taken as a format, such
+// as the one given to Span.
+type literal string
 
+// attrMessage returns the message of a record whose msg argument is a.
+// It is the resolved value of a, or its key if a is a group.
+func attrMessage(a Attr) string {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		return a.Key
+	}
+	return v.String()
+}
+
+// formatOperands returns the number of leading args the format string
+// consumes. They are those its verbs, and '*' widths or precisions,
+// take, as fmt.Sprintf counts them, explicit argument indexes included,
+// up to the first that is an Attr or doesn't suit its verb. So a '%'
+// that isn't meant as a verb, as in "disk 100% full", takes neither the
+// Attrs nor the keys of the key-value pairs that follow.
+func formatOperands(format string, args []any) int {
+	verbs := formatVerbs(format)
+	n := 0
+	for ; n < len(verbs) && n < len(args); n++ {
+		if _, ok := args[n].(Attr); ok || !verbAccepts(verbs[n], args[n]) {
+			break
+		}
+	}
+	return n
+}
+
+// formatVerbs returns the verb of each operand of the format string, '*'
+// for a width or precision, in the order of the operands.
+func formatVerbs(format string) []byte {
+	var verbs []byte
+	argNum := 0
+	set := func(verb byte) {
+		for len(verbs) <= argNum {
+			verbs = append(verbs, 'v')
+		}
+		verbs[argNum] = verb
+		argNum++
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+	directive:
+		for ; i < len(format); i++ {
+			switch c := format[i]; {
+			case strings.IndexByte("+-# 0.", c) >= 0 || '1' <= c && c <= '9':
+			case c == '*':
+				set('*')
+			case c == '[':
+				j := strings.IndexByte(format[i:], ']')
+				if j < 0 {
+					return verbs
+				}
+				if idx, err := strconv.Atoi(format[i+1 : i+j]); err == nil && idx > 0 {
+					argNum = idx - 1
+				}
+				i += j
+			default:
+				break directive
+			}
+		}
+		if i < len(format) && format[i] != '%' {
+			set(format[i])
+		}
+	}
+	return verbs
+}
+
+// verbAccepts reports whether fmt formats arg with verb, rather than
+// writing a "%!verb(...)" error in its place. Values other than the
+// booleans, numbers and strings, such as slices, are taken as suiting any
+// verb.
+func verbAccepts(verb byte, arg any) bool {
+	switch arg.(type) {
+	case fmt.Formatter:
+		return true
+	case error, fmt.Stringer:
+		if strings.IndexByte("vsqxX", verb) >= 0 {
+			return true
+		}
+	}
+	if verb == 'v' || verb == 'T' {
+		return true
+	}
+	if arg == nil {
+		return false
+	}
+	switch v := reflect.ValueOf(arg); v.Kind() {
+	case reflect.Bool:
+		return verb == 't'
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strings.IndexByte("bcdoOqxXU*", verb) >= 0
+	case reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return strings.IndexByte("beEfFgGxX", verb) >= 0
+	case reflect.String:
+		return strings.IndexByte("sqxX", verb) >= 0
 	default:
-		return Any(badKey, x), args[1:]
+		return verb != '*'
 	}
 }
 
+// argsToAttrSlice turns the args of a logging call into attributes.
+// An Attr is taken as is, a string and the element following it as a
+// key-value pair, and any other element, or a string at the end, as a
+// value with a missing key, badKey.
 func argsToAttrSlice(args []any) []Attr {
-	var (
-		attr  Attr
-		attrs []Attr
-	)
+	if len(args) == 0 {
+		return nil
+	}
+	if allAttrs(args) {
+		attrs := make([]Attr, len(args))
+		for i, arg := range args {
+			attrs[i] = arg.(Attr)
+		}
+		return applyNamespaces(attrs)
+	}
+	// Most calls pass key-value pairs; a few attrs among them only cost a grow.
+	attrs := make([]Attr, 0, (len(args)+1)/2)
 	for len(args) > 0 {
-		attr, args = argsToAttr(args)
-		attrs = append(attrs, attr)
+		switch x := args[0].(type) {
+		case string:
+			if len(args) == 1 {
+				attrs = append(attrs, String(badKey, x))
+				args = nil
+				break
+			}
+			attrs = append(attrs, Any(x, args[1]))
+			args = args[2:]
+		case Attr:
+			attrs = append(attrs, x)
+			args = args[1:]
+		default:
+			attrs = append(attrs, Any(badKey, x))
+			args = args[1:]
+		}
+	}
+	return applyNamespaces(attrs)
+}
+
+// allAttrs reports whether every element of args is an Attr.
+func allAttrs(args []any) bool {
+	for _, arg := range args {
+		if _, ok := arg.(Attr); !ok {
+			return false
+		}
 	}
-	return attrs
+	return true
 }
@@ -0,0 +1,52 @@
+package log
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// maxAttrCacheEntries bounds the number of children remembered by the
+// attrCache of a single handler. When it is full, the cache starts over.
+const maxAttrCacheEntries = 256
+
+var attrCacheHits, attrCacheMisses atomic.Uint64
+
+// AttrCacheStats reports how many calls to WithAttrs on the handlers of
+// this package returned a previously created child (hits) or created a new
+// one (misses).
+func AttrCacheStats() (hits, misses uint64) {
+	return attrCacheHits.Load(), attrCacheMisses.Load()
+}
+
+// attrCache lets a handler hand out the same child for identical calls to
+// WithAttrs. Servers deriving many long-lived loggers from one parent with
+// the same few attribute sets then hold one child handler, and one copy of
+// its preformatted attributes, per distinct set.
+//
+// Children are keyed by their preformatted bytes, which are fully
+// determined by the parent and the attributes.
+type attrCache struct {
+	mu       sync.Mutex
+	children map[string]slog.Handler
+}
+
+// intern returns the child already created for the preformatted bytes
+// key, or else remembers and returns child.
+func (c *attrCache) intern(key []byte, child slog.Handler) slog.Handler {
+	if c == nil {
+		return child
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if h, ok := c.children[string(key)]; ok {
+		attrCacheHits.Add(1)
+		return h
+	}
+	attrCacheMisses.Add(1)
+	if c.children == nil || len(c.children) >= maxAttrCacheEntries {
+		c.children = make(map[string]slog.Handler)
+	}
+	c.children[string(key)] = child
+	return child
+}
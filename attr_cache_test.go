@@ -0,0 +1,143 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// deviceAttrs returns the attributes of the n-th of a few distinct sets.
+func deviceAttrs(n int) []slog.Attr {
+	return []slog.Attr{
+		slog.String("fleet", fmt.Sprintf("fleet-%d", n)),
+		slog.Int("shard", n),
+		slog.Bool("beta", n%2 == 0),
+	}
+}
+
+func TestAttrCacheShares(t *testing.T) {
+	h := NewTextHandlerWithOptions(io.Discard, &HandlerOptions{NoColor: true})
+	a := h.WithAttrs(deviceAttrs(1))
+	if b := h.WithAttrs(deviceAttrs(1)); b != a {
+		t.Error("identical attrs got distinct children")
+	}
+	if c := h.WithAttrs(deviceAttrs(2)); c == a {
+		t.Error("distinct attrs got the same child")
+	}
+	if d := h.WithGroup("g").WithAttrs(deviceAttrs(1)); d == a {
+		t.Error("a child in a group is shared with one outside it")
+	}
+}
+
+func TestAttrCacheBounded(t *testing.T) {
+	h := NewJSONHandler(io.Discard, nil)
+	for i := 0; i < 3*maxAttrCacheEntries; i++ {
+		h.WithAttrs(deviceAttrs(i))
+	}
+	if n := len(h.children.children); n > maxAttrCacheEntries {
+		t.Errorf("the cache holds %d children, want at most %d", n, maxAttrCacheEntries)
+	}
+}
+
+func TestAttrCacheConcurrent(t *testing.T) {
+	const sets, goroutines = 20, 16
+	for _, tt := range []struct {
+		name string
+		new  func(w io.Writer) slog.Handler
+	}{
+		{"text", func(w io.Writer) slog.Handler {
+			return NewTextHandlerWithOptions(w, &HandlerOptions{NoColor: true})
+		}},
+		{"indent", func(w io.Writer) slog.Handler { return NewIndentHandler(w, nil) }},
+		{"json", func(w io.Writer) slog.Handler { return NewJSONHandler(w, nil) }},
+		{"logfmt", func(w io.Writer) slog.Handler { return NewLogfmtHandler(w, nil) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			parent := tt.new(&buf)
+			children := make([][sets]slog.Handler, goroutines)
+			var wg sync.WaitGroup
+			for g := range children {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < sets; i++ {
+						n := (i + g) % sets
+						h := parent.WithAttrs(deviceAttrs(n))
+						children[g][n] = h
+						r := slog.NewRecord(time.Time{}, slog.LevelInfo, fmt.Sprintf("device %d", n), 0)
+						h.Handle(context.Background(), r)
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			for n := 0; n < sets; n++ {
+				for g := 1; g < goroutines; g++ {
+					if children[g][n] != children[0][n] {
+						t.Fatalf("set %d: goroutines 0 and %d got distinct children", n, g)
+					}
+				}
+			}
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				// The output of IndentHandler spreads over several lines.
+				if !strings.Contains(line, "device ") {
+					continue
+				}
+				var n int
+				if _, err := fmt.Sscanf(line[strings.Index(line, "device "):], "device %d", &n); err != nil {
+					t.Fatal(err)
+				}
+				if tt.name != "indent" && !strings.Contains(line, fmt.Sprintf("fleet-%d", n)) {
+					t.Errorf("the record of device %d has the attrs of another set: %s", n, line)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAttrCacheChildren reports the memory held by 10k children
+// derived with 20 distinct sets of 10 attributes, with the children
+// shared through the cache and, for comparison, without it.
+func BenchmarkAttrCacheChildren(b *testing.B) {
+	const children, sets = 10_000, 20
+	attrs := make([][]slog.Attr, sets)
+	for i := range attrs {
+		for j := 0; j < 10; j++ {
+			attrs[i] = append(attrs[i], slog.String(fmt.Sprintf("key%d", j), fmt.Sprintf("value-%d-%d", i, j)))
+		}
+	}
+	for _, shared := range []bool{true, false} {
+		b.Run(fmt.Sprintf("shared=%t", shared), func(b *testing.B) {
+			b.ReportAllocs()
+			var heldBytes uint64
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				h := NewTextHandlerWithOptions(io.Discard, nil)
+				if !shared {
+					h.children = nil
+				}
+				held := make([]slog.Handler, children)
+				for c := range held {
+					held[c] = h.WithAttrs(attrs[c%sets])
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				runtime.KeepAlive(held)
+				if after.HeapAlloc > before.HeapAlloc {
+					heldBytes += after.HeapAlloc - before.HeapAlloc
+				}
+			}
+			b.ReportMetric(float64(heldBytes)/float64(b.N), "held-B/op")
+		})
+	}
+}
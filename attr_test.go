@@ -0,0 +1,300 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// attrsEqual reports whether got and want hold equal attributes, in the
+// same order.
+func attrsEqual(got, want []Attr) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !got[i].Equal(want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNamespace(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		args []any
+		want []Attr
+	}{
+		{
+			name: "nests the following attributes",
+			args: []any{Int("before", 1), Namespace("http"), Int("status", 200), Duration("latency", time.Second)},
+			want: []Attr{Int("before", 1), Group("http", Int("status", 200), Duration("latency", time.Second))},
+		},
+		{
+			name: "key-value pairs",
+			args: []any{"a", 1, Namespace("g"), "b", 2},
+			want: []Attr{Int("a", 1), Group("g", Int("b", 2))},
+		},
+		{
+			name: "a second marker switches groups",
+			args: []any{Namespace("req"), Int("id", 7), Namespace("resp"), Int("status", 200)},
+			want: []Attr{Group("req", Int("id", 7)), Group("resp", Int("status", 200))},
+		},
+		{
+			name: "an empty name returns to the top level",
+			args: []any{Namespace("req"), Int("id", 7), Namespace(""), Bool("ok", true)},
+			want: []Attr{Group("req", Int("id", 7)), Bool("ok", true)},
+		},
+		{
+			name: "a marker last has no effect",
+			args: []any{Int("a", 1), Namespace("g")},
+			want: []Attr{Int("a", 1)},
+		},
+		{
+			name: "consecutive markers",
+			args: []any{Namespace("a"), Namespace("b"), Int("x", 1)},
+			want: []Attr{Group("b", Int("x", 1))},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := argsToAttrSlice(tt.args); !attrsEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceThroughLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&Options{Writer: &buf, NewHandler: func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+		return NewJSONHandler(w, opts)
+	}})
+	l.Info("request done", Namespace("http"), Int("status", 200), Namespace(""), "ok", true)
+	want := `"msg":"request done","http":{"status":200},"ok":true}`
+	if got := buf.String(); !strings.Contains(got, want) {
+		t.Errorf("got %s, want it to hold %s", got, want)
+	}
+}
+
+func TestAttrMessage(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		msg       any
+		args      []any
+		wantMsg   string
+		wantAttrs []Attr
+	}{
+		{
+			name:      "string attr",
+			msg:       String("event", "user_created"),
+			wantMsg:   "user_created",
+			wantAttrs: []Attr{String("event", "user_created")},
+		},
+		{
+			name:      "attr ahead of the args",
+			msg:       String("event", "user_created"),
+			args:      []any{"id", 7},
+			wantMsg:   "user_created",
+			wantAttrs: []Attr{String("event", "user_created"), Int("id", 7)},
+		},
+		{
+			name:      "int attr",
+			msg:       Int("status", 404),
+			wantMsg:   "404",
+			wantAttrs: []Attr{Int("status", 404)},
+		},
+		{
+			name:      "group attr",
+			msg:       Group("user", "id", 7),
+			wantMsg:   "user",
+			wantAttrs: []Attr{Group("user", "id", 7)},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, attrs := messageAndAttrs(tt.msg, tt.args)
+			if msg != tt.wantMsg {
+				t.Errorf("got message %q, want %q", msg, tt.wantMsg)
+			}
+			if !attrsEqual(attrs, tt.wantAttrs) {
+				t.Errorf("got attrs %v, want %v", attrs, tt.wantAttrs)
+			}
+		})
+	}
+}
+
+func TestAttrMessageThroughLogger(t *testing.T) {
+	var buf bytes.Buffer
+	defer SetDefault(Default())
+	SetDefault(New(&Options{Writer: &buf, Deterministic: true}))
+	Info(String("event", "user_created"))
+	// The event attribute is rendered ahead of the message.
+	if got, want := buf.String(), "|  INFO | event=\"user_created\" user_created \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// recordAttrs returns the attributes of r.
+func recordAttrs(r slog.Record) []Attr {
+	var attrs []Attr
+	r.Attrs(func(a Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
+
+func TestArgsSameThroughWithAndLog(t *testing.T) {
+	err := errors.New("boom")
+	for _, tt := range []struct {
+		name string
+		args []any
+		want []Attr
+	}{
+		{"pairs", []any{"a", 1, "b", "x"}, []Attr{Int("a", 1), String("b", "x")}},
+		{"attrs", []any{Int("a", 1), Bool("ok", true)}, []Attr{Int("a", 1), Bool("ok", true)}},
+		{"attrs and pairs", []any{Int("a", 1), "b", 2}, []Attr{Int("a", 1), Int("b", 2)}},
+		{"trailing key", []any{"a", 1, "dangling"}, []Attr{Int("a", 1), String(badKey, "dangling")}},
+		{"lone key", []any{"dangling"}, []Attr{String(badKey, "dangling")}},
+		{"int", []any{42, "a", 1}, []Attr{Int(badKey, 42), Int("a", 1)}},
+		{"error", []any{"a", 1, err}, []Attr{Int("a", 1), Any(badKey, err)}},
+		{"nil", []any{nil}, []Attr{Any(badKey, nil)}},
+		{"non-string key", []any{1, 2}, []Attr{Int(badKey, 1), Int(badKey, 2)}},
+		{"key with nil value", []any{"a", nil}, []Attr{Any("a", nil)}},
+		{"group", []any{Group("req", "id", 7)}, []Attr{Group("req", Int("id", 7))}},
+		{"string value that looks like a key", []any{"a", "b", "c"}, []Attr{String("a", "b"), String(badKey, "c")}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l, ring := newRingLogger(&Options{})
+			l.Info("msg", tt.args...)
+			l.With(tt.args...).Info("msg")
+			recs := ring.Records()
+			if len(recs) != 2 {
+				t.Fatalf("got %d records, want 2", len(recs))
+			}
+			logged, with := recordAttrs(recs[0]), recordAttrs(recs[1])
+			if !attrsEqual(logged, tt.want) {
+				t.Errorf("Info: got %v, want %v", logged, tt.want)
+			}
+			if !attrsEqual(with, tt.want) {
+				t.Errorf("With: got %v, want %v", with, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgsAfterFormatOperands(t *testing.T) {
+	l, ring := newRingLogger(&Options{})
+	l.Info("copied %d files to %s", 3, "/tmp", "took", "2s", 7)
+	l.With("took", "2s", 7).Info("copied %d files to %s", 3, "/tmp")
+	want := []Attr{String("took", "2s"), Int(badKey, 7)}
+	for i, r := range ring.Records() {
+		if r.Message != "copied 3 files to /tmp" {
+			t.Errorf("record %d: message %q", i, r.Message)
+		}
+		if got := recordAttrs(r); !attrsEqual(got, want) {
+			t.Errorf("record %d: got %v, want %v", i, got, want)
+		}
+	}
+}
+
+// A '%' not meant as a verb takes neither an Attr nor a key.
+func TestFormatOperandsPercent(t *testing.T) {
+	for _, tt := range []struct {
+		msg       string
+		args      []any
+		wantMsg   string
+		wantAttrs []Attr
+	}{
+		{"disk 100% full", []any{Int("free", 0)}, "disk 100% full", []Attr{Int("free", 0)}},
+		{"progress 50% done", []any{"step", 3}, "progress 50% done", []Attr{Int("step", 3)}},
+		{"%d%% of %s", []any{50, "/var", "step", 3}, "50% of /var", []Attr{Int("step", 3)}},
+		{"retry in %*d s", []any{3, 5, "n", 1}, "retry in   5 s", []Attr{Int("n", 1)}},
+		{"took %s", []any{time.Second, "n", 1}, "took 1s", []Attr{Int("n", 1)}},
+		{"level %d", []any{LevelWarn, Bool("ok", true)}, "level 3", []Attr{Bool("ok", true)}},
+		{"%[2]d-%[1]d", []any{1, 2}, "2-1", nil},
+	} {
+		t.Run(tt.msg, func(t *testing.T) {
+			l, ring := newRingLogger(&Options{})
+			l.Info(tt.msg, tt.args...)
+			r := ring.Records()[0]
+			if r.Message != tt.wantMsg {
+				t.Errorf("got message %q, want %q", r.Message, tt.wantMsg)
+			}
+			if got := recordAttrs(r); !attrsEqual(got, tt.wantAttrs) {
+				t.Errorf("got attrs %v, want %v", got, tt.wantAttrs)
+			}
+		})
+	}
+}
+
+func TestArgsToAttrSlice(t *testing.T) {
+	err := errors.New("boom")
+	for _, tt := range []struct {
+		name string
+		args []any
+		want []Attr
+	}{
+		{"none", nil, nil},
+		{"pairs", []any{"a", 1, "b", "x"}, []Attr{Int("a", 1), String("b", "x")}},
+		{"attrs", []any{Int("a", 1), Bool("b", true)}, []Attr{Int("a", 1), Bool("b", true)}},
+		{"mixed", []any{"a", 1, Int("b", 2), "c", 3}, []Attr{Int("a", 1), Int("b", 2), Int("c", 3)}},
+		{"lone string", []any{"a", 1, "dangling"}, []Attr{Int("a", 1), String(badKey, "dangling")}},
+		{"value without key", []any{42, "a", 1}, []Attr{Int(badKey, 42), Int("a", 1)}},
+		{"error without key", []any{err}, []Attr{Any(badKey, err)}},
+		{"several without key", []any{1, 2.5, true}, []Attr{Int(badKey, 1), Float64(badKey, 2.5), Bool(badKey, true)}},
+		{"string taken as key", []any{"a", "b", "c"}, []Attr{String("a", "b"), String(badKey, "c")}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := argsToAttrSlice(tt.args); !attrsEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestArgsToAttrSliceCopies checks that the fast path for attributes
+// doesn't hand back the caller's slice.
+func TestArgsToAttrSliceCopies(t *testing.T) {
+	args := []any{Int("a", 1), Int("b", 2)}
+	got := argsToAttrSlice(args)
+	got[0] = Int("z", 26)
+	if a := args[0].(Attr); a.Key != "a" {
+		t.Errorf("args changed: %v", args)
+	}
+}
+
+func benchmarkArgs(n int, attrs bool) []any {
+	args := make([]any, 0, n)
+	for i := 0; len(args) < n; i++ {
+		key := "key" + string(rune('a'+i%26))
+		if attrs {
+			args = append(args, Int(key, i))
+		} else {
+			args = append(args, key, i)
+		}
+	}
+	return args
+}
+
+func BenchmarkArgsToAttrSlice(b *testing.B) {
+	for _, n := range []int{4, 16, 64} {
+		for _, kind := range []struct {
+			name  string
+			attrs bool
+		}{{"pairs", false}, {"attrs", true}} {
+			args := benchmarkArgs(n, kind.attrs)
+			b.Run(fmt.Sprintf("%s/%d", kind.name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					argsToAttrSlice(args)
+				}
+			})
+		}
+	}
+}
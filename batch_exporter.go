@@ -0,0 +1,285 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batchRequestTimeout bounds each attempt at sending a batch, and
+// batchCloseTimeout how long Close waits for the records queued to be
+// sent.
+const (
+	batchRequestTimeout = 30 * time.Second
+	batchCloseTimeout   = 30 * time.Second
+)
+
+// batchOptions are the options of a batchExporter, set from those of the
+// handler.
+type batchOptions struct {
+	BatchSize     int
+	QueueSize     int
+	FlushInterval time.Duration
+	MaxRetries    int // negative for none
+	MinBackoff    time.Duration
+	MaxBackoff    time.Duration
+	Block         bool
+	Drops         *Drops
+	OnError       func(err error)
+}
+
+// batchExporter is the queue and sending goroutine shared by the handlers
+// sending records in batches, such as [WebhookHandler]. Items are queued
+// by enqueue and sent by send, in batches of up to BatchSize, when a batch
+// is full or FlushInterval after its first item. A batch failing with a
+// retryable error is sent again with exponential backoff, up to MaxRetries
+// times, then dropped. Once the exporter is stopped, the batches are sent
+// only once.
+type batchExporter[T any] struct {
+	opts batchOptions
+	// send sends a batch once, and reports whether it may be sent again if
+	// it failed.
+	send func(ctx context.Context, batch []T) (retry bool, err error)
+
+	queue   chan T
+	flushes chan chan error
+	stop    chan struct{} // closed by close
+	done    chan struct{} // closed once run returns
+	ctx     context.Context
+	cancel  context.CancelFunc // aborts the batch being sent
+	closed  atomic.Bool
+	dropped atomic.Int64
+
+	// unregister, if set, is called by close, as for RegisterFlusher.
+	unregister func()
+
+	sendMu  sync.RWMutex   // held for writing while closed is set
+	senders sync.WaitGroup // calls to enqueue in progress
+
+	mu        sync.Mutex
+	lastErr   error
+	lastErrAt time.Time
+}
+
+// newBatchExporter returns a batchExporter sending with send, and starts
+// its sending goroutine.
+func newBatchExporter[T any](opts batchOptions, send func(ctx context.Context, batch []T) (bool, error)) *batchExporter[T] {
+	e := &batchExporter[T]{
+		opts:    opts,
+		send:    send,
+		queue:   make(chan T, opts.QueueSize),
+		flushes: make(chan chan error),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	go e.run()
+	return e
+}
+
+// enqueue queues item, of a record at level. When the queue is full, item
+// is dropped, or, with Block, enqueue waits for room until ctx is done. An
+// item at LevelPanic or above is queued whatever the room, and sent before
+// enqueue returns, as the process is likely to end. After close, enqueue
+// returns net.ErrClosed.
+func (e *batchExporter[T]) enqueue(ctx context.Context, level slog.Level, item T) error {
+	e.sendMu.RLock()
+	if e.closed.Load() {
+		e.sendMu.RUnlock()
+		return net.ErrClosed
+	}
+	e.senders.Add(1)
+	e.sendMu.RUnlock()
+
+	if level >= LevelPanic.Level() {
+		select {
+		case e.queue <- item:
+		case <-e.stop:
+			e.senders.Done()
+			return net.ErrClosed
+		}
+		e.senders.Done()
+		fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), crashFlushTimeout)
+		defer cancel()
+		return e.flush(fctx)
+	}
+	defer e.senders.Done()
+	if e.opts.Block {
+		select {
+		case e.queue <- item:
+			return nil
+		case <-e.stop:
+			return net.ErrClosed
+		case <-ctx.Done():
+		}
+	} else {
+		select {
+		case e.queue <- item:
+			return nil
+		default:
+		}
+	}
+	e.dropped.Add(1)
+	e.opts.Drops.Add(DropQueue, 1)
+	return nil
+}
+
+// run sends the queued items until the exporter is stopped.
+func (e *batchExporter[T]) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+	var batch []T
+	send := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := e.sendBatch(batch)
+		clear(batch)
+		batch = batch[:0]
+		return err
+	}
+	// drain moves the items queued so far into batches and sends them.
+	drain := func() error {
+		var errs []error
+		for {
+			select {
+			case item := <-e.queue:
+				batch = append(batch, item)
+				if len(batch) >= e.opts.BatchSize {
+					errs = append(errs, send())
+				}
+			default:
+				errs = append(errs, send())
+				return errors.Join(errs...)
+			}
+		}
+	}
+	for {
+		select {
+		case item := <-e.queue:
+			batch = append(batch, item)
+			if len(batch) >= e.opts.BatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case done := <-e.flushes:
+			done <- drain()
+		case <-e.stop:
+			// The items of the calls to enqueue under way are sent too.
+			e.senders.Wait()
+			drain()
+			return
+		}
+	}
+}
+
+// sendBatch sends one batch, retrying with exponential backoff until the
+// exporter is stopped, and drops it if it still fails.
+func (e *batchExporter[T]) sendBatch(batch []T) error {
+	var err error
+	backoff := e.opts.MinBackoff
+	for try := 0; ; try++ {
+		ctx, cancel := context.WithTimeout(e.ctx, batchRequestTimeout)
+		retry, sendErr := e.send(ctx, batch)
+		cancel()
+		if err = sendErr; err == nil || !retry || try >= e.opts.MaxRetries {
+			break
+		}
+		if !e.wait(backoff) {
+			break
+		}
+		backoff = min(2*backoff, e.opts.MaxBackoff)
+	}
+	e.mu.Lock()
+	if err != nil {
+		e.lastErr, e.lastErrAt = err, time.Now()
+	} else {
+		e.lastErr = nil
+	}
+	e.mu.Unlock()
+	if err != nil {
+		e.dropped.Add(int64(len(batch)))
+		e.opts.Drops.Add(DropFailed, int64(len(batch)))
+		if e.opts.OnError != nil {
+			e.opts.OnError(err)
+		}
+	}
+	return err
+}
+
+// wait waits for d, and reports false if the exporter was stopped first.
+func (e *batchExporter[T]) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-e.stop:
+		return false
+	}
+}
+
+// flush sends the items queued, waiting until they are sent or ctx is
+// done.
+func (e *batchExporter[T]) flush(ctx context.Context) error {
+	done := make(chan error, 1)
+	select {
+	case e.flushes <- done:
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close sends the items queued and stops the exporter, waiting until it
+// is done or ctx is done, when the batch being sent is abandoned. It
+// returns the error of the last batch sent.
+func (e *batchExporter[T]) close(ctx context.Context) error {
+	e.sendMu.Lock()
+	closed := e.closed.Swap(true)
+	e.sendMu.Unlock()
+	if closed {
+		return nil
+	}
+	if e.unregister != nil {
+		e.unregister()
+	}
+	close(e.stop)
+	defer e.cancel()
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lastErr
+}
+
+// health reports the state of the queue and of the last batch sent, under
+// name.
+func (e *batchExporter[T]) health(name string) ComponentHealth {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return ComponentHealth{
+		Name:          name,
+		Healthy:       !e.closed.Load() && e.lastErr == nil && len(e.queue) < cap(e.queue),
+		QueueDepth:    len(e.queue),
+		QueueCapacity: cap(e.queue),
+		LastError:     e.lastErr,
+		LastErrorTime: e.lastErrAt,
+	}
+}
@@ -0,0 +1,466 @@
+package log
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// binaryVersion is the version of the format written by BinaryHandler.
+const binaryVersion = 1
+
+// binaryMagic starts the header of a binary stream. Its first byte, a
+// record length of zero, tells it from a record.
+const binaryMagic = "\x00ZLB"
+
+// binaryMaxRecord bounds the length of a record the Decoder accepts, so
+// that a corrupt length doesn't make it allocate without bound.
+const binaryMaxRecord = 64 << 20
+
+// ErrBinaryFormat is returned by a [Decoder] reading a stream that is not
+// in the format of BinaryHandler, or in a version it doesn't know.
+var ErrBinaryFormat = errors.New("log: invalid binary log stream")
+
+// Tags of the values in the binary format.
+const (
+	binaryAny byte = iota
+	binaryBool
+	binaryDuration
+	binaryFloat64
+	binaryInt64
+	binaryString
+	binaryTime
+	binaryUint64
+	binaryGroup
+)
+
+// BinaryHandler writes records in a compact binary format, for high-rate
+// logging where text and JSON cost too much, such as tracing on embedded
+// devices. The records are read back with a [Decoder], or rendered as
+// text with [DumpBinary].
+//
+// The stream starts with a header carrying the version of the format. Each
+// record is then prefixed with its length, and holds its level, the time
+// elapsed since the previous record, its message and its attributes. The
+// keys of the attributes are written once, the following records naming
+// them by number, and the values have their type: ints, durations and
+// times are varints, floats 8 bytes, and the values of kind Any their text.
+// A stream continues with a new header, as when a process appends to the
+// file of another, from which the keys are written again.
+//
+// Since each record depends on those before it, the writer must not drop
+// any: a record written in part leaves the rest of the stream unreadable.
+type BinaryHandler struct {
+	opts   HandlerOptions
+	s      *binaryStream
+	attrs  []slog.Attr // from WithAttrs, in their groups
+	groups []string    // from WithGroup
+}
+
+// binaryStream is the state of the stream written by a BinaryHandler and
+// the handlers derived from it.
+type binaryStream struct {
+	mu      sync.Mutex
+	w       io.Writer
+	started bool           // whether the header was written
+	last    int64          // time of the previous record, in nanoseconds
+	keys    map[string]int // numbers of the keys written
+	buf     []byte
+}
+
+// NewBinaryHandler returns a BinaryHandler writing to w. Of opts, Level,
+// AddSource and ReplaceAttr are used.
+func NewBinaryHandler(w io.Writer, opts *slog.HandlerOptions) *BinaryHandler {
+	h := &BinaryHandler{opts: *handlerOptions(opts), s: &binaryStream{w: w, keys: map[string]int{}}}
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelInfo
+	}
+	return h
+}
+
+func (h *BinaryHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *BinaryHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = append(slices.Clip(h.attrs), inGroups(h.groups, attrs)...)
+	return &h2
+}
+
+func (h *BinaryHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+func (h *BinaryHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := slices.Clip(h.attrs)
+	if h.opts.AddSource && r.PC != 0 {
+		attrs = append(attrs, slog.String(slog.SourceKey, h.opts.source(r.PC)))
+	}
+	var own []slog.Attr
+	h.opts.recordAttrs(r, func(a slog.Attr) bool {
+		own = append(own, a)
+		return true
+	})
+	attrs = append(attrs, inGroups(h.groups, own)...)
+
+	s := h.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		if _, err := s.w.Write(append([]byte(binaryMagic), binaryVersion)); err != nil {
+			return err
+		}
+		s.started = true
+	}
+	// The record is encoded after room for its length, moved before it
+	// once known.
+	const room = binary.MaxVarintLen64
+	buf := append(s.buf[:0], make([]byte, room)...)
+	buf = append(buf, byte(int8(r.Level)))
+	if r.Time.IsZero() {
+		buf = append(buf, 0)
+	} else {
+		t := r.Time.UnixNano()
+		buf = append(buf, 1)
+		buf = binary.AppendVarint(buf, t-s.last)
+		s.last = t
+	}
+	buf = appendBinaryString(buf, r.Message)
+	buf = s.appendAttrs(buf, &h.opts, nil, attrs)
+	n := binary.PutUvarint(buf[:room], uint64(len(buf)-room))
+	start := room - n
+	copy(buf[start:], buf[:n])
+	s.buf = buf
+	_, err := s.w.Write(buf[start:])
+	return err
+}
+
+// appendAttrs appends the number of attrs kept and each of them, in
+// groups. It is called with mu held.
+func (s *binaryStream) appendAttrs(buf []byte, opts *HandlerOptions, groups []string, attrs []slog.Attr) []byte {
+	kept := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		if a, ok := opts.field(groups, a); ok {
+			kept = append(kept, a)
+		}
+	}
+	return s.appendFields(buf, kept)
+}
+
+// appendFields appends the number of attrs, returned by field, and each
+// of them. It is called with mu held.
+func (s *binaryStream) appendFields(buf []byte, attrs []slog.Attr) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(attrs)))
+	for _, a := range attrs {
+		buf = s.appendKey(buf, a.Key)
+		buf = s.appendValue(buf, a.Value)
+	}
+	return buf
+}
+
+// appendKey appends the number of key, preceded by key itself the first
+// time, with number zero. It is called with mu held.
+func (s *binaryStream) appendKey(buf []byte, key string) []byte {
+	if n, ok := s.keys[key]; ok {
+		return binary.AppendUvarint(buf, uint64(n))
+	}
+	s.keys[key] = len(s.keys) + 1
+	buf = append(buf, 0)
+	return appendBinaryString(buf, key)
+}
+
+// appendValue appends v, with its tag.
+func (s *binaryStream) appendValue(buf []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindBool:
+		b := byte(0)
+		if v.Bool() {
+			b = 1
+		}
+		return append(buf, binaryBool, b)
+	case slog.KindDuration:
+		return binary.AppendVarint(append(buf, binaryDuration), int64(v.Duration()))
+	case slog.KindFloat64:
+		return binary.LittleEndian.AppendUint64(append(buf, binaryFloat64), math.Float64bits(v.Float64()))
+	case slog.KindInt64:
+		return binary.AppendVarint(append(buf, binaryInt64), v.Int64())
+	case slog.KindString:
+		return appendBinaryString(append(buf, binaryString), v.String())
+	case slog.KindTime:
+		return binary.AppendVarint(append(buf, binaryTime), v.Time().UnixNano())
+	case slog.KindUint64:
+		return binary.AppendUvarint(append(buf, binaryUint64), v.Uint64())
+	case slog.KindGroup:
+		return s.appendFields(append(buf, binaryGroup), v.Group())
+	}
+	return appendBinaryString(append(buf, binaryAny), string(appendValue(nil, v)))
+}
+
+func appendBinaryString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// Decoder reads the records written by a [BinaryHandler]:
+//
+//	dec := log.NewDecoder(f)
+//	for {
+//		r, err := dec.Decode()
+//		if err != nil {
+//			break // io.EOF at the end
+//		}
+//		...
+//	}
+//
+// The values of kind Any are read back as strings, and the records have
+// no PC: their source, if written, is an attribute.
+type Decoder struct {
+	r       *bufio.Reader
+	started bool
+	last    int64
+	keys    []string
+	rec     []byte
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode returns the next record. At the end of the stream, it returns
+// io.EOF, or io.ErrUnexpectedEOF if the stream ends within a record, as
+// when the writer was stopped while writing. A stream not in the binary
+// format returns ErrBinaryFormat.
+func (d *Decoder) Decode() (slog.Record, error) {
+	for {
+		n, err := d.length()
+		if err != nil {
+			return slog.Record{}, err
+		}
+		if n == 0 {
+			if err := d.header(); err != nil {
+				return slog.Record{}, err
+			}
+			continue
+		}
+		if !d.started {
+			return slog.Record{}, ErrBinaryFormat
+		}
+		if n > binaryMaxRecord {
+			return slog.Record{}, fmt.Errorf("%w: record of %d bytes", ErrBinaryFormat, n)
+		}
+		d.rec = slices.Grow(d.rec[:0], int(n))[:n]
+		if _, err := io.ReadFull(d.r, d.rec); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return slog.Record{}, err
+		}
+		return d.record(d.rec)
+	}
+}
+
+// length reads the length of the next record, zero for a header.
+func (d *Decoder) length() (uint64, error) {
+	b, err := d.r.Peek(binary.MaxVarintLen64)
+	n, size := binary.Uvarint(b)
+	switch {
+	case size < 0:
+		return 0, fmt.Errorf("%w: record length overflows", ErrBinaryFormat)
+	case size == 0 && len(b) == 0 && err == io.EOF:
+		return 0, io.EOF
+	case size == 0 && err == io.EOF:
+		return 0, io.ErrUnexpectedEOF
+	case size == 0:
+		return 0, err
+	}
+	d.r.Discard(size)
+	return n, nil
+}
+
+// header reads the rest of a header, after its first byte, and starts a
+// new stream.
+func (d *Decoder) header() error {
+	var b [len(binaryMagic)]byte // the rest of the magic, then the version
+	if _, err := io.ReadFull(d.r, b[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if string(b[:len(b)-1]) != binaryMagic[1:] {
+		return ErrBinaryFormat
+	}
+	if version := b[len(b)-1]; version != binaryVersion {
+		return fmt.Errorf("%w: version %d", ErrBinaryFormat, version)
+	}
+	d.started, d.last, d.keys = true, 0, d.keys[:0]
+	return nil
+}
+
+// binaryReader reads the fields of a record, the first error sticking.
+type binaryReader struct {
+	b   []byte
+	err error
+}
+
+func (br *binaryReader) fail() {
+	if br.err == nil {
+		br.err = io.ErrUnexpectedEOF
+	}
+	br.b = nil
+}
+
+func (br *binaryReader) byte() byte {
+	if len(br.b) == 0 {
+		br.fail()
+		return 0
+	}
+	c := br.b[0]
+	br.b = br.b[1:]
+	return c
+}
+
+func (br *binaryReader) uvarint() uint64 {
+	v, n := binary.Uvarint(br.b)
+	if n <= 0 {
+		br.fail()
+		return 0
+	}
+	br.b = br.b[n:]
+	return v
+}
+
+func (br *binaryReader) varint() int64 {
+	v, n := binary.Varint(br.b)
+	if n <= 0 {
+		br.fail()
+		return 0
+	}
+	br.b = br.b[n:]
+	return v
+}
+
+func (br *binaryReader) string() string {
+	n := br.uvarint()
+	if n > uint64(len(br.b)) {
+		br.fail()
+		return ""
+	}
+	s := string(br.b[:n])
+	br.b = br.b[n:]
+	return s
+}
+
+// record decodes the record in b.
+func (d *Decoder) record(b []byte) (slog.Record, error) {
+	br := &binaryReader{b: b}
+	level := slog.Level(int8(br.byte()))
+	var t time.Time
+	if br.byte() == 1 {
+		d.last += br.varint()
+		t = time.Unix(0, d.last)
+	}
+	msg := br.string()
+	attrs := d.attrs(br, 0)
+	if br.err != nil {
+		return slog.Record{}, br.err
+	}
+	r := slog.NewRecord(t, level, msg, 0)
+	r.AddAttrs(attrs...)
+	return r, nil
+}
+
+// attrs decodes a number of attributes and each of them.
+func (d *Decoder) attrs(br *binaryReader, depth int) []slog.Attr {
+	n := br.uvarint()
+	if n > uint64(len(br.b)) || depth > 100 {
+		br.fail()
+		return nil
+	}
+	attrs := make([]slog.Attr, 0, n)
+	for ; n > 0 && br.err == nil; n-- {
+		var key string
+		if id := br.uvarint(); id == 0 {
+			key = br.string()
+			d.keys = append(d.keys, key)
+		} else if id <= uint64(len(d.keys)) {
+			key = d.keys[id-1]
+		} else {
+			br.err = ErrBinaryFormat
+			return nil
+		}
+		attrs = append(attrs, slog.Attr{Key: key, Value: d.value(br, depth)})
+	}
+	return attrs
+}
+
+// value decodes a value, with its tag.
+func (d *Decoder) value(br *binaryReader, depth int) slog.Value {
+	switch tag := br.byte(); tag {
+	case binaryBool:
+		return slog.BoolValue(br.byte() != 0)
+	case binaryDuration:
+		return slog.DurationValue(time.Duration(br.varint()))
+	case binaryFloat64:
+		if len(br.b) < 8 {
+			br.fail()
+			return slog.Value{}
+		}
+		f := math.Float64frombits(binary.LittleEndian.Uint64(br.b))
+		br.b = br.b[8:]
+		return slog.Float64Value(f)
+	case binaryInt64:
+		return slog.Int64Value(br.varint())
+	case binaryString, binaryAny:
+		return slog.StringValue(br.string())
+	case binaryTime:
+		return slog.TimeValue(time.Unix(0, br.varint()))
+	case binaryUint64:
+		return slog.Uint64Value(br.uvarint())
+	case binaryGroup:
+		return slog.GroupValue(d.attrs(br, depth+1)...)
+	default:
+		if br.err == nil {
+			br.err = ErrBinaryFormat
+		}
+		return slog.Value{}
+	}
+}
+
+// DumpBinary renders the records written by a BinaryHandler, read from r,
+// as a TextHandler does, to w, whatever their level. It stops at the end
+// of r, returning nil, or at the first error.
+func DumpBinary(r io.Reader, w io.Writer) error {
+	dec := NewDecoder(r)
+	h := NewTextHandler(w, &slog.HandlerOptions{Level: LevelTrace})
+	for {
+		rec, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := h.Handle(context.Background(), rec); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"testing"
+	"time"
+)
+
+type binaryValuer struct{}
+
+func (binaryValuer) LogValue() slog.Value { return slog.IntValue(42) }
+
+// binaryRecords writes records with a value of each slog.Kind, and
+// returns the stream and the attributes expected back, values of kind Any
+// as strings and LogValuers resolved.
+func binaryRecords(t testing.TB) ([]byte, [][]slog.Attr) {
+	var buf bytes.Buffer
+	h := NewBinaryHandler(&buf, &slog.HandlerOptions{Level: LevelTrace})
+	at := time.Date(2024, 6, 1, 12, 0, 0, 5, time.UTC)
+	values := []slog.Attr{
+		slog.Any("any", []int{1, 2}),
+		slog.Bool("bool", true),
+		slog.Duration("duration", -1500*time.Millisecond),
+		slog.Float64("float", math.Inf(-1)),
+		slog.Int64("int", math.MinInt64),
+		slog.String("string", "héllo\nworld"),
+		slog.Time("time", at),
+		slog.Uint64("uint", math.MaxUint64),
+		slog.Group("group", slog.Int("a", 1), slog.Group("nested", slog.String("b", "x"))),
+		slog.Any("valuer", binaryValuer{}),
+	}
+	want := [][]slog.Attr{{
+		slog.String("any", "[1 2]"),
+		values[1], values[2], values[3], values[4], values[5], values[6], values[7], values[8],
+		slog.Int("valuer", 42),
+	}}
+	r := slog.NewRecord(at, LevelTrace.Level(), "all kinds", 0)
+	r.AddAttrs(values...)
+	if err := h.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	// The keys written once are named by number after, and the time is
+	// relative to the previous record, or absent.
+	r = slog.NewRecord(at.Add(-time.Hour), LevelFatal.Level(), "again", 0)
+	r.AddAttrs(slog.Int("int", 1), slog.Bool("bool", false))
+	h.WithGroup("g").Handle(context.Background(), r)
+	want = append(want, []slog.Attr{slog.Group("g", slog.Int("int", 1), slog.Bool("bool", false))})
+	h.Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelInfo, "", 0))
+	want = append(want, nil)
+	return buf.Bytes(), want
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	stream, want := binaryRecords(t)
+	// A stream continued by another writer starts again with a header.
+	second, _ := binaryRecords(t)
+	stream = append(stream, second...)
+	want = append(want, want...)
+
+	dec := NewDecoder(bytes.NewReader(stream))
+	for i, attrs := range want {
+		r, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		var got []slog.Attr
+		r.Attrs(func(a slog.Attr) bool {
+			got = append(got, a)
+			return true
+		})
+		if len(got) != len(attrs) {
+			t.Fatalf("record %d: got %v, want %v", i, got, attrs)
+		}
+		for j, a := range got {
+			if !a.Equal(attrs[j]) || a.Value.Kind() != attrs[j].Value.Kind() {
+				t.Errorf("record %d: got %v (%s), want %v (%s)", i, a, a.Value.Kind(), attrs[j], attrs[j].Value.Kind())
+			}
+		}
+		switch i % 3 {
+		case 0:
+			if r.Level != LevelTrace.Level() || r.Message != "all kinds" || !r.Time.Equal(time.Date(2024, 6, 1, 12, 0, 0, 5, time.UTC)) {
+				t.Errorf("record %d: %v %v %q", i, r.Time, r.Level, r.Message)
+			}
+		case 1:
+			if r.Level != LevelFatal.Level() || !r.Time.Equal(time.Date(2024, 6, 1, 11, 0, 0, 5, time.UTC)) {
+				t.Errorf("record %d: %v %v", i, r.Time, r.Level)
+			}
+		case 2:
+			if !r.Time.IsZero() {
+				t.Errorf("record %d: time %v", i, r.Time)
+			}
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("at the end: %v, want io.EOF", err)
+	}
+}
+
+// ReplaceAttr sees the groups around the attributes, and a group left
+// empty is dropped.
+func TestBinaryReplaceAttr(t *testing.T) {
+	var buf bytes.Buffer
+	var seen []string
+	h := NewBinaryHandler(&buf, &slog.HandlerOptions{ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		seen = append(seen, fmt.Sprint(groups, a.Key))
+		if a.Key == "secret" {
+			return slog.Attr{}
+		}
+		return a
+	}}).WithGroup("req")
+	r := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+	r.AddAttrs(slog.Group("user", slog.String("name", "ann")), slog.Group("auth", slog.String("secret", "x")))
+	h.Handle(context.Background(), r)
+	got, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attrs []string
+	got.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a.String())
+		return true
+	})
+	if s := fmt.Sprint(attrs); s != "[req=[user=[name=ann]]]" {
+		t.Errorf("attrs %s", s)
+	}
+	if s := fmt.Sprint(seen); s != "[[req user]name [req auth]secret]" {
+		t.Errorf("ReplaceAttr saw %s", s)
+	}
+}
+
+// A stream cut within a record returns io.ErrUnexpectedEOF.
+func TestBinaryTruncated(t *testing.T) {
+	stream, want := binaryRecords(t)
+	for n := 1; n < len(stream); n++ {
+		dec := NewDecoder(bytes.NewReader(stream[:n]))
+		var err error
+		for i := 0; err == nil && i <= len(want); i++ {
+			_, err = dec.Decode()
+		}
+		if err != io.ErrUnexpectedEOF && err != io.EOF {
+			t.Errorf("%d bytes of %d: %v", n, len(stream), err)
+		}
+	}
+}
+
+func TestBinaryFormatErrors(t *testing.T) {
+	for _, in := range []string{
+		"\x05abcde",                           // no header
+		"\x00ZLX\x01",                         // bad magic
+		"\x00ZLB\x02",                         // unknown version
+		"\x00ZLB\x01\x05\x00\x00\x00\x01\x01", // key number not written
+		"\x00ZLB\x01\xff\xff\xff\xff\x0f",     // record too long
+		"\x00ZLB\x01\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\x01", // length overflows
+	} {
+		if _, err := NewDecoder(bytes.NewReader([]byte(in))).Decode(); !errors.Is(err, ErrBinaryFormat) {
+			t.Errorf("%q: %v", in, err)
+		}
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	stream, _ := binaryRecords(f)
+	f.Add(stream)
+	f.Add([]byte(binaryMagic + "\x01"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		dec := NewDecoder(bytes.NewReader(b))
+		for i := 0; i < 1000; i++ {
+			r, err := dec.Decode()
+			if err != nil {
+				if err != io.EOF && err != io.ErrUnexpectedEOF && !errors.Is(err, ErrBinaryFormat) {
+					t.Fatalf("error %v", err)
+				}
+				return
+			}
+			// What was read back renders.
+			NewTextHandler(io.Discard, nil).Handle(context.Background(), r)
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package log
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// byteBudgetMessage is the message of the summary records of a
+// ByteBudgetHandler.
+const byteBudgetMessage = "log byte budget exceeded"
+
+// ByteBudgetOptions are options for a [ByteBudgetHandler].
+type ByteBudgetOptions struct {
+	// Bytes is the number of bytes that may be written per window.
+	Bytes int64
+
+	// Window is the length of a budget window. If zero, a minute is used.
+	Window time.Duration
+
+	// BypassLevel is the level from which records are written even when
+	// the budget is spent. The zero value, which would let every record
+	// through, means that none do.
+	BypassLevel Level
+
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+
+	// Drops, if set, counts the records left out under DropBudget, for
+	// the next record that gets through. See [Drops].
+	Drops *Drops
+}
+
+// ByteBudgetHandler caps the number of bytes written by a handler per
+// time window, to keep a burst of records, such as an error logged in a
+// retry loop, from filling the disk. Once the budget of a window is spent,
+// records are still formatted, to count their bytes, but not written,
+// except those at or above BypassLevel and those logged with
+// [Logger.Always]. The first record of the next window is preceded by a
+// summary record at LevelWarn giving the number of records and bytes
+// left out.
+//
+// Records are handled one at a time.
+type ByteBudgetHandler struct {
+	h Handler
+	b *byteBudget
+}
+
+// byteBudget is the state shared by a ByteBudgetHandler and the handlers
+// derived from it. It is also the writer of the wrapped handler.
+type byteBudget struct {
+	opts ByteBudgetOptions
+	out  io.Writer
+	root Handler // wrapped handler without attributes, for summaries
+
+	mu           sync.Mutex
+	start        time.Time // start of the current window
+	written      int64     // bytes written in the current window
+	suppressing  bool      // whether Write discards what it is given
+	dropped      int64     // records left out in the current window
+	droppedBytes int64     // and their size
+}
+
+// NewByteBudgetHandler returns a ByteBudgetHandler writing to out through
+// the handler returned by newHandler, which must write to the writer it
+// is given:
+//
+//	h := log.NewByteBudgetHandler(file, func(w io.Writer) log.Handler {
+//		return log.NewTextHandler(w, nil)
+//	}, log.ByteBudgetOptions{Bytes: 10 << 20, Window: time.Minute})
+func NewByteBudgetHandler(out io.Writer, newHandler func(w io.Writer) Handler, opts ByteBudgetOptions) *ByteBudgetHandler {
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	b := &byteBudget{opts: opts, out: out}
+	b.root = newHandler(b)
+	b.start = b.now()
+	return &ByteBudgetHandler{h: b.root, b: b}
+}
+
+func (b *byteBudget) now() time.Time {
+	if b.opts.Clock != nil {
+		return b.opts.Clock()
+	}
+	return time.Now()
+}
+
+// Write is called by the wrapped handler, with b.mu held.
+func (b *byteBudget) Write(p []byte) (int, error) {
+	if b.suppressing {
+		b.droppedBytes += int64(len(p))
+		return len(p), nil
+	}
+	n, err := b.out.Write(p)
+	b.written += int64(n)
+	return n, err
+}
+
+// rollover starts a new window, first writing the summary of the
+// previous one if records were left out.
+func (b *byteBudget) rollover(ctx context.Context, now time.Time) error {
+	dropped, droppedBytes := b.dropped, b.droppedBytes
+	b.start, b.written, b.dropped, b.droppedBytes = now, 0, 0, 0
+	if dropped == 0 {
+		return nil
+	}
+	r := slog.NewRecord(now, LevelWarn.Level(), byteBudgetMessage, 0)
+	r.AddAttrs(
+		Int64("suppressed_records", dropped),
+		Int64("suppressed_bytes", droppedBytes),
+		Duration("window", b.opts.Window),
+	)
+	// The summary doesn't count against the new window.
+	err := b.root.Handle(ctx, r)
+	b.written = 0
+	return err
+}
+
+func (h *ByteBudgetHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.h.Enabled(ctx, level)
+}
+
+func (h *ByteBudgetHandler) Handle(ctx context.Context, r slog.Record) error {
+	b := h.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now := b.now(); now.Sub(b.start) >= b.opts.Window {
+		if err := b.rollover(ctx, now); err != nil {
+			return err
+		}
+	}
+	bypass := IsForced(ctx) || b.opts.BypassLevel != 0 && r.Level >= b.opts.BypassLevel.Level()
+	b.suppressing = !bypass && b.written >= b.opts.Bytes
+	if b.suppressing {
+		b.dropped++
+		b.opts.Drops.Add(DropBudget, 1)
+		b.opts.Drops.restoreFrom(r)
+	}
+	err := h.h.Handle(ctx, r)
+	b.suppressing = false
+	return err
+}
+
+func (h *ByteBudgetHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ByteBudgetHandler{h: h.h.WithAttrs(attrs), b: h.b}
+}
+
+func (h *ByteBudgetHandler) WithGroup(name string) slog.Handler {
+	return &ByteBudgetHandler{h: h.h.WithGroup(name), b: h.b}
+}
+
+// Unwrap returns the handler wrapped by h.
+func (h *ByteBudgetHandler) Unwrap() Handler {
+	return h.h
+}
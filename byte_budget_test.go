@@ -0,0 +1,134 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lineHandler writes the message of each record, then the values of its
+// attributes, on a line.
+type lineHandler struct{ w io.Writer }
+
+func (h lineHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h lineHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h lineHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h lineHandler) Handle(_ context.Context, r slog.Record) error {
+	line := r.Message
+	r.Attrs(func(a slog.Attr) bool {
+		line += " " + a.Key + "=" + a.Value.String()
+		return true
+	})
+	_, err := io.WriteString(h.w, line+"\n")
+	return err
+}
+
+// newBudget returns a ByteBudgetHandler writing lines to out, and the
+// fake clock of its windows.
+func newBudget(out io.Writer, opts ByteBudgetOptions) (*ByteBudgetHandler, *fakeClock) {
+	clock := newFakeClock()
+	opts.Clock = clock.now
+	return NewByteBudgetHandler(out, func(w io.Writer) Handler { return lineHandler{w} }, opts), clock
+}
+
+func handleMessages(h slog.Handler, level slog.Level, msgs ...string) {
+	for _, msg := range msgs {
+		h.Handle(context.Background(), slog.NewRecord(time.Time{}, level, msg, 0))
+	}
+}
+
+func lines(buf *bytes.Buffer) []string {
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func TestByteBudgetBoundary(t *testing.T) {
+	for _, tt := range []struct {
+		budget int64
+		want   []string
+	}{
+		// A record is written whole if the budget isn't spent before it.
+		{9, []string{"aaaa", "bbbb"}},
+		{10, []string{"aaaa", "bbbb"}},
+		{11, []string{"aaaa", "bbbb", "cccc"}},
+		{5, []string{"aaaa"}},
+		{4, []string{"aaaa"}},
+	} {
+		var buf bytes.Buffer
+		h, _ := newBudget(&buf, ByteBudgetOptions{Bytes: tt.budget, Window: time.Minute})
+		handleMessages(h, slog.LevelInfo, "aaaa", "bbbb", "cccc", "dddd")
+		if got := lines(&buf); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("budget %d: got %q, want %q", tt.budget, got, tt.want)
+		}
+	}
+}
+
+func TestByteBudgetRollover(t *testing.T) {
+	var buf bytes.Buffer
+	h, clock := newBudget(&buf, ByteBudgetOptions{Bytes: 10, Window: time.Minute})
+	handleMessages(h, slog.LevelInfo, "aaaa", "bbbb", "cccc", "dddddddd")
+	clock.advance(59 * time.Second)
+	handleMessages(h, slog.LevelInfo, "eeee")
+	clock.advance(time.Second)
+	handleMessages(h, slog.LevelInfo, "ffff", "gggg", "hhhh")
+	want := []string{
+		"aaaa",
+		"bbbb",
+		"log byte budget exceeded suppressed_records=3 suppressed_bytes=19 window=1m0s",
+		"ffff",
+		"gggg",
+	}
+	if got := lines(&buf); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestByteBudgetBypass(t *testing.T) {
+	var buf bytes.Buffer
+	h, _ := newBudget(&buf, ByteBudgetOptions{Bytes: 5, BypassLevel: LevelError})
+	handleMessages(h, slog.LevelInfo, "aaaa", "bbbb")
+	handleMessages(h, slog.LevelError, "eeee")
+	handleMessages(h, LevelFatal.Level(), "ffff")
+	h.Handle(withForced(context.Background()), slog.NewRecord(time.Time{}, slog.LevelInfo, "always", 0))
+	handleMessages(h, slog.LevelWarn, "wwww")
+	if got, want := lines(&buf), []string{"aaaa", "eeee", "ffff", "always"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestByteBudgetNoBypassByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	h, _ := newBudget(&buf, ByteBudgetOptions{Bytes: 5})
+	handleMessages(h, slog.LevelInfo, "aaaa")
+	handleMessages(h, LevelFatal.Level(), "ffff")
+	if got, want := lines(&buf), []string{"aaaa"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// The records left out are counted in Drops, and reported by the next
+// record of the Logger to get through, even if it comes after records
+// left out in turn.
+func TestByteBudgetDrops(t *testing.T) {
+	var buf bytes.Buffer
+	drops := new(Drops)
+	h, clock := newBudget(&buf, ByteBudgetOptions{Bytes: 5, Window: time.Minute, Drops: drops})
+	l := New(&Options{Writer: io.Discard, Drops: drops, NewHandler: func(io.Writer, *slog.HandlerOptions) slog.Handler { return h }})
+	l.Info("aaaa")
+	l.Info("bbbb")
+	l.Info("cccc")
+	l.Info("dddd") // carries dropped.budget=2, and is left out too
+	clock.advance(time.Minute)
+	l.Info("eeee")
+	got := lines(&buf)
+	if len(got) != 3 || got[0] != "aaaa" ||
+		!strings.HasPrefix(got[1], "log byte budget exceeded suppressed_records=3 ") ||
+		got[2] != "eeee dropped=[budget=3]" {
+		t.Errorf("got %q, want aaaa, the summary of 3 records, then eeee with dropped.budget=3", got)
+	}
+}
@@ -0,0 +1,100 @@
+package log
+
+import (
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CallerAction is what a [CallerRule] does to the records it matches.
+type CallerAction int
+
+const (
+	// CallerDrop discards the records.
+	CallerDrop CallerAction = iota
+	// CallerFloor discards the records below the rule's level.
+	CallerFloor
+	// CallerOverride logs the records at the rule's level instead of
+	// their own, typically to downgrade a chatty package.
+	CallerOverride
+)
+
+// CallerRule applies an action to the records logged from functions whose
+// fully qualified name starts with Prefix, such as "github.com/acme/client"
+// for a whole package tree or "github.com/acme/client.(*Conn).retry" for a
+// single method.
+type CallerRule struct {
+	Prefix string
+	Action CallerAction
+	Level  Level
+}
+
+// CallerFilter applies rules to records depending on the function that
+// logged them, as given by the record's PC. When several rules match, the
+// one with the longest prefix wins. Its rules can be replaced at any time.
+type CallerFilter struct {
+	rules atomic.Pointer[[]CallerRule]
+}
+
+// NewCallerFilter returns a CallerFilter applying the given rules.
+func NewCallerFilter(rules ...CallerRule) *CallerFilter {
+	f := new(CallerFilter)
+	f.SetRules(rules...)
+	return f
+}
+
+// SetRules replaces the rules of f.
+func (f *CallerFilter) SetRules(rules ...CallerRule) {
+	rules = append([]CallerRule(nil), rules...)
+	f.rules.Store(&rules)
+}
+
+// Rules returns a copy of the rules of f.
+func (f *CallerFilter) Rules() []CallerRule {
+	return append([]CallerRule(nil), *f.rules.Load()...)
+}
+
+// apply returns the level at which a record logged from pc at the given
+// level should be handled. It reports false if the record is dropped.
+func (f *CallerFilter) apply(pc uintptr, level slog.Level) (slog.Level, bool) {
+	if f == nil || pc == 0 {
+		return level, true
+	}
+	rules := *f.rules.Load()
+	if len(rules) == 0 {
+		return level, true
+	}
+	fn := funcName(pc)
+	var match *CallerRule
+	for i, rule := range rules {
+		if strings.HasPrefix(fn, rule.Prefix) && (match == nil || len(rule.Prefix) > len(match.Prefix)) {
+			match = &rules[i]
+		}
+	}
+	if match == nil {
+		return level, true
+	}
+	switch match.Action {
+	case CallerFloor:
+		return level, level >= match.Level.Level()
+	case CallerOverride:
+		return match.Level.Level(), true
+	default:
+		return level, false
+	}
+}
+
+// funcNames caches the function names of the PCs seen by funcName.
+var funcNames sync.Map // uintptr -> string
+
+// funcName returns the fully qualified name of the function containing pc.
+func funcName(pc uintptr) string {
+	if name, ok := funcNames.Load(pc); ok {
+		return name.(string)
+	}
+	f, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	funcNames.Store(pc, f.Function)
+	return f.Function
+}
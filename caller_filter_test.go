@@ -0,0 +1,83 @@
+package log
+
+import (
+	"context"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+// chattyClient stands for a third-party package logging too much.
+type chattyClient struct{ l Logger }
+
+func (c chattyClient) poll()  { c.l.Info("polling") }
+func (c chattyClient) retry() { c.l.Warn("retrying") }
+
+func TestCallerFilter(t *testing.T) {
+	filter := NewCallerFilter(
+		CallerRule{Prefix: "zestack.dev/log.chattyClient.", Action: CallerFloor, Level: LevelWarn},
+		CallerRule{Prefix: "zestack.dev/log.warnFromUtils", Action: CallerOverride, Level: LevelDebug},
+	)
+	l, ring := newRingLogger(&Options{Level: LevelDebug, CallerFilter: filter})
+	c := chattyClient{l}
+	c.poll()
+	c.retry()
+	warnFromUtils(l, "downgraded")
+	l.Info("kept")
+	want := []string{"WARN retrying", "DEBUG downgraded", "INFO kept"}
+	if got := messages(ring); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCallerFilterLongestPrefix(t *testing.T) {
+	filter := NewCallerFilter(
+		CallerRule{Prefix: "zestack.dev/log.chattyClient.", Action: CallerDrop},
+		CallerRule{Prefix: "zestack.dev/log.chattyClient.retry", Action: CallerOverride, Level: LevelError},
+	)
+	l, ring := newRingLogger(&Options{Level: LevelDebug, CallerFilter: filter})
+	c := chattyClient{l}
+	c.poll()
+	c.retry()
+	want := []string{"ERROR retrying"}
+	if got := messages(ring); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCallerFilterSetRules(t *testing.T) {
+	filter := NewCallerFilter(CallerRule{Prefix: "zestack.dev/log.warnFromUtils", Action: CallerDrop})
+	l, ring := newRingLogger(&Options{Level: LevelDebug, CallerFilter: filter})
+	warnFromUtils(l, "dropped")
+	filter.SetRules()
+	warnFromUtils(l, "kept")
+	// The override takes the record below the level of the logger.
+	filter.SetRules(CallerRule{Prefix: "zestack.dev/log.warnFromUtils", Action: CallerOverride, Level: LevelTrace})
+	warnFromUtils(l, "below the level")
+	want := []string{"WARN kept"}
+	if got := messages(ring); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCallerFilterHandle(t *testing.T) {
+	filter := NewCallerFilter(CallerRule{Prefix: "zestack.dev/log.chattyClient.", Action: CallerDrop})
+	l, ring := newRingLogger(&Options{Level: LevelDebug, CallerFilter: filter})
+	var pcs [1]uintptr
+	runtime.Callers(1, pcs[:])
+	ctx := context.Background()
+	l.Handle(ctx, NewRecord(time.Time{}, LevelInfo, "from the test", pcs[0]))
+	l.Handle(ctx, NewRecord(time.Time{}, LevelInfo, "from the client", chattyClient{}.pc()))
+	want := []string{"INFO from the test"}
+	if got := messages(ring); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// pc returns a PC within a method of chattyClient.
+func (chattyClient) pc() uintptr {
+	var pcs [1]uintptr
+	runtime.Callers(1, pcs[:])
+	return pcs[0]
+}
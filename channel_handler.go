@@ -0,0 +1,184 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// ChannelOptions are options for a [ChannelHandler].
+type ChannelOptions struct {
+	// Level reports the minimum level of the records sent. If nil, all
+	// records are.
+	Level slog.Leveler
+
+	// Buffer is the capacity of the channel.
+	Buffer int
+
+	// Policy is what Handle does when the channel is full. With
+	// DropOldest and no Buffer, there is no record to drop for the new
+	// one, which is dropped instead.
+	Policy DropPolicy
+
+	// Drops, if set, counts the records dropped from the full channel
+	// under DropQueue. See [Drops].
+	Drops *Drops
+}
+
+// ChannelHandler delivers records as values on a channel, for programs
+// that display or process them themselves, such as a terminal UI:
+//
+//	h, records := log.NewChannelHandler(256)
+//	go func() {
+//		for r := range records {
+//			view.Append(r.Level, r.Message)
+//		}
+//	}()
+//
+// The records sent are copies, with the attributes added with WithAttrs
+// ahead of their own, in the groups opened with WithGroup, and their
+// values resolved, so that they can be passed to another handler as they
+// are. Close closes the channel.
+type ChannelHandler struct {
+	c      *channel
+	attrs  []slog.Attr // from WithAttrs, in their groups
+	groups []string    // from WithGroup
+}
+
+// channel is the channel shared by a ChannelHandler and the handlers
+// derived from it.
+type channel struct {
+	opts    ChannelOptions
+	ch      chan slog.Record
+	dropped atomic.Int64
+
+	// Senders hold mu for reading; Close closes stop to wake those
+	// blocked on a full channel, then takes mu to close ch once they
+	// are gone.
+	mu     sync.RWMutex
+	closed bool
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewChannelHandler returns a ChannelHandler and its channel, of capacity
+// buf. The records handled when the channel is full are dropped.
+func NewChannelHandler(buf int) (*ChannelHandler, <-chan slog.Record) {
+	return NewChannelHandlerWithOptions(ChannelOptions{Buffer: buf, Policy: DropNewest})
+}
+
+// NewChannelHandlerWithOptions returns a ChannelHandler and its channel.
+func NewChannelHandlerWithOptions(opts ChannelOptions) (*ChannelHandler, <-chan slog.Record) {
+	c := &channel{
+		opts: opts,
+		ch:   make(chan slog.Record, max(opts.Buffer, 0)),
+		stop: make(chan struct{}),
+	}
+	return &ChannelHandler{c: c}, c.ch
+}
+
+func (h *ChannelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.c.opts.Level == nil || level >= h.c.opts.Level.Level()
+}
+
+// Handle sends a copy of r on the channel, unless the handler is closed,
+// in which case it returns net.ErrClosed.
+func (h *ChannelHandler) Handle(ctx context.Context, r slog.Record) error {
+	rec := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	rec.AddAttrs(h.attrs...)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, resolveAttr(a))
+		return true
+	})
+	rec.AddAttrs(inGroups(h.groups, attrs)...)
+
+	c := h.c
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	select {
+	case c.ch <- rec:
+		return nil
+	default:
+	}
+	switch {
+	case IsForced(ctx) || c.opts.Policy == BlockWhenFull:
+		select {
+		case c.ch <- rec:
+			return nil
+		case <-c.stop:
+			return net.ErrClosed
+		case <-ctx.Done():
+		}
+	case c.opts.Policy == DropOldest && cap(c.ch) > 0:
+		for {
+			select {
+			case c.ch <- rec:
+				return nil
+			default:
+			}
+			select {
+			case <-c.ch:
+				c.drop()
+			default:
+			}
+		}
+	}
+	c.drop()
+	return nil
+}
+
+// drop counts a record as dropped from the full channel.
+func (c *channel) drop() {
+	c.dropped.Add(1)
+	c.opts.Drops.Add(DropQueue, 1)
+}
+
+func (h *ChannelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	resolved := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		resolved[i] = resolveAttr(a)
+	}
+	h2 := *h
+	h2.attrs = append(slices.Clip(h.attrs), inGroups(h.groups, resolved)...)
+	return &h2
+}
+
+func (h *ChannelHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+// Dropped returns the number of records dropped from the full channel
+// since h was created.
+func (h *ChannelHandler) Dropped() int64 {
+	return h.c.dropped.Load()
+}
+
+// Close closes the channel, once the records being sent are, those
+// waiting for room giving up. It may be called more than once, and
+// concurrently with Handle.
+func (h *ChannelHandler) Close() error {
+	c := h.c
+	c.once.Do(func() {
+		close(c.stop)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.closed = true
+		close(c.ch)
+	})
+	return nil
+}
@@ -0,0 +1,134 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+// logChannelRecords logs the same records to h, with attributes and
+// groups from the Logger and the call.
+func logChannelRecords(h slog.Handler) {
+	l := slog.New(h).With("app", "shop").WithGroup("req")
+	l.Info("started", "method", "GET", slog.Group("user", "id", 7, "name", "ann"))
+	l.With("path", "/cart").Warn("slow", "took", 2*time.Second)
+	l.Error("failed", "err", errors.New("timeout"), slog.Any("lazy", lazyValue{}))
+}
+
+type lazyValue struct{}
+
+func (lazyValue) LogValue() slog.Value { return slog.StringValue("resolved") }
+
+// The records received render as those handled directly would.
+func TestChannelHandlerRender(t *testing.T) {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var want bytes.Buffer
+	logChannelRecords(NewTextHandler(&want, opts))
+
+	h, records := NewChannelHandler(16)
+	logChannelRecords(h)
+	h.Close()
+	var got bytes.Buffer
+	text := NewTextHandler(&got, opts)
+	for r := range records {
+		if err := text.Handle(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got.String() != want.String() {
+		t.Errorf("got:\n%s\nwant:\n%s", got.String(), want.String())
+	}
+}
+
+// channelMessages returns the messages of the records received so far.
+func channelMessages(records <-chan slog.Record) []string {
+	var msgs []string
+	for {
+		select {
+		case r := <-records:
+			msgs = append(msgs, r.Message)
+		default:
+			return msgs
+		}
+	}
+}
+
+func TestChannelHandlerPolicies(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		opts    ChannelOptions
+		want    []string
+		dropped int64
+	}{
+		{"DropNewest", ChannelOptions{Buffer: 2, Policy: DropNewest}, []string{"a", "b"}, 2},
+		{"DropOldest", ChannelOptions{Buffer: 2, Policy: DropOldest}, []string{"c", "d"}, 2},
+		// Without a buffer, there is no record to drop for the new one.
+		{"DropOldest unbuffered", ChannelOptions{Policy: DropOldest}, nil, 4},
+		{"DropNewest unbuffered", ChannelOptions{Policy: DropNewest}, nil, 4},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			drops := new(Drops)
+			tt.opts.Drops = drops
+			h, records := NewChannelHandlerWithOptions(tt.opts)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				l := slog.New(h)
+				for _, msg := range []string{"a", "b", "c", "d"} {
+					l.Info(msg)
+				}
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Handle doesn't return")
+			}
+			if got := channelMessages(records); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("received %q, want %q", got, tt.want)
+			}
+			if h.Dropped() != tt.dropped {
+				t.Errorf("Dropped = %d, want %d", h.Dropped(), tt.dropped)
+			}
+			if a, _ := drops.take(); a.Value.Group()[0].Value.Int64() != tt.dropped {
+				t.Errorf("drops = %v", a)
+			}
+		})
+	}
+}
+
+// A record waiting for room returns net.ErrClosed on Close, and the
+// records handled afterwards too.
+func TestChannelHandlerBlockClose(t *testing.T) {
+	h, records := NewChannelHandlerWithOptions(ChannelOptions{Buffer: 1, Policy: BlockWhenFull})
+	l := slog.New(h)
+	l.Info("queued")
+	blocked := make(chan error)
+	go func() {
+		blocked <- h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "blocked", 0))
+	}()
+	select {
+	case err := <-blocked:
+		t.Fatalf("Handle returned %v on a full channel", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	h.Close()
+	if err := <-blocked; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("blocked Handle: %v", err)
+	}
+	if err := h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "late", 0)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Handle after Close: %v", err)
+	}
+	var msgs []string
+	for r := range records {
+		msgs = append(msgs, r.Message)
+	}
+	if fmt.Sprint(msgs) != "[queued]" {
+		t.Errorf("received %q", msgs)
+	}
+	h.Close()
+}
@@ -0,0 +1,132 @@
+package log
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+)
+
+// Keys of the special fields of Google Cloud Logging.
+const (
+	cloudSourceKey = "logging.googleapis.com/sourceLocation"
+	cloudTraceKey  = "logging.googleapis.com/trace"
+)
+
+type traceKey struct{}
+
+// ContextWithTrace returns a copy of ctx carrying the trace of the
+// request being served, for handlers that record it, such as those
+// returned by [NewCloudLoggingHandler]. For Cloud Logging, trace is the
+// resource name of the trace, "projects/PROJECT_ID/traces/TRACE_ID".
+func ContextWithTrace(ctx context.Context, trace string) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// TraceFromContext returns the trace stored in ctx by [ContextWithTrace],
+// or "" if there is none.
+func TraceFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	trace, _ := ctx.Value(traceKey{}).(string)
+	return trace
+}
+
+// NewCloudLoggingHandler creates a JSONHandler writing records in the
+// structured format that Google Cloud Logging reads from the standard
+// output of Cloud Run services and GKE containers:
+//
+//	{"timestamp":"2024-06-01T12:00:00Z","severity":"INFO","message":"hello","user":"alice"}
+//
+// The levels of this package map to the Cloud Logging severities: TRACE
+// and DEBUG to DEBUG, INFO to INFO, WARN to WARNING, ERROR to ERROR,
+// PANIC to CRITICAL and FATAL to ALERT. With AddSource, the location of
+// the logging call is written as logging.googleapis.com/sourceLocation,
+// and the trace stored in the context of the record by [ContextWithTrace]
+// as logging.googleapis.com/trace. The attributes are written as by
+// NewJSONHandler, and end up in the jsonPayload of the log entry.
+// ReplaceAttr sees the built-in attributes under their usual keys.
+func NewCloudLoggingHandler(out io.Writer, opts *slog.HandlerOptions) *JSONHandler {
+	return NewCloudLoggingHandlerWithOptions(out, handlerOptions(opts))
+}
+
+// NewCloudLoggingHandlerWithOptions is like [NewCloudLoggingHandler] but
+// accepts the extended options of this package.
+func NewCloudLoggingHandlerWithOptions(out io.Writer, opts *HandlerOptions) *JSONHandler {
+	h := NewJSONHandlerWithOptions(out, opts)
+	h.layout = jsonCloud
+	return h
+}
+
+// appendCloudHeader appends the built-in attributes of r in the layout
+// of Google Cloud Logging.
+func (h *JSONHandler) appendCloudHeader(ctx context.Context, buf []byte, r slog.Record) []byte {
+	if !r.Time.IsZero() {
+		if a, ok := h.opts.builtin(slog.Time(slog.TimeKey, r.Time)); ok {
+			buf = appendJSONSep(buf)
+			buf = append(buf, `"timestamp":`...)
+			buf = appendJSONValue(buf, a.Value)
+		}
+	}
+	if a, ok := h.opts.builtin(slog.Any(slog.LevelKey, r.Level)); ok {
+		buf = appendJSONSep(buf)
+		buf = append(buf, `"severity":`...)
+		if isSlogLevel(a.Value) {
+			buf = appendJSONString(buf, cloudSeverity(a.Value.Any().(slog.Level)))
+		} else {
+			buf = appendJSONValue(buf, a.Value)
+		}
+	}
+	if ev, ok := recordEvent(r); ok {
+		buf = h.appendBuiltin(buf, ev)
+	}
+	if a, ok := h.opts.builtin(slog.String(slog.MessageKey, r.Message)); ok {
+		buf = appendJSONSep(buf)
+		buf = append(buf, `"message":`...)
+		buf = appendJSONValue(buf, a.Value)
+	}
+	if h.opts.AddSource {
+		f := h.opts.frame(r.PC)
+		src := &slog.Source{Function: f.Function, File: f.File, Line: f.Line}
+		if a, ok := h.opts.builtin(slog.Any(slog.SourceKey, src)); ok {
+			buf = append(buf, `,"`+cloudSourceKey+`":`...)
+			if src, isSource := a.Value.Any().(*slog.Source); isSource && a.Value.Kind() == slog.KindAny {
+				// The line is a string, as the int64 fields of the
+				// Cloud Logging API are in JSON.
+				buf = append(buf, `{"file":`...)
+				buf = appendJSONString(buf, src.File)
+				buf = append(buf, `,"line":`...)
+				buf = appendJSONString(buf, strconv.Itoa(src.Line))
+				buf = append(buf, `,"function":`...)
+				buf = appendJSONString(buf, src.Function)
+				buf = append(buf, '}')
+			} else {
+				buf = appendJSONValue(buf, a.Value)
+			}
+		}
+	}
+	if trace := TraceFromContext(ctx); trace != "" {
+		buf = append(buf, `,"`+cloudTraceKey+`":`...)
+		buf = appendJSONString(buf, trace)
+	}
+	return buf
+}
+
+// cloudSeverity returns the Cloud Logging severity of a level.
+func cloudSeverity(l slog.Level) string {
+	switch level := parseSlogLevel(l); {
+	case level <= LevelDebug:
+		return "DEBUG"
+	case level == LevelInfo:
+		return "INFO"
+	case level == LevelWarn:
+		return "WARNING"
+	case level == LevelError:
+		return "ERROR"
+	case level == LevelPanic:
+		return "CRITICAL"
+	default:
+		return "ALERT"
+	}
+}
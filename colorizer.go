@@ -0,0 +1,115 @@
+package log
+
+import "io"
+
+// Style is a style of the output of TextHandler and FastTextHandler,
+// rendered by a [Colorizer].
+type Style int
+
+const (
+	StyleReset   Style = iota // ends all styles
+	StyleDefault              // the message
+	StyleDim                  // separators and attributes
+	StyleDate                 // the date of the record time
+	StyleClock                // the clock of the record time
+	StyleSource               // the source location
+	StyleTrace                // the label of LevelTrace
+	StyleDebug                // the label of LevelDebug
+	StyleInfo                 // the label of LevelInfo
+	StyleWarn                 // the label of LevelWarn
+	StyleError                // the label of LevelError
+	StylePanic                // the label of LevelPanic
+	StyleFatal                // the label of LevelFatal
+	StyleKey                  // the keys of the attributes, if set apart
+	StyleValue                // the values of the attributes, if set apart
+)
+
+// levelStyle returns the style of the label of a level. Levels below
+// LevelTrace take its style, and levels above LevelFatal that of LevelPanic.
+func levelStyle(level Level) Style {
+	switch {
+	case level <= LevelTrace:
+		return StyleTrace
+	case level > LevelFatal:
+		return StylePanic
+	default:
+		return StyleTrace + Style(level-LevelTrace)
+	}
+}
+
+// Colorizer renders the styles of TextHandler and FastTextHandler as
+// terminal escape sequences. Set it as [HandlerOptions.Colorizer].
+//
+// By default, the styles are rendered by the zestack.dev/color package,
+// which also decides from the writer whether to write them. Building with
+// the nocolorpkg tag leaves that package out, BasicANSIColorizer being the
+// default instead.
+type Colorizer interface {
+	// Start returns the escape sequence starting s.
+	Start(s Style) []byte
+
+	// Wrap returns text in style s, followed by the end of the style.
+	Wrap(s Style, text string) string
+
+	// Writer returns the writer a handler writing to out writes to, which
+	// may drop or translate the escape sequences.
+	Writer(out io.Writer) io.Writer
+}
+
+// PlainColorizer is a Colorizer without styles: the output holds no
+// escape sequences.
+type PlainColorizer struct{}
+
+func (PlainColorizer) Start(Style) []byte               { return nil }
+func (PlainColorizer) Wrap(_ Style, text string) string { return text }
+func (PlainColorizer) Writer(out io.Writer) io.Writer   { return out }
+
+// BasicANSIColorizer is a Colorizer writing the SGR sequences of the
+// default styles as they are, whatever the writer.
+type BasicANSIColorizer struct{}
+
+// ansiStyles are the SGR sequences of the styles, in the colors of the
+// zestack.dev/color attributes used by default.
+var ansiStyles = [...]string{
+	StyleReset:   "\x1b[0m",
+	StyleDefault: "\x1b[97m",   // FgHiWhite
+	StyleDim:     "\x1b[90m",   // FgHiBlack
+	StyleDate:    "\x1b[35m",   // FgMagenta
+	StyleClock:   "\x1b[34m",   // FgBlue
+	StyleSource:  "\x1b[36m",   // FgCyan
+	StyleTrace:   "\x1b[96;1m", // FgHiCyan, Bold
+	StyleDebug:   "\x1b[96;1m", // FgHiCyan, Bold
+	StyleInfo:    "\x1b[92;1m", // FgHiGreen, Bold
+	StyleWarn:    "\x1b[93;1m", // FgHiYellow, Bold
+	StyleError:   "\x1b[91;1m", // FgHiRed, Bold
+	StylePanic:   "\x1b[95;1m", // FgHiMagenta, Bold
+	StyleFatal:   "\x1b[94;1m", // FgHiBlue, Bold
+}
+
+func (BasicANSIColorizer) Start(s Style) []byte {
+	if s < 0 || int(s) >= len(ansiStyles) {
+		return nil
+	}
+	return []byte(ansiStyles[s])
+}
+
+func (c BasicANSIColorizer) Wrap(s Style, text string) string {
+	start := c.Start(s)
+	if len(start) == 0 {
+		return text
+	}
+	return string(start) + text + ansiStyles[StyleReset]
+}
+
+func (BasicANSIColorizer) Writer(out io.Writer) io.Writer { return out }
+
+// colorizer returns the Colorizer of o.
+func (o *HandlerOptions) colorizer() Colorizer {
+	switch {
+	case o.Colorizer != nil:
+		return o.Colorizer
+	case o.Theme != nil:
+		return newThemeColorizer(*o.Theme)
+	}
+	return defaultColorizer
+}
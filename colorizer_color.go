@@ -0,0 +1,73 @@
+//go:build !nocolorpkg
+
+package log
+
+import (
+	"io"
+
+	"zestack.dev/color"
+)
+
+// defaultColorizer renders the styles with the zestack.dev/color package.
+var defaultColorizer Colorizer = colorPackage{}
+
+// colorPackage is the Colorizer of the zestack.dev/color package.
+type colorPackage struct{}
+
+// colorAttributes are the color attributes of the styles.
+var colorAttributes = [...][]color.Attribute{
+	StyleReset:   {color.Reset},
+	StyleDefault: {color.FgHiWhite},
+	StyleDim:     {color.FgHiBlack},
+	StyleDate:    {color.FgMagenta},
+	StyleClock:   {color.FgBlue},
+	StyleTrace:   {color.FgHiCyan, color.Bold},
+	StyleDebug:   {color.FgHiCyan, color.Bold},
+	StyleInfo:    {color.FgHiGreen, color.Bold},
+	StyleWarn:    {color.FgHiYellow, color.Bold},
+	StyleError:   {color.FgHiRed, color.Bold},
+	StylePanic:   {color.FgHiMagenta, color.Bold},
+	StyleFatal:   {color.FgHiBlue, color.Bold},
+}
+
+// colorStarts and colorStyles are the sequences and colors of the styles,
+// computed once.
+var (
+	colorStarts [len(colorAttributes)][]byte
+	colorStyles [len(colorAttributes)]*color.Color
+)
+
+func init() {
+	for s, attrs := range colorAttributes {
+		if attrs != nil {
+			colorStarts[s] = color.Bytes(attrs...)
+			colorStyles[s] = color.New(attrs...)
+		}
+	}
+}
+
+func (colorPackage) Start(s Style) []byte {
+	if s < 0 || int(s) >= len(colorStarts) {
+		return nil
+	}
+	return colorStarts[s]
+}
+
+func (colorPackage) Wrap(s Style, text string) string {
+	if s == StyleSource {
+		// The color package picks the color of a namespace from its name.
+		return color.Namespace(text).String()
+	}
+	if s < 0 || int(s) >= len(colorStyles) || colorStyles[s] == nil {
+		return text
+	}
+	return colorStyles[s].Wrap(text).String()
+}
+
+// Writer wraps out in a color.Writer, unless it is one already.
+func (colorPackage) Writer(out io.Writer) io.Writer {
+	if w, ok := out.(color.Writer); ok {
+		return w
+	}
+	return color.NewWriter(out)
+}
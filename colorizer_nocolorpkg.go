@@ -0,0 +1,7 @@
+//go:build nocolorpkg
+
+package log
+
+// defaultColorizer writes the SGR sequences of the styles as they are, the
+// zestack.dev/color package being left out of the build.
+var defaultColorizer Colorizer = BasicANSIColorizer{}
@@ -0,0 +1,138 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// styleNames are the names of the styles, for the golden files.
+var styleNames = [...]string{
+	StyleReset:   "reset",
+	StyleDefault: "default",
+	StyleDim:     "dim",
+	StyleDate:    "date",
+	StyleClock:   "clock",
+	StyleSource:  "source",
+	StyleTrace:   "trace",
+	StyleDebug:   "debug",
+	StyleInfo:    "info",
+	StyleWarn:    "warn",
+	StyleError:   "error",
+	StylePanic:   "panic",
+	StyleFatal:   "fatal",
+	StyleKey:     "key",
+	StyleValue:   "value",
+}
+
+// colorizerStyles renders each style with c, then the style of each
+// level, including those below LevelTrace and above LevelFatal.
+func colorizerStyles(c Colorizer) []byte {
+	var buf bytes.Buffer
+	for s, name := range styleNames {
+		fmt.Fprintf(&buf, "%-8s start=%q wrap=%q\n", name, c.Start(Style(s)), c.Wrap(Style(s), "text"))
+	}
+	for _, level := range []Level{LevelTrace - 1, LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError, LevelPanic, LevelFatal, LevelFatal + 1} {
+		fmt.Fprintf(&buf, "%-8s %s\n", level, styleNames[levelStyle(level)])
+	}
+	return buf.Bytes()
+}
+
+// colorizerRecords renders records of each level with the handler made by
+// newHandler, in color whatever the writer.
+func colorizerRecords(c Colorizer, newHandler func(*bytes.Buffer, *HandlerOptions) slog.Handler) []byte {
+	var buf bytes.Buffer
+	h := newHandler(&buf, &HandlerOptions{
+		HandlerOptions: slog.HandlerOptions{Level: LevelTrace.Level()},
+		Colorizer:      c,
+		ForceColor:     true,
+	})
+	t := time.Date(2024, 6, 1, 12, 34, 56, 789000000, time.UTC)
+	for _, level := range []Level{LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError, LevelPanic, LevelFatal} {
+		r := slog.NewRecord(t, level.Level(), "disk almost full", 0)
+		r.AddAttrs(slog.String("mount", "/var"), slog.Int("free_mb", 512))
+		h.Handle(context.Background(), r)
+	}
+	return buf.Bytes()
+}
+
+func newTextColorizerHandler(buf *bytes.Buffer, opts *HandlerOptions) slog.Handler {
+	return NewTextHandlerWithOptions(buf, opts)
+}
+
+func newFastTextColorizerHandler(buf *bytes.Buffer, opts *HandlerOptions) slog.Handler {
+	return NewFastTextHandlerWithOptions(buf, opts)
+}
+
+func TestColorizerGolden(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		c    Colorizer
+	}{
+		{"basic_ansi", BasicANSIColorizer{}},
+		{"plain", PlainColorizer{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			checkGolden(t, "colorizer_"+tt.name+"_styles.golden", colorizerStyles(tt.c))
+			checkGolden(t, "colorizer_"+tt.name+"_text.golden", colorizerRecords(tt.c, newTextColorizerHandler))
+			checkGolden(t, "colorizer_"+tt.name+"_fast_text.golden", colorizerRecords(tt.c, newFastTextColorizerHandler))
+		})
+	}
+}
+
+// PlainColorizer leaves no escape sequence in the output, even in color.
+func TestPlainColorizer(t *testing.T) {
+	for _, newHandler := range []func(*bytes.Buffer, *HandlerOptions) slog.Handler{newTextColorizerHandler, newFastTextColorizerHandler} {
+		if out := colorizerRecords(PlainColorizer{}, newHandler); bytes.IndexByte(out, 0x1b) >= 0 {
+			t.Errorf("escape sequence in %q", out)
+		}
+	}
+}
+
+// keyColorizer sets the keys of the attributes apart.
+type keyColorizer struct{ BasicANSIColorizer }
+
+func (c keyColorizer) Start(s Style) []byte {
+	if s == StyleKey {
+		return []byte("\x1b[4m")
+	}
+	return c.BasicANSIColorizer.Start(s)
+}
+
+// ttyWriter is a buffer taken for a terminal while tty is set.
+type ttyWriter struct {
+	bytes.Buffer
+	tty bool
+}
+
+func (w *ttyWriter) terminal() bool { return w.tty }
+
+// Without colors, TextHandler writes no escape sequence but those of the
+// message, the attributes preformatted in color included, and the other
+// way around.
+func TestTextHandlerPalette(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	out := &ttyWriter{tty: true}
+	h := NewTextHandlerWithOptions(out, &HandlerOptions{Colorizer: keyColorizer{}})
+	colored := h.WithAttrs([]slog.Attr{slog.String("app", "shop")})
+	out.tty = false
+	plain := colored.WithAttrs([]slog.Attr{slog.String("user", "\x1b[1mann")})
+	r := slog.NewRecord(time.Time{}, slog.LevelInfo, "\x1b[31mred\x1b[0m", 0)
+	colored.Handle(context.Background(), r)
+	plain.Handle(context.Background(), r)
+	want := "|  INFO | \x1b[31mred\x1b[0m app=\"shop\" \n" +
+		"|  INFO | \x1b[31mred\x1b[0m app=\"shop\" user=\"\\x1b[1mann\" \n"
+	if got := out.String(); got != want {
+		t.Errorf("without colors:\ngot  %q\nwant %q", got, want)
+	}
+	out.Reset()
+	out.tty = true
+	plain.Handle(context.Background(), r)
+	if got := out.String(); !strings.Contains(got, "\x1b[4mapp") || !strings.Contains(got, "\x1b[4muser") {
+		t.Errorf("in color: %q", got)
+	}
+}
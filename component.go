@@ -0,0 +1,142 @@
+package log
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+)
+
+// ComponentKey is the key of the attribute naming the component of the
+// Loggers returned by [Logger.Component].
+const ComponentKey = "component"
+
+// scopeOp is a call to With, if attrs is set, or else to WithGroup.
+type scopeOp struct {
+	group string
+	attrs []slog.Attr
+}
+
+// componentConfig is the configuration of a component, set by the
+// ComponentOptions.
+type componentConfig struct {
+	level  *Level
+	attrs  []any
+	output io.Writer
+}
+
+// ComponentOption configures a component created by [Logger.Component].
+type ComponentOption func(c *componentConfig)
+
+// ComponentLevel sets the level of the component, instead of the level
+// of its parent at the time of the call.
+func ComponentLevel(level Level) ComponentOption {
+	return func(c *componentConfig) { c.level = &level }
+}
+
+// ComponentAttrs adds attributes to all the records of the component, as
+// if by [Logger.With].
+func ComponentAttrs(args ...any) ComponentOption {
+	return func(c *componentConfig) { c.attrs = append(c.attrs, args...) }
+}
+
+// ComponentOutput makes the component write to w, instead of the output
+// of its parent.
+func ComponentOutput(w io.Writer) ComponentOption {
+	return func(c *componentConfig) { c.output = w }
+}
+
+// Component returns a child of l for the subsystem name: its records
+// carry a ComponentKey attribute with name and the attributes given with
+// ComponentAttrs, it has a level of its own, and it is registered under
+// name with [RegisterComponent], so that [TempComponentLevel] applies to
+// it. Its handler is created the way New created the handler of l, with
+// the attributes and groups of l, its ComponentKey attribute ahead of
+// them.
+//
+// Changing the level of the component, or of l, doesn't affect the other.
+// Unless ComponentOutput is given, the component shares the output of l,
+// and SetOutput on either changes both.
+//
+// If the handler of l was set with SetHandler, it is kept: the handler of
+// the component is derived from it with WithAttrs, so that its attributes
+// belong to the groups of l, and filters the records below the level of
+// the component. ComponentOutput has then no effect.
+func (l *logger) Component(name string, opts ...ComponentOption) Logger {
+	var cfg componentConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	args := append([]any{String(ComponentKey, name)}, cfg.attrs...)
+	attrs := expandDetails(context.Background(), l.Handler(), argsToAttrSlice(args))
+
+	c := l.clone(l.Handler())
+	c.level = new(atomic.Int32)
+	c.slogLevel = nil
+	if cfg.level != nil {
+		c.SetLevel(*cfg.level)
+	} else {
+		c.SetLevel(l.Level())
+	}
+	if cfg.output != nil && !c.custom.Load() {
+		c.out = new(atomic.Pointer[io.Writer])
+		c.out.Store(&cfg.output)
+	}
+	// The attributes of the component come first, outside of the groups
+	// of l.
+	c.scope = append([]scopeOp{{attrs: attrs}}, l.scope...)
+	if c.custom.Load() {
+		c.setHandler(&componentHandler{next: l.Handler().WithAttrs(attrs), level: &leveler{c}})
+		RegisterComponent(name, c)
+		return c
+	}
+	var w io.Writer = &writer{l: c}
+	if c.fixedOutput {
+		w = c.Output()
+	}
+	h := c.build(w, &leveler{c})
+	for _, op := range c.scope {
+		if op.attrs != nil {
+			h = h.WithAttrs(op.attrs)
+		} else {
+			h = h.WithGroup(op.group)
+		}
+	}
+	c.setHandler(h)
+	RegisterComponent(name, c)
+	return c
+}
+
+// componentHandler applies the level of a component to a handler set
+// with SetHandler, which doesn't follow it.
+type componentHandler struct {
+	next  slog.Handler
+	level slog.Leveler
+}
+
+func (h *componentHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.next.Enabled(ctx, level)
+}
+
+func (h *componentHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &componentHandler{next: h.next.WithAttrs(attrs), level: h.level}
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &componentHandler{next: h.next.WithGroup(name), level: h.level}
+}
+
+// Unwrap returns the handler wrapped by h.
+func (h *componentHandler) Unwrap() Handler {
+	return h.next
+}
@@ -0,0 +1,160 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// newComponentParent returns a Logger writing slog text lines to buf.
+func newComponentParent(buf *bytes.Buffer) Logger {
+	return New(&Options{Writer: buf, Level: LevelInfo, NewHandler: func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+		return slog.NewTextHandler(w, &slog.HandlerOptions{Level: opts.Level, ReplaceAttr: dropTime})
+	}})
+}
+
+func dropTime(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.TimeKey && len(groups) == 0 {
+		return slog.Attr{}
+	}
+	return a
+}
+
+func checkLines(t *testing.T, buf *bytes.Buffer, want ...string) {
+	t.Helper()
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if buf.Len() == 0 {
+		got = nil
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	buf.Reset()
+}
+
+// Reconfiguring a component affects neither its parent nor its siblings.
+func TestComponentSiblings(t *testing.T) {
+	var buf bytes.Buffer
+	parent := newComponentParent(&buf).With("app", "shop")
+	db := parent.Component("test.siblings.db", ComponentAttrs("pool", 4))
+	cache := parent.Component("test.siblings.cache")
+
+	db.SetLevel(LevelDebug)
+	parent.Debug("parent")
+	db.Debug("db")
+	cache.Debug("cache")
+	checkLines(t, &buf, `level=DEBUG msg=db component=test.siblings.db pool=4 app=shop`)
+
+	undo := TempComponentLevel("test.siblings.cache", LevelWarn)
+	cache.Info("cache")
+	db.Info("db")
+	parent.Info("parent")
+	checkLines(t, &buf,
+		`level=INFO msg=db component=test.siblings.db pool=4 app=shop`,
+		`level=INFO msg=parent app=shop`)
+	undo()
+	cache.Info("cache")
+	checkLines(t, &buf, `level=INFO msg=cache component=test.siblings.cache app=shop`)
+	if parent.Level() != LevelInfo || db.Level() != LevelDebug || cache.Level() != LevelInfo {
+		t.Errorf("levels: parent %v, db %v, cache %v", parent.Level(), db.Level(), cache.Level())
+	}
+
+	// The attributes of a component don't leak into its siblings, nor into
+	// the Loggers derived from the parent.
+	db.With("q", 1).Info("query")
+	parent.With("r", 2).Info("request")
+	checkLines(t, &buf,
+		`level=INFO msg=query component=test.siblings.db pool=4 app=shop q=1`,
+		`level=INFO msg=request app=shop r=2`)
+}
+
+// failingWriter fails once closed.
+type failingWriter struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("closed")
+	}
+	return w.Buffer.Write(p)
+}
+
+// Tearing down the output of a component, or replacing the component,
+// leaves the parent and the siblings working.
+func TestComponentTeardown(t *testing.T) {
+	var buf bytes.Buffer
+	parent := newComponentParent(&buf)
+	out := new(failingWriter)
+	jobs := parent.Component("test.teardown.jobs", ComponentOutput(out))
+	mail := parent.Component("test.teardown.mail")
+
+	jobs.Info("job")
+	out.closed = true
+	jobs.Info("lost")
+	parent.Info("parent")
+	mail.Info("mail")
+	checkLines(t, &buf,
+		`level=INFO msg=parent`,
+		`level=INFO msg=mail component=test.teardown.mail`)
+	if got := out.String(); got != "level=INFO msg=job component=test.teardown.jobs\n" {
+		t.Errorf("component output: %q", got)
+	}
+
+	// SetOutput on a component with its own output leaves the parent's.
+	var jobsOut bytes.Buffer
+	jobs.SetOutput(&jobsOut)
+	jobs.Info("job")
+	if parent.Output() != io.Writer(&buf) {
+		t.Error("SetOutput on the component changed the output of the parent")
+	}
+	if got := jobsOut.String(); got != "level=INFO msg=job component=test.teardown.jobs\n" {
+		t.Errorf("component output: %q", got)
+	}
+
+	// A component created again under the same name replaces the first in
+	// the registry, which TempComponentLevel then leaves alone.
+	jobs2 := parent.Component("test.teardown.jobs", ComponentLevel(LevelWarn))
+	undo := TempComponentLevel("test.teardown.jobs", LevelDebug)
+	defer undo()
+	if jobs.Level() != LevelInfo || jobs2.Level() != LevelDebug {
+		t.Errorf("levels: first %v, second %v", jobs.Level(), jobs2.Level())
+	}
+}
+
+// A handler set with SetHandler is kept by Component, the level of the
+// component applied on top of it.
+func TestComponentSetHandler(t *testing.T) {
+	var buf, custom bytes.Buffer
+	parent := newComponentParent(&buf)
+	parent.(interface{ SetHandler(slog.Handler) }).SetHandler(slog.NewJSONHandler(&custom, &slog.HandlerOptions{
+		Level:       slog.LevelDebug,
+		ReplaceAttr: dropTime,
+	}))
+	parent = parent.WithGroup("req")
+	db := parent.Component("test.sethandler.db", ComponentLevel(LevelWarn))
+
+	db.Info("hidden")
+	db.Warn("slow")
+	parent.Info("parent")
+	if buf.Len() != 0 {
+		t.Errorf("written to the handler built by New: %q", buf.String())
+	}
+	want := `{"level":"WARN","msg":"slow","req":{"component":"test.sethandler.db"}}` + "\n" +
+		`{"level":"INFO","msg":"parent"}` + "\n"
+	if got := custom.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	custom.Reset()
+	db.SetLevel(LevelDebug)
+	db.Debug("query")
+	want = `{"level":"DEBUG","msg":"query","req":{"component":"test.sethandler.db"}}` + "\n"
+	if got := custom.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PanicKey is the key under which [CatchCrashes] attaches the panic value.
+const PanicKey = "panic"
+
+// crashFlushTimeout bounds the time CatchCrashes, Panic and Fatal spend
+// flushing.
+const crashFlushTimeout = 2 * time.Second
+
+// Flusher is implemented by handlers and writers that hold records
+// before writing them, such as asynchronous or buffered ones.
+// Flush writes the held records, giving up when ctx is done.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+var (
+	flushMu  sync.Mutex
+	flushers = map[*flusherEntry]struct{}{}
+)
+
+type flusherEntry struct{ f Flusher }
+
+// RegisterFlusher registers f to be flushed by [CatchCrashes],
+// [Logger.Panic] and [Logger.Fatal], and returns a function that
+// unregisters it, to be called when f is closed.
+// The asynchronous and buffered components of this package register
+// themselves when they are created.
+func RegisterFlusher(f Flusher) (unregister func()) {
+	e := &flusherEntry{f}
+	flushMu.Lock()
+	flushers[e] = struct{}{}
+	flushMu.Unlock()
+	return func() {
+		flushMu.Lock()
+		delete(flushers, e)
+		flushMu.Unlock()
+	}
+}
+
+// flushAll flushes the registered flushers concurrently, giving up after
+// timeout, and returns their errors joined.
+func flushAll(timeout time.Duration) error {
+	flushMu.Lock()
+	fs := make([]Flusher, 0, len(flushers))
+	for e := range flushers {
+		fs = append(fs, e.f)
+	}
+	flushMu.Unlock()
+	if len(fs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	errs := make(chan error, len(fs))
+	for _, f := range fs {
+		go func(f Flusher) { errs <- f.Flush(ctx) }(f)
+	}
+	var all []error
+	for range fs {
+		select {
+		case err := <-errs:
+			all = append(all, err)
+		case <-ctx.Done():
+			return errors.Join(append(all, ctx.Err())...)
+		}
+	}
+	return errors.Join(all...)
+}
+
+// CatchCrashes makes sure that a panic crashing the program is logged.
+// It is meant to be deferred at the top of main, and of any goroutine
+// whose panics would crash the program:
+//
+//	func main() {
+//		defer log.CatchCrashes(log.Default())
+//		...
+//	}
+//
+// On panic, it flushes the flushers registered with RegisterFlusher, so
+// that the records in flight are not lost, logs the panic value under
+// PanicKey and the stack of the panic under StackKey at LevelFatal,
+// whatever the level of l, then panics again with the same value. Flushing
+// gives up after a short deadline so that a stuck output can't hide the
+// crash.
+//
+// CatchCrashes must be deferred directly, not called from a deferred
+// function, otherwise it can't recover the panic.
+func CatchCrashes(l Logger) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	var stack Stack
+	args := []any{Any(PanicKey, v)}
+	switch x := v.(type) {
+	case *PanicError:
+		stack = x.Stack
+		if x.Err != nil {
+			args = append(args, errorAttrs(x.Err, false)...)
+		}
+	}
+	if stack == nil {
+		stack = panicStack()
+	}
+	args = append(args, Any(StackKey, stack))
+
+	flushAll(crashFlushTimeout)
+	l.LogSlog(withForced(context.Background()), LevelFatal.Level(), "program crashed", args...)
+	flushAll(crashFlushTimeout)
+	panic(v)
+}
+
+// panicStack returns the stack of the panic being recovered by its
+// caller, starting at the function that panicked. The runtime frames
+// leading to the panic, as for a nil dereference, are left out.
+func panicStack() Stack {
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(1, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack Stack
+	found := false
+	for {
+		f, more := frames.Next()
+		if found && (stack != nil || !strings.HasPrefix(f.Function, "runtime.")) {
+			stack = append(stack, f)
+		} else if f.Function == "runtime.gopanic" {
+			found = true
+		}
+		if !more {
+			break
+		}
+	}
+	return stack
+}
@@ -0,0 +1,96 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// crashingMain is run by TestCatchCrashes in a subprocess: it logs a
+// record held by an asynchronous handler and a buffered writer, then
+// crashes.
+func crashingMain(path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	w := NewBufferedWriter(f, 0, time.Hour)
+	h := NewAsyncHandler(NewJSONHandler(w, nil), 16, DropNewest)
+	l := New(&Options{Writer: f, NewHandler: func(_ io.Writer, _ *slog.HandlerOptions) slog.Handler { return h }})
+	l.SetLevel(LevelError)
+
+	defer CatchCrashes(l)
+	l.Error("request failed", "id", 7)
+	var m map[string]int
+	m["crash"]++ // assignment to entry in nil map
+}
+
+func TestCatchCrashes(t *testing.T) {
+	if path := os.Getenv("LOG_TEST_CRASH_FILE"); path != "" {
+		crashingMain(path)
+		return
+	}
+	path := filepath.Join(t.TempDir(), "crash.log")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCatchCrashes$")
+	cmd.Env = append(os.Environ(), "LOG_TEST_CRASH_FILE="+path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+		t.Fatalf("got %v, want the exit status 2 of a panic", err)
+	}
+	if !strings.Contains(stderr.String(), "assignment to entry in nil map") {
+		t.Errorf("the program didn't panic again with the same value:\n%s", stderr.String())
+	}
+
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d records, want the record in flight and the crash:\n%s", len(lines), out)
+	}
+	if !strings.Contains(lines[0], `"msg":"request failed"`) {
+		t.Errorf("the record in flight was lost: %s", lines[0])
+	}
+	crash := lines[1]
+	for _, want := range []string{
+		`"level":"FATAL"`,
+		`"msg":"program crashed"`,
+		`"panic":"assignment to entry in nil map"`,
+		"log.crashingMain",
+	} {
+		if !strings.Contains(crash, want) {
+			t.Errorf("the crash record lacks %s: %s", want, crash)
+		}
+	}
+}
+
+func TestFlushAllTimeout(t *testing.T) {
+	stuck := flusherFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	defer RegisterFlusher(stuck)()
+	start := time.Now()
+	if err := flushAll(50 * time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("flushAll took %v", d)
+	}
+}
+
+type flusherFunc func(ctx context.Context) error
+
+func (f flusherFunc) Flush(ctx context.Context) error { return f(ctx) }
@@ -0,0 +1,87 @@
+package log
+
+import (
+	"context"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadlineSkip(t *testing.T) {
+	deadline := func(d time.Duration) context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		t.Cleanup(cancel)
+		return ctx
+	}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []string
+	}{
+		{"no context", nil, []string{"TRACE trace", "DEBUG debug", "INFO info", "WARN warn", "ERROR error"}},
+		{"no deadline", context.Background(), []string{"TRACE trace", "DEBUG debug", "INFO info", "WARN warn", "ERROR error"}},
+		{"far", deadline(time.Hour), []string{"TRACE trace", "DEBUG debug", "INFO info", "WARN warn", "ERROR error"}},
+		{"near", deadline(10 * time.Millisecond), []string{"INFO info", "WARN warn", "ERROR error"}},
+		{"expired", deadline(-time.Second), []string{"INFO info", "WARN warn", "ERROR error"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drops := new(Drops)
+			l, ring := newRingLogger(&Options{
+				Level:        LevelTrace,
+				DeadlineSkip: DeadlineSkip{Below: 50 * time.Millisecond, MaxLevel: LevelDebug},
+				Drops:        drops,
+			})
+			l.TraceContext(tt.ctx, "trace")
+			l.DebugContext(tt.ctx, "debug")
+			l.InfoContext(tt.ctx, "info")
+			l.WarnContext(tt.ctx, "warn")
+			l.ErrorContext(tt.ctx, "error")
+			if got := messages(ring); !slices.Equal(got, tt.want) {
+				t.Errorf("messages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeadlineSkipDrops(t *testing.T) {
+	drops := new(Drops)
+	l, ring := newRingLogger(&Options{
+		Level:        LevelTrace,
+		DeadlineSkip: DeadlineSkip{Below: time.Second, MaxLevel: LevelInfo},
+		Drops:        drops,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	l.DebugContext(ctx, "skipped")
+	l.InfoContext(ctx, "skipped")
+	l.InfoContext(withForced(ctx), "forced")
+	l.Info("no context")
+
+	if got, want := messages(ring), []string{"INFO forced", "INFO no context"}; !slices.Equal(got, want) {
+		t.Fatalf("messages = %q, want %q", got, want)
+	}
+	v, _ := attrValue(ring.Records()[0], DroppedKey)
+	if got, want := v.String(), "[deadline=2]"; got != want {
+		t.Errorf("%s = %s, want %s", DroppedKey, got, want)
+	}
+}
+
+func TestContextMethodsSource(t *testing.T) {
+	l, ring := newRingLogger(&Options{Level: LevelTrace, AddSource: true})
+	ctx := context.Background()
+	l.TraceContext(ctx, "trace")
+	l.DebugContext(ctx, "debug")
+	l.InfoContext(ctx, "info")
+	l.WarnContext(ctx, "warn")
+	l.ErrorContext(ctx, "error")
+	for _, r := range ring.Records() {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		if !strings.HasSuffix(frame.Function, ".TestContextMethodsSource") {
+			t.Errorf("%s: source function = %q, want the caller", r.Message, frame.Function)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// dedupMinTick is the shortest period at which a DedupHandler looks for
+// the windows that have ended.
+const dedupMinTick = time.Millisecond
+
+// RepeatedKey is the key of the attribute giving the number of records a
+// [DedupHandler] collapsed.
+const RepeatedKey = "repeated"
+
+// Repeats is the value of the RepeatedKey attribute, the number of
+// records a DedupHandler collapsed. TextHandler renders the attribute as
+// set by [Strings].Repeated, the other handlers as a number.
+type Repeats int
+
+// repeatsValue returns the Repeats held by v, if any, checking its kind
+// first so that other values cost no type assertion.
+func repeatsValue(v slog.Value) (Repeats, bool) {
+	if v.Kind() != slog.KindAny {
+		return 0, false
+	}
+	n, ok := v.Any().(Repeats)
+	return n, ok
+}
+
+// DedupOptions are options for a [DedupHandler].
+type DedupOptions struct {
+	// Window is how long after a record its repeats are collapsed. It is
+	// not extended by the repeats: a run of repeats longer than Window is
+	// summed up once per window. If zero, a second is used.
+	Window time.Duration
+
+	// CompareAttrs makes records repeats only if their attributes, those
+	// added with WithAttrs included, are also the same. By default, the
+	// level and the message are compared.
+	CompareAttrs bool
+
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+}
+
+// DedupHandler collapses the consecutive repeats of a record, such as the
+// error of a reconnect loop logged hundreds of times a second:
+//
+//	ERROR connection refused
+//	ERROR connection refused last message repeated 499 times
+//
+// The first record is passed at once; its repeats within the window are
+// suppressed, then summed up by one record at the time of the last of
+// them, carrying their number under RepeatedKey. The summary is passed
+// when a different record comes, or when the window ends, by a goroutine
+// that Close stops; a repeat after the window is passed, starting the
+// next one. Records logged with [Logger.Always] are always passed.
+//
+// A DedupHandler is registered with [RegisterFlusher] until closed.
+type DedupHandler struct {
+	next slog.Handler
+	d    *dedup
+}
+
+// dedup is the state shared by a DedupHandler and the handlers derived
+// from it.
+type dedup struct {
+	opts       DedupOptions
+	stop       chan struct{}
+	done       chan struct{}
+	unregister func()
+
+	mu      sync.Mutex
+	closed  bool
+	last    *DedupHandler // handler of the last record, nil if none
+	record  slog.Record   // last record
+	key     string        // attributes of the last record, for CompareAttrs
+	start   time.Time     // when the last record passed came
+	repeats int           // repeats suppressed since the last record passed
+}
+
+// NewDedupHandler returns a DedupHandler passing records to next, and
+// starts its goroutine.
+func NewDedupHandler(next slog.Handler, opts DedupOptions) *DedupHandler {
+	if opts.Window <= 0 {
+		opts.Window = time.Second
+	}
+	h := &DedupHandler{next: next, d: &dedup{
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}}
+	h.d.unregister = RegisterFlusher(h)
+	go h.d.run()
+	return h
+}
+
+func (h *DedupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *DedupHandler) Handle(ctx context.Context, r slog.Record) error {
+	if IsForced(ctx) {
+		return h.next.Handle(ctx, r)
+	}
+	d := h.d
+	var key string
+	if d.opts.CompareAttrs {
+		key = recordKey(r)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	if d.last != nil && !d.closed && now.Sub(d.start) < d.opts.Window && d.record.Level == r.Level &&
+		d.record.Message == r.Message && (!d.opts.CompareAttrs || d.last == h && d.key == key) {
+		d.record = r.Clone()
+		d.repeats++
+		return nil
+	}
+	err := d.flush(ctx)
+	if err2 := h.next.Handle(ctx, r); err2 != nil {
+		err = err2
+	}
+	d.last, d.record, d.key, d.start = h, r.Clone(), key, now
+	return err
+}
+
+// flush passes the summary of the repeats, if any. It is called with mu
+// held.
+func (d *dedup) flush(ctx context.Context) error {
+	if d.repeats == 0 {
+		return nil
+	}
+	r := d.record
+	r.AddAttrs(slog.Any(RepeatedKey, Repeats(d.repeats)))
+	d.repeats = 0
+	return d.last.next.Handle(ctx, r)
+}
+
+// run passes the summaries of the repeats whose window has ended, until
+// the handler is closed.
+func (d *dedup) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(max(d.opts.Window/2, dedupMinTick))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.mu.Lock()
+			if d.last != nil && d.now().Sub(d.start) >= d.opts.Window {
+				d.flush(context.Background())
+				d.last = nil
+			}
+			d.mu.Unlock()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+func (d *dedup) now() time.Time {
+	if d.opts.Clock != nil {
+		return d.opts.Clock()
+	}
+	return time.Now()
+}
+
+// Flush passes the summary of the repeats suppressed so far, if any.
+func (h *DedupHandler) Flush(ctx context.Context) error {
+	h.d.mu.Lock()
+	defer h.d.mu.Unlock()
+	return h.d.flush(ctx)
+}
+
+// Close passes the summary of the repeats suppressed so far, if any, and
+// stops the goroutine of h. Records handled afterwards are passed as they
+// are.
+func (h *DedupHandler) Close() error {
+	d := h.d
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	err := d.flush(context.Background())
+	d.mu.Unlock()
+	d.unregister()
+	close(d.stop)
+	<-d.done
+	return err
+}
+
+func (h *DedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &DedupHandler{next: h.next.WithAttrs(attrs), d: h.d}
+}
+
+func (h *DedupHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &DedupHandler{next: h.next.WithGroup(name), d: h.d}
+}
+
+// Unwrap returns the handler wrapped by h.
+func (h *DedupHandler) Unwrap() Handler {
+	return h.next
+}
+
+// recordKey returns the attributes of r as text, to compare them.
+func recordKey(r slog.Record) string {
+	var buf []byte
+	var appendAttr func(a slog.Attr)
+	appendAttr = func(a slog.Attr) {
+		buf = append(buf, a.Key...)
+		buf = append(buf, '=')
+		v := a.Value.Resolve()
+		if v.Kind() != slog.KindGroup {
+			buf = appendValue(buf, v)
+			buf = append(buf, ' ')
+			return
+		}
+		buf = append(buf, '{')
+		for _, ga := range v.Group() {
+			appendAttr(ga)
+		}
+		buf = append(buf, '}')
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(a)
+		return true
+	})
+	return string(buf)
+}
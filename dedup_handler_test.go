@@ -0,0 +1,98 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestDedupHandler(t *testing.T) {
+	clock := newFakeClock()
+	ring := NewRingHandler(100)
+	h := NewDedupHandler(ring, DedupOptions{Window: time.Minute, Clock: clock.now})
+	defer h.Close()
+	ctx := context.Background()
+	handle := func(msg string) {
+		h.Handle(ctx, slog.NewRecord(clock.now(), slog.LevelError, msg, 0))
+		clock.advance(time.Second)
+	}
+	handle("refused")
+	handle("refused")
+	handle("refused")
+	handle("timeout")
+	handle("refused")
+	h.Flush(ctx)
+	checkMessages(t, messages(ring, RepeatedKey),
+		"ERROR refused", "ERROR refused repeated=2", "ERROR timeout", "ERROR refused")
+
+	// Forced records are always passed, and don't end the run.
+	h.Handle(withForced(ctx), slog.NewRecord(clock.now(), slog.LevelError, "refused", 0))
+	handle("refused")
+	h.Flush(ctx)
+	checkMessages(t, messages(ring, RepeatedKey),
+		"ERROR refused", "ERROR refused repeated=2", "ERROR timeout", "ERROR refused",
+		"ERROR refused", "ERROR refused repeated=1")
+}
+
+// A storm of repeats longer than the window is summed up once per window,
+// the window running from the first record of each.
+func TestDedupHandlerStorm(t *testing.T) {
+	clock := newFakeClock()
+	ring := NewRingHandler(100)
+	h := NewDedupHandler(ring, DedupOptions{Window: time.Minute, Clock: clock.now})
+	ctx := context.Background()
+	for i := 0; i < 150; i++ {
+		h.Handle(ctx, slog.NewRecord(clock.now(), slog.LevelError, "refused", 0))
+		clock.advance(time.Second)
+	}
+	h.Close()
+	checkMessages(t, messages(ring, RepeatedKey),
+		"ERROR refused", "ERROR refused repeated=59",
+		"ERROR refused", "ERROR refused repeated=59",
+		"ERROR refused", "ERROR refused repeated=29")
+}
+
+// The summary is passed by the goroutine of the handler once the window
+// has ended, without another record.
+func TestDedupHandlerWindowEnd(t *testing.T) {
+	ring := NewRingHandler(100)
+	h := NewDedupHandler(ring, DedupOptions{Window: 20 * time.Millisecond})
+	defer h.Close()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		h.Handle(ctx, slog.NewRecord(time.Now(), slog.LevelError, "refused", 0))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for ring.Len() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	checkMessages(t, messages(ring, RepeatedKey), "ERROR refused", "ERROR refused repeated=2")
+}
+
+// A window too short to tick at its half doesn't stop the handler.
+func TestDedupHandlerShortWindow(t *testing.T) {
+	ring := NewRingHandler(100)
+	h := NewDedupHandler(ring, DedupOptions{Window: time.Nanosecond})
+	h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelError, "refused", 0))
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkMessages(t, messages(ring, RepeatedKey), "ERROR refused")
+}
+
+func TestDedupHandlerCompareAttrs(t *testing.T) {
+	clock := newFakeClock()
+	ring := NewRingHandler(100)
+	h := NewDedupHandler(ring, DedupOptions{CompareAttrs: true, Clock: clock.now})
+	defer h.Close()
+	ctx := context.Background()
+	for _, peer := range []string{"a", "a", "b", "b", "b"} {
+		r := slog.NewRecord(clock.now(), slog.LevelError, "refused", 0)
+		r.AddAttrs(slog.String("peer", peer))
+		h.Handle(ctx, r)
+	}
+	h.Flush(ctx)
+	checkMessages(t, messages(ring, RepeatedKey),
+		"ERROR refused", "ERROR refused repeated=1", "ERROR refused", "ERROR refused repeated=2")
+}
@@ -0,0 +1,61 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// describeMessage is the message of the record emitted by New when
+// Options.Describe is set.
+const describeMessage = "logger configured"
+
+// describe logs, past the level check, one record describing the
+// configuration of l, so that the output itself tells why some records
+// are or are not there. Its shape is stable:
+//
+//	logger configured log.level="INFO" log.handler="*log.TextHandler"
+//	log.output="/dev/stderr" log.terminal=true log.color=true
+//	log.add_source=false
+//
+// with, when the output is a RotatingFile, a log.rotation group of its
+// settings.
+func (l *logger) describe(opts *Options) {
+	out := l.Output()
+	h := l.Handler()
+	colored := false
+	if th, ok := h.(*TextHandler); ok {
+		colored = th.colored()
+	}
+	attrs := []any{
+		String("level", l.Level().String()),
+		String("handler", fmt.Sprintf("%T", h)),
+		String("output", describeWriter(out)),
+		Bool("terminal", isTerminal(out)),
+		Bool("color", colored),
+		Bool("add_source", opts.AddSource),
+	}
+	if f, ok := out.(*RotatingFile); ok {
+		attrs = append(attrs, Group("rotation",
+			Int64("max_size", f.opts.MaxSize),
+			Int("max_backups", f.opts.MaxBackups),
+			Duration("max_age", f.opts.MaxAge),
+			String("schedule", f.opts.Schedule.String()),
+			Bool("numbered", f.opts.Numbered),
+			Bool("compress", f.opts.Compress),
+		))
+	}
+	l.log(withForced(context.Background()), LevelInfo.Level(), describeMessage, []any{Group("log", attrs...)})
+}
+
+// describeWriter names w for describe.
+func describeWriter(w io.Writer) string {
+	switch f := w.(type) {
+	case *os.File:
+		return f.Name()
+	case *RotatingFile:
+		return f.name
+	}
+	return fmt.Sprintf("%T", w)
+}
@@ -0,0 +1,61 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+)
+
+// detail is the value of an attribute returned by Detail.
+type detail struct {
+	level Level
+	attrs []Attr
+}
+
+// LogValue drops the attributes when they reach a handler without going
+// through a Logger, which alone knows whether to keep them.
+func (d detail) LogValue() slog.Value {
+	return slog.GroupValue()
+}
+
+// Detail returns an attribute standing for attrs when level is enabled on
+// the Logger, and for nothing otherwise. One logging call can then give a
+// summary at Info and the full payload when Debug is on:
+//
+//	log.Info("request", "status", status, log.Detail(log.LevelDebug, log.Any("body", body)))
+//
+// The attrs are added at the place of the attribute, as if given directly.
+// Detail attributes are resolved by the Logger when the record is logged,
+// or when they are passed to With, against the level at that time; they
+// must be given at the top level, not inside a Group.
+func Detail(level Level, attrs ...Attr) Attr {
+	return Attr{Value: slog.AnyValue(detail{level: level, attrs: attrs})}
+}
+
+func isDetail(a Attr) bool {
+	if a.Value.Kind() != slog.KindLogValuer {
+		return false
+	}
+	_, ok := a.Value.LogValuer().(detail)
+	return ok
+}
+
+// expandDetails replaces the Detail attributes among attrs by their
+// contents if their level is enabled on h, and drops them otherwise.
+func expandDetails(ctx context.Context, h Handler, attrs []Attr) []Attr {
+	if !slices.ContainsFunc(attrs, isDetail) {
+		return attrs
+	}
+	res := make([]Attr, 0, len(attrs))
+	for _, a := range attrs {
+		if !isDetail(a) {
+			res = append(res, a)
+			continue
+		}
+		d := a.Value.LogValuer().(detail)
+		if h.Enabled(ctx, d.level.Level()) {
+			res = append(res, d.attrs...)
+		}
+	}
+	return res
+}
@@ -0,0 +1,75 @@
+package log
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+func TestDetail(t *testing.T) {
+	tests := []struct {
+		level Level
+		want  string
+	}{
+		{LevelInfo, "|  INFO | request status=200 \n"},
+		{LevelDebug, "|  INFO | request body=\"{\\\"id\\\":1}\" size=7 status=200 \n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			l := New(&Options{Writer: &buf, Level: tt.level, Deterministic: true})
+			l.Info("request", "status", 200, Detail(LevelDebug, String("body", `{"id":1}`), Int("size", 7)))
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetailPosition(t *testing.T) {
+	l, ring := newRingLogger(&Options{Level: LevelDebug})
+	l.Info("msg", "a", 1, Detail(LevelDebug, Int("b", 2)), "c", 3, Detail(LevelTrace, Int("d", 4)))
+	got := recordAttrs(ring.Records()[0])
+	want := []Attr{Int("a", 1), Int("b", 2), Int("c", 3)}
+	if !attrsEqual(got, want) {
+		t.Errorf("attrs = %v, want %v", got, want)
+	}
+}
+
+func TestDetailWith(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&Options{Writer: &buf, Level: LevelDebug, Deterministic: true})
+	child := l.With(Detail(LevelDebug, String("tenant", "acme")))
+	// The level is checked when With is called.
+	l.SetLevel(LevelInfo)
+	child.Info("msg")
+	if got, want := buf.String(), "|  INFO | msg tenant=\"acme\" \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	child = l.With(Detail(LevelDebug, String("tenant", "acme")))
+	child.Info("msg")
+	if got, want := buf.String(), "|  INFO | msg \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestDetailWithoutLogger checks that a Detail attribute reaching a handler
+// directly, which can't tell whether to keep it, is left out.
+func TestDetailWithoutLogger(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	slog.New(h).Info("msg", Detail(LevelDebug, Int("b", 2)))
+	if got, want := buf.String(), "|  INFO | msg \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,199 @@
+package log
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+const (
+	// maxDiffDepth caps how deep Diff descends into nested values;
+	// deeper values are compared as a whole.
+	maxDiffDepth = 5
+	// maxDiffElems caps how many slice elements Diff compares.
+	maxDiffElems = 32
+)
+
+// Change is the value of an attribute produced by [Diff] for a field
+// whose value changed. Text handlers render it as "old→new".
+type Change struct {
+	Old any
+	New any
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%v→%v", changeSide(c.Old), changeSide(c.New))
+}
+
+// missing stands for the side of a Change where a map key is absent.
+type missing struct{}
+
+func (missing) String() string { return "<none>" }
+
+func changeSide(v any) any {
+	if v == nil {
+		return "<nil>"
+	}
+	return v
+}
+
+// Diff returns a Group attribute holding only what changed between before
+// and after, one [Change] per changed field:
+//
+//	log.Info("config reloaded", log.Diff("config", oldCfg, newCfg))
+//
+// renders as config.timeout=30s→1m0s in a TextHandler.
+//
+// Structs are compared field by field and maps key by key, recursively,
+// up to a fixed depth. Fields are named after their `log` struct tag if
+// present, and skipped if the tag is "-" or the field is unexported.
+// Slices are compared as a whole, by length and their first elements.
+// Values implementing fmt.Stringer or error are compared as a whole.
+//
+// Values compared as a whole give a single Change rather than a Group.
+// If nothing changed, Diff returns the empty Attr, which handlers ignore.
+func Diff(key string, before, after any) Attr {
+	attrs := appendChanges(nil, key, diffValues(reflect.ValueOf(before), reflect.ValueOf(after), 0))
+	if len(attrs) == 0 {
+		return Attr{}
+	}
+	return attrs[0]
+}
+
+// diffValues returns the changes between two values, or a single change
+// with an empty key if they must be compared as a whole.
+func diffValues(before, after reflect.Value, depth int) []Attr {
+	before, after = indirect(before), indirect(after)
+	whole := func() []Attr {
+		if diffEqual(before, after) {
+			return nil
+		}
+		return []Attr{{Value: slog.AnyValue(Change{diffInterface(before), diffInterface(after)})}}
+	}
+	if !before.IsValid() || !after.IsValid() || before.Type() != after.Type() || depth >= maxDiffDepth || isOpaque(before.Type()) {
+		return whole()
+	}
+	switch before.Kind() {
+	case reflect.Struct:
+		var attrs []Attr
+		t := before.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			attrs = appendChanges(attrs, name, diffValues(before.Field(i), after.Field(i), depth+1))
+		}
+		return attrs
+	case reflect.Map:
+		keys := append(before.MapKeys(), after.MapKeys()...)
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+		})
+		var attrs []Attr
+		var last string
+		for i, k := range keys {
+			name := fmt.Sprint(k.Interface())
+			if i > 0 && name == last {
+				continue
+			}
+			last = name
+			ov, nv := before.MapIndex(k), after.MapIndex(k)
+			switch {
+			case !ov.IsValid():
+				attrs = append(attrs, Any(name, Change{missing{}, nv.Interface()}))
+			case !nv.IsValid():
+				attrs = append(attrs, Any(name, Change{ov.Interface(), missing{}}))
+			default:
+				attrs = appendChanges(attrs, name, diffValues(ov, nv, depth+1))
+			}
+		}
+		return attrs
+	default:
+		return whole()
+	}
+}
+
+// appendChanges appends the changes of a field or map entry, which are
+// either a single change of the whole value or a group of changes.
+func appendChanges(attrs []Attr, name string, changes []Attr) []Attr {
+	switch {
+	case len(changes) == 0:
+		return attrs
+	case len(changes) == 1 && changes[0].Key == "":
+		return append(attrs, Attr{Key: name, Value: changes[0].Value})
+	default:
+		return append(attrs, Attr{Key: name, Value: slog.GroupValue(changes...)})
+	}
+}
+
+// fieldName returns the name under which Diff reports a struct field,
+// and false if the field is skipped.
+func fieldName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	tag, _, _ := strings.Cut(f.Tag.Get("log"), ",")
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	default:
+		return tag, true
+	}
+}
+
+var (
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// isOpaque reports whether values of t are compared as a whole.
+func isOpaque(t reflect.Type) bool {
+	return t.Implements(stringerType) || t.Implements(errorType) ||
+		reflect.PointerTo(t).Implements(stringerType)
+}
+
+// indirect follows pointers and interfaces, stopping at nil.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && !v.IsNil() {
+		if v.Kind() == reflect.Pointer && isOpaque(v.Type()) {
+			break
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func diffInterface(v reflect.Value) any {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// diffEqual compares two values as a whole, slices by their length and
+// first maxDiffElems elements.
+func diffEqual(before, after reflect.Value) bool {
+	if !before.IsValid() || !after.IsValid() {
+		return before.IsValid() == after.IsValid()
+	}
+	if before.Type() != after.Type() {
+		return false
+	}
+	if before.Kind() == reflect.Slice {
+		if before.Len() != after.Len() {
+			return false
+		}
+		for i := 0; i < before.Len() && i < maxDiffElems; i++ {
+			if !reflect.DeepEqual(diffInterface(before.Index(i)), diffInterface(after.Index(i))) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(diffInterface(before), diffInterface(after))
+}
@@ -0,0 +1,150 @@
+package log
+
+import (
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// changes flattens the attribute of Diff into the changes by dotted key.
+func changes(a Attr) map[string]string {
+	m := map[string]string{}
+	var walk func(prefix string, attrs []Attr)
+	walk = func(prefix string, attrs []Attr) {
+		for _, a := range attrs {
+			if a.Value.Kind() == slog.KindGroup {
+				walk(prefix+a.Key+".", a.Value.Group())
+				continue
+			}
+			m[prefix+a.Key] = a.Value.Any().(Change).String()
+		}
+	}
+	if !a.Equal(Attr{}) {
+		walk("", []Attr{a})
+	}
+	return m
+}
+
+type diffLimits struct {
+	Rate   int
+	Burst  int
+	secret string
+}
+
+type diffConfig struct {
+	Name    string
+	Timeout time.Duration `log:"timeout"`
+	Token   string        `log:"-"`
+	Limits  diffLimits
+	Peers   []string
+	Labels  map[string]string
+	Backup  *diffLimits
+	Err     error
+}
+
+func TestDiff(t *testing.T) {
+	base := func() diffConfig {
+		return diffConfig{
+			Name:    "api",
+			Timeout: 30 * time.Second,
+			Token:   "s3cr3t",
+			Limits:  diffLimits{Rate: 10, Burst: 20, secret: "a"},
+			Peers:   []string{"a", "b"},
+			Labels:  map[string]string{"env": "prod", "zone": "eu"},
+			Backup:  &diffLimits{Rate: 1},
+		}
+	}
+	for _, tt := range []struct {
+		name   string
+		change func(c *diffConfig)
+		want   map[string]string
+	}{
+		{"nothing", func(c *diffConfig) {}, map[string]string{}},
+		{"skipped fields", func(c *diffConfig) {
+			c.Token = "other"
+			c.Limits.secret = "b"
+		}, map[string]string{}},
+		{"field", func(c *diffConfig) { c.Timeout = time.Minute }, map[string]string{
+			"config.timeout": "30s→1m0s",
+		}},
+		{"nested struct", func(c *diffConfig) {
+			c.Limits.Burst = 40
+			c.Name = "web"
+		}, map[string]string{
+			"config.Name":         "api→web",
+			"config.Limits.Burst": "20→40",
+		}},
+		{"pointer", func(c *diffConfig) { c.Backup = &diffLimits{Rate: 2} }, map[string]string{
+			"config.Backup.Rate": "1→2",
+		}},
+		{"nil pointer", func(c *diffConfig) { c.Backup = nil }, map[string]string{
+			"config.Backup": "{1 0 }→<nil>",
+		}},
+		{"map", func(c *diffConfig) {
+			c.Labels = map[string]string{"env": "staging", "tier": "1"}
+		}, map[string]string{
+			"config.Labels.env":  "prod→staging",
+			"config.Labels.tier": "<none>→1",
+			"config.Labels.zone": "eu→<none>",
+		}},
+		{"slice element", func(c *diffConfig) { c.Peers = []string{"a", "c"} }, map[string]string{
+			"config.Peers": "[a b]→[a c]",
+		}},
+		{"slice length", func(c *diffConfig) { c.Peers = c.Peers[:1] }, map[string]string{
+			"config.Peers": "[a b]→[a]",
+		}},
+		{"error", func(c *diffConfig) { c.Err = errors.New("boom") }, map[string]string{
+			"config.Err": "<nil>→boom",
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after := base(), base()
+			tt.change(&after)
+			if got := changes(Diff("config", before, after)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffDepth(t *testing.T) {
+	type node struct {
+		V    int
+		Next *node
+	}
+	chain := func(leaf int) *node {
+		n := &node{V: leaf}
+		for i := 0; i < maxDiffDepth+2; i++ {
+			n = &node{Next: n}
+		}
+		return n
+	}
+	got := changes(Diff("n", chain(1), chain(2)))
+	if len(got) != 1 {
+		t.Fatalf("got %v, want one change", got)
+	}
+	for k := range got {
+		if n := countDots(k); n != maxDiffDepth {
+			t.Errorf("got the change at %q, want it at depth %d", k, maxDiffDepth)
+		}
+	}
+}
+
+func countDots(s string) int {
+	n := 0
+	for _, c := range s {
+		if c == '.' {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDiffTypeChange(t *testing.T) {
+	got := changes(Diff("v", 1, "1"))
+	if want := map[string]string{"v": "1→1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
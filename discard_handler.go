@@ -0,0 +1,37 @@
+package log
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+// DiscardHandler discards all records. Its Enabled always returns false,
+// so that a Logger using it returns from its logging calls before
+// computing the caller, formatting the message or building the record:
+//
+//	log.New(&log.Options{NewHandler: func(io.Writer, *slog.HandlerOptions) slog.Handler {
+//		return log.DiscardHandler
+//	}})
+//
+// Records logged with [Logger.Always] are still passed to it, and dropped.
+var DiscardHandler Handler = discardHandler{}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// discards reports whether the records written to w are discarded, w
+// being io.Discard or the output of a Logger set to it.
+func discards(w io.Writer) bool {
+	if w == io.Discard {
+		return true
+	}
+	if d, ok := w.(interface{ discards() bool }); ok {
+		return d.discards()
+	}
+	return false
+}
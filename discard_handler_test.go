@@ -0,0 +1,61 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+// The logging calls of a Logger discarding its records don't allocate.
+func TestDiscardAllocs(t *testing.T) {
+	discarding := New(&Options{NewHandler: func(io.Writer, *slog.HandlerOptions) slog.Handler {
+		return DiscardHandler
+	}})
+	set := New(&Options{Writer: new(bytes.Buffer)})
+	set.SetOutput(io.Discard)
+	for _, tt := range []struct {
+		name string
+		l    Logger
+	}{
+		{"DiscardHandler", discarding},
+		{"Writer io.Discard", New(&Options{Writer: io.Discard})},
+		{"SetOutput io.Discard", set},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// The arguments are built once: through a Logger of unknown
+			// type, the caller allocates them otherwise.
+			l := tt.l
+			args, format := []any{"method", "GET", "status", 200}, []any{3}
+			allocs := testing.AllocsPerRun(100, func() {
+				l.Info("request", args...)
+				l.Error("failed after %d tries", format...)
+				l.With().WithGroup("").Debug("request")
+			})
+			if allocs != 0 {
+				t.Errorf("%v allocations per call, want 0", allocs)
+			}
+		})
+	}
+
+	text := NewTextHandler(io.Discard, nil)
+	allocs := testing.AllocsPerRun(100, func() {
+		if text.Enabled(context.Background(), slog.LevelError) {
+			t.Fatal("enabled")
+		}
+		DiscardHandler.WithAttrs(nil).WithGroup("g")
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per call, want 0", allocs)
+	}
+}
+
+func BenchmarkDiscard(b *testing.B) {
+	l := New(&Options{Writer: io.Discard})
+	args := []any{"method", "GET", "status", 200}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("request", args...)
+	}
+}
@@ -0,0 +1,102 @@
+package log
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DroppedKey is the key of the attribute carrying the counts of the
+// records left out before a record. See [Drops].
+const DroppedKey = "dropped"
+
+// Reasons under which the components of this package count the records
+// they leave out in [Drops].
+const (
+	DropDeadline  = "deadline"  // skipped by Options.DeadlineSkip
+	DropBudget    = "budget"    // left out by a ByteBudgetHandler
+	DropQueue     = "queue"     // dropped from the full queue of a handler
+	DropDuplicate = "duplicate" // repeats suppressed by an ErrorDedup
+	DropSampled   = "sampled"   // left out by a SamplingHandler
+	DropThrottled = "throttled" // over the rate of a RateLimitHandler
+	DropFailed    = "failed"    // given up on after the retries of a handler
+)
+
+// Drops accumulates the records left out by the suppressing components
+// of a logging pipeline, by reason, until the next record that gets
+// through, which then carries them as a group under DroppedKey:
+//
+//	dropped.budget=12 dropped.deadline=3
+//
+// so that the gap is visible where it happened in the stream. Share one
+// Drops between the Logger, through [Options.Drops], and the components
+// of its pipeline, such as [ByteBudgetOptions.Drops]. A Drops is safe for
+// concurrent use; the zero value is ready to use.
+type Drops struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// Add counts n records left out for reason.
+func (d *Drops) Add(reason string, n int64) {
+	if d == nil || n <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.counts == nil {
+		d.counts = make(map[string]int64)
+	}
+	d.counts[reason] += n
+}
+
+// take returns the counts accumulated so far as a DroppedKey group,
+// resetting them, and reports whether there were any.
+func (d *Drops) take() (Attr, bool) {
+	if d == nil {
+		return Attr{}, false
+	}
+	d.mu.Lock()
+	counts := d.counts
+	d.counts = nil
+	d.mu.Unlock()
+	if len(counts) == 0 {
+		return Attr{}, false
+	}
+	attrs := make([]Attr, 0, len(counts))
+	for reason, n := range counts {
+		attrs = append(attrs, Int64(reason, n))
+	}
+	slices.SortFunc(attrs, func(a, b Attr) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return slog.Attr{Key: DroppedKey, Value: slog.GroupValue(attrs...)}, true
+}
+
+// restore counts again the records of a DroppedKey group, taken by take
+// for a record that did not get through either.
+func (d *Drops) restore(a Attr) {
+	if d == nil || a.Key != DroppedKey || a.Value.Kind() != slog.KindGroup {
+		return
+	}
+	for _, c := range a.Value.Group() {
+		if c.Value.Kind() == slog.KindInt64 {
+			d.Add(c.Key, c.Value.Int64())
+		}
+	}
+}
+
+// restoreFrom restores the DroppedKey group of r, if any.
+func (d *Drops) restoreFrom(r slog.Record) {
+	if d == nil {
+		return
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == DroppedKey {
+			d.restore(a)
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,144 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// droppedOf returns the DroppedKey group of r, as text, or "" if it has
+// none.
+func droppedOf(r slog.Record) string {
+	v, ok := attrValue(r, DroppedKey)
+	if !ok {
+		return ""
+	}
+	return v.String()
+}
+
+// TestDropsTwoSources shares one Drops between DeadlineSkip and a
+// SamplingHandler, and checks that the next record through carries the
+// counts of both.
+func TestDropsTwoSources(t *testing.T) {
+	clock := newFakeClock()
+	drops := new(Drops)
+	ring := NewRingHandler(100)
+	l := New(&Options{
+		Writer:       io.Discard,
+		Level:        LevelDebug,
+		Drops:        drops,
+		DeadlineSkip: DeadlineSkip{Below: time.Second, MaxLevel: LevelDebug},
+		NewHandler: func(io.Writer, *slog.HandlerOptions) slog.Handler {
+			return NewSamplingHandler(ring, SamplingOptions{
+				Rules: map[Level]SamplingRule{LevelInfo: {First: 1}},
+				Drops: drops,
+				Clock: clock.now,
+			})
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	l.Info("first")
+	for i := 0; i < 3; i++ {
+		l.Info("sampled out")
+	}
+	for i := 0; i < 2; i++ {
+		l.DebugContext(ctx, "skipped")
+	}
+	l.Warn("through")
+	l.Warn("after")
+
+	recs := ring.Records()
+	if len(recs) != 3 {
+		t.Fatalf("got %d records, want 3", len(recs))
+	}
+	want := []string{"", "[deadline=2 sampled=3]", ""}
+	for i, r := range recs {
+		if got := droppedOf(r); got != want[i] {
+			t.Errorf("%s: %s = %q, want %q", r.Message, DroppedKey, got, want[i])
+		}
+	}
+}
+
+// flakyHandler fails while fail is set, and passes records on otherwise.
+type flakyHandler struct {
+	slog.Handler
+	fail bool
+}
+
+func (h *flakyHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.fail {
+		return errors.New("write failed")
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// TestDropsKeptOnError checks that counts taken for a record the handler
+// failed to write are attached to the next one instead.
+func TestDropsKeptOnError(t *testing.T) {
+	drops := new(Drops)
+	ring := NewRingHandler(10)
+	fh := &flakyHandler{Handler: ring, fail: true}
+	l := New(&Options{
+		Writer:       io.Discard,
+		Drops:        drops,
+		ErrorHandler: func(error, Record) {},
+		NewHandler:   func(io.Writer, *slog.HandlerOptions) slog.Handler { return fh },
+	})
+	drops.Add(DropQueue, 4)
+	l.Info("lost")
+	fh.fail = false
+	l.Info("kept")
+	if got, want := droppedOf(ring.Records()[0]), "[queue=4]"; got != want {
+		t.Errorf("%s = %q, want %q", DroppedKey, got, want)
+	}
+}
+
+func TestDropsConcurrent(t *testing.T) {
+	drops := new(Drops)
+	var wg sync.WaitGroup
+	var taken [2]int64
+	var mu sync.Mutex
+	collect := func() {
+		a, ok := drops.take()
+		if !ok {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range a.Value.Group() {
+			switch c.Key {
+			case DropThrottled:
+				taken[0] += c.Value.Int64()
+			case DropQueue:
+				taken[1] += c.Value.Int64()
+			}
+		}
+	}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if i%2 == 0 {
+					drops.Add(DropThrottled, 1)
+				} else {
+					drops.Add(DropQueue, 2)
+				}
+				if j%100 == 0 {
+					collect()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	collect()
+	if taken != [2]int64{4000, 8000} {
+		t.Errorf("taken %v, want [4000 8000]", taken)
+	}
+}
@@ -0,0 +1,166 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// ECSVersion is the version of the Elastic Common Schema followed by the
+// handlers returned by [NewECSHandler].
+const ECSVersion = "8.11.0"
+
+// NewECSHandler creates a JSONHandler that lays records out following the
+// Elastic Common Schema, so that they can be indexed by Elasticsearch
+// without an ingest pipeline:
+//
+//	{"@timestamp":"2024-06-01T12:00:00Z","log":{"level":"error"},"message":"boom","ecs":{"version":"8.11.0"},"error":{"message":"EOF","type":"*errors.errorString"}}
+//
+// The time, level, message and source location are written as
+// @timestamp, log.level, message and log.origin.file, and the [Event] of
+// the record as event.action. An error attribute
+// logged under ErrorKey, as made by [Err], and a stack under StackKey are
+// moved into the error object as error.message, error.type and
+// error.stack_trace, unless they belong to a group. Other attributes and
+// groups are written as by NewJSONHandler. ReplaceAttr sees the built-in
+// attributes under their usual keys.
+func NewECSHandler(out io.Writer, opts *slog.HandlerOptions) *JSONHandler {
+	return NewECSHandlerWithOptions(out, handlerOptions(opts))
+}
+
+// NewECSHandlerWithOptions is like [NewECSHandler] but accepts the
+// extended options of this package.
+func NewECSHandlerWithOptions(out io.Writer, opts *HandlerOptions) *JSONHandler {
+	h := NewJSONHandlerWithOptions(out, opts)
+	h.layout = jsonECS
+	return h
+}
+
+// appendECSHeader appends the built-in attributes of r in the layout of
+// the Elastic Common Schema.
+func (h *JSONHandler) appendECSHeader(buf []byte, r slog.Record) []byte {
+	if !r.Time.IsZero() {
+		if a, ok := h.opts.builtin(slog.Time(slog.TimeKey, r.Time)); ok {
+			buf = appendJSONSep(buf)
+			buf = append(buf, `"@timestamp":`...)
+			buf = appendJSONValue(buf, a.Value)
+		}
+	}
+	buf = appendJSONSep(buf)
+	buf = append(buf, `"log":{`...)
+	if a, ok := h.opts.builtin(slog.Any(slog.LevelKey, r.Level)); ok {
+		buf = append(buf, `"level":`...)
+		if isSlogLevel(a.Value) {
+			buf = appendJSONString(buf, strings.ToLower(levelToString(a.Value.Any().(slog.Level))))
+		} else {
+			buf = appendJSONValue(buf, a.Value)
+		}
+	}
+	if h.opts.AddSource {
+		if a, ok := h.opts.builtin(slog.String(slog.SourceKey, h.opts.source(r.PC))); ok {
+			src := a.Value.String()
+			file, line := src, ""
+			if i := strings.LastIndexByte(src, ':'); i >= 0 {
+				file, line = src[:i], src[i+1:]
+			}
+			buf = appendJSONSep(buf)
+			buf = append(buf, `"origin":{"file":{"name":`...)
+			buf = appendJSONString(buf, file)
+			if _, err := strconv.Atoi(line); err == nil {
+				buf = append(buf, `,"line":`...)
+				buf = append(buf, line...)
+			}
+			buf = append(buf, "}}"...)
+		}
+	}
+	buf = append(buf, '}')
+	if ev, ok := recordEvent(r); ok {
+		if a, ok := h.opts.builtin(ev); ok {
+			buf = append(buf, `,"event":{"action":`...)
+			buf = appendJSONValue(buf, a.Value)
+			buf = append(buf, '}')
+		}
+	}
+	if a, ok := h.opts.builtin(slog.String(slog.MessageKey, r.Message)); ok {
+		buf = append(buf, `,"message":`...)
+		buf = appendJSONValue(buf, a.Value)
+	}
+	buf = append(buf, `,"ecs":{"version":"`+ECSVersion+`"}`...)
+	return buf
+}
+
+// ecsError collects the attributes of a record that make up the error
+// object of the Elastic Common Schema.
+type ecsError struct {
+	found   bool
+	message string
+	typ     string
+	stack   Stack
+}
+
+// take reports whether a belongs to the error object, and if so records
+// it, as changed by ReplaceAttr.
+func (e *ecsError) take(h *JSONHandler, a slog.Attr) bool {
+	v := a.Value.Resolve()
+	if v.Kind() != slog.KindAny {
+		return false
+	}
+	switch x := v.Any().(type) {
+	case error:
+		if a.Key != ErrorKey || isNil(x) {
+			return false
+		}
+	case Stack:
+		if a.Key != StackKey {
+			return false
+		}
+	default:
+		return false
+	}
+	a.Value = v
+	if rep := h.opts.ReplaceAttr; rep != nil {
+		a = rep(nil, a)
+		a.Value = a.Value.Resolve()
+		if a.Equal(slog.Attr{}) {
+			return true
+		}
+	}
+	e.found = true
+	switch x := a.Value.Any().(type) {
+	case Stack:
+		e.stack = x
+	case error:
+		e.message, e.typ = errorText(x), fmt.Sprintf("%T", x)
+	default:
+		e.message = a.Value.String()
+	}
+	return true
+}
+
+// append appends the error object, if any attribute went into it.
+func (e *ecsError) append(buf []byte) []byte {
+	if !e.found {
+		return buf
+	}
+	buf = append(buf, `,"error":{`...)
+	if e.message != "" || e.typ != "" {
+		buf = append(buf, `"message":`...)
+		buf = appendJSONString(buf, e.message)
+	}
+	if e.typ != "" {
+		buf = append(buf, `,"type":`...)
+		buf = appendJSONString(buf, e.typ)
+	}
+	if len(e.stack) > 0 {
+		var sb strings.Builder
+		for _, f := range e.stack {
+			fmt.Fprintf(&sb, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		}
+		buf = appendJSONSep(buf)
+		buf = append(buf, `"stack_trace":`...)
+		buf = appendJSONString(buf, sb.String())
+	}
+	return append(buf, '}')
+}
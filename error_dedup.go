@@ -0,0 +1,159 @@
+package log
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorRepeatsKey is the key of the attribute an [ErrorDedup] adds to the
+// records of an error seen before.
+const ErrorRepeatsKey = "err_repeats"
+
+// Defaults of ErrorDedup.
+const (
+	errorDedupWindow = time.Minute
+	errorDedupSize   = 256
+)
+
+// ErrorDedup suppresses the records of an error logged again and again,
+// from whatever call site and with whatever message, such as the error of
+// a broken connection reported by every request using it. Set it as
+// [Options.ErrorDedup].
+//
+// The error of a record is its msg argument if that is an error, or else
+// the first attribute holding an error. Errors are told apart by their
+// identity, the error value itself if it is comparable, and by the types
+// along their unwrap chain; errors wrapping one of Sentinels, as reported
+// by errors.Is, are all taken for that sentinel, so that different
+// wrappings of it are grouped.
+//
+// The first record of an error in a window is logged in full. The repeats
+// within the window are suppressed, and counted under DropDuplicate in
+// the Drops of the logger, if any; the first record of the error after
+// the window carries their number under ErrorRepeatsKey. With Annotate,
+// repeats are logged instead, each carrying the number of repeats so far.
+// Records at LevelPanic and above and those logged with [Logger.Always]
+// are never suppressed.
+//
+// Set the fields before the logger is used. An ErrorDedup is safe for
+// concurrent use and may be shared by several loggers.
+type ErrorDedup struct {
+	// Window is how long repeats of an error are suppressed after it is
+	// logged. If zero, a minute is used.
+	Window time.Duration
+
+	// Size is the number of distinct errors tracked; the least recently
+	// seen are forgotten first. If zero, 256 are tracked.
+	Size int
+
+	// Sentinels are errors for which all the errors wrapping them are
+	// taken as one.
+	Sentinels []error
+
+	// Annotate logs the repeats of an error with their count instead of
+	// suppressing them.
+	Annotate bool
+
+	mu      sync.Mutex
+	lru     list.List // of *errorSeen, most recently seen first
+	entries map[errorFingerprint]*list.Element
+}
+
+// errorFingerprint identifies an error for ErrorDedup.
+type errorFingerprint struct {
+	id    any    // the error or its sentinel, if comparable
+	chain string // the types along the unwrap chain
+	text  string // the message of errors that are not comparable
+}
+
+// errorSeen is the state of one error tracked by ErrorDedup.
+type errorSeen struct {
+	fp      errorFingerprint
+	start   time.Time // when the current window started
+	repeats int64     // repeats in the current window
+}
+
+// fingerprint returns the fingerprint of err.
+func (d *ErrorDedup) fingerprint(err error) errorFingerprint {
+	for _, s := range d.Sentinels {
+		if errors.Is(err, s) {
+			err = s
+			break
+		}
+	}
+	var chain strings.Builder
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		fmt.Fprintf(&chain, "%T;", e)
+	}
+	fp := errorFingerprint{chain: chain.String()}
+	if reflect.TypeOf(err).Comparable() {
+		fp.id = err
+	} else {
+		fp.text = errorText(err)
+	}
+	return fp
+}
+
+// check records that err is logged at now. It reports whether the record
+// is to be suppressed, and otherwise the number of repeats to attach, if
+// any.
+func (d *ErrorDedup) check(err error, now time.Time) (suppress bool, repeats int64) {
+	fp := d.fingerprint(err)
+	window := d.Window
+	if window <= 0 {
+		window = errorDedupWindow
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.entries == nil {
+		d.entries = make(map[errorFingerprint]*list.Element)
+	}
+	if e, ok := d.entries[fp]; ok {
+		d.lru.MoveToFront(e)
+		seen := e.Value.(*errorSeen)
+		if now.Sub(seen.start) < window {
+			seen.repeats++
+			if d.Annotate {
+				return false, seen.repeats
+			}
+			return true, 0
+		}
+		// A new window: report the repeats of the previous one.
+		repeats = seen.repeats
+		if d.Annotate {
+			repeats = 0
+		}
+		seen.start, seen.repeats = now, 0
+		return false, repeats
+	}
+	d.entries[fp] = d.lru.PushFront(&errorSeen{fp: fp, start: now})
+	size := d.Size
+	if size <= 0 {
+		size = errorDedupSize
+	}
+	for d.lru.Len() > size {
+		last := d.lru.Back()
+		delete(d.entries, last.Value.(*errorSeen).fp)
+		d.lru.Remove(last)
+	}
+	return false, 0
+}
+
+// recordError returns the error of a record logged with msg and attrs,
+// as described for ErrorDedup, or nil.
+func recordError(msg any, attrs []Attr) error {
+	if err, ok := msg.(error); ok {
+		return err
+	}
+	for _, a := range attrs {
+		if err, ok := a.Value.Any().(error); ok && !isNil(err) {
+			return err
+		}
+	}
+	return nil
+}
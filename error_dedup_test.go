@@ -0,0 +1,93 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var errTimeout = errors.New("timeout")
+
+// Wrapped variants of a sentinel are grouped, whatever the call site,
+// the message and the wrapping.
+func TestErrorDedupSentinel(t *testing.T) {
+	clock := newFakeClock()
+	drops := new(Drops)
+	l, ring := newRingLogger(&Options{
+		Clock:      clock.now,
+		Drops:      drops,
+		ErrorDedup: &ErrorDedup{Window: time.Minute, Sentinels: []error{errTimeout}},
+	})
+	l.Error(fmt.Errorf("dial db: %w", errTimeout))
+	l.Warn("query failed", "err", fmt.Errorf("query: %w", fmt.Errorf("read: %w", errTimeout)))
+	l.Error("cache miss", "cause", fmt.Errorf("cache: %w", errTimeout))
+	l.Error(errTimeout)
+	checkMessages(t, messages(ring, ErrorRepeatsKey), "ERROR dial db: timeout")
+
+	// After the window, the next record carries the repeats suppressed.
+	clock.advance(time.Minute)
+	l.Error("retry failed", "err", fmt.Errorf("retry: %w", errTimeout))
+	checkMessages(t, messages(ring, ErrorRepeatsKey), "ERROR dial db: timeout", "ERROR retry failed err_repeats=3")
+
+	// The drops of the first window went with the record after them: a
+	// repeat in the new window is counted anew.
+	l.Error(fmt.Errorf("again: %w", errTimeout))
+	if a, ok := drops.take(); !ok || a.Value.Group()[0].Value.Int64() != 1 {
+		t.Errorf("drops = %v, want duplicate=1", a)
+	}
+}
+
+// Unrelated errors, and errors wrapping no sentinel, are not grouped.
+func TestErrorDedupUnrelated(t *testing.T) {
+	clock := newFakeClock()
+	l, ring := newRingLogger(&Options{
+		Clock:      clock.now,
+		ErrorDedup: &ErrorDedup{Sentinels: []error{errTimeout}},
+	})
+	l.Error(fmt.Errorf("dial: %w", errTimeout))
+	l.Error(errors.New("disk full"))
+	// Same text, another error.
+	l.Error(errors.New("disk full"))
+	// Another wrapping of the same error, without a sentinel for it.
+	errRefused := errors.New("refused")
+	l.Error(fmt.Errorf("a: %w", errRefused))
+	l.Error(fmt.Errorf("b: %w", errRefused))
+	// The same error value is grouped, sentinel or not.
+	l.Error(errRefused)
+	l.Error("again", "err", errRefused)
+	checkMessages(t, messages(ring, ErrorRepeatsKey),
+		"ERROR dial: timeout", "ERROR disk full", "ERROR disk full", "ERROR a: refused", "ERROR b: refused", "ERROR refused")
+}
+
+// With Annotate, repeats are logged with their count so far.
+func TestErrorDedupAnnotate(t *testing.T) {
+	clock := newFakeClock()
+	l, ring := newRingLogger(&Options{
+		Clock:      clock.now,
+		ErrorDedup: &ErrorDedup{Annotate: true, Sentinels: []error{errTimeout}},
+	})
+	l.Error(fmt.Errorf("a: %w", errTimeout))
+	l.Error(fmt.Errorf("b: %w", errTimeout))
+	l.Error(fmt.Errorf("c: %w", errTimeout))
+	clock.advance(errorDedupWindow)
+	l.Error(fmt.Errorf("d: %w", errTimeout))
+	checkMessages(t, messages(ring, ErrorRepeatsKey),
+		"ERROR a: timeout", "ERROR b: timeout err_repeats=1", "ERROR c: timeout err_repeats=2", "ERROR d: timeout")
+}
+
+// The errors seen least recently are forgotten past Size.
+func TestErrorDedupSize(t *testing.T) {
+	clock := newFakeClock()
+	l, ring := newRingLogger(&Options{
+		Clock:      clock.now,
+		ErrorDedup: &ErrorDedup{Size: 2},
+	})
+	errA, errB, errC := errors.New("a"), errors.New("b"), errors.New("c")
+	l.Error(errA)
+	l.Error(errB)
+	l.Error(errC) // forgets errA
+	l.Error(errA) // forgets errB
+	l.Error(errC)
+	checkMessages(t, messages(ring, ErrorRepeatsKey), "ERROR a", "ERROR b", "ERROR c", "ERROR a")
+}
@@ -0,0 +1,114 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errorThrottle is the minimum interval between two reports of an
+// identical error to Options.ErrorHandler.
+const errorThrottle = time.Second
+
+// errorReporter forwards handler errors to Options.ErrorHandler,
+// throttling repeats of the same error.
+type errorReporter struct {
+	fn func(err error, r Record)
+
+	failing atomic.Bool // whether the last Handle call failed
+
+	mu         sync.Mutex
+	lastErr    error     // last error, reported or not
+	lastErrAt  time.Time // when it happened
+	last       string    // text of the last reported error
+	lastAt     time.Time // when it was reported
+	suppressed int       // repeats of last not reported since
+}
+
+// ok records that a Handle call succeeded.
+func (e *errorReporter) ok() {
+	if e.failing.Load() {
+		e.failing.Store(false)
+	}
+}
+
+func (e *errorReporter) report(err error, r Record) {
+	if e == nil {
+		return
+	}
+	now := time.Now()
+	e.failing.Store(true)
+	e.mu.Lock()
+	e.lastErr, e.lastErrAt = err, now
+	if e.fn == nil {
+		e.mu.Unlock()
+		return
+	}
+	msg := err.Error()
+	if msg == e.last && now.Sub(e.lastAt) < errorThrottle {
+		e.suppressed++
+		e.mu.Unlock()
+		return
+	}
+	if e.suppressed > 0 && msg == e.last {
+		err = fmt.Errorf("%w (repeated %d more times)", err, e.suppressed)
+	}
+	e.last, e.lastAt, e.suppressed = msg, now, 0
+	e.mu.Unlock()
+
+	leave := enterHook()
+	defer leave()
+	e.fn(err, r)
+}
+
+// Hooks such as Options.ErrorHandler may log through the logger that
+// invoked them, which would feed back into the pipeline forever. While a
+// hook runs, the id of its goroutine is kept in hookGoroutines, and
+// records logged from that goroutine are written to os.Stderr directly.
+// Goroutine ids are only looked up while at least one hook is running,
+// so ordinary logging pays a single atomic load.
+var (
+	hooksRunning   atomic.Int32
+	hookGoroutines sync.Map // goroutine id -> struct{}
+)
+
+func enterHook() (leave func()) {
+	id := goroutineID()
+	hooksRunning.Add(1)
+	hookGoroutines.Store(id, struct{}{})
+	return func() {
+		hookGoroutines.Delete(id)
+		hooksRunning.Add(-1)
+	}
+}
+
+// inHook reports whether the calling goroutine is running a hook.
+func inHook() bool {
+	if hooksRunning.Load() == 0 {
+		return false
+	}
+	_, ok := hookGoroutines.Load(goroutineID())
+	return ok
+}
+
+// goroutineID parses the id of the calling goroutine from its stack header.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// writeRaw is the minimal path for records logged from within a hook.
+func writeRaw(level Level, msg string) {
+	fmt.Fprintf(os.Stderr, "log: %s %s (logged from within a log hook)\n", level, msg)
+}
@@ -0,0 +1,107 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingHandler fails to handle all records, counting them.
+type failingHandler struct {
+	slog.Handler
+	handled *atomic.Int64
+	err     error
+}
+
+func (h *failingHandler) Handle(context.Context, slog.Record) error {
+	h.handled.Add(1)
+	return h.err
+}
+
+func newFailingLogger(errorHandler func(err error, r Record)) (Logger, *atomic.Int64) {
+	handled := new(atomic.Int64)
+	l := New(&Options{
+		Writer:       io.Discard,
+		Level:        LevelInfo,
+		ErrorHandler: errorHandler,
+		NewHandler: func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+			return &failingHandler{Handler: slog.NewTextHandler(w, opts), handled: handled, err: errors.New("disk full")}
+		},
+	})
+	return l, handled
+}
+
+func TestErrorHandlerLoggingThroughLogger(t *testing.T) {
+	var l Logger
+	var calls atomic.Int64
+	l, handled := newFailingLogger(func(err error, r Record) {
+		calls.Add(1)
+		// The easy mistake: reporting the failure through the logger
+		// that failed.
+		l.Error("logging failed", "err", err, "msg", r.Message)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Info("first")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging from the error handler hangs")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("error handler called %d times, want 1", n)
+	}
+	// Only the original record reached the handler: the one logged by
+	// the error handler went to os.Stderr.
+	if n := handled.Load(); n != 1 {
+		t.Errorf("handler got %d records, want 1", n)
+	}
+	if inHook() {
+		t.Error("the goroutine is still marked as running a hook")
+	}
+}
+
+func TestErrorHandlerThrottle(t *testing.T) {
+	var calls atomic.Int64
+	l, _ := newFailingLogger(func(error, Record) { calls.Add(1) })
+	for i := 0; i < 100; i++ {
+		l.Info("again")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("error handler called %d times for one repeated error, want 1", n)
+	}
+}
+
+func TestErrorHandlerConcurrentLogging(t *testing.T) {
+	// While a hook runs on one goroutine, the others log as usual.
+	var l Logger
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	l, handled := newFailingLogger(func(error, Record) {
+		close(entered)
+		<-release
+	})
+	go l.Info("blocked in the hook")
+	<-entered
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Info("concurrent")
+		}()
+	}
+	wg.Wait()
+	close(release)
+	if n := handled.Load(); n != 11 {
+		t.Errorf("handler got %d records, want 11", n)
+	}
+}
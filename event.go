@@ -0,0 +1,53 @@
+package log
+
+import "log/slog"
+
+// EventKey is the key of the attribute naming the event a record stands
+// for. See [Event].
+const EventKey = "event"
+
+// Event returns an Attr naming the event a record stands for, a stable
+// identifier for machines to key on, as opposed to the message, which is
+// free text for humans:
+//
+//	logger.Info("user signed up via referral", log.Event("user.signup"))
+//
+// The handlers of this package render the event in a fixed place: right
+// after the level in text output, and as a top-level field in JSON, even
+// within groups opened by WithGroup. The key EventKey is reserved for it:
+// the first attribute of a record under EventKey, not nested in a group,
+// is taken as its event, whether made by Event or not. Any later one is
+// rendered as an ordinary attribute.
+//
+// [SamplingOptions.ByEvent] and [FilterByEvent] key on the event rather
+// than on the message.
+func Event(name string) Attr {
+	return slog.String(EventKey, name)
+}
+
+// recordEvent returns the event attribute of r, and whether it has one.
+func recordEvent(r slog.Record) (slog.Attr, bool) {
+	var ev slog.Attr
+	found := false
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == EventKey {
+			ev, found = a, true
+			return false
+		}
+		return true
+	})
+	return ev, found
+}
+
+// attrsAfterEvent is like recordAttrs, but leaves out the event attribute
+// of r, which the handler rendered already.
+func (o *HandlerOptions) attrsAfterEvent(r slog.Record, fn func(slog.Attr) bool) {
+	skipped := false
+	o.recordAttrs(r, func(a slog.Attr) bool {
+		if !skipped && a.Key == EventKey {
+			skipped = true
+			return true
+		}
+		return fn(a)
+	})
+}
@@ -0,0 +1,117 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+)
+
+// eventRecord has an event among its attributes, a second attribute
+// under EventKey and a third in a group, which are ordinary ones.
+func eventRecord() slog.Record {
+	r := slog.NewRecord(time.Time{}, slog.LevelInfo, "user signed up", 0)
+	r.AddAttrs(Int("id", 7), Event("user.signup"), String(EventKey, "again"), Group("x", String(EventKey, "nested")))
+	return r
+}
+
+func TestEventPosition(t *testing.T) {
+	tests := []struct {
+		name string
+		new  func(io.Writer, *HandlerOptions) slog.Handler
+		want string
+	}{
+		{"text", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewTextHandlerWithOptions(w, o) },
+			`|  INFO | event="user.signup" user signed up g.id=7 g.event="again" g.x.event="nested" ` + "\n"},
+		{"fast text", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewFastTextHandlerWithOptions(w, o) },
+			`INF event="user.signup" user signed up g.id=7 g.event="again" g.x.event="nested"` + "\n"},
+		{"indent", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewIndentHandlerWithOptions(w, o) },
+			"level: INFO\nevent: \"user.signup\"\nmsg: user signed up\ng:\n    id: 7\n    event: \"again\"\n    x:\n        event: \"nested\"\n---\n"},
+		{"json", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewJSONHandlerWithOptions(w, o) },
+			`{"level":"INFO","event":"user.signup","msg":"user signed up","g":{"id":7,"event":"again","x":{"event":"nested"}}}` + "\n"},
+		{"logfmt", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewLogfmtHandlerWithOptions(w, o) },
+			`level=INFO event=user.signup msg="user signed up" g.id=7 g.event=again g.x.event=nested` + "\n"},
+		{"cloud logging", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewCloudLoggingHandlerWithOptions(w, o) },
+			`{"severity":"INFO","event":"user.signup","message":"user signed up","g":{"id":7,"event":"again","x":{"event":"nested"}}}` + "\n"},
+		{"ecs", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewECSHandlerWithOptions(w, o) },
+			`{"log":{"level":"info"},"event":{"action":"user.signup"},"message":"user signed up","ecs":{"version":"8.11.0"},"g":{"id":7,"event":"again","x":{"event":"nested"}}}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := tt.new(&buf, &HandlerOptions{}).WithGroup("g")
+			if err := h.Handle(context.Background(), eventRecord()); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSamplingByEvent(t *testing.T) {
+	clock := newFakeClock()
+	ring := NewRingHandler(100)
+	h := NewSamplingHandler(ring, SamplingOptions{
+		Rules:   map[Level]SamplingRule{LevelInfo: {First: 2}},
+		ByEvent: true,
+		Clock:   clock.now,
+	})
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		// The messages differ, the events don't.
+		for _, ev := range []string{"user.signup", "user.login"} {
+			r := slog.NewRecord(clock.now(), slog.LevelInfo, ev+" "+string(rune('a'+i)), 0)
+			r.AddAttrs(Event(ev))
+			h.Handle(ctx, r)
+		}
+		h.Handle(ctx, slog.NewRecord(clock.now(), slog.LevelInfo, "no event", 0))
+	}
+	counts := make(map[string]int)
+	for _, r := range ring.Records() {
+		name := ""
+		if ev, ok := recordEvent(r); ok {
+			name = ev.Value.String()
+		}
+		counts[name]++
+	}
+	want := map[string]int{"user.signup": 2, "user.login": 2, "": 2}
+	for ev, n := range want {
+		if counts[ev] != n {
+			t.Errorf("event %q: %d records passed, want %d", ev, counts[ev], n)
+		}
+	}
+
+	clock.advance(time.Second)
+	r := slog.NewRecord(clock.now(), slog.LevelInfo, "next tick", 0)
+	r.AddAttrs(Event("user.signup"))
+	h.Handle(ctx, r)
+	if n := len(ring.Records()); n != 7 {
+		t.Errorf("%d records after the tick, want 7", n)
+	}
+}
+
+func TestFilterByEvent(t *testing.T) {
+	ring := NewRingHandler(100)
+	var h slog.Handler = NewFilterHandler(ring, FilterByEvent(func(name string) bool {
+		return name != "health.check"
+	}))
+	// The event stays at the top level under WithGroup.
+	h = h.WithGroup("req")
+	ctx := context.Background()
+	for _, ev := range []string{"health.check", "user.login", ""} {
+		r := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg "+ev, 0)
+		if ev != "" {
+			r.AddAttrs(Event(ev))
+		}
+		r.AddAttrs(String("path", "/"))
+		h.Handle(ctx, r)
+	}
+	if got, want := messages(ring), []string{"INFO msg user.login", "INFO msg "}; !slices.Equal(got, want) {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,32 @@
+package log_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"zestack.dev/log"
+)
+
+// A bridge from another logging package builds the records itself and
+// hands them to a Logger, without importing log/slog.
+func ExampleLogger_Handle() {
+	l := log.New(&log.Options{Writer: os.Stdout, Level: log.LevelDebug, NoColor: true})
+
+	// A zero time leaves the time out.
+	r := log.NewRecord(time.Time{}, log.LevelWarn, "disk almost full", 0)
+	r.AddAttrs(log.String("mount", "/var"), log.Int("free_mb", 512))
+	if err := l.Handle(context.Background(), r); err != nil {
+		panic(err)
+	}
+	// Output:
+	// |  WARN | disk almost full mount="/var" free_mb=512
+}
+
+func ExampleRecordLevel() {
+	r := log.NewRecord(time.Time{}, log.LevelError, "failed", 0)
+	fmt.Println(r.Level, log.RecordLevel(r))
+	// Output:
+	// ERROR ERROR
+}
@@ -0,0 +1,144 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// ErrorKey is the key under which [Logger.Panic] and [Logger.Fatal] attach
+// the error they are given, if any.
+const ErrorKey = "err"
+
+// errorChainKey is the key of the types of the errors wrapped by the
+// error attached under ErrorKey.
+const errorChainKey = "err_chain"
+
+// PanicError is the value passed to panic by [Logger.Panic].
+// If Panic was given an error, PanicError wraps it, so that errors.Is and
+// errors.As work on the recovered value.
+type PanicError struct {
+	// Message is the formatted log message.
+	Message string
+	// Err is the error given to Panic, if any.
+	Err error
+	// Stack is the call stack of the Panic call.
+	Stack Stack
+}
+
+func (e *PanicError) Error() string {
+	return e.Message
+}
+
+func (e *PanicError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	exitMu    sync.Mutex
+	exitHooks []func(err error)
+)
+
+// RegisterExitHook registers fn to be called by [Logger.Fatal] before
+// the program exits. fn receives the error given to Fatal, or nil.
+// Hooks run in the order they were registered.
+func RegisterExitHook(fn func(err error)) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitHooks = append(exitHooks, fn)
+}
+
+// exit runs the exit hooks and exits the program with status 1.
+func exit(err error) {
+	exitMu.Lock()
+	hooks := exitHooks[:len(exitHooks):len(exitHooks)]
+	exitMu.Unlock()
+	for _, fn := range hooks {
+		fn(err)
+	}
+	os.Exit(1)
+}
+
+// findError returns the error among the msg and args of a Panic or Fatal
+// call: msg itself, or else the first error among the args, be it an
+// operand of the format of msg, an argument of its own, the value of a
+// key-value pair or that of an Attr. It reports whether the error is
+// already an attribute of the record, as in Fatal("failed", "err", err).
+func findError(msg any, args []any) (err error, attached bool) {
+	switch m := msg.(type) {
+	case error:
+		return m, false
+	case Attr:
+		if err := attrError(m); err != nil {
+			return err, true
+		}
+	case string:
+		n := formatOperands(m, args)
+		for _, arg := range args[:n] {
+			if err, ok := arg.(error); ok {
+				return err, false
+			}
+		}
+		args = args[n:]
+	}
+	for len(args) > 0 {
+		switch x := args[0].(type) {
+		case string:
+			if len(args) > 1 {
+				if err, ok := args[1].(error); ok {
+					return err, true
+				}
+				args = args[1:]
+			}
+		case Attr:
+			if err := attrError(x); err != nil {
+				return err, true
+			}
+		case error:
+			return x, false
+		}
+		args = args[1:]
+	}
+	return nil, false
+}
+
+// attrError returns the error held by a, if any.
+func attrError(a Attr) error {
+	if a.Value.Kind() != slog.KindAny {
+		return nil
+	}
+	err, _ := a.Value.Any().(error)
+	return err
+}
+
+// errorAttrs returns the attributes describing err: the error itself,
+// unless it is already attached, and, if it wraps other errors, the types
+// along its unwrap chain.
+func errorAttrs(err error, attached bool) []any {
+	var attrs []any
+	if !attached {
+		attrs = append(attrs, Any(ErrorKey, err))
+	}
+	var chain []string
+	var walk func(err error)
+	walk = func(err error) {
+		chain = append(chain, fmt.Sprintf("%T", err))
+		switch x := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, e := range x.Unwrap() {
+				walk(e)
+			}
+		default:
+			if e := errors.Unwrap(err); e != nil {
+				walk(e)
+			}
+		}
+	}
+	walk(err)
+	if len(chain) > 1 {
+		attrs = append(attrs, Any(errorChainKey, chain))
+	}
+	return attrs
+}
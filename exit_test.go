@@ -0,0 +1,100 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestPanicWrapsError(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&Options{Writer: &buf, NoColor: true})
+	cause := fmt.Errorf("open config: %w", fs.ErrNotExist)
+	for _, call := range []struct {
+		name string
+		fn   func()
+	}{
+		{"msg", func() { l.Panic(cause) }},
+		{"format operand", func() { l.Panic("loading failed: %v", cause) }},
+		{"argument", func() { l.Panic("loading failed", cause) }},
+		{"key-value pair", func() { l.Panic("loading failed", "err", cause) }},
+		{"attr", func() { l.Panic("loading failed", Err(cause)) }},
+	} {
+		t.Run(call.name, func(t *testing.T) {
+			buf.Reset()
+			pe := recoverPanic(t, call.fn)
+			if !errors.Is(pe, fs.ErrNotExist) {
+				t.Errorf("errors.Is(%v, fs.ErrNotExist) = false", pe)
+			}
+			var target *PanicError
+			if !errors.As(pe, &target) || target.Err != cause {
+				t.Errorf("the PanicError doesn't wrap the error given")
+			}
+			line, _, _ := strings.Cut(buf.String(), "\n")
+			if n := strings.Count(line, "err="); n != 1 {
+				t.Errorf("got %d err attributes, want 1: %s", n, line)
+			}
+			if !strings.Contains(line, "err_chain=") {
+				t.Errorf("no unwrap chain: %s", line)
+			}
+		})
+	}
+}
+
+func TestFindError(t *testing.T) {
+	err := errors.New("boom")
+	for _, tt := range []struct {
+		name         string
+		msg          any
+		args         []any
+		want         error
+		wantAttached bool
+	}{
+		{"none", "failed", []any{"n", 1}, nil, false},
+		{"msg", err, nil, err, false},
+		{"format operand", "failed: %v", []any{err}, err, false},
+		{"bare argument", "failed", []any{"n", 1, err}, err, false},
+		{"pair", "failed", []any{"err", err}, err, true},
+		{"pair after a format operand", "copy %s", []any{"a.txt", "cause", err}, err, true},
+		{"attr", "failed", []any{Err(err)}, err, true},
+		{"attr msg", Err(err), nil, err, true},
+		{"string value", "failed", []any{"err", "boom"}, nil, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, attached := findError(tt.msg, tt.args)
+			if got != tt.want || attached != tt.wantAttached {
+				t.Errorf("got %v, %t, want %v, %t", got, attached, tt.want, tt.wantAttached)
+			}
+		})
+	}
+}
+
+func TestFatalExitHook(t *testing.T) {
+	if os.Getenv("LOG_TEST_FATAL") == "1" {
+		RegisterExitHook(func(err error) {
+			fmt.Printf("hook: %t\n", errors.Is(err, fs.ErrNotExist))
+		})
+		New(&Options{Writer: os.Stderr, NoColor: true}).Fatal("loading failed", "err", fmt.Errorf("open: %w", fs.ErrNotExist))
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFatalExitHook$")
+	cmd.Env = append(os.Environ(), "LOG_TEST_FATAL=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("got %v, want exit status 1", err)
+	}
+	if got := stdout.String(); !strings.Contains(got, "hook: true") {
+		t.Errorf("the exit hook didn't get the error: %q", got)
+	}
+	if line := stderr.String(); strings.Count(line, "err=") != 1 || !strings.Contains(line, "FATAL") {
+		t.Errorf("got %q, want one FATAL record with one err attribute", line)
+	}
+}
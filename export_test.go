@@ -0,0 +1,11 @@
+package log
+
+import "bytes"
+
+// Exported for the tests of package log_test.
+var CheckGolden = checkGolden
+
+// Terminal is an output taken by the handlers for a terminal.
+type Terminal struct{ bytes.Buffer }
+
+func (*Terminal) terminal() bool { return true }
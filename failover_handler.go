@@ -0,0 +1,210 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// FailoverErrorKey is the key of the attribute with which a
+// [FailoverHandler] passes a record to its fallback handler, giving the
+// error of the primary handler.
+const FailoverErrorKey = "failover_error"
+
+// failoverRecoveredMessage is the message of the record a FailoverHandler
+// passes to its primary handler when it works again.
+const failoverRecoveredMessage = "primary log handler recovered"
+
+// failoverProbeInterval is the default of FailoverOptions.ProbeInterval.
+const failoverProbeInterval = 10 * time.Second
+
+// FailoverOptions are options for a [FailoverHandler].
+type FailoverOptions struct {
+	// Threshold is the number of consecutive failures of the primary
+	// handler after which the records go straight to the fallback one,
+	// as by a circuit breaker. If zero, each record is tried on the
+	// primary handler first.
+	Threshold int
+
+	// ProbeInterval is how often a record is tried on the primary handler
+	// again, once Threshold is reached. If zero, ten seconds are used.
+	ProbeInterval time.Duration
+
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+}
+
+// FailoverHandler passes records to a primary handler, such as one
+// sending them to a network collector, and the records it fails to handle
+// to a fallback handler, such as one writing to a local file, with the
+// error of the primary handler under FailoverErrorKey:
+//
+//	h := log.NewFailoverHandler(gelf, log.NewJSONHandler(file, nil))
+//
+// Once the primary handler handles a record again after failing, a record
+// at LevelWarn saying so, with the number of failures, is passed to it.
+// Records whose fallback fails too return both errors.
+//
+// The levels enabled are those of the primary handler. Attributes and
+// groups added with WithAttrs and WithGroup go to both.
+type FailoverHandler struct {
+	primary  slog.Handler
+	fallback slog.Handler
+	f        *failover
+}
+
+// failover is the state shared by a FailoverHandler and the handlers
+// derived from it.
+type failover struct {
+	opts FailoverOptions
+	root slog.Handler // primary handler without attributes, for recoveries
+
+	mu        sync.Mutex
+	failures  int       // consecutive failures of the primary handler
+	probeAt   time.Time // when to try the primary handler again, if open
+	lastErr   error
+	lastErrAt time.Time
+}
+
+// NewFailoverHandler returns a FailoverHandler passing records to
+// primary, and to fallback when primary fails.
+func NewFailoverHandler(primary, fallback slog.Handler) *FailoverHandler {
+	return NewFailoverHandlerWithOptions(primary, fallback, FailoverOptions{})
+}
+
+// NewFailoverHandlerWithOptions is like NewFailoverHandler, with options.
+func NewFailoverHandlerWithOptions(primary, fallback slog.Handler, opts FailoverOptions) *FailoverHandler {
+	if opts.ProbeInterval <= 0 {
+		opts.ProbeInterval = failoverProbeInterval
+	}
+	return &FailoverHandler{
+		primary:  primary,
+		fallback: fallback,
+		f:        &failover{opts: opts, root: primary},
+	}
+}
+
+func (f *failover) now() time.Time {
+	if f.opts.Clock != nil {
+		return f.opts.Clock()
+	}
+	return time.Now()
+}
+
+func (h *FailoverHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.primary.Enabled(ctx, level)
+}
+
+func (h *FailoverHandler) Handle(ctx context.Context, r slog.Record) error {
+	f := h.f
+	if open, err := f.open(); open {
+		return h.handleFallback(ctx, r, err)
+	}
+	err := h.primary.Handle(ctx, r.Clone())
+	if err == nil {
+		return f.succeeded(ctx)
+	}
+	f.failed(err)
+	return h.handleFallback(ctx, r, err)
+}
+
+// open reports whether the breaker is open, the record going straight to
+// the fallback handler, with the last error of the primary handler. Once
+// in each probe interval, it lets one record through.
+func (f *failover) open() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.opts.Threshold <= 0 || f.failures < f.opts.Threshold {
+		return false, nil
+	}
+	now := f.now()
+	if now.Before(f.probeAt) {
+		return true, f.lastErr
+	}
+	f.probeAt = now.Add(f.opts.ProbeInterval)
+	return false, nil
+}
+
+// failed counts a failure of the primary handler.
+func (f *failover) failed(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures++
+	f.lastErr, f.lastErrAt = err, f.now()
+	if f.failures == f.opts.Threshold {
+		f.probeAt = f.lastErrAt.Add(f.opts.ProbeInterval)
+	}
+}
+
+// succeeded resets the failures of the primary handler, passing it the
+// record of its recovery if it had failed.
+func (f *failover) succeeded(ctx context.Context) error {
+	f.mu.Lock()
+	failures := f.failures
+	f.failures = 0
+	f.lastErr = nil
+	f.mu.Unlock()
+	if failures == 0 {
+		return nil
+	}
+	r := slog.NewRecord(f.now(), LevelWarn.Level(), failoverRecoveredMessage, 0)
+	r.AddAttrs(Int("failures", failures))
+	return f.root.Handle(ctx, r)
+}
+
+// handleFallback passes r to the fallback handler, with the error of the
+// primary handler, which it returns if the fallback handler doesn't take
+// records of the level of r.
+func (h *FailoverHandler) handleFallback(ctx context.Context, r slog.Record, err error) error {
+	if !h.fallback.Enabled(ctx, r.Level) && !IsForced(ctx) {
+		return err
+	}
+	r = r.Clone()
+	r.AddAttrs(String(FailoverErrorKey, err.Error()))
+	if err2 := h.fallback.Handle(ctx, r); err2 != nil {
+		return errors.Join(err, err2)
+	}
+	return nil
+}
+
+func (h *FailoverHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &FailoverHandler{
+		primary:  h.primary.WithAttrs(attrs),
+		fallback: h.fallback.WithAttrs(attrs),
+		f:        h.f,
+	}
+}
+
+func (h *FailoverHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &FailoverHandler{
+		primary:  h.primary.WithGroup(name),
+		fallback: h.fallback.WithGroup(name),
+		f:        h.f,
+	}
+}
+
+// LogHealth reports whether the primary handler works.
+func (h *FailoverHandler) LogHealth() ComponentHealth {
+	f := h.f
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return ComponentHealth{
+		Name:          "failover",
+		Healthy:       f.failures == 0,
+		LastError:     f.lastErr,
+		LastErrorTime: f.lastErrAt,
+	}
+}
+
+// Handlers returns the primary and fallback handlers of h.
+func (h *FailoverHandler) Handlers() []Handler {
+	return []Handler{h.primary, h.fallback}
+}
@@ -0,0 +1,45 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestFailoverHandler(t *testing.T) {
+	primary := &flakyHandler{Handler: NewRingHandler(10), fail: true}
+	fallback := NewRingHandler(10)
+	h := NewFailoverHandler(primary, &levelHandler{Handler: fallback, level: slog.LevelWarn})
+	ctx := context.Background()
+
+	// A record the fallback handler takes is passed to it, with the error
+	// of the primary handler.
+	if err := h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelError, "saved", 0)); err != nil {
+		t.Errorf("Handle() = %v, want nil", err)
+	}
+	if fallback.Len() != 1 {
+		t.Fatalf("the fallback handler got %d records, want 1", fallback.Len())
+	}
+	if v, ok := attrValue(fallback.Records()[0], FailoverErrorKey); !ok || v.String() != "write failed" {
+		t.Errorf("%s = %v", FailoverErrorKey, v)
+	}
+
+	// A record below its level is lost: the error of the primary handler
+	// is returned.
+	err := h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelInfo, "lost", 0))
+	if err == nil || err.Error() != "write failed" {
+		t.Errorf("Handle() = %v, want the error of the primary handler", err)
+	}
+	if fallback.Len() != 1 {
+		t.Errorf("the fallback handler got %d records, want 1", fallback.Len())
+	}
+
+	// Both errors are returned when the fallback handler fails too.
+	failing := &flakyHandler{Handler: NewRingHandler(10), fail: true}
+	h = NewFailoverHandler(primary, failing)
+	err = h.Handle(ctx, slog.NewRecord(time.Time{}, slog.LevelError, "lost", 0))
+	if err == nil || err.Error() != "write failed\nwrite failed" {
+		t.Errorf("Handle() = %q, want both errors", err)
+	}
+}
@@ -0,0 +1,212 @@
+package log
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// fastTimeFormat is the clock-only layout used by FastTextHandler.
+const fastTimeFormat = "15:04:05.000000"
+
+// fastLabels are the labels of the levels in FastTextHandler.
+var fastLabels = map[Level]string{
+	LevelTrace: "TRC",
+	LevelDebug: "DBG",
+	LevelInfo:  "INF",
+	LevelWarn:  "WRN",
+	LevelError: "ERR",
+	LevelPanic: "PNC",
+	LevelFatal: "FTL",
+}
+
+// fastLevels returns the label of each level in its style.
+func fastLevels(c Colorizer) map[Level][]byte {
+	m := make(map[Level][]byte, len(fastLabels))
+	for level, label := range fastLabels {
+		var b []byte
+		b = append(b, c.Start(levelStyle(level))...)
+		b = append(b, label...)
+		b = append(b, c.Start(StyleReset)...)
+		m[level] = b
+	}
+	return m
+}
+
+// FastTextHandler is a reduced-fidelity text handler for very high record
+// rates, such as TRACE logging of a single component. Each record is one
+// line of the form
+//
+//	15:04:05.000000 LVL message key=value ...
+//
+// Only the level label is colored, when TextHandler would write colors:
+// see [HandlerOptions.ForceColor]. The time is printed without the date,
+// multi-line messages are not folded and stacks are not rendered as
+// blocks. Levels and ReplaceAttr behave as for [TextHandler].
+type FastTextHandler struct {
+	opts         HandlerOptions
+	preformatted []byte // data from WithAttrs
+	prefix       string // group names from WithGroup, dot-terminated
+	groups       []string
+	mu           *sync.Mutex
+	out          io.Writer
+	terminal     func() bool      // whether out writes to a terminal
+	noColorEnv   bool             // whether NO_COLOR was set when h was created
+	levels       map[Level][]byte // labels of the levels, in their style
+}
+
+// NewFastTextHandler creates a FastTextHandler that writes to out,
+// using the given options. If opts is nil, the default options are used.
+func NewFastTextHandler(out io.Writer, opts *slog.HandlerOptions) *FastTextHandler {
+	return NewFastTextHandlerWithOptions(out, handlerOptions(opts))
+}
+
+// NewFastTextHandlerWithOptions is like [NewFastTextHandler] but accepts
+// the extended options of this package.
+func NewFastTextHandlerWithOptions(out io.Writer, opts *HandlerOptions) *FastTextHandler {
+	h := &FastTextHandler{out: out, mu: &sync.Mutex{}}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelInfo
+	}
+	h.levels = fastLevels(h.opts.colorizer())
+	h.terminal = sync.OnceValue(func() bool { return isTerminal(out) })
+	if t, ok := out.(interface{ terminal() bool }); ok {
+		h.terminal = t.terminal
+	}
+	h.noColorEnv = noColorEnv()
+	return h
+}
+
+// colored reports whether h colors the level labels, deciding as
+// [TextHandler] does.
+func (h *FastTextHandler) colored() bool {
+	switch {
+	case h.opts.NoColor:
+		return false
+	case h.opts.ForceColor:
+		return true
+	}
+	return !h.noColorEnv && h.terminal()
+}
+
+func (h *FastTextHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *FastTextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+func (h *FastTextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.preformatted = slices.Clip(h.preformatted)
+	for _, a := range attrs {
+		h2.preformatted = h2.appendAttr(h2.preformatted, h.prefix, a)
+	}
+	return &h2
+}
+
+func (h *FastTextHandler) Handle(_ context.Context, r slog.Record) error {
+	bufp := allocBuf()
+	buf := *bufp
+	defer func() {
+		*bufp = buf
+		freeBuf(bufp)
+	}()
+	if !r.Time.IsZero() {
+		if a, ok := h.opts.builtin(slog.Time(slog.TimeKey, r.Time)); ok {
+			if a.Value.Kind() == slog.KindTime {
+				buf = a.Value.Time().AppendFormat(buf, fastTimeFormat)
+			} else {
+				buf = append(buf, a.Value.String()...)
+			}
+			buf = append(buf, ' ')
+		}
+	}
+	if a, ok := h.opts.builtin(slog.Any(slog.LevelKey, r.Level)); ok {
+		if l, isLevel := a.Value.Any().(slog.Level); isLevel {
+			level := parseSlogLevel(l)
+			if label, found := fastLabels[level]; !found {
+				buf = append(buf, level.String()...)
+			} else if h.colored() {
+				buf = append(buf, h.levels[level]...)
+			} else {
+				buf = append(buf, label...)
+			}
+		} else {
+			buf = append(buf, a.Value.String()...)
+		}
+		buf = append(buf, ' ')
+	}
+	if ev, ok := recordEvent(r); ok {
+		if a, ok := h.opts.builtin(ev); ok {
+			buf = append(buf, a.Key...)
+			buf = append(buf, '=')
+			buf = appendValue(buf, a.Value)
+			buf = append(buf, ' ')
+		}
+	}
+	if a, ok := h.opts.builtin(slog.String(slog.MessageKey, r.Message)); ok {
+		buf = append(buf, a.Value.String()...)
+	}
+	if d, ok := h.opts.uptime(); ok {
+		if a, ok := h.opts.builtin(slog.Duration(UptimeKey, d)); ok {
+			buf = append(buf, ' ')
+			buf = append(buf, a.Key...)
+			buf = append(buf, '=')
+			buf = appendValue(buf, a.Value)
+		}
+	}
+	buf = append(buf, h.preformatted...)
+	h.opts.attrsAfterEvent(r, func(a slog.Attr) bool {
+		buf = h.appendAttr(buf, h.prefix, a)
+		return true
+	})
+	buf = append(buf, '\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.out.Write(buf)
+	return err
+}
+
+func (h *FastTextHandler) appendAttr(buf []byte, prefix string, a slog.Attr) []byte {
+	a.Value = a.Value.Resolve()
+	a = h.opts.replaceGroup(h.groups, a)
+	if rep := h.opts.ReplaceAttr; rep != nil && a.Value.Kind() != slog.KindGroup {
+		a = rep(h.groups, a)
+		a.Value = a.Value.Resolve()
+	}
+	if a.Equal(slog.Attr{}) {
+		return buf
+	}
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			buf = h.appendAttr(buf, prefix, ga)
+		}
+		return buf
+	default:
+		buf = append(buf, ' ')
+		buf = append(buf, prefix...)
+		buf = append(buf, a.Key...)
+		buf = append(buf, '=')
+		return appendValue(buf, a.Value)
+	}
+}
@@ -0,0 +1,161 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+var fastTestTime = time.Date(2024, 6, 1, 12, 34, 56, 789012345, time.UTC)
+
+func TestFastTextHandlerFormat(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts HandlerOptions
+		h    func(slog.Handler) slog.Handler
+		r    func() slog.Record
+		want string
+	}{
+		{
+			name: "attrs",
+			r: func() slog.Record {
+				r := slog.NewRecord(fastTestTime, slog.LevelInfo, "request done", 0)
+				r.AddAttrs(slog.String("path", "/a b"), slog.Int("status", 200), slog.Duration("took", 1500*time.Millisecond))
+				return r
+			},
+			want: "12:34:56.789012 INF request done path=\"/a b\" status=200 took=1.5s\n",
+		},
+		{
+			name: "levels",
+			opts: HandlerOptions{HandlerOptions: slog.HandlerOptions{Level: LevelTrace.Level()}},
+			r: func() slog.Record {
+				return slog.NewRecord(fastTestTime, LevelTrace.Level(), "step", 0)
+			},
+			want: "12:34:56.789012 TRC step\n",
+		},
+		{
+			name: "level between the levels of the package",
+			r: func() slog.Record {
+				return slog.NewRecord(fastTestTime, LevelFatal.Level()+4, "worse", 0)
+			},
+			want: "12:34:56.789012 FATAL+1 worse\n",
+		},
+		{
+			name: "zero time",
+			r: func() slog.Record {
+				return slog.NewRecord(time.Time{}, slog.LevelWarn, "no time", 0)
+			},
+			want: "WRN no time\n",
+		},
+		{
+			name: "groups and WithAttrs",
+			h: func(h slog.Handler) slog.Handler {
+				return h.WithAttrs([]slog.Attr{slog.String("app", "api")}).WithGroup("req").WithAttrs([]slog.Attr{slog.Int("id", 7)})
+			},
+			r: func() slog.Record {
+				r := slog.NewRecord(fastTestTime, slog.LevelError, "failed", 0)
+				r.AddAttrs(slog.Group("user", slog.String("name", "ann")))
+				return r
+			},
+			want: "12:34:56.789012 ERR failed app=\"api\" req.id=7 req.user.name=\"ann\"\n",
+		},
+		{
+			name: "ReplaceAttr",
+			opts: HandlerOptions{HandlerOptions: slog.HandlerOptions{ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+				switch a.Key {
+				case slog.TimeKey, "secret":
+					return slog.Attr{}
+				}
+				return a
+			}}},
+			r: func() slog.Record {
+				r := slog.NewRecord(fastTestTime, slog.LevelInfo, "login", 0)
+				r.AddAttrs(slog.String("secret", "hunter2"), slog.Bool("ok", true))
+				return r
+			},
+			want: "INF login ok=true\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := tt.opts
+			opts.Colorizer = PlainColorizer{}
+			var h slog.Handler = NewFastTextHandlerWithOptions(&buf, &opts)
+			if tt.h != nil {
+				h = tt.h(h)
+			}
+			if err := h.Handle(context.Background(), tt.r()); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFastTextHandlerColors(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	colored := "12:34:56.789012 \x1b[93;1mWRN\x1b[0m low disk free=3\n"
+	plain := "12:34:56.789012 WRN low disk free=3\n"
+	for _, tt := range []struct {
+		name string
+		out  interface {
+			io.Writer
+			String() string
+		}
+		opts    HandlerOptions
+		noColor string
+		want    string
+	}{
+		// Only the label of the level is colored.
+		{"terminal", new(Terminal), HandlerOptions{}, "", colored},
+		{"not a terminal", new(bytes.Buffer), HandlerOptions{}, "", plain},
+		{"NO_COLOR", new(Terminal), HandlerOptions{}, "1", plain},
+		{"ForceColor", new(bytes.Buffer), HandlerOptions{ForceColor: true}, "1", colored},
+		{"NoColor", new(Terminal), HandlerOptions{NoColor: true, ForceColor: true}, "", plain},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			opts := tt.opts
+			opts.Colorizer = BasicANSIColorizer{}
+			h := NewFastTextHandlerWithOptions(tt.out, &opts)
+			r := slog.NewRecord(fastTestTime, slog.LevelWarn, "low disk", 0)
+			r.AddAttrs(slog.Int("free", 3))
+			h.Handle(context.Background(), r)
+			if got := tt.out.String(); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func benchmarkHandler(b *testing.B, h slog.Handler) {
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := slog.NewRecord(fastTestTime, LevelTrace.Level(), "entering step", 0)
+		r.AddAttrs(slog.String("step", "parse"), slog.Int("n", i), slog.Bool("cached", false))
+		h.Handle(ctx, r)
+	}
+}
+
+func BenchmarkFastTextHandler(b *testing.B) {
+	benchmarkHandler(b, NewFastTextHandlerWithOptions(io.Discard, &HandlerOptions{
+		HandlerOptions: slog.HandlerOptions{Level: LevelTrace.Level()},
+		Colorizer:      BasicANSIColorizer{},
+		ForceColor:     true,
+	}))
+}
+
+func BenchmarkTextHandler(b *testing.B) {
+	benchmarkHandler(b, NewTextHandlerWithOptions(io.Discard, &HandlerOptions{
+		HandlerOptions: slog.HandlerOptions{Level: LevelTrace.Level()},
+		Colorizer:      BasicANSIColorizer{},
+		ForceColor:     true,
+	}))
+}
@@ -0,0 +1,143 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+)
+
+// FilterHandler passes to a handler only the records accepted by a
+// predicate, to drop whole records, such as those of health checks,
+// which ReplaceAttr can only strip of their attributes:
+//
+//	h := log.NewFilterHandler(next, log.FilterByAttr("path", func(v slog.Value) bool {
+//		return v.String() != "/healthz"
+//	}))
+//
+// The predicate sees the record with the attributes added with WithAttrs
+// ahead of its own, in the groups opened with WithGroup, as the handler
+// would render it: the event of the record, if any, stays at the top
+// level. Records logged with [Logger.Always] are not filtered.
+type FilterHandler struct {
+	next   slog.Handler
+	fn     func(ctx context.Context, r slog.Record) bool
+	attrs  []slog.Attr // from WithAttrs, in their groups
+	groups []string    // groups from WithGroup
+}
+
+// NewFilterHandler returns a FilterHandler passing to next the records for
+// which fn returns true. If fn is nil, all records are passed.
+func NewFilterHandler(next slog.Handler, fn func(ctx context.Context, r slog.Record) bool) *FilterHandler {
+	return &FilterHandler{next: next, fn: fn}
+}
+
+func (h *FilterHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *FilterHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.fn != nil && !IsForced(ctx) && !h.fn(ctx, h.record(r)) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// record returns r as seen by the predicate, with the attributes of h.
+func (h *FilterHandler) record(r slog.Record) slog.Record {
+	if len(h.attrs) == 0 && len(h.groups) == 0 {
+		return r
+	}
+	r2 := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r2.AddAttrs(h.attrs...)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	if i := slices.IndexFunc(attrs, func(a slog.Attr) bool { return a.Key == EventKey }); i >= 0 {
+		r2.AddAttrs(attrs[i])
+		attrs = slices.Delete(attrs, i, i+1)
+	}
+	r2.AddAttrs(inGroups(h.groups, attrs)...)
+	return r2
+}
+
+// inGroups returns attrs nested in groups, outermost first.
+func inGroups(groups []string, attrs []slog.Attr) []slog.Attr {
+	if len(attrs) == 0 {
+		return nil
+	}
+	for i := len(groups) - 1; i >= 0; i-- {
+		attrs = []slog.Attr{{Key: groups[i], Value: slog.GroupValue(attrs...)}}
+	}
+	return attrs
+}
+
+func (h *FilterHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.next = h.next.WithAttrs(attrs)
+	h2.attrs = append(slices.Clip(h.attrs), inGroups(h.groups, attrs)...)
+	return &h2
+}
+
+func (h *FilterHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.next = h.next.WithGroup(name)
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+// Unwrap returns the handler wrapped by h.
+func (h *FilterHandler) Unwrap() Handler {
+	return h.next
+}
+
+// FilterByAttr returns a predicate for [NewFilterHandler] accepting the
+// records that have no attribute with the given key, or one whose value
+// match accepts. Keys of attributes in groups are those of the groups and
+// the attribute joined by dots, as in "req.path". Values are resolved
+// before match sees them.
+func FilterByAttr(key string, match func(slog.Value) bool) func(ctx context.Context, r slog.Record) bool {
+	return func(_ context.Context, r slog.Record) bool {
+		ok := true
+		r.Attrs(func(a slog.Attr) bool {
+			ok = filterAttr(key, "", a, match)
+			return ok
+		})
+		return ok
+	}
+}
+
+// FilterByEvent returns a predicate for [NewFilterHandler] accepting the
+// records without an event, and those whose event name match accepts.
+// See [Event].
+func FilterByEvent(match func(name string) bool) func(ctx context.Context, r slog.Record) bool {
+	return func(_ context.Context, r slog.Record) bool {
+		ev, ok := recordEvent(r)
+		return !ok || match(ev.Value.Resolve().String())
+	}
+}
+
+// filterAttr reports whether a, with the groups in prefix, is accepted:
+// it does not have the key, or match accepts its value.
+func filterAttr(key, prefix string, a slog.Attr, match func(slog.Value) bool) bool {
+	v := a.Value.Resolve()
+	if v.Kind() != slog.KindGroup {
+		return prefix+a.Key != key || match(v)
+	}
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, ga := range v.Group() {
+		if !filterAttr(key, prefix, ga, match) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,474 @@
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"slices"
+	"time"
+)
+
+// Defaults of FluentOptions.
+const (
+	fluentTag           = "app"
+	fluentBatchSize     = 100
+	fluentQueueSize     = 1000
+	fluentFlushInterval = time.Second
+	fluentAckTimeout    = 10 * time.Second
+	fluentMaxRetries    = 3
+	fluentMinBackoff    = 500 * time.Millisecond
+	fluentMaxBackoff    = 30 * time.Second
+)
+
+// Keys of the record fields of a FluentHandler.
+const (
+	FluentMessageKey = "message"
+	FluentLevelKey   = "level"
+)
+
+// FluentOptions are options for a [FluentHandler].
+type FluentOptions struct {
+	HandlerOptions
+
+	// Tag is the tag of the events, by which Fluentd routes them. If
+	// empty, "app" is used.
+	Tag string
+
+	// BatchSize is the largest number of events sent in one message.
+	// If zero, 100 is used.
+	BatchSize int
+
+	// QueueSize is the number of records the handler holds before they
+	// are sent. If zero, 1000 is used.
+	QueueSize int
+
+	// FlushInterval is how long a record may wait for its batch to fill
+	// up before it is sent anyway. If zero, a second is used.
+	FlushInterval time.Duration
+
+	// RequireAck asks the server to acknowledge each message, for
+	// at-least-once delivery: a message not acknowledged within
+	// AckTimeout, ten seconds if zero, is sent again.
+	RequireAck bool
+	AckTimeout time.Duration
+
+	// MaxRetries is the number of times a message is sent again when the
+	// server couldn't be reached, or didn't acknowledge it, waiting longer
+	// each time, from MinBackoff to MaxBackoff, before it is dropped. If
+	// zero, 3 is used; if negative, messages are not sent again. Without
+	// RequireAck, the connection holds the messages instead, as set with
+	// NetBuffer in Net.
+	MaxRetries int
+	MinBackoff time.Duration // if zero, half a second
+	MaxBackoff time.Duration // if zero, 30 seconds
+
+	// Block makes Handle wait for room in a full queue, until its context
+	// is done, instead of dropping the record.
+	Block bool
+
+	// Net are the options of the connection. See [NewNetWriter].
+	Net []NetWriterOption
+
+	// Drops, if set, counts the records dropped from a full queue under
+	// DropQueue, and those of the messages given up on under DropFailed.
+	// See [Drops].
+	Drops *Drops
+
+	// OnError, if set, is called with the errors met sending a message.
+	OnError func(err error)
+}
+
+// FluentHandler sends records to Fluentd or Fluent Bit with the forward
+// protocol, in MessagePack. Each record is an event of Tag, with the time
+// of the record, in nanoseconds, and a map of its fields: the message
+// under FluentMessageKey, the level under FluentLevelKey, as named by
+// [Level.String], the source with AddSource, and the attributes, groups
+// being nested maps:
+//
+//	{"message": "request", "level": "INFO", "req": {"method": "GET", "status": 200}}
+//
+// Records are encoded by Handle and queued, then sent in batches by a
+// background goroutine, in PackedForward mode, when a batch is full or
+// FlushInterval after its first record. The connection is a [NetWriter],
+// which dials again when it breaks. With RequireAck, each message carries
+// a chunk id the server must send back, and is sent again until it does.
+// A record at LevelPanic or above is sent at once, with the records queued
+// before it, Handle waiting until they are sent. Close sends the records
+// queued and stops the handler.
+//
+// A FluentHandler is registered with [RegisterFlusher] until closed.
+type FluentHandler struct {
+	opts   *FluentOptions
+	e      *fluentExporter
+	attrs  []slog.Attr // from WithAttrs, processed, in their groups
+	groups []string    // from WithGroup
+}
+
+// fluentExporter sends the events of a FluentHandler, queued encoded.
+type fluentExporter struct {
+	*batchExporter[[]byte]
+	opts *FluentOptions
+	w    *NetWriter
+}
+
+// NewFluentHandler returns a FluentHandler sending records to the server
+// listening on addr, with network "tcp" or "unix", and starts its sending
+// goroutine. It dials when the first batch is sent.
+func NewFluentHandler(network, addr string, opts *FluentOptions) *FluentHandler {
+	o := new(FluentOptions)
+	if opts != nil {
+		*o = *opts
+	}
+	if o.Level == nil {
+		o.Level = slog.LevelInfo
+	}
+	if o.Tag == "" {
+		o.Tag = fluentTag
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = fluentBatchSize
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = fluentQueueSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = fluentFlushInterval
+	}
+	if o.AckTimeout <= 0 {
+		o.AckTimeout = fluentAckTimeout
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = fluentMaxRetries
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = fluentMinBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = fluentMaxBackoff
+	}
+	e := &fluentExporter{opts: o, w: NewNetWriter(network, addr, o.Net...)}
+	e.batchExporter = newBatchExporter(batchOptions{
+		BatchSize:     o.BatchSize,
+		QueueSize:     o.QueueSize,
+		FlushInterval: o.FlushInterval,
+		MaxRetries:    o.MaxRetries,
+		MinBackoff:    o.MinBackoff,
+		MaxBackoff:    o.MaxBackoff,
+		Block:         o.Block,
+		Drops:         o.Drops,
+		OnError:       o.OnError,
+	}, e.send)
+	h := &FluentHandler{opts: o, e: e}
+	e.unregister = RegisterFlusher(h)
+	return h
+}
+
+func (h *FluentHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *FluentHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+func (h *FluentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	var fields []slog.Attr
+	for _, a := range attrs {
+		if a, ok := h.opts.field(h.groups, a); ok {
+			fields = append(fields, a)
+		}
+	}
+	h2 := *h
+	h2.attrs = append(slices.Clip(h.attrs), inGroups(h.groups, fields)...)
+	return &h2
+}
+
+func (h *FluentHandler) Handle(ctx context.Context, r slog.Record) error {
+	e := h.e
+	if e.closed.Load() {
+		return net.ErrClosed
+	}
+	fields := []slog.Attr{
+		slog.String(FluentMessageKey, r.Message),
+		slog.String(FluentLevelKey, levelToString(r.Level)),
+	}
+	if h.opts.AddSource && r.PC != 0 {
+		fields = append(fields, slog.String(slog.SourceKey, h.opts.source(r.PC)))
+	}
+	fields = append(fields, h.attrs...)
+	var attrs []slog.Attr
+	h.opts.recordAttrs(r, func(a slog.Attr) bool {
+		if a, ok := h.opts.field(h.groups, a); ok {
+			attrs = append(attrs, a)
+		}
+		return true
+	})
+	fields = append(fields, inGroups(h.groups, attrs)...)
+
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	// An event is [time, record], the time as an EventTime extension.
+	event := append([]byte(nil), 0x92, 0xd7, 0x00)
+	event = binary.BigEndian.AppendUint32(event, uint32(t.Unix()))
+	event = binary.BigEndian.AppendUint32(event, uint32(t.Nanosecond()))
+	event = appendMsgpackMap(event, fields)
+	return e.enqueue(ctx, r.Level, event)
+}
+
+// fluentFields returns attrs with the groups without a key inlined, and
+// those of the same key merged, as keys of a map must be unique.
+func fluentFields(fields, attrs []slog.Attr) []slog.Attr {
+	for _, a := range attrs {
+		if a.Value.Kind() != slog.KindGroup {
+			fields = append(fields, a)
+			continue
+		}
+		if a.Key == "" {
+			fields = fluentFields(fields, a.Value.Group())
+			continue
+		}
+		i := slices.IndexFunc(fields, func(f slog.Attr) bool {
+			return f.Key == a.Key && f.Value.Kind() == slog.KindGroup
+		})
+		if i < 0 {
+			fields = append(fields, a)
+			continue
+		}
+		group := append(slices.Clip(fields[i].Value.Group()), a.Value.Group()...)
+		fields[i].Value = slog.GroupValue(group...)
+	}
+	return fields
+}
+
+// appendMsgpackMap appends attrs as a MessagePack map, groups being
+// nested maps.
+func appendMsgpackMap(buf []byte, attrs []slog.Attr) []byte {
+	fields := fluentFields(nil, attrs)
+	buf = appendMsgpackHeader(buf, len(fields), 0x80, 0xdf)
+	for _, a := range fields {
+		buf = appendMsgpackString(buf, a.Key)
+		buf = appendMsgpackValue(buf, a.Value)
+	}
+	return buf
+}
+
+// appendMsgpackValue appends v in MessagePack.
+func appendMsgpackValue(buf []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindString:
+		return appendMsgpackString(buf, v.String())
+	case slog.KindInt64:
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(v.Int64()))
+	case slog.KindUint64:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), v.Uint64())
+	case slog.KindFloat64:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(v.Float64()))
+	case slog.KindBool:
+		if v.Bool() {
+			return append(buf, 0xc3)
+		}
+		return append(buf, 0xc2)
+	case slog.KindDuration:
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(v.Duration()))
+	case slog.KindTime:
+		return appendMsgpackString(buf, v.Time().Format(time.RFC3339Nano))
+	case slog.KindGroup:
+		return appendMsgpackMap(buf, v.Group())
+	}
+	if isNil(v.Any()) {
+		return append(buf, 0xc0)
+	}
+	switch x := v.Any().(type) {
+	case error:
+		return appendMsgpackString(buf, errorText(x))
+	case []byte:
+		return appendMsgpackBin(buf, x)
+	}
+	return appendMsgpackString(buf, string(appendValue(nil, v)))
+}
+
+// appendMsgpackHeader appends the header of an array or map of n
+// elements, given its fix and 32-bit type bytes, the 16-bit one following
+// the latter.
+func appendMsgpackHeader(buf []byte, n int, fix, typ32 byte) []byte {
+	switch {
+	case n < 16:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, typ32-1), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, typ32), uint32(n))
+	}
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(n))
+	}
+	return append(buf, s...)
+}
+
+func appendMsgpackBin(buf []byte, b []byte) []byte {
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xc5), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xc6), uint32(n))
+	}
+	return append(buf, b...)
+}
+
+// send sends one batch as a PackedForward message, and reports whether it
+// may be sent again if it failed: if it must be acknowledged, and the
+// connection is not closed.
+func (e *fluentExporter) send(_ context.Context, batch [][]byte) (retry bool, err error) {
+	var entries []byte
+	for _, event := range batch {
+		entries = append(entries, event...)
+	}
+	msg := appendMsgpackHeader(nil, 3, 0x90, 0xdd)
+	msg = appendMsgpackString(msg, e.opts.Tag)
+	msg = appendMsgpackBin(msg, entries)
+	var chunk string
+	if e.opts.RequireAck {
+		var id [16]byte
+		rand.Read(id[:])
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+		msg = append(msg, 0x82)
+		msg = appendMsgpackString(msg, "size")
+		msg = binary.BigEndian.AppendUint64(append(msg, 0xcf), uint64(len(batch)))
+		msg = appendMsgpackString(msg, "chunk")
+		msg = appendMsgpackString(msg, chunk)
+	} else {
+		msg = append(msg, 0x81)
+		msg = appendMsgpackString(msg, "size")
+		msg = binary.BigEndian.AppendUint64(append(msg, 0xcf), uint64(len(batch)))
+	}
+
+	if !e.opts.RequireAck {
+		_, err = e.w.Write(msg)
+		return false, err
+	}
+	err = e.w.exchange(msg, func(conn net.Conn) error {
+		return readFluentAck(conn, chunk, e.opts.AckTimeout)
+	})
+	return !errors.Is(err, net.ErrClosed), err
+}
+
+// readFluentAck reads the answer of the server to the message of chunk,
+// a map whose "ack" is chunk.
+func readFluentAck(conn net.Conn, chunk string, timeout time.Duration) error {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+	var buf []byte
+	var b [256]byte
+	for {
+		n, err := conn.Read(b[:])
+		buf = append(buf, b[:n]...)
+		if ack, ok := parseFluentAck(buf); ok {
+			if ack != chunk {
+				return fmt.Errorf("log: Fluent ack %q for chunk %q", ack, chunk)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseFluentAck parses the answer of the server, a map of strings, and
+// returns its "ack". It reports false if the answer is incomplete.
+func parseFluentAck(buf []byte) (ack string, ok bool) {
+	// str reads a string at buf[i:], returning it and the index past it.
+	str := func(i int) (string, int, bool) {
+		if i >= len(buf) {
+			return "", 0, false
+		}
+		var n int
+		switch c := buf[i]; {
+		case c&0xe0 == 0xa0:
+			n, i = int(c&0x1f), i+1
+		case c == 0xd9 && i+2 <= len(buf):
+			n, i = int(buf[i+1]), i+2
+		case c == 0xda && i+3 <= len(buf):
+			n, i = int(binary.BigEndian.Uint16(buf[i+1:])), i+3
+		default:
+			return "", 0, false
+		}
+		if i+n > len(buf) {
+			return "", 0, false
+		}
+		return string(buf[i : i+n]), i + n, true
+	}
+	if len(buf) == 0 || buf[0]&0xf0 != 0x80 {
+		return "", false
+	}
+	i := 1
+	for pairs := int(buf[0] & 0x0f); pairs > 0; pairs-- {
+		key, j, ok := str(i)
+		if !ok {
+			return "", false
+		}
+		value, j, ok := str(j)
+		if !ok {
+			return "", false
+		}
+		if key == "ack" {
+			ack = value
+		}
+		i = j
+	}
+	return ack, true
+}
+
+// Flush sends the records queued, waiting until they are sent or ctx is
+// done.
+func (h *FluentHandler) Flush(ctx context.Context) error {
+	return h.e.flush(ctx)
+}
+
+// Close sends the records queued, stops the handler and closes the
+// connection, waiting for the records for 30 seconds at most. Records
+// handled afterwards return net.ErrClosed.
+func (h *FluentHandler) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), batchCloseTimeout)
+	defer cancel()
+	err := h.e.close(ctx)
+	return errors.Join(err, h.e.w.Close())
+}
+
+// LogHealth reports the state of the queue and of the connection.
+func (h *FluentHandler) LogHealth() ComponentHealth {
+	e := h.e
+	health := e.w.LogHealth()
+	health.Name = "fluent"
+	health.Healthy = health.Healthy && !e.closed.Load() && len(e.queue) < cap(e.queue)
+	health.QueueDepth, health.QueueCapacity = len(e.queue), cap(e.queue)
+	return health
+}
@@ -0,0 +1,276 @@
+package log
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fluentServer is a Fluentd server recording the messages sent to it. It
+// acknowledges them when asked to, unless refuse is set, then closing the
+// connection instead.
+type fluentServer struct {
+	ln      net.Listener
+	release chan struct{} // if set, acks wait until it is closed
+
+	mu       sync.Mutex
+	refuse   int // acks left to refuse
+	arrived  int
+	messages []string // the messages of the events of each message
+}
+
+func newFluentServer(t *testing.T) *fluentServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fluentServer{ln: ln}
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		ln.Close()
+		wg.Wait()
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer conn.Close()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *fluentServer) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		msgs, chunk, err := readFluentMessage(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.arrived++
+		refuse := s.refuse > 0
+		if refuse {
+			s.refuse--
+		} else {
+			s.messages = append(s.messages, msgs)
+		}
+		s.mu.Unlock()
+		if chunk == "" {
+			continue
+		}
+		if refuse {
+			return
+		}
+		if s.release != nil {
+			<-s.release
+		}
+		ack := appendMsgpackString(append([]byte(nil), 0x81), "ack")
+		if _, err := conn.Write(appendMsgpackString(ack, chunk)); err != nil {
+			return
+		}
+	}
+}
+
+// received returns the messages received and acknowledged, if asked to,
+// and the number of messages received.
+func (s *fluentServer) received() ([]string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...), s.arrived
+}
+
+func (s *fluentServer) waitArrived(t *testing.T, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, arrived := s.received(); arrived >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no message received")
+		}
+	}
+}
+
+// readFluentMessage reads a PackedForward message, and returns the
+// messages of its events, joined by commas, and its chunk.
+func readFluentMessage(r *bufio.Reader) (msgs, chunk string, err error) {
+	next := func(n int) []byte {
+		if err != nil {
+			return nil
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return b
+	}
+	str := func() string {
+		b := next(1)
+		switch {
+		case err != nil:
+			return ""
+		case b[0]&0xe0 == 0xa0:
+			return string(next(int(b[0] & 0x1f)))
+		case b[0] == 0xd9:
+			return string(next(int(next(1)[0])))
+		}
+		err = fmt.Errorf("string type %#x", b[0])
+		return ""
+	}
+	if b := next(1); err == nil && b[0] != 0x93 {
+		return "", "", fmt.Errorf("message type %#x", b[0])
+	}
+	str() // tag
+	var entries []byte
+	switch b := next(1); {
+	case err != nil:
+	case b[0] == 0xc4:
+		entries = next(int(next(1)[0]))
+	case b[0] == 0xc5:
+		entries = next(int(binary.BigEndian.Uint16(next(2))))
+	default:
+		return "", "", fmt.Errorf("entries type %#x", b[0])
+	}
+	options := next(1)
+	for i := 0; err == nil && i < int(options[0]&0x0f); i++ {
+		switch str() {
+		case "size":
+			next(9)
+		case "chunk":
+			chunk = str()
+		}
+	}
+	if err != nil {
+		return "", "", err
+	}
+	// The message is the first field of each event.
+	var list []string
+	for _, e := range strings.Split(string(entries), "\xa7message")[1:] {
+		list = append(list, e[1:1+int(e[0]&0x1f)])
+	}
+	return strings.Join(list, ","), chunk, nil
+}
+
+func newTestFluent(t *testing.T, s *fluentServer, opts FluentOptions) *FluentHandler {
+	t.Helper()
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = time.Hour
+	}
+	if opts.MinBackoff == 0 {
+		opts.MinBackoff = time.Millisecond
+	}
+	opts.Net = append(opts.Net, NetBackoff(time.Millisecond, time.Millisecond))
+	h := NewFluentHandler("tcp", s.ln.Addr().String(), &opts)
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestFluentHandlerBatches(t *testing.T) {
+	for _, ack := range []bool{false, true} {
+		t.Run(fmt.Sprint("ack=", ack), func(t *testing.T) {
+			s := newFluentServer(t)
+			h := newTestFluent(t, s, FluentOptions{BatchSize: 2, RequireAck: ack})
+			l := slog.New(h)
+			for _, msg := range []string{"a", "b", "c"} {
+				l.Info(msg)
+			}
+			if err := h.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			s.waitArrived(t, 2)
+			if msgs, _ := s.received(); fmt.Sprint(msgs) != "[a,b c]" {
+				t.Errorf("messages = %q", msgs)
+			}
+		})
+	}
+}
+
+// A message not acknowledged is sent again, then dropped.
+func TestFluentHandlerRetry(t *testing.T) {
+	s := newFluentServer(t)
+	s.refuse = 2
+	drops := new(Drops)
+	h := newTestFluent(t, s, FluentOptions{RequireAck: true, AckTimeout: time.Second, MaxRetries: 2, Drops: drops})
+	slog.New(h).Info("retried")
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, n := s.received(); n != 3 || fmt.Sprint(msgs) != "[retried]" {
+		t.Errorf("%d messages received, acknowledged %q", n, msgs)
+	}
+
+	s.mu.Lock()
+	s.refuse = 3
+	s.mu.Unlock()
+	slog.New(h).Info("lost")
+	if err := h.Flush(context.Background()); err == nil {
+		t.Error("Flush: no error")
+	}
+	if _, n := s.received(); n != 6 {
+		t.Errorf("%d messages received, want 6", n)
+	}
+	if a, ok := drops.take(); !ok || a.String() != "dropped=[failed=1]" {
+		t.Errorf("drops = %v", a)
+	}
+}
+
+func TestFluentHandlerClose(t *testing.T) {
+	s := newFluentServer(t)
+	h := newTestFluent(t, s, FluentOptions{RequireAck: true})
+	slog.New(h).Info("queued")
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, _ := s.received(); fmt.Sprint(msgs) != "[queued]" {
+		t.Errorf("messages = %q", msgs)
+	}
+	if err := h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "late", 0)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Handle after Close: %v", err)
+	}
+	if err := h.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestFluentHandlerBlock(t *testing.T) {
+	s := newFluentServer(t)
+	s.release = make(chan struct{})
+	h := newTestFluent(t, s, FluentOptions{RequireAck: true, BatchSize: 1, QueueSize: 1, Block: true})
+	l := slog.New(h)
+	l.Info("sending")
+	s.waitArrived(t, 1)
+	l.Info("queued")
+	blocked := make(chan error)
+	go func() {
+		blocked <- h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "blocked", 0))
+	}()
+	closed := make(chan error)
+	go func() { closed <- h.Close() }()
+	if err := <-blocked; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("blocked Handle: %v", err)
+	}
+	close(s.release)
+	if err := <-closed; err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if msgs, _ := s.received(); fmt.Sprint(msgs) != "[sending queued]" {
+		t.Errorf("messages = %q", msgs)
+	}
+}
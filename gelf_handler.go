@@ -0,0 +1,249 @@
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// gelfChunkSize is the default size of the UDP chunks of a GELFHandler,
+// which fits the usual Ethernet MTU.
+const gelfChunkSize = 1420
+
+// gelfMaxChunks is the number of chunks a GELF message can be split into.
+const gelfMaxChunks = 128
+
+// ErrGELFTooLarge is returned by a GELFHandler for a record too large to
+// be sent over UDP, even in chunks.
+var ErrGELFTooLarge = errors.New("log: GELF message too large")
+
+// GELFOptions are options for a [GELFHandler].
+type GELFOptions struct {
+	HandlerOptions
+
+	// Host is the host field of the messages. If empty, the name reported
+	// by os.Hostname is used.
+	Host string
+
+	// ChunkSize is the largest UDP datagram sent; longer messages are
+	// split into chunks. If zero, 1420 bytes are used.
+	ChunkSize int
+
+	// OnError, if set, is called with the errors met sending a record,
+	// in addition to their being returned by Handle.
+	OnError func(err error)
+}
+
+// GELFHandler sends records to Graylog as GELF 1.1 messages, over UDP or
+// TCP:
+//
+//	{"version":"1.1","host":"web-1","short_message":"hello","timestamp":1717243200.000,"level":6,"_user":"alice"}
+//
+// The first line of the message is the short_message, and the whole
+// message, if longer, the full_message. The levels of this package map to
+// the syslog severities as for [SyslogHandler]. Attributes are sent as
+// additional fields, prefixed with "_", groups joining their key with a
+// dot, as in "_req.id". GELF reserves "_id", so an attribute named "id"
+// outside of any group is sent as "__id". Numbers are sent as numbers and
+// all other values as strings.
+//
+// Over UDP, messages longer than ChunkSize are sent in chunks. Over TCP,
+// they are terminated by a null byte; when sending fails, the handler
+// reconnects and tries once more. A GELFHandler is safe for concurrent
+// use.
+type GELFHandler struct {
+	opts         GELFOptions
+	conn         *netConn
+	preformatted []byte // additional fields from WithAttrs
+	prefix       string // group names from WithGroup, dot-terminated
+	groups       []string
+}
+
+// NewGELFHandler connects to the GELF input listening on addr, with
+// network "udp" or "tcp", and returns a GELFHandler sending records to it.
+// If opts is nil, the default options are used.
+func NewGELFHandler(network, addr string, opts *GELFOptions) (*GELFHandler, error) {
+	h := &GELFHandler{}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelInfo
+	}
+	if h.opts.Host == "" {
+		h.opts.Host, _ = os.Hostname()
+	}
+	if h.opts.ChunkSize <= 0 {
+		h.opts.ChunkSize = gelfChunkSize
+	}
+	conn, err := newNetConn("gelf", func() (net.Conn, error) {
+		return net.Dial(network, addr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	h.conn = conn
+	return h, nil
+}
+
+func (h *GELFHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *GELFHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+func (h *GELFHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.preformatted = slices.Clip(h.preformatted)
+	for _, a := range attrs {
+		h2.preformatted = h.appendAttr(h2.preformatted, h.prefix, h.groups, a)
+	}
+	return &h2
+}
+
+func (h *GELFHandler) Handle(_ context.Context, r slog.Record) error {
+	bufp := allocBuf()
+	buf := *bufp
+	defer func() {
+		*bufp = buf
+		freeBuf(bufp)
+	}()
+	buf = append(buf, `{"version":"1.1","host":`...)
+	buf = appendJSONString(buf, h.opts.Host)
+	short, _, multiline := strings.Cut(r.Message, "\n")
+	buf = append(buf, `,"short_message":`...)
+	buf = appendJSONString(buf, short)
+	if multiline {
+		buf = append(buf, `,"full_message":`...)
+		buf = appendJSONString(buf, r.Message)
+	}
+	if !r.Time.IsZero() {
+		// Seconds since the epoch, with milliseconds.
+		buf = append(buf, `,"timestamp":`...)
+		buf = strconv.AppendFloat(buf, float64(r.Time.UnixMilli())/1e3, 'f', 3, 64)
+	}
+	buf = append(buf, `,"level":`...)
+	buf = strconv.AppendInt(buf, int64(syslogSeverity(r.Level)), 10)
+	if h.opts.AddSource {
+		buf = appendGELFField(buf, "", slog.SourceKey, slog.StringValue(h.opts.source(r.PC)))
+	}
+	buf = append(buf, h.preformatted...)
+	h.opts.recordAttrs(r, func(a slog.Attr) bool {
+		buf = h.appendAttr(buf, h.prefix, h.groups, a)
+		return true
+	})
+	buf = append(buf, '}')
+
+	err := h.conn.write(func(conn net.Conn) error {
+		if isStream(conn) {
+			_, err := conn.Write(append(buf, 0))
+			return err
+		}
+		return h.writeChunks(conn, buf)
+	})
+	if err != nil && h.opts.OnError != nil {
+		h.opts.OnError(err)
+	}
+	return err
+}
+
+// writeChunks sends msg as one datagram, or as GELF chunks if it is
+// longer than the chunk size.
+func (h *GELFHandler) writeChunks(conn net.Conn, msg []byte) error {
+	if len(msg) <= h.opts.ChunkSize {
+		_, err := conn.Write(msg)
+		return err
+	}
+	// Each chunk has a 12-byte header: magic bytes, message ID, sequence
+	// number and count.
+	size := h.opts.ChunkSize - 12
+	if size <= 0 {
+		return ErrGELFTooLarge
+	}
+	count := (len(msg) + size - 1) / size
+	if count > gelfMaxChunks {
+		return ErrGELFTooLarge
+	}
+	chunk := make([]byte, 12, h.opts.ChunkSize)
+	chunk[0], chunk[1] = 0x1e, 0x0f
+	if _, err := rand.Read(chunk[2:10]); err != nil {
+		return err
+	}
+	chunk[11] = byte(count)
+	for i := 0; i < count; i++ {
+		chunk[10] = byte(i)
+		end := min(len(msg), (i+1)*size)
+		if _, err := conn.Write(append(chunk[:12], msg[i*size:end]...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendAttr appends the additional fields of a, in the groups of prefix.
+func (h *GELFHandler) appendAttr(buf []byte, prefix string, groups []string, a slog.Attr) []byte {
+	a, ok := h.opts.field(groups, a)
+	if !ok {
+		return buf
+	}
+	return flattenAttr(buf, prefix, a, func(buf []byte, prefix string, a slog.Attr) []byte {
+		return appendGELFField(buf, prefix, a.Key, a.Value)
+	})
+}
+
+// appendGELFField appends v as the additional field named after key and
+// the groups in prefix.
+func appendGELFField(buf []byte, prefix, key string, v slog.Value) []byte {
+	name := prefix + key
+	if name == "id" {
+		name = "_id"
+	}
+	buf = append(buf, `,"_`...)
+	// Field names may only hold letters, digits, '_', '.' and '-'.
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '_', c == '.', c == '-':
+		default:
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	buf = append(buf, `":`...)
+	switch v.Kind() {
+	case slog.KindInt64, slog.KindUint64, slog.KindFloat64, slog.KindDuration:
+		return appendJSONValue(buf, v)
+	case slog.KindString:
+		return appendJSONString(buf, v.String())
+	default:
+		return appendJSONString(buf, string(appendValue(nil, v)))
+	}
+}
+
+// Close closes the connection to Graylog. Records handled afterwards
+// return net.ErrClosed.
+func (h *GELFHandler) Close() error {
+	return h.conn.close()
+}
+
+// LogHealth reports the state of the connection to Graylog.
+func (h *GELFHandler) LogHealth() ComponentHealth {
+	return h.conn.health()
+}
@@ -0,0 +1,192 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestGELF(t *testing.T, network, addr string, opts GELFOptions) *GELFHandler {
+	t.Helper()
+	opts.Host = "web-1"
+	h, err := NewGELFHandler(network, addr, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// gelfRecord logs a record through h, with a message of n bytes after its
+// first line.
+func gelfRecord(t *testing.T, h slog.Handler, n int) error {
+	t.Helper()
+	r := slog.NewRecord(time.UnixMilli(1717243200123), slog.LevelWarn, "hello\n"+strings.Repeat("x", n), 0)
+	r.AddAttrs(slog.Int("id", 7), slog.Group("user", slog.String("name", "ann"), slog.Duration("age", time.Second)))
+	return h.WithAttrs([]slog.Attr{slog.Bool("cached", true)}).WithGroup("req").Handle(context.Background(), r)
+}
+
+// checkGELFMessage checks the fields of the message of gelfRecord.
+func checkGELFMessage(t *testing.T, msg []byte, n int) {
+	t.Helper()
+	var fields map[string]any
+	if err := json.Unmarshal(msg, &fields); err != nil {
+		t.Fatalf("%v: %q", err, msg)
+	}
+	full, _ := fields["full_message"].(string)
+	delete(fields, "full_message")
+	want := map[string]any{
+		"version":        "1.1",
+		"host":           "web-1",
+		"short_message":  "hello",
+		"timestamp":      1717243200.123,
+		"level":          4.0,
+		"_cached":        "true",
+		"_req.id":        7.0,
+		"_req.user.name": "ann",
+		"_req.user.age":  1e9,
+	}
+	if fmt.Sprint(fields) != fmt.Sprint(want) {
+		t.Errorf("got  %v\nwant %v", fields, want)
+	}
+	if full != "hello\n"+strings.Repeat("x", n) {
+		t.Errorf("full_message of %d bytes", len(full))
+	}
+}
+
+func TestGELFHandlerUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	h := newTestGELF(t, "udp", pc.LocalAddr().String(), GELFOptions{})
+	if err := gelfRecord(t, h, 10); err != nil {
+		t.Fatal(err)
+	}
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64<<10)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGELFMessage(t, buf[:n], 10)
+
+	// An attribute named "id" outside of any group is "__id", GELF
+	// reserving "_id".
+	slog.New(h).Info("one", "id", 1)
+	n, _, err = pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf[:n], []byte(`,"__id":1}`)) {
+		t.Errorf("got %s", buf[:n])
+	}
+}
+
+// A message longer than ChunkSize is sent in chunks, which put together
+// in the order of their sequence numbers make the message.
+func TestGELFHandlerChunks(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	const chunkSize, size = 100, 1000
+	h := newTestGELF(t, "udp", pc.LocalAddr().String(), GELFOptions{ChunkSize: chunkSize})
+	if err := gelfRecord(t, h, size); err != nil {
+		t.Fatal(err)
+	}
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var (
+		id     []byte
+		chunks [][]byte
+		count  int
+	)
+	buf := make([]byte, 64<<10)
+	for i := 0; count == 0 || i < count; i++ {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk := buf[:n]
+		if n > chunkSize || n <= 12 || chunk[0] != 0x1e || chunk[1] != 0x0f {
+			t.Fatalf("chunk %d of %d bytes: % x", i, n, chunk[:min(n, 12)])
+		}
+		if i == 0 {
+			id, count = bytes.Clone(chunk[2:10]), int(chunk[11])
+			chunks = make([][]byte, count)
+		}
+		if !bytes.Equal(chunk[2:10], id) || int(chunk[11]) != count || int(chunk[10]) != i {
+			t.Fatalf("chunk %d: header % x, want id % x, sequence %d of %d", i, chunk[:12], id, i, count)
+		}
+		chunks[chunk[10]] = bytes.Clone(chunk[12:])
+	}
+	if count < 2 || count > gelfMaxChunks {
+		t.Fatalf("%d chunks", count)
+	}
+	checkGELFMessage(t, bytes.Join(chunks, nil), size)
+}
+
+// A message needing more chunks than GELF allows is not sent.
+func TestGELFHandlerTooLarge(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	for _, chunkSize := range []int{12, 20} {
+		var errs []error
+		h := newTestGELF(t, "udp", pc.LocalAddr().String(), GELFOptions{
+			ChunkSize: chunkSize,
+			OnError:   func(err error) { errs = append(errs, err) },
+		})
+		if err := gelfRecord(t, h, gelfMaxChunks*chunkSize); !errors.Is(err, ErrGELFTooLarge) {
+			t.Errorf("chunk size %d: Handle returned %v", chunkSize, err)
+		}
+		if len(errs) != 1 || !errors.Is(errs[0], ErrGELFTooLarge) {
+			t.Errorf("chunk size %d: OnError got %v", chunkSize, errs)
+		}
+	}
+	pc.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if n, _, err := pc.ReadFrom(make([]byte, 64<<10)); err == nil {
+		t.Errorf("a datagram of %d bytes was sent", n)
+	}
+}
+
+// Over TCP, the messages are whole, and terminated by a null byte.
+func TestGELFHandlerTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	h := newTestGELF(t, "tcp", ln.Addr().String(), GELFOptions{ChunkSize: 100})
+	for _, n := range []int{10, 1000} {
+		if err := gelfRecord(t, h, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	for _, n := range []int{10, 1000} {
+		msg, err := r.ReadBytes(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGELFMessage(t, msg[:len(msg)-1], n)
+	}
+}
@@ -0,0 +1,65 @@
+package log
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	globalMu    sync.Mutex // serializes changes to globalAttrs
+	globalAttrs atomic.Pointer[[]Attr]
+)
+
+// SetGlobalAttr adds an attribute with the given key and value to every
+// record logged from now on, by any Logger of this package, including the
+// ones already derived with With or WithGroup. Setting a key again
+// replaces its value. The attributes are added after those of the
+// logging call, including to the records passed to [Logger.Handle], and
+// like them belong to the groups of the Logger: a Logger derived with
+// WithGroup("req") logs a global "deploy" attribute as req.deploy.
+//
+// It is meant for tags changing at runtime, such as a deployment id;
+// attributes known when a Logger is created belong in With.
+func SetGlobalAttr(key string, v any) {
+	updateGlobalAttrs(func(attrs []Attr) []Attr {
+		a := Any(key, v)
+		if i := slices.IndexFunc(attrs, func(a Attr) bool { return a.Key == key }); i >= 0 {
+			attrs[i] = a
+			return attrs
+		}
+		return append(attrs, a)
+	})
+}
+
+// DeleteGlobalAttr removes the attribute with the given key set by
+// SetGlobalAttr, if any.
+func DeleteGlobalAttr(key string) {
+	updateGlobalAttrs(func(attrs []Attr) []Attr {
+		return slices.DeleteFunc(attrs, func(a Attr) bool { return a.Key == key })
+	})
+}
+
+// updateGlobalAttrs replaces the global attributes with the result of fn
+// on a copy of them, so that records being logged keep a consistent set.
+func updateGlobalAttrs(fn func([]Attr) []Attr) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	var attrs []Attr
+	if p := globalAttrs.Load(); p != nil {
+		attrs = slices.Clone(*p)
+	}
+	attrs = fn(attrs)
+	if len(attrs) == 0 {
+		globalAttrs.Store(nil)
+		return
+	}
+	globalAttrs.Store(&attrs)
+}
+
+// addGlobalAttrs adds the global attributes to r.
+func addGlobalAttrs(r *Record) {
+	if p := globalAttrs.Load(); p != nil {
+		r.AddAttrs(*p...)
+	}
+}
@@ -0,0 +1,122 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetGlobalAttrs removes the global attributes when the test ends.
+func resetGlobalAttrs(t *testing.T) {
+	t.Cleanup(func() { globalAttrs.Store(nil) })
+}
+
+func TestGlobalAttrs(t *testing.T) {
+	resetGlobalAttrs(t)
+	l, ring := newRingLogger(&Options{})
+
+	SetGlobalAttr("deploy", "a")
+	l.Info("first", "k", 1)
+	SetGlobalAttr("deploy", "b")
+	SetGlobalAttr("region", "eu")
+	l.Info("second")
+	DeleteGlobalAttr("deploy")
+	l.Info("third")
+	DeleteGlobalAttr("region")
+	l.Info("fourth")
+
+	want := []string{
+		"[k=1 deploy=a]",
+		"[deploy=b region=eu]",
+		"[region=eu]",
+		"[]",
+	}
+	for i, r := range ring.Records() {
+		if got := fmt.Sprint(recordAttrs(r)); got != want[i] {
+			t.Errorf("%s: attrs = %s, want %s", r.Message, got, want[i])
+		}
+	}
+}
+
+func TestGlobalAttrsHandle(t *testing.T) {
+	resetGlobalAttrs(t)
+	l, ring := newRingLogger(&Options{})
+	SetGlobalAttr("deploy", "a")
+
+	r := NewRecord(time.Now(), LevelInfo, "replayed", 0)
+	r.AddAttrs(String("k", "v"))
+	if err := l.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	got := ring.Records()
+	if len(got) != 1 {
+		t.Fatalf("got %d records, want 1", len(got))
+	}
+	if v, ok := attrValue(got[0], "deploy"); !ok || v.String() != "a" {
+		t.Errorf("deploy = %v, %t; want a", v, ok)
+	}
+	if r.NumAttrs() != 1 {
+		t.Errorf("the caller's record has %d attrs, want 1", r.NumAttrs())
+	}
+}
+
+func TestGlobalAttrsWithGroup(t *testing.T) {
+	resetGlobalAttrs(t)
+	var buf bytes.Buffer
+	l := New(&Options{Writer: &buf, Deterministic: true}).WithGroup("req")
+	SetGlobalAttr("deploy", "a")
+	l.Info("msg", "path", "/")
+	if got, want := buf.String(), "|  INFO | msg req.deploy=\"a\" req.path=\"/\" \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestGlobalAttrsConcurrent logs while the global attributes change, and
+// checks that each record sees a consistent set: run with -race.
+func TestGlobalAttrsConcurrent(t *testing.T) {
+	resetGlobalAttrs(t)
+	l, ring := newRingLogger(&Options{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := "g" + strconv.Itoa(i)
+			for j := 0; j < 200; j++ {
+				SetGlobalAttr(key, j)
+				SetGlobalAttr("shared", j)
+				DeleteGlobalAttr(key)
+			}
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				l.Info("msg")
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, r := range ring.Records() {
+		seen := make(map[string]bool)
+		r.Attrs(func(a Attr) bool {
+			if seen[a.Key] {
+				t.Errorf("key %q repeated in %v", a.Key, recordAttrs(r))
+			}
+			seen[a.Key] = true
+			return true
+		})
+	}
+	DeleteGlobalAttr("shared")
+	if p := globalAttrs.Load(); p != nil {
+		t.Errorf("global attrs left: %v", *p)
+	}
+}
@@ -0,0 +1,181 @@
+package log
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// HealthReporter is implemented by the handlers and writers that can
+// tell whether they work, such as asynchronous handlers and rotating or
+// network writers. [Health] collects their reports.
+type HealthReporter interface {
+	LogHealth() ComponentHealth
+}
+
+// ComponentHealth is the state of one component of a logging pipeline.
+// Fields that don't apply to a component are left zero, and are left
+// out of its JSON form.
+type ComponentHealth struct {
+	// Name identifies the component, such as "async" or "file".
+	Name string
+	// Healthy reports whether the component works as intended.
+	Healthy bool
+
+	// QueueDepth and QueueCapacity are the number of records held by a
+	// queue and the number it can hold.
+	QueueDepth    int
+	QueueCapacity int
+
+	// LastError is the last error met by the component, and
+	// LastErrorTime when it happened.
+	LastError     error
+	LastErrorTime time.Time
+
+	// Path and Size are the path and size of the current file.
+	Path string
+	Size int64
+
+	// Connected reports whether a network writer is connected, and
+	// Reconnects how many times it reconnected.
+	Connected  bool
+	Reconnects int
+}
+
+// MarshalJSON returns the JSON form of h, with snake_case keys and
+// the fields that don't apply left out.
+func (h ComponentHealth) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Name          string     `json:"name"`
+		Healthy       bool       `json:"healthy"`
+		QueueDepth    int        `json:"queue_depth,omitempty"`
+		QueueCapacity int        `json:"queue_capacity,omitempty"`
+		LastError     string     `json:"last_error,omitempty"`
+		LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+		Path          string     `json:"path,omitempty"`
+		Size          int64      `json:"size,omitempty"`
+		Connected     bool       `json:"connected,omitempty"`
+		Reconnects    int        `json:"reconnects,omitempty"`
+	}{
+		Name:          h.Name,
+		Healthy:       h.Healthy,
+		QueueDepth:    h.QueueDepth,
+		QueueCapacity: h.QueueCapacity,
+		Path:          h.Path,
+		Size:          h.Size,
+		Connected:     h.Connected,
+		Reconnects:    h.Reconnects,
+	}
+	if h.LastError != nil {
+		v.LastError = h.LastError.Error()
+	}
+	if !h.LastErrorTime.IsZero() {
+		v.LastErrorTime = &h.LastErrorTime
+	}
+	return json.Marshal(v)
+}
+
+// HealthReport is the state of a logging pipeline, as returned by [Health].
+// It marshals to JSON as is, for exposing on an admin endpoint.
+type HealthReport struct {
+	// Healthy reports whether all the components are healthy.
+	Healthy bool `json:"healthy"`
+	// Components lists the components that reported their state,
+	// the logger itself first.
+	Components []ComponentHealth `json:"components"`
+}
+
+// Health returns the state of the pipeline of the default Logger.
+// See [LoggerHealth].
+func Health() HealthReport {
+	return LoggerHealth(Default())
+}
+
+// LoggerHealth returns the state of the pipeline of l: whether its last
+// record was handled without error, then the state of each handler and
+// writer along its chain that implements HealthReporter.
+//
+// The chain is followed through the handlers and writers that expose what
+// they wrap, with an Unwrap method returning a Handler or an io.Writer, or
+// a Handlers or Writers method returning several.
+func LoggerHealth(l Logger) HealthReport {
+	report := HealthReport{Healthy: true}
+	if ll, ok := l.(*logger); ok {
+		report.add(ll.errs.health())
+	}
+	seen := map[any]bool{}
+	var walk func(v any, depth int)
+	walk = func(v any, depth int) {
+		if v == nil || depth > maxHealthDepth || !markSeen(seen, v) {
+			return
+		}
+		if r, ok := v.(HealthReporter); ok {
+			report.add(r.LogHealth())
+		}
+		switch x := v.(type) {
+		case interface{ Unwrap() Handler }:
+			walk(x.Unwrap(), depth+1)
+		case interface{ Unwrap() io.Writer }:
+			walk(x.Unwrap(), depth+1)
+		case interface{ Handlers() []Handler }:
+			for _, h := range x.Handlers() {
+				walk(h, depth+1)
+			}
+		case interface{ Writers() []io.Writer }:
+			for _, w := range x.Writers() {
+				walk(w, depth+1)
+			}
+		}
+	}
+	if hl, ok := l.(interface{ Handler() slog.Handler }); ok {
+		walk(hl.Handler(), 0)
+	}
+	walk(l.Output(), 0)
+	return report
+}
+
+func (l *logger) Pressure() float64 {
+	var p float64
+	for _, c := range LoggerHealth(l).Components {
+		if c.QueueCapacity > 0 {
+			p = max(p, min(1, float64(c.QueueDepth)/float64(c.QueueCapacity)))
+		}
+	}
+	return p
+}
+
+// maxHealthDepth bounds how deep LoggerHealth follows a chain.
+const maxHealthDepth = 16
+
+func (r *HealthReport) add(h ComponentHealth) {
+	r.Components = append(r.Components, h)
+	r.Healthy = r.Healthy && h.Healthy
+}
+
+// markSeen records v in seen and reports whether it was not there yet.
+// Values that can't be map keys are never considered seen.
+func markSeen(seen map[any]bool, v any) (first bool) {
+	defer func() {
+		if recover() != nil {
+			first = true
+		}
+	}()
+	if seen[v] {
+		return false
+	}
+	seen[v] = true
+	return true
+}
+
+// health returns the state of the handler chain as seen by the logger.
+func (e *errorReporter) health() ComponentHealth {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return ComponentHealth{
+		Name:          "logger",
+		Healthy:       !e.failing.Load(),
+		LastError:     e.lastErr,
+		LastErrorTime: e.lastErrAt,
+	}
+}
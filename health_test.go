@@ -0,0 +1,123 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errDiskFull = errors.New("no space left on device")
+
+// degradedWriter is a writer whose writes all fail, and says so.
+type degradedWriter struct {
+	mu     sync.Mutex
+	lastAt time.Time
+}
+
+func (w *degradedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastAt = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	return 0, errDiskFull
+}
+
+func (w *degradedWriter) LogHealth() ComponentHealth {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	h := ComponentHealth{Name: "disk", Healthy: w.lastAt.IsZero()}
+	if !h.Healthy {
+		h.LastError, h.LastErrorTime = errDiskFull, w.lastAt
+	}
+	return h
+}
+
+// componentNames returns the names of the components of r.
+func componentNames(r HealthReport) []string {
+	var names []string
+	for _, c := range r.Components {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestHealthDegradedWriter(t *testing.T) {
+	l := New(&Options{Writer: new(degradedWriter), ErrorHandler: func(error, Record) {}})
+	if r := LoggerHealth(l); !r.Healthy {
+		t.Fatalf("unhealthy before any write: %+v", r)
+	}
+	l.Info("lost")
+	r := LoggerHealth(l)
+	if r.Healthy {
+		t.Fatalf("healthy after a failed write: %+v", r)
+	}
+	if got := strings.Join(componentNames(r), ","); got != "logger,disk" {
+		t.Fatalf("components = %s, want logger,disk", got)
+	}
+	for _, c := range r.Components {
+		if c.Healthy || !errors.Is(c.LastError, errDiskFull) || c.LastErrorTime.IsZero() {
+			t.Errorf("%s: got %+v, want unhealthy with the write error", c.Name, c)
+		}
+	}
+}
+
+func TestHealthBufferedDegradedWriter(t *testing.T) {
+	w := NewBufferedWriter(new(degradedWriter), 0, time.Hour)
+	defer w.Close()
+	l := New(&Options{Writer: w})
+	l.Info("held")
+	if r := LoggerHealth(l); !r.Healthy {
+		t.Fatalf("unhealthy before the flush: %+v", r)
+	}
+	if err := w.Flush(); !errors.Is(err, errDiskFull) {
+		t.Fatalf("Flush returned %v", err)
+	}
+	r := LoggerHealth(l)
+	if got := strings.Join(componentNames(r), ","); got != "logger,buffer,disk" {
+		t.Fatalf("components = %s, want logger,buffer,disk", got)
+	}
+	if r.Healthy || !r.Components[0].Healthy || r.Components[1].Healthy {
+		t.Errorf("got %+v, want the buffer unhealthy, and the logger, which wrote to it, healthy", r)
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"healthy":false,"components":[{"name":"logger","healthy":true},` +
+		`{"name":"buffer","healthy":false,"last_error":"no space left on device","last_error_time":`
+	if !strings.HasPrefix(string(b), want) {
+		t.Errorf("got %s, want it to start with %s", b, want)
+	}
+}
+
+func TestHealthAsyncQueue(t *testing.T) {
+	blocked := &blockingHandler{
+		Handler: slog.NewJSONHandler(io.Discard, nil),
+		entered: make(chan struct{}),
+		gate:    make(chan struct{}),
+	}
+	h := NewAsyncHandler(blocked, 4, DropNewest)
+	l := New(&Options{Writer: io.Discard, NewHandler: func(io.Writer, *slog.HandlerOptions) slog.Handler { return h }})
+	l.Info("held by the worker")
+	<-blocked.entered
+	for i := 0; i < 4; i++ {
+		l.Info("queued")
+	}
+	r := LoggerHealth(l)
+	if got := strings.Join(componentNames(r), ","); got != "logger,async" {
+		t.Fatalf("components = %s, want logger,async", got)
+	}
+	if c := r.Components[1]; c.Healthy || c.QueueDepth != 4 || c.QueueCapacity != 4 {
+		t.Errorf("got %+v, want a full queue of 4", c)
+	}
+	if p := l.(*logger).Pressure(); p != 1 {
+		t.Errorf("Pressure() = %v, want 1", p)
+	}
+	close(blocked.gate)
+	h.Close()
+}
@@ -1,31 +1,38 @@
 package log
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log/slog"
-	"runtime"
 	"slices"
-	"strconv"
 	"strings"
 	"sync"
-	"time"
 )
 
 type IndentHandler struct {
-	opts           slog.HandlerOptions
+	opts           HandlerOptions
 	preformatted   []byte   // data from WithGroup and WithAttrs
+	groups         []string // all groups from WithGroup
 	unopenedGroups []string // groups from WithGroup that haven't been opened
 	indentLevel    int      // same as number of opened groups so far
 	mu             *sync.Mutex
 	out            io.Writer
+	children       *attrCache
 }
 
 func NewIndentHandler(out io.Writer, opts *slog.HandlerOptions) *IndentHandler {
+	return NewIndentHandlerWithOptions(out, handlerOptions(opts))
+}
+
+// NewIndentHandlerWithOptions is like [NewIndentHandler] but accepts the
+// extended options of this package.
+func NewIndentHandlerWithOptions(out io.Writer, opts *HandlerOptions) *IndentHandler {
 	h := &IndentHandler{
-		out: out,
-		mu:  &sync.Mutex{},
+		out:      out,
+		mu:       &sync.Mutex{},
+		children: new(attrCache),
 	}
 	if opts != nil {
 		h.opts = *opts
@@ -33,6 +40,7 @@ func NewIndentHandler(out io.Writer, opts *slog.HandlerOptions) *IndentHandler {
 	if h.opts.Level == nil {
 		h.opts.Level = slog.LevelInfo
 	}
+	h.opts.shortSourceByDefault()
 	return h
 }
 
@@ -45,10 +53,12 @@ func (h *IndentHandler) WithGroup(name string) slog.Handler {
 		return h
 	}
 	h2 := *h
+	h2.children = new(attrCache)
 	// Add an unopened group to h2 without modifying h.
 	h2.unopenedGroups = make([]string, len(h.unopenedGroups)+1)
 	copy(h2.unopenedGroups, h.unopenedGroups)
 	h2.unopenedGroups[len(h2.unopenedGroups)-1] = name
+	h2.groups = append(slices.Clip(h.groups), name)
 	return &h2
 }
 
@@ -56,20 +66,27 @@ func (h *IndentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	if len(attrs) == 0 {
 		return h
 	}
+	// Pre-format the attributes at the depth of the groups they belong to.
+	var formatted []byte
+	for _, a := range attrs {
+		formatted = h.appendAttr(formatted, a, h.indentLevel+len(h.unopenedGroups))
+	}
+	// Attributes that produce no output must not open any group.
+	if len(formatted) == 0 {
+		return h
+	}
 	h2 := *h
+	h2.children = new(attrCache)
 	// Force an append to copy the underlying array.
 	pre := slices.Clip(h.preformatted)
 	// Add all groups from WithGroup that haven't already been added.
 	h2.preformatted = h2.appendUnopenedGroups(pre, h2.indentLevel)
+	h2.preformatted = append(h2.preformatted, formatted...)
 	// Each of those groups increased the indent level by 1.
 	h2.indentLevel += len(h2.unopenedGroups)
 	// Now all groups have been opened.
 	h2.unopenedGroups = nil
-	// Pre-format the attributes.
-	for _, a := range attrs {
-		h2.preformatted = h2.appendAttr(h2.preformatted, a, h2.indentLevel)
-	}
-	return &h2
+	return h.children.intern(h2.preformatted, &h2)
 }
 
 func (h *IndentHandler) appendUnopenedGroups(buf []byte, indentLevel int) []byte {
@@ -87,31 +104,42 @@ func (h *IndentHandler) Handle(ctx context.Context, r slog.Record) error {
 		*bufp = buf
 		freeBuf(bufp)
 	}()
-	if !r.Time.IsZero() {
-		buf = h.appendAttr(buf, slog.Time(slog.TimeKey, r.Time), 0)
-	}
-	buf = h.appendAttr(buf, slog.Any(slog.LevelKey, r.Level), 0)
-	if h.opts.AddSource {
-		fs := runtime.CallersFrames([]uintptr{r.PC})
-		f, _ := fs.Next()
-		// Optimize to minimize allocation.
-		srcbufp := allocBuf()
-		defer freeBuf(srcbufp)
-		*srcbufp = append(*srcbufp, f.File...)
-		*srcbufp = append(*srcbufp, ':')
-		*srcbufp = strconv.AppendInt(*srcbufp, int64(f.Line), 10)
-		buf = h.appendAttr(buf, slog.String(slog.SourceKey, string(*srcbufp)), 0)
+	if h.opts.CompactHeader {
+		buf = h.appendHeader(buf, r)
+	} else {
+		if !r.Time.IsZero() {
+			buf = h.appendBuiltinAttr(buf, slog.Time(slog.TimeKey, r.Time))
+		}
+		buf = h.appendBuiltinAttr(buf, slog.Any(slog.LevelKey, r.Level))
+		if h.opts.AddSource && r.PC != 0 {
+			buf = h.appendBuiltinAttr(buf, slog.String(slog.SourceKey, h.opts.source(r.PC)))
+		}
 	}
 
-	buf = h.appendAttr(buf, slog.String(slog.MessageKey, r.Message), 0)
+	if ev, ok := recordEvent(r); ok {
+		buf = h.appendBuiltinAttr(buf, ev)
+	}
+	buf = h.appendBuiltinAttr(buf, slog.String(slog.MessageKey, r.Message))
+	if t := h.opts.handledAt(); !t.IsZero() {
+		buf = h.appendBuiltinAttr(buf, slog.Time(HandledAtKey, t))
+	}
+	if d, ok := h.opts.uptime(); ok {
+		buf = h.appendBuiltinAttr(buf, slog.Duration(UptimeKey, d))
+	}
 	// Insert preformatted attributes just after built-in ones.
 	buf = append(buf, h.preformatted...)
 	if r.NumAttrs() > 0 {
-		buf = h.appendUnopenedGroups(buf, h.indentLevel)
-		r.Attrs(func(a slog.Attr) bool {
-			buf = h.appendAttr(buf, a, h.indentLevel+len(h.unopenedGroups))
+		attrbufp := allocBuf()
+		defer freeBuf(attrbufp)
+		h.opts.attrsAfterEvent(r, func(a slog.Attr) bool {
+			*attrbufp = h.appendAttr(*attrbufp, a, h.indentLevel+len(h.unopenedGroups))
 			return true
 		})
+		// Open the pending groups only if they have something in them.
+		if len(*attrbufp) > 0 {
+			buf = h.appendUnopenedGroups(buf, h.indentLevel)
+			buf = append(buf, *attrbufp...)
+		}
 	}
 	buf = append(buf, "---\n"...)
 	h.mu.Lock()
@@ -120,16 +148,75 @@ func (h *IndentHandler) Handle(ctx context.Context, r slog.Record) error {
 	return err
 }
 
+// appendHeader appends the time, level and source of r on one line,
+// for CompactHeader. Each goes through ReplaceAttr like the other
+// built-in attributes.
+func (h *IndentHandler) appendHeader(buf []byte, r slog.Record) []byte {
+	start := len(buf)
+	sep := func() {
+		if len(buf) > start {
+			buf = append(buf, ' ')
+		}
+	}
+	if !r.Time.IsZero() {
+		if a, ok := h.opts.builtin(h.opts.inLocation(slog.Time(slog.TimeKey, r.Time))); ok {
+			layout := &DefaultTimeLayout
+			if h.opts.TimeLayout != nil {
+				layout = h.opts.TimeLayout
+			}
+			if a.Value.Kind() == slog.KindTime {
+				buf = append(buf, layout.format(a.Value.Time())...)
+			} else {
+				buf = append(buf, a.Value.String()...)
+			}
+		}
+	}
+	if a, ok := h.opts.builtin(slog.Any(slog.LevelKey, r.Level)); ok {
+		sep()
+		if isSlogLevel(a.Value) {
+			buf = append(buf, padLevel(h.opts.levelName(a.Value.Any().(slog.Level)), h.opts.levelWidth(h.opts.levelName))...)
+		} else {
+			buf = append(buf, a.Value.String()...)
+		}
+	}
+	if h.opts.AddSource && r.PC != 0 {
+		if a, ok := h.opts.builtin(slog.String(slog.SourceKey, h.opts.source(r.PC))); ok {
+			sep()
+			buf = append(buf, a.Value.String()...)
+		}
+	}
+	if len(buf) > start {
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+// appendBuiltinAttr appends an attribute that belongs to the record itself.
+// Only such attributes get the special rendering of the built-in keys.
+func (h *IndentHandler) appendBuiltinAttr(buf []byte, a slog.Attr) []byte {
+	return h.appendAttrOf(buf, a, nil, 0, true)
+}
+
 func (h *IndentHandler) appendAttr(buf []byte, a slog.Attr, indentLevel int) []byte {
+	return h.appendAttrOf(buf, a, h.groups, indentLevel, false)
+}
+
+// appendAttrOf appends a, within groups, the groups from WithGroup and
+// those of the Group attributes around it, for ReplaceGroup and
+// ReplaceAttr.
+func (h *IndentHandler) appendAttrOf(buf []byte, a slog.Attr, groups []string, indentLevel int, builtin bool) []byte {
+	// Deal with nil values before resolving them calls any of their methods.
+	a, ok := h.opts.applyNilPolicy(a)
+	if !ok {
+		return buf
+	}
 	// Resolve the Attr's value before doing anything else.
 	a.Value = a.Value.Resolve()
+	a = h.opts.inLocation(a)
+	a = h.opts.replaceGroup(groups, a)
 	if rep := h.opts.ReplaceAttr; rep != nil && a.Value.Kind() != slog.KindGroup {
-		var gs []string
-		if h.unopenedGroups != nil {
-			gs = h.unopenedGroups[:]
-		}
 		// a.Value is resolved before calling ReplaceAttr, so the user doesn't have to.
-		a = rep(gs, a)
+		a = rep(groups, a)
 		// The ReplaceAttr function may return an unresolved Attr.
 		a.Value = a.Value.Resolve()
 	}
@@ -137,13 +224,37 @@ func (h *IndentHandler) appendAttr(buf []byte, a slog.Attr, indentLevel int) []b
 	if a.Equal(slog.Attr{}) {
 		return buf
 	}
-	if a.Value.Kind() != slog.KindGroup {
-		// key
-		buf = append(buf, a.Key...)
-		buf = append(buf, ": "...)
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		// Ignore empty groups.
+		if len(attrs) == 0 {
+			return buf
+		}
+		// If the key is empty, inline the attrs.
+		if a.Key == "" {
+			for _, ga := range attrs {
+				buf = h.appendAttrOf(buf, ga, groups, indentLevel, false)
+			}
+			return buf
+		}
+		// Otherwise, write it out and indent the rest of the attrs,
+		// taking the key back if none of them produced any output.
+		start := len(buf)
+		buf = fmt.Appendf(buf, "%*s%s:\n", indentLevel*4, "", a.Key)
+		header := len(buf)
+		groups = append(slices.Clip(groups), a.Key)
+		for _, ga := range attrs {
+			buf = h.appendAttrOf(buf, ga, groups, indentLevel+1, false)
+		}
+		if len(buf) == header {
+			buf = buf[:start]
+		}
+		return buf
 	}
-	switch a.Key {
-	case slog.MessageKey:
+	// Indent 4 spaces per level.
+	buf = fmt.Appendf(buf, "%*s%s: ", indentLevel*4, "", a.Key)
+	switch key := a.Key; {
+	case builtin && key == slog.MessageKey:
 		// message
 		msgbufp := allocBuf()
 		defer freeBuf(msgbufp)
@@ -170,43 +281,24 @@ func (h *IndentHandler) appendAttr(buf []byte, a slog.Attr, indentLevel int) []b
 			lines++
 		}
 		buf = append(buf, *msgbufp...)
-	case slog.LevelKey:
-		buf = append(buf, levelToString(a.Value.Any().(slog.Level))...)
+	case builtin && key == slog.LevelKey && isSlogLevel(a.Value):
+		buf = append(buf, h.opts.levelName(a.Value.Any().(slog.Level))...)
 		buf = append(buf, '\n')
-	case slog.SourceKey:
+	case builtin && key == slog.SourceKey:
 		buf = append(buf, a.Value.String()...)
 		buf = append(buf, '\n')
 	default:
-		// Indent 4 spaces per level.
-		buf = fmt.Appendf(buf, "%*s", indentLevel*4, "")
-		switch a.Value.Kind() {
-		case slog.KindString:
-			// Quote string values, to make them easy to parse.
-			buf = strconv.AppendQuote(buf, a.Value.String())
-			buf = append(buf, '\n')
-		case slog.KindTime:
-			// Write times in a standard way, without the monotonic time.
-			buf = a.Value.Time().AppendFormat(buf, time.RFC3339Nano)
-			buf = append(buf, '\n')
-		case slog.KindGroup:
-			attrs := a.Value.Group()
-			// Ignore empty groups.
-			if len(attrs) == 0 {
-				return buf
-			}
-			// If the key is non-empty, write it out and indent the rest of the attrs.
-			// Otherwise, inline the attrs.
-			if a.Key != "" {
-				buf = fmt.Appendf(buf, "%s:\n", a.Key)
-				indentLevel++
-			}
-			for _, ga := range attrs {
-				buf = h.appendAttr(buf, ga, indentLevel)
+		if st, ok := stackValue(a.Value); ok {
+			// Render stacks as a list of frames.
+			buf = append(bytes.TrimRight(buf, " "), '\n')
+			for _, f := range st {
+				buf = fmt.Appendf(buf, "%*s- %s\n", (indentLevel+1)*4, "", f.Function)
+				buf = fmt.Appendf(buf, "%*s  %s:%d\n", (indentLevel+1)*4, "", f.File, f.Line)
 			}
-		default:
-			buf = append(buf, a.Value.String()...)
-			buf = append(buf, '\n')
+			break
 		}
+		buf = appendValue(buf, a.Value)
+		buf = append(buf, '\n')
 	}
 	return buf
 }
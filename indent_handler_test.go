@@ -0,0 +1,179 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"zestack.dev/log"
+	"zestack.dev/log/logtest"
+)
+
+func TestIndentHandlerEmptyGroups(t *testing.T) {
+	for _, tt := range emptyGroupCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := tt.derive(log.NewIndentHandler(&buf, nil))
+			h.Handle(context.Background(), slog.NewRecord(textTestTime, slog.LevelInfo, "msg", 0))
+			if got, want := buf.String(), "time: 2024-06-01T12:00:00Z\nlevel: INFO\nmsg: msg\n---\n"; got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestIndentHandlerInnerEmptyGroup(t *testing.T) {
+	var buf bytes.Buffer
+	h := log.NewIndentHandler(&buf, nil).WithGroup("req").WithAttrs([]slog.Attr{slog.Int("id", 7)}).WithGroup("empty")
+	h.Handle(context.Background(), slog.NewRecord(textTestTime, slog.LevelInfo, "msg", 0))
+	if got, want := buf.String(), "time: 2024-06-01T12:00:00Z\nlevel: INFO\nmsg: msg\nreq:\n    id: 7\n---\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestIndentHandlerConformance(t *testing.T) {
+	logtest.TestHandlerConformance(t, func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+		return log.NewIndentHandler(w, opts)
+	}, parseIndent)
+}
+
+// parseIndent parses the output of an IndentHandler: records separated by
+// "---", one "key: value" per line, groups as a key followed by their
+// attributes indented by four more spaces, and messages of several lines
+// as ">-" blocks.
+func parseIndent(out []byte) ([]logtest.Entry, error) {
+	var entries []logtest.Entry
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	e := logtest.Entry{}
+	stack := []logtest.Entry{e}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if line == "---" {
+			entries = append(entries, e)
+			e = logtest.Entry{}
+			stack = []logtest.Entry{e}
+			continue
+		}
+		trimmed := strings.TrimLeft(line, " ")
+		depth := (len(line) - len(trimmed)) / 4
+		if depth >= len(stack) {
+			return nil, fmt.Errorf("line %d: unexpected indentation in %q", i+1, line)
+		}
+		stack = stack[:depth+1]
+		key, val, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: no key in %q", i+1, line)
+		}
+		val = strings.TrimPrefix(val, " ")
+		switch {
+		case val == "":
+			g := logtest.Entry{}
+			stack[depth][key] = g
+			stack = append(stack, g)
+		case val == ">-":
+			prefix := strings.Repeat(" ", 4*(depth+1))
+			var block []string
+			for i+1 < len(lines) && strings.HasPrefix(lines[i+1], prefix) {
+				i++
+				block = append(block, strings.TrimPrefix(lines[i], prefix))
+			}
+			stack[depth][key] = strings.Join(block, "\n")
+		case strings.HasPrefix(val, `"`):
+			s, err := strconv.Unquote(val)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			stack[depth][key] = s
+		default:
+			stack[depth][key] = val
+		}
+	}
+	if len(e) > 0 {
+		return nil, fmt.Errorf("record not terminated by ---")
+	}
+	return entries, nil
+}
+
+func TestIndentHandlerCompactHeader(t *testing.T) {
+	source := func(_ []string, a slog.Attr) slog.Attr {
+		if a.Key == slog.SourceKey {
+			return slog.String(slog.SourceKey, "user.go:42")
+		}
+		return a
+	}
+	drop := func(keys ...string) func([]string, slog.Attr) slog.Attr {
+		return func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && slices.Contains(keys, a.Key) {
+				return slog.Attr{}
+			}
+			return source(groups, a)
+		}
+	}
+	tests := []struct {
+		name        string
+		compact     bool
+		time        time.Time
+		replaceAttr func([]string, slog.Attr) slog.Attr
+		want        string
+	}{
+		{"fields", false, textTestTime, source,
+			"time: 2024-06-01T12:00:00Z\nlevel: WARN\nsource: user.go:42\nmsg: disk full\ng:\n    a: 1\n---\n"},
+		{"compact", true, textTestTime, source,
+			"2024-06-01 12:00:00  WARN user.go:42\nmsg: disk full\ng:\n    a: 1\n---\n"},
+		{"fields without time", false, time.Time{}, source,
+			"level: WARN\nsource: user.go:42\nmsg: disk full\ng:\n    a: 1\n---\n"},
+		{"compact without time", true, time.Time{}, source,
+			" WARN user.go:42\nmsg: disk full\ng:\n    a: 1\n---\n"},
+		{"compact without source", true, textTestTime, drop(slog.SourceKey),
+			"2024-06-01 12:00:00  WARN\nmsg: disk full\ng:\n    a: 1\n---\n"},
+		{"compact without header", true, textTestTime, drop(slog.TimeKey, slog.LevelKey, slog.SourceKey),
+			"msg: disk full\ng:\n    a: 1\n---\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := log.NewIndentHandlerWithOptions(&buf, &log.HandlerOptions{
+				HandlerOptions: slog.HandlerOptions{AddSource: true, ReplaceAttr: tt.replaceAttr},
+				CompactHeader:  tt.compact,
+			})
+			var pcs [1]uintptr
+			runtime.Callers(1, pcs[:])
+			r := slog.NewRecord(tt.time, slog.LevelWarn, "disk full", pcs[0])
+			r.AddAttrs(slog.Group("g", slog.Int("a", 1)))
+			if err := h.Handle(context.Background(), r); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestIndentHandlerCompactHeaderLevelWidth checks that the header pads the
+// levels to a common width, as TextHandler does.
+func TestIndentHandlerCompactHeaderLevelWidth(t *testing.T) {
+	var buf bytes.Buffer
+	h := log.NewIndentHandlerWithOptions(&buf, &log.HandlerOptions{CompactHeader: true})
+	for _, level := range []log.Level{log.LevelInfo, log.LevelError, log.LevelFatal} {
+		h.Handle(context.Background(), slog.NewRecord(textTestTime, level.Level(), "msg", 0))
+	}
+	var headers []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "2024") {
+			headers = append(headers, line)
+		}
+	}
+	want := []string{"2024-06-01 12:00:00  INFO", "2024-06-01 12:00:00 ERROR", "2024-06-01 12:00:00 FATAL"}
+	if !slices.Equal(headers, want) {
+		t.Errorf("headers = %q, want %q", headers, want)
+	}
+}
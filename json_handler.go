@@ -0,0 +1,350 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// JSONHandler writes records as newline-delimited JSON objects, for log
+// shippers and other machine readers:
+//
+//	{"time":"2024-06-01T12:00:00Z","level":"INFO","msg":"hello","user":{"id":42}}
+//
+// Levels are written as the names of this package's levels, times as
+// RFC 3339 strings with nanoseconds, and groups as nested objects. A value
+// that fails to marshal is replaced by a "!ERROR:" string describing the
+// failure rather than breaking the line.
+//
+// To use it as the handler of a Logger:
+//
+//	log.New(&log.Options{NewHandler: func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+//		return log.NewJSONHandler(w, opts)
+//	}})
+type JSONHandler struct {
+	opts         HandlerOptions
+	preformatted []byte   // attributes from WithAttrs, with their groups opened
+	groups       []string // all groups started from WithGroup
+	nOpenGroups  int      // number of groups opened in preformatted
+	mu           *sync.Mutex
+	out          io.Writer
+	children     *attrCache
+	layout       jsonLayout
+}
+
+// jsonLayout is the set of field names a JSONHandler writes the built-in
+// attributes with.
+type jsonLayout int
+
+const (
+	jsonPlain jsonLayout = iota
+	jsonECS              // see NewECSHandler
+	jsonCloud            // see NewCloudLoggingHandler
+)
+
+// NewJSONHandler creates a JSONHandler that writes to out,
+// using the given options. If opts is nil, the default options are used.
+func NewJSONHandler(out io.Writer, opts *slog.HandlerOptions) *JSONHandler {
+	return NewJSONHandlerWithOptions(out, handlerOptions(opts))
+}
+
+// NewJSONHandlerWithOptions is like [NewJSONHandler] but accepts the
+// extended options of this package.
+func NewJSONHandlerWithOptions(out io.Writer, opts *HandlerOptions) *JSONHandler {
+	h := &JSONHandler{out: out, mu: &sync.Mutex{}, children: new(attrCache)}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelInfo
+	}
+	return h
+}
+
+func (h *JSONHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *JSONHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.children = new(attrCache)
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+func (h *JSONHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.children = new(attrCache)
+	h2.preformatted = slices.Clip(h.preformatted)
+	// Open the pending groups only if the attributes produce something.
+	var buf []byte
+	for _, a := range attrs {
+		buf = h.appendAttr(buf, h.groups, a)
+	}
+	if len(buf) == 0 {
+		return h
+	}
+	h2.preformatted = h2.appendOpenGroups(h2.preformatted)
+	h2.nOpenGroups = len(h2.groups)
+	h2.preformatted = appendJSONSep(h2.preformatted)
+	h2.preformatted = append(h2.preformatted, buf...)
+	return h.children.intern(h2.preformatted, &h2)
+}
+
+// appendOpenGroups opens the groups not yet opened in preformatted.
+func (h *JSONHandler) appendOpenGroups(buf []byte) []byte {
+	for _, g := range h.groups[h.nOpenGroups:] {
+		buf = appendJSONSep(buf)
+		buf = appendJSONString(buf, g)
+		buf = append(buf, ":{"...)
+	}
+	return buf
+}
+
+func (h *JSONHandler) Handle(ctx context.Context, r slog.Record) error {
+	bufp := allocBuf()
+	buf := *bufp
+	defer func() {
+		*bufp = buf
+		freeBuf(bufp)
+	}()
+	buf = append(buf, '{')
+	switch h.layout {
+	case jsonECS:
+		buf = h.appendECSHeader(buf, r)
+	case jsonCloud:
+		buf = h.appendCloudHeader(ctx, buf, r)
+	default:
+		if !r.Time.IsZero() {
+			buf = h.appendBuiltin(buf, slog.Time(slog.TimeKey, r.Time))
+		}
+		buf = h.appendBuiltin(buf, slog.Any(slog.LevelKey, r.Level))
+		if ev, ok := recordEvent(r); ok {
+			buf = h.appendBuiltin(buf, ev)
+		}
+		if h.opts.AddSource {
+			buf = h.appendBuiltin(buf, slog.String(slog.SourceKey, h.opts.source(r.PC)))
+		}
+		buf = h.appendBuiltin(buf, slog.String(slog.MessageKey, r.Message))
+	}
+	if t := h.opts.handledAt(); !t.IsZero() {
+		buf = h.appendBuiltin(buf, slog.Time(HandledAtKey, t))
+	}
+	if d, ok := h.opts.uptime(); ok {
+		buf = h.appendBuiltin(buf, slog.Duration(UptimeKey, d))
+	}
+	if len(h.preformatted) > 0 {
+		buf = appendJSONSep(buf)
+		buf = append(buf, h.preformatted...)
+	}
+	opened := h.nOpenGroups
+	var ecsErr ecsError
+	if r.NumAttrs() > 0 {
+		attrbufp := allocBuf()
+		defer freeBuf(attrbufp)
+		h.opts.attrsAfterEvent(r, func(a slog.Attr) bool {
+			if h.layout == jsonECS && len(h.groups) == 0 && ecsErr.take(h, a) {
+				return true
+			}
+			*attrbufp = h.appendAttr(*attrbufp, h.groups, a)
+			return true
+		})
+		// Open the pending groups only if they have something in them.
+		if len(*attrbufp) > 0 {
+			buf = h.appendOpenGroups(buf)
+			opened = len(h.groups)
+			buf = appendJSONSep(buf)
+			buf = append(buf, *attrbufp...)
+		}
+	}
+	for i := 0; i < opened; i++ {
+		buf = append(buf, '}')
+	}
+	buf = ecsErr.append(buf)
+	buf = append(buf, "}\n"...)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.out.Write(buf)
+	return err
+}
+
+// appendBuiltin appends a built-in attribute, the level as the name of
+// the level of this package.
+func (h *JSONHandler) appendBuiltin(buf []byte, a slog.Attr) []byte {
+	a, ok := h.opts.builtin(a)
+	if !ok {
+		return buf
+	}
+	buf = appendJSONSep(buf)
+	buf = appendJSONString(buf, a.Key)
+	buf = append(buf, ':')
+	if a.Key == slog.LevelKey && isSlogLevel(a.Value) {
+		return appendJSONString(buf, levelToString(a.Value.Any().(slog.Level)))
+	}
+	return appendJSONValue(buf, a.Value)
+}
+
+// appendAttr appends a as a member of the innermost of groups, preceded
+// by a comma unless buf is empty or ends an opening brace.
+func (h *JSONHandler) appendAttr(buf []byte, groups []string, a slog.Attr) []byte {
+	a, ok := h.opts.applyNilPolicy(a)
+	if !ok {
+		return buf
+	}
+	a.Value = a.Value.Resolve()
+	a = h.opts.replaceGroup(groups, a)
+	if rep := h.opts.ReplaceAttr; rep != nil && a.Value.Kind() != slog.KindGroup {
+		a = rep(groups, a)
+		a.Value = a.Value.Resolve()
+	}
+	if a.Equal(slog.Attr{}) {
+		return buf
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		// Inline the attrs of a group without key.
+		if a.Key == "" {
+			for _, ga := range attrs {
+				buf = h.appendAttr(buf, groups, ga)
+			}
+			return buf
+		}
+		// Leave out groups with nothing in them.
+		start := len(buf)
+		buf = appendJSONSep(buf)
+		buf = appendJSONString(buf, a.Key)
+		buf = append(buf, ":{"...)
+		header := len(buf)
+		groups = append(slices.Clip(groups), a.Key)
+		for _, ga := range attrs {
+			buf = h.appendAttr(buf, groups, ga)
+		}
+		if len(buf) == header {
+			return buf[:start]
+		}
+		return append(buf, '}')
+	}
+	buf = appendJSONSep(buf)
+	buf = appendJSONString(buf, a.Key)
+	buf = append(buf, ':')
+	return appendJSONValue(buf, a.Value)
+}
+
+// appendJSONSep appends the comma separating a member from the previous
+// one, if any.
+func appendJSONSep(buf []byte) []byte {
+	if len(buf) == 0 || buf[len(buf)-1] == '{' {
+		return buf
+	}
+	return append(buf, ',')
+}
+
+// appendJSONValue appends the JSON form of a resolved, non-group value.
+func appendJSONValue(buf []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindString:
+		return appendJSONString(buf, v.String())
+	case slog.KindInt64:
+		return strconv.AppendInt(buf, v.Int64(), 10)
+	case slog.KindUint64:
+		return strconv.AppendUint(buf, v.Uint64(), 10)
+	case slog.KindFloat64:
+		f := v.Float64()
+		// JSON has no NaN or infinities; write them as strings.
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return appendJSONString(buf, strconv.FormatFloat(f, 'g', -1, 64))
+		}
+		return strconv.AppendFloat(buf, f, 'g', -1, 64)
+	case slog.KindBool:
+		return strconv.AppendBool(buf, v.Bool())
+	case slog.KindDuration:
+		return strconv.AppendInt(buf, int64(v.Duration()), 10)
+	case slog.KindTime:
+		buf = append(buf, '"')
+		buf = v.Time().AppendFormat(buf, time.RFC3339Nano)
+		return append(buf, '"')
+	default:
+		return appendJSONAny(buf, v.Any())
+	}
+}
+
+func appendJSONAny(buf []byte, v any) []byte {
+	if isNil(v) {
+		return append(buf, "null"...)
+	}
+	switch x := v.(type) {
+	case slog.Level:
+		return appendJSONString(buf, levelToString(x))
+	case Stack:
+		buf = append(buf, '[')
+		for i, f := range x {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSONString(buf, f.Function+" "+f.File+":"+strconv.Itoa(f.Line))
+		}
+		return append(buf, ']')
+	case json.Marshaler:
+	case error:
+		return appendJSONString(buf, errorText(x))
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return appendJSONString(buf, fmt.Sprintf("!ERROR:%v", err))
+	}
+	return append(buf, b...)
+}
+
+// appendJSONString appends s as a JSON string. Invalid UTF-8 is replaced
+// by U+FFFD, as encoding/json does.
+func appendJSONString(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c < 0x20:
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				buf = append(buf, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buf = append(buf, `\ufffd`...)
+		case r == '\u2028' || r == '\u2029':
+			buf = append(buf, `\u202`...)
+			buf = append(buf, hex[r&0xf])
+		default:
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(buf, '"')
+}
@@ -0,0 +1,16 @@
+package log_test
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"zestack.dev/log"
+	"zestack.dev/log/logtest"
+)
+
+func TestJSONHandlerConformance(t *testing.T) {
+	logtest.TestHandlerConformance(t, func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+		return log.NewJSONHandler(w, opts)
+	}, logtest.ParseJSON)
+}
@@ -92,9 +92,23 @@ func (l Level) String() string {
 	}
 }
 
+// FromSlogLevel converts a slog.Level to a Level. Each Level spans four
+// slog levels, so slog levels between two of them are rounded down to the
+// lower one, the way slog names them: slog.LevelInfo+2 ("INFO+2") gives
+// LevelInfo and slog.LevelDebug+2 ("DEBUG+2") gives LevelDebug.
+func FromSlogLevel(l slog.Level) Level {
+	return parseSlogLevel(l)
+}
+
 // 将 log.Level 转换成日志级别
 func parseSlogLevel(l slog.Level) Level {
-	return Level(int(l/4) + int(LevelInfo))
+	// Divide rounding towards negative infinity, as slog does when naming
+	// levels; integer division alone would round negative levels up.
+	q := int(l) / 4
+	if int(l)%4 < 0 {
+		q--
+	}
+	return Level(q + int(LevelInfo))
 }
 
 // 字符串转日志级别
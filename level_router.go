@@ -0,0 +1,120 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// LevelRoute sends the records with levels from Min to Max, inclusive, to
+// Handler. See [LevelRouterHandler].
+type LevelRoute struct {
+	Min, Max Level
+	Handler  slog.Handler
+}
+
+// matches reports whether the route covers level. Levels between those of
+// this package are compared as they are.
+func (r *LevelRoute) matches(level slog.Level) bool {
+	return r.Min.Level() <= level && level <= r.Max.Level()
+}
+
+// LevelRouterHandler sends each record to the handlers of the routes
+// covering its level, such as WARN and above to the console and INFO and
+// below to a file:
+//
+//	h := log.NewLevelRouterHandler(nil,
+//		log.LevelRoute{Min: log.LevelWarn, Max: log.LevelFatal, Handler: log.NewTextHandler(os.Stderr, nil)},
+//		log.LevelRoute{Min: log.LevelTrace, Max: log.LevelInfo, Handler: log.NewJSONHandler(file, nil)},
+//	)
+//
+// A record covered by several routes goes to all of them, and a record
+// covered by none to the fallback handler, if any. Each handler still
+// applies its own level. Attributes and groups added with WithAttrs and
+// WithGroup go to all handlers.
+type LevelRouterHandler struct {
+	routes   []LevelRoute
+	fallback slog.Handler
+}
+
+// NewLevelRouterHandler returns a LevelRouterHandler with the given
+// routes, sending the records no route covers to fallback. If fallback is
+// nil, those records are dropped.
+func NewLevelRouterHandler(fallback slog.Handler, routes ...LevelRoute) *LevelRouterHandler {
+	return &LevelRouterHandler{routes: routes, fallback: fallback}
+}
+
+func (h *LevelRouterHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	matched := false
+	for i := range h.routes {
+		if r := &h.routes[i]; r.matches(level) {
+			if r.Handler.Enabled(ctx, level) {
+				return true
+			}
+			matched = true
+		}
+	}
+	return !matched && h.fallback != nil && h.fallback.Enabled(ctx, level)
+}
+
+// Handle sends r to the handlers of the routes covering its level, even
+// if some of them fail, and returns their errors joined.
+func (h *LevelRouterHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	matched := false
+	forced := IsForced(ctx)
+	for i := range h.routes {
+		route := &h.routes[i]
+		if !route.matches(r.Level) {
+			continue
+		}
+		matched = true
+		if forced || route.Handler.Enabled(ctx, r.Level) {
+			errs = append(errs, route.Handler.Handle(ctx, r.Clone()))
+		}
+	}
+	if !matched && h.fallback != nil && (forced || h.fallback.Enabled(ctx, r.Level)) {
+		errs = append(errs, h.fallback.Handle(ctx, r))
+	}
+	return errors.Join(errs...)
+}
+
+func (h *LevelRouterHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.derive(func(hh slog.Handler) slog.Handler { return hh.WithAttrs(attrs) })
+}
+
+func (h *LevelRouterHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.derive(func(hh slog.Handler) slog.Handler { return hh.WithGroup(name) })
+}
+
+// derive returns a LevelRouterHandler with the same routes, their handlers
+// and the fallback replaced by fn of them.
+func (h *LevelRouterHandler) derive(fn func(slog.Handler) slog.Handler) *LevelRouterHandler {
+	h2 := &LevelRouterHandler{routes: make([]LevelRoute, len(h.routes))}
+	for i, r := range h.routes {
+		r.Handler = fn(r.Handler)
+		h2.routes[i] = r
+	}
+	if h.fallback != nil {
+		h2.fallback = fn(h.fallback)
+	}
+	return h2
+}
+
+// Handlers returns the handlers of the routes of h, then its fallback.
+func (h *LevelRouterHandler) Handlers() []Handler {
+	handlers := make([]Handler, 0, len(h.routes)+1)
+	for _, r := range h.routes {
+		handlers = append(handlers, r.Handler)
+	}
+	if h.fallback != nil {
+		handlers = append(handlers, h.fallback)
+	}
+	return handlers
+}
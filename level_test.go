@@ -0,0 +1,159 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestFromSlogLevelRoundTrip(t *testing.T) {
+	for level := LevelTrace - 8; level <= LevelFatal+8; level++ {
+		if got := FromSlogLevel(level.Level()); got != level {
+			t.Errorf("FromSlogLevel(%v) = %v, want %v", level.Level(), got, level)
+		}
+	}
+	// Each slog level falls in the Level whose slog level is the closest
+	// at or below it, as slog names them.
+	for l := slog.Level(-64); l <= 64; l++ {
+		level := FromSlogLevel(l)
+		if low := level.Level(); l < low || l >= low+4 {
+			t.Errorf("FromSlogLevel(%v) = %v, which spans [%v, %v)", l, level, low, low+4)
+		}
+	}
+	// Intermediate levels are rounded down, as slog names them.
+	for _, tt := range []struct {
+		l    slog.Level
+		want Level
+	}{
+		{slog.LevelInfo + 2, LevelInfo},
+		{slog.LevelDebug + 2, LevelDebug},
+		{slog.LevelDebug - 1, LevelTrace},
+		{slog.LevelDebug - 5, LevelTrace - 1},
+		{slog.LevelError + 5, LevelPanic},
+		{slog.LevelError + 13, LevelFatal + 1},
+	} {
+		if got := FromSlogLevel(tt.l); got != tt.want {
+			t.Errorf("FromSlogLevel(%v) = %v, want %v", tt.l, got, tt.want)
+		}
+	}
+}
+
+func TestLogSlogKeepsLevel(t *testing.T) {
+	ring := NewRingHandler(10)
+	l := New(&Options{Level: LevelTrace, NewHandler: func(_ io.Writer, opts *slog.HandlerOptions) slog.Handler {
+		return &levelHandler{Handler: ring, level: opts.Level}
+	}})
+	for _, level := range []slog.Level{slog.LevelInfo + 2, slog.LevelDebug - 3, slog.LevelError + 1} {
+		l.LogSlog(context.Background(), level, "msg")
+		recs := ring.Records()
+		if got := recs[len(recs)-1].Level; got != level {
+			t.Errorf("LogSlog(%v): the record has level %v", level, got)
+		}
+	}
+}
+
+func TestOptionsLeveler(t *testing.T) {
+	var lv slog.LevelVar
+	lv.Set(slog.LevelWarn)
+	ring := NewRingHandler(10)
+	l := New(&Options{Leveler: &lv, NewHandler: func(_ io.Writer, opts *slog.HandlerOptions) slog.Handler {
+		return &levelHandler{Handler: ring, level: opts.Level}
+	}})
+	ctx := context.Background()
+	if l.Enabled(ctx, LevelInfo) || !l.Enabled(ctx, LevelWarn) {
+		t.Error("the logger doesn't follow the level of its Leveler")
+	}
+	if got := l.Level(); got != LevelWarn {
+		t.Errorf("Level() = %v, want WARN", got)
+	}
+
+	// A level between those of the package reaches the handler as is.
+	lv.Set(slog.LevelInfo + 2)
+	if l.Enabled(ctx, LevelInfo) || !l.(*logger).Handler().Enabled(ctx, slog.LevelInfo+2) {
+		t.Error("the level between INFO and WARN isn't honored")
+	}
+	if got := l.Level(); got != LevelInfo {
+		t.Errorf("Level() = %v, want INFO", got)
+	}
+
+	// SetLevel sets the LevelVar, for the code sharing it too.
+	l.SetLevel(LevelDebug)
+	if got := lv.Level(); got != slog.LevelDebug {
+		t.Errorf("SetLevel(DEBUG) set the LevelVar to %v", got)
+	}
+	if !l.With("k", "v").Enabled(ctx, LevelDebug) {
+		t.Error("a derived logger doesn't follow the Leveler")
+	}
+
+	// A Leveler that can't be set is left alone, silently.
+	l = New(&Options{Leveler: slog.LevelWarn, Writer: io.Discard})
+	out := captureStderr(t, func() { l.SetLevel(LevelDebug) })
+	if out != "" {
+		t.Errorf("SetLevel wrote %q on os.Stderr", out)
+	}
+	if got := l.Level(); got != LevelWarn {
+		t.Errorf("Level() = %v after SetLevel, want WARN", got)
+	}
+}
+
+func TestCheckLevel(t *testing.T) {
+	// A handler with a level of its own doesn't follow SetLevel.
+	out := captureStderr(t, func() {
+		New(&Options{Writer: &bytes.Buffer{}, NewHandler: func(w io.Writer, _ *slog.HandlerOptions) slog.Handler {
+			return slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelInfo})
+		}})
+	})
+	if !strings.Contains(out, "does not follow the logger level") {
+		t.Errorf("got %q, want a warning", out)
+	}
+
+	// The supported way: passing on the options received, whose Level
+	// follows the logger's.
+	var buf bytes.Buffer
+	var l Logger
+	out = captureStderr(t, func() {
+		l = New(&Options{Writer: &buf, Level: LevelInfo, NewHandler: func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+			return slog.NewTextHandler(w, opts)
+		}})
+	})
+	if out != "" {
+		t.Errorf("got %q, want no warning", out)
+	}
+	l.Debug("hidden")
+	l.SetLevel(LevelDebug)
+	l.Debug("shown")
+	if got := buf.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "shown") {
+		t.Errorf("the handler doesn't follow SetLevel: %q", got)
+	}
+	if got := l.Level(); got != LevelDebug {
+		t.Errorf("the probe changed the level to %v", got)
+	}
+
+	// The probe never sets the Leveler of the caller, which other
+	// goroutines may be reading meanwhile.
+	var lv slog.LevelVar
+	lv.Set(slog.LevelWarn)
+	var seen []slog.Level
+	New(&Options{Writer: &buf, Leveler: &lv, NewHandler: func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+		return &levelHandler{Handler: slog.NewTextHandler(w, opts), level: levelFunc(func() slog.Level {
+			seen = append(seen, lv.Level())
+			return opts.Level.Level()
+		})}
+	}})
+	if len(seen) == 0 {
+		t.Fatal("the handler wasn't probed")
+	}
+	for _, level := range seen {
+		if level != slog.LevelWarn {
+			t.Fatalf("the LevelVar was set to %v during the probe", level)
+		}
+	}
+}
+
+// levelFunc is a slog.Leveler calling a function.
+type levelFunc func() slog.Level
+
+func (f levelFunc) Level() slog.Level { return f() }
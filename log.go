@@ -5,6 +5,7 @@ import (
 	"io"
 	"log/slog"
 	"sync/atomic"
+	"time"
 )
 
 // Logger defines the logging interface.
@@ -29,13 +30,36 @@ type Logger interface {
 	// The Record's Attrs consist of the Logger's attributes followed by
 	// the Attrs specified by args.
 	//
-	// The attribute arguments are processed as follows:
+	// If msg is a string holding formatting verbs, as understood by
+	// [fmt.Sprintf], the message is msg formatted with as many leading
+	// args as the verbs consume, up to the first that is an Attr or
+	// doesn't suit its verb, such as a string for %d. So the '%' of
+	// "disk 100% full" takes neither the Attrs nor the keys that follow.
+	// A string without verbs is the message as is, and a msg of any
+	// other type is formatted with [fmt.Sprint].
+	//
+	// The remaining arguments are processed as by [Logger.With]:
 	//   - If an argument is an Attr, it is used as is.
 	//   - If an argument is a string and this is not the last argument,
 	//     the following argument is treated as the value and the two are combined
 	//     into an Attr.
 	//   - Otherwise, the argument is treated as a value with key "!BADKEY".
+	//
+	// So log.Info("user %s logged in", name, "ip", ip) logs the message
+	// "user alice logged in" with the attribute ip=..., and the same
+	// "ip", ip arguments give the same attribute when passed to With.
+	//
+	// If msg is an Attr, it is added to the Record's Attrs ahead of the
+	// arguments, and the message is the Attr's value, or its key if it is
+	// a Group, so
+	//
+	//	log.Info(log.String("event", "user_created"))
+	//
+	// logs the message "user_created" with the attribute event=user_created.
 	Log(level Level, msg any, args ...any)
+	// LogSlog is like Log but takes the level as a [slog.Level], keeping
+	// levels that fall between the ones of this package intact.
+	LogSlog(ctx context.Context, level slog.Level, msg any, args ...any)
 	// Trace logs at [LevelTrace].
 	Trace(msg any, args ...any)
 	// Debug logs at [LevelDebug].
@@ -46,10 +70,82 @@ type Logger interface {
 	Warn(msg any, args ...any)
 	// Error logs at [LevelError].
 	Error(msg any, args ...any)
+	// TraceContext logs at [LevelTrace] with ctx, which is passed to the
+	// handler and checked against [Options.DeadlineSkip].
+	TraceContext(ctx context.Context, msg any, args ...any)
+	// DebugContext logs at [LevelDebug] with ctx.
+	DebugContext(ctx context.Context, msg any, args ...any)
+	// InfoContext logs at [LevelInfo] with ctx.
+	InfoContext(ctx context.Context, msg any, args ...any)
+	// WarnContext logs at [LevelWarn] with ctx.
+	WarnContext(ctx context.Context, msg any, args ...any)
+	// ErrorContext logs at [LevelError] with ctx.
+	ErrorContext(ctx context.Context, msg any, args ...any)
 	// Panic logs at [LevelPanic].
 	Panic(msg any, args ...any)
 	// Fatal logs at [LevelFatal].
 	Fatal(msg any, args ...any)
+	// Always logs at [LevelInfo] whatever the level of the Logger, for the
+	// few records that must always be seen, such as a startup banner.
+	// Only the level check is bypassed: handlers routing records by level
+	// still route it as an Info record. See [IsForced].
+	Always(msg any, args ...any)
+	// Span logs "msg started" at [LevelTrace] and returns a function that
+	// logs "msg finished" together with the elapsed duration. msg is
+	// taken as is, not as a format. Both records carry a "depth"
+	// attribute of 1: Span knows nothing of the spans open around it,
+	// which SpanContext does. The handlers render the depth as any other
+	// attribute, without indenting the records. The args are converted
+	// to attributes as if by [Logger.With].
+	//
+	// If LevelTrace is disabled, Span returns a no-op function.
+	Span(msg string, args ...any) func()
+	// SpanContext is like Span, but the span is nested in the one of ctx,
+	// if any: its "depth" attribute is one more than that of the span of
+	// ctx, and the returned context carries the span for the spans nested
+	// in it. The depth belongs to the context rather than to the Logger,
+	// so that the spans of concurrent requests don't count each other.
+	//
+	//	ctx, end := l.SpanContext(ctx, "load")
+	//	defer end()
+	//
+	// If LevelTrace is disabled, SpanContext returns ctx and a no-op
+	// function.
+	SpanContext(ctx context.Context, msg string, args ...any) (context.Context, func())
+	// Component returns a child Logger for the subsystem name, with a
+	// "component" attribute, a level of its own and, through opts, its
+	// own attributes and output, registered with [RegisterComponent].
+	Component(name string, opts ...ComponentOption) Logger
+	// Handle sends a record built elsewhere, for example with [NewRecord],
+	// to the Logger's handler if its level is enabled.
+	Handle(ctx context.Context, r Record) error
+	// Pressure returns how full the queues of the Logger's pipeline are,
+	// from 0 to 1: the largest fraction of its capacity in use by any of
+	// the queues reporting their depth through [HealthReporter]. It is 0
+	// for pipelines without queues, which handle records synchronously.
+	//
+	// Pressure is advisory: callers that would rather slow down than see
+	// records dropped can check it before logging in bulk, but nothing
+	// keeps the queues from filling up between the check and the call.
+	Pressure() float64
+}
+
+// DeadlineSkip describes the records skipped by [Options.DeadlineSkip]:
+// those at or below MaxLevel, logged with a context whose deadline is less
+// than Below away. Records without a context, or with a context without a
+// deadline, are never skipped.
+type DeadlineSkip struct {
+	Below    time.Duration
+	MaxLevel Level
+}
+
+// skip reports whether a record at level logged with ctx is skipped.
+func (d *DeadlineSkip) skip(ctx context.Context, level slog.Level) bool {
+	if d.Below <= 0 || level > d.MaxLevel.Level() || level >= LevelPanic.Level() {
+		return false
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) < d.Below
 }
 
 type Options struct {
@@ -64,6 +160,15 @@ type Options struct {
 	// to adjust the minimum level dynamically, use a LevelVar.
 	Level Level
 
+	// Leveler, if set, is the level of the logger instead of Level, as a
+	// [slog.Leveler] such as a *slog.LevelVar shared with code written for
+	// slog. It is read for each record, and passed to the handler as is,
+	// so that levels between the ones of this package are honored;
+	// [Logger.Level] returns it as converted by [FromSlogLevel].
+	// [Logger.SetLevel] sets it if it is a *slog.LevelVar, and has no
+	// effect otherwise: the level is then up to the code owning Leveler.
+	Leveler slog.Leveler
+
 	// ReplaceAttr is called to rewrite each non-group attribute before it is logged.
 	// The attribute's value has been resolved (see [Value.Resolve]).
 	// If ReplaceAttr returns a zero Attr, the attribute is discarded.
@@ -91,24 +196,112 @@ type Options struct {
 	// remove attributes from the output.
 	ReplaceAttr func(groups []string, a Attr) Attr
 
-	// 前端日志写入接口
+	// ReplaceGroup, if set, is called for each Group attribute before its
+	// contents, so that a whole group can be dropped, renamed or replaced
+	// without knowing its members. See [HandlerOptions.ReplaceGroup].
+	// It is honored by the default handler; a custom NewHandler has to
+	// pass it to its handler through HandlerOptions.
+	ReplaceGroup func(groups []string, a Attr) Attr
+
+	// Writer is the initial output of the logger. If nil, os.Stderr is used.
+	//
+	// The handler does not write to Writer directly: NewHandler receives a
+	// writer that forwards to the logger's current output, so that
+	// [Logger.SetOutput] takes effect at any time, including for handlers
+	// created by a custom NewHandler. Handlers must therefore write to the
+	// writer they are given rather than to one they captured elsewhere.
 	Writer io.Writer
 
+	// DisableOutputIndirection passes Writer to NewHandler as is, for
+	// handlers that manage their own writer. [Logger.SetOutput] then has
+	// no effect and reports so on os.Stderr.
+	DisableOutputIndirection bool
+
+	// CallerFilter drops, or changes the level of, records depending on
+	// the function that logged them. Its rules can be changed while the
+	// logger is in use.
+	CallerFilter *CallerFilter
+
+	// Describe causes New to log one record describing the configuration
+	// of the logger: its level, handler, output, whether the output is a
+	// terminal and colored, and the rotation settings of a RotatingFile
+	// output. The record goes through the handler like any other but
+	// is logged whatever the level, as if by [Logger.Always].
+	Describe bool
+
+	// Clock returns the time of the records logged through the logger, and
+	// is passed on to the default handler for the times it computes itself.
+	// If nil, time.Now is used. A zero time leaves the time out.
+	Clock func() time.Time
+
+	// NoColor and ForceColor are passed on to the default handler, as
+	// the options of the same names of [HandlerOptions]: with neither,
+	// colors are written only to terminals, and only if the NO_COLOR
+	// environment variable is not set, as decided again when SetOutput
+	// replaces the output.
+	NoColor    bool
+	ForceColor bool
+
+	// SourcePath is passed on to the default handler, as
+	// HandlerOptions.SourcePath: how source locations are rendered, as
+	// "http/server.go:412" if nil.
+	SourcePath func(file string, line int) string
+
+	// TimeLocation is passed on to the default handler, as
+	// HandlerOptions.TimeLocation: the zone times are rendered in.
+	TimeLocation *time.Location
+
+	// Deterministic makes the output of the default handler depend only on
+	// what is logged, so that two runs of a program produce identical logs
+	// to diff: no colors, times from Clock only, which leaves them out if
+	// Clock is nil, attributes sorted by key, and short source paths. Maps
+	// are rendered with sorted keys in any case.
+	Deterministic bool
+
+	// DeadlineSkip skips low-level records logged with a context whose
+	// deadline is close, so that formatting them doesn't compete with
+	// finishing the request. It is off when DeadlineSkip.Below is zero.
+	DeadlineSkip DeadlineSkip
+
+	// Drops, if set, collects the records left out by DeadlineSkip and by
+	// the components of the pipeline sharing it, and attaches their counts
+	// to the next record handled. See [Drops].
+	Drops *Drops
+
+	// ErrorDedup, if set, suppresses the repeats of the errors logged
+	// again and again. See [ErrorDedup].
+	ErrorDedup *ErrorDedup
+
+	// ErrorHandler is called when the handler fails to handle a record,
+	// errors being discarded otherwise. Repeats of the same error are
+	// reported at most once per second. Records logged while ErrorHandler
+	// runs, including through this logger, are written to os.Stderr
+	// directly instead of going back through the handler.
+	ErrorHandler func(err error, r Record)
+
+	// NewHandler creates the handler of the logger from the writer and
+	// options described above. If nil, a [TextHandler] is used.
+	//
+	// The Level of the options it receives follows the logger's level, so
+	// handlers must filter with it, not with a level of their own, for
+	// [Logger.SetLevel] to take effect. New reports on os.Stderr handlers
+	// that don't.
 	NewHandler func(w io.Writer, opts *slog.HandlerOptions) slog.Handler
 }
 
-var defaultLogger atomic.Value
+var defaultLogger atomic.Pointer[Logger]
 
 func init() {
-	defaultLogger.Store(New(nil))
+	l := New(nil)
+	defaultLogger.Store(&l)
 }
 
 func Default() Logger {
-	return defaultLogger.Load().(Logger)
+	return *defaultLogger.Load()
 }
 
 func SetDefault(l Logger) {
-	defaultLogger.Store(l)
+	defaultLogger.Store(&l)
 }
 
 func GetLevel() Level {
@@ -143,10 +336,53 @@ func Log(level Level, msg any, args ...any) {
 	Default().Log(level, msg, args...)
 }
 
+func LogSlog(ctx context.Context, level slog.Level, msg any, args ...any) {
+	Default().LogSlog(ctx, level, msg, args...)
+}
+
 func Trace(msg any, args ...any) { Default().Trace(msg, args...) }
 func Debug(msg any, args ...any) { Default().Debug(msg, args...) }
 func Info(msg any, args ...any)  { Default().Info(msg, args...) }
 func Warn(msg any, args ...any)  { Default().Warn(msg, args...) }
 func Error(msg any, args ...any) { Default().Error(msg, args...) }
+
+func TraceContext(ctx context.Context, msg any, args ...any) {
+	Default().TraceContext(ctx, msg, args...)
+}
+
+func DebugContext(ctx context.Context, msg any, args ...any) {
+	Default().DebugContext(ctx, msg, args...)
+}
+
+func InfoContext(ctx context.Context, msg any, args ...any) {
+	Default().InfoContext(ctx, msg, args...)
+}
+
+func WarnContext(ctx context.Context, msg any, args ...any) {
+	Default().WarnContext(ctx, msg, args...)
+}
+
+func ErrorContext(ctx context.Context, msg any, args ...any) {
+	Default().ErrorContext(ctx, msg, args...)
+}
+
 func Panic(msg any, args ...any) { Default().Panic(msg, args...) }
 func Fatal(msg any, args ...any) { Default().Fatal(msg, args...) }
+
+func Always(msg any, args ...any) { Default().Always(msg, args...) }
+
+// Pressure returns the pressure of the default Logger's pipeline.
+// See [Logger.Pressure].
+func Pressure() float64 { return Default().Pressure() }
+
+func Component(name string, opts ...ComponentOption) Logger {
+	return Default().Component(name, opts...)
+}
+
+func Span(msg string, args ...any) func() {
+	return Default().Span(msg, args...)
+}
+
+func SpanContext(ctx context.Context, msg string, args ...any) (context.Context, func()) {
+	return Default().SpanContext(ctx, msg, args...)
+}
@@ -0,0 +1,200 @@
+package log
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// LogfmtHandler writes records as strict logfmt lines, for ingestion
+// pipelines such as Vector or Promtail:
+//
+//	time=2024-06-01T12:00:00Z level=INFO msg="hello world" user.id=42
+//
+// Unlike TextHandler, it never writes terminal escape sequences, writes
+// times as RFC 3339 with nanoseconds and levels as a plain level= field,
+// and keeps every record on a single line: newlines in messages and values
+// are escaped rather than wrapped. Values are quoted only when they must
+// be, that is when they are empty or contain spaces, '=', quotes or
+// control characters. Groups are flattened into dot-joined keys.
+type LogfmtHandler struct {
+	opts         HandlerOptions
+	preformatted []byte // data from WithAttrs
+	prefix       string // group names from WithGroup, dot-terminated
+	groups       []string
+	mu           *sync.Mutex
+	out          io.Writer
+	children     *attrCache
+}
+
+// NewLogfmtHandler creates a LogfmtHandler that writes to out,
+// using the given options. If opts is nil, the default options are used.
+func NewLogfmtHandler(out io.Writer, opts *slog.HandlerOptions) *LogfmtHandler {
+	return NewLogfmtHandlerWithOptions(out, handlerOptions(opts))
+}
+
+// NewLogfmtHandlerWithOptions is like [NewLogfmtHandler] but accepts the
+// extended options of this package.
+func NewLogfmtHandlerWithOptions(out io.Writer, opts *HandlerOptions) *LogfmtHandler {
+	h := &LogfmtHandler{out: out, mu: &sync.Mutex{}, children: new(attrCache)}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelInfo
+	}
+	return h
+}
+
+func (h *LogfmtHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *LogfmtHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.children = new(attrCache)
+	h2.prefix = h.prefix + name + "."
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+func (h *LogfmtHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.children = new(attrCache)
+	h2.preformatted = slices.Clip(h.preformatted)
+	for _, a := range attrs {
+		h2.preformatted = h.appendAttr(h2.preformatted, h.prefix, h.groups, a)
+	}
+	return h.children.intern(h2.preformatted, &h2)
+}
+
+func (h *LogfmtHandler) Handle(_ context.Context, r slog.Record) error {
+	bufp := allocBuf()
+	buf := *bufp
+	defer func() {
+		*bufp = buf
+		freeBuf(bufp)
+	}()
+	if !r.Time.IsZero() {
+		buf = h.appendBuiltin(buf, slog.Time(slog.TimeKey, r.Time))
+	}
+	buf = h.appendBuiltin(buf, slog.Any(slog.LevelKey, r.Level))
+	if ev, ok := recordEvent(r); ok {
+		buf = h.appendBuiltin(buf, ev)
+	}
+	if h.opts.AddSource {
+		buf = h.appendBuiltin(buf, slog.String(slog.SourceKey, h.opts.source(r.PC)))
+	}
+	buf = h.appendBuiltin(buf, slog.String(slog.MessageKey, r.Message))
+	if t := h.opts.handledAt(); !t.IsZero() {
+		buf = h.appendBuiltin(buf, slog.Time(HandledAtKey, t))
+	}
+	if d, ok := h.opts.uptime(); ok {
+		buf = h.appendBuiltin(buf, slog.Duration(UptimeKey, d))
+	}
+	buf = append(buf, h.preformatted...)
+	h.opts.attrsAfterEvent(r, func(a slog.Attr) bool {
+		buf = h.appendAttr(buf, h.prefix, h.groups, a)
+		return true
+	})
+	buf = append(buf, '\n')
+	// Every field is preceded by a space; leave out the one of the first.
+	line := buf
+	if line[0] == ' ' {
+		line = line[1:]
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.out.Write(line)
+	return err
+}
+
+// appendBuiltin appends a built-in attribute, the level as the name of
+// the level of this package.
+func (h *LogfmtHandler) appendBuiltin(buf []byte, a slog.Attr) []byte {
+	a, ok := h.opts.builtin(a)
+	if !ok {
+		return buf
+	}
+	if a.Key == slog.LevelKey && isSlogLevel(a.Value) {
+		a.Value = slog.StringValue(levelToString(a.Value.Any().(slog.Level)))
+	}
+	return appendLogfmtField(buf, "", a.Key, a.Value)
+}
+
+// appendAttr appends the fields of a, in the groups of prefix.
+func (h *LogfmtHandler) appendAttr(buf []byte, prefix string, groups []string, a slog.Attr) []byte {
+	a, ok := h.opts.field(groups, a)
+	if !ok {
+		return buf
+	}
+	return flattenAttr(buf, prefix, a, func(buf []byte, prefix string, a slog.Attr) []byte {
+		return appendLogfmtField(buf, prefix, a.Key, a.Value)
+	})
+}
+
+// appendLogfmtField appends " key=value", with the key prefixed by the
+// dot-joined names of its groups.
+func appendLogfmtField(buf []byte, prefix, key string, v slog.Value) []byte {
+	buf = append(buf, ' ')
+	buf = appendLogfmtKey(buf, prefix)
+	buf = appendLogfmtKey(buf, key)
+	buf = append(buf, '=')
+	if v.Kind() == slog.KindString {
+		return appendLogfmtString(buf, v.String())
+	}
+	start := len(buf)
+	buf = appendValue(buf, v)
+	if needsLogfmtQuoting(string(buf[start:])) {
+		s := string(buf[start:])
+		buf = strconv.AppendQuote(buf[:start], s)
+	}
+	return buf
+}
+
+// appendLogfmtKey appends a key, replacing the characters that would end
+// it or break the line by underscores.
+func appendLogfmtKey(buf []byte, key string) []byte {
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f || r == utf8.RuneError {
+			r = '_'
+		}
+		buf = utf8.AppendRune(buf, r)
+	}
+	return buf
+}
+
+// appendLogfmtString appends s, quoted only if needed.
+func appendLogfmtString(buf []byte, s string) []byte {
+	if needsLogfmtQuoting(s) {
+		return strconv.AppendQuote(buf, s)
+	}
+	return append(buf, s...)
+}
+
+// needsLogfmtQuoting reports whether s must be quoted to be read back as
+// a single logfmt value.
+func needsLogfmtQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		switch {
+		case r <= ' ', r == '=', r == '"', r == '\\', r == 0x7f, r == utf8.RuneError:
+			return true
+		case r >= 0x80 && !strconv.IsPrint(r):
+			return true
+		}
+	}
+	return false
+}
@@ -7,10 +7,9 @@ import (
 	"log/slog"
 	"os"
 	"runtime"
+	"slices"
 	"sync/atomic"
 	"time"
-
-	"zestack.dev/color"
 )
 
 type leveler struct {
@@ -18,17 +17,52 @@ type leveler struct {
 }
 
 func (l *leveler) Level() slog.Level {
+	if sl := l.l.slogLevel; sl != nil {
+		return sl.Level()
+	}
 	return l.l.Level().Level()
 }
 
 type writer struct {
-	l *logger
+	l   *logger
+	tty atomic.Pointer[terminalState] // of the output last asked about
+}
+
+// terminalState records whether an output of a logger, as stored by
+// SetOutput, writes to a terminal.
+type terminalState struct {
+	out      *io.Writer
+	terminal bool
 }
 
 func (w *writer) Write(p []byte) (n int, err error) {
 	return w.l.Output().Write(p)
 }
 
+// WriteString writes s to the current output, without converting it to
+// a byte slice if the output is an io.StringWriter.
+func (w *writer) WriteString(s string) (n int, err error) {
+	return io.WriteString(w.l.Output(), s)
+}
+
+// discards reports whether the current output is io.Discard, for the
+// handlers to report themselves disabled.
+func (w *writer) discards() bool {
+	return w.l.Output() == io.Discard
+}
+
+// terminal reports whether the current output writes to a terminal,
+// asking again only when SetOutput has replaced it.
+func (w *writer) terminal() bool {
+	out := w.l.out.Load()
+	if st := w.tty.Load(); st != nil && st.out == out {
+		return st.terminal
+	}
+	st := &terminalState{out: out, terminal: isTerminal(*out)}
+	w.tty.Store(st)
+	return st.terminal
+}
+
 func (w *writer) Fd() uintptr {
 	o := w.l.Output()
 	if x, ok := o.(interface{ Fd() uintptr }); ok {
@@ -38,69 +72,185 @@ func (w *writer) Fd() uintptr {
 }
 
 type logger struct {
-	level   atomic.Int32 // Level
-	out     atomic.Value // io.Writer
-	handler atomic.Value // slog.Handler
+	level   *atomic.Int32              // Level, shared with clones
+	out     *atomic.Pointer[io.Writer] // io.Writer, shared with clones
+	handler atomic.Pointer[slog.Handler]
+	errs    *errorReporter
+	callers *CallerFilter
+	clock   func() time.Time // time of the records, nil for time.Now
+	skip    DeadlineSkip
+	drops   *Drops
+	dedup   *ErrorDedup
+
+	// slogLevel is Options.Leveler, shared with clones: if set, the level
+	// follows it instead of level.
+	slogLevel slog.Leveler
+
+	// build creates a handler like the one New creates, writing to w at
+	// level, for Component; scope holds the With and WithGroup calls that
+	// led from that handler to the current one.
+	build func(w io.Writer, level slog.Leveler) slog.Handler
+	scope []scopeOp
+
+	// fixedOutput is set when Options.DisableOutputIndirection is used;
+	// the handler then owns its writer and SetOutput has no effect.
+	fixedOutput bool
+
+	// custom is set when the handler was set with SetHandler, or derived
+	// from one that was: build then doesn't create it.
+	custom atomic.Bool
 }
 
-func defaultNewHandler(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
-	writer, ok := w.(color.Writer)
-	if !ok {
-		writer = color.NewWriter(w)
+// defaultNewHandler returns the NewHandler used when Options.NewHandler
+// is nil, which also honors the options of opts meant for the handlers
+// of this package.
+func defaultNewHandler(opts *Options) func(w io.Writer, o *slog.HandlerOptions) slog.Handler {
+	return func(w io.Writer, o *slog.HandlerOptions) slog.Handler {
+		ho := handlerOptions(o)
+		ho.ReplaceGroup = opts.ReplaceGroup
+		ho.Clock = opts.clock()
+		ho.NoColor = opts.NoColor
+		ho.ForceColor = opts.ForceColor
+		ho.TimeLocation = opts.TimeLocation
+		ho.SourcePath = opts.SourcePath
+		if opts.Deterministic {
+			ho.NoColor = true
+			ho.ForceColor = false
+			ho.SortAttrs = true
+			ho.ShortSource = true
+		}
+		return NewTextHandlerWithOptions(w, ho)
 	}
-	return NewTextHandler(writer, opts)
 }
 
+// New returns a Logger configured by opts, or by the default options if
+// opts is nil. The Logger keeps a copy of opts: changing them afterwards,
+// or passing them to New again, doesn't affect it.
 func New(opts *Options) Logger {
-	if opts == nil {
-		opts = &Options{
-			Level: LevelInfo,
-		}
+	o := Options{Level: LevelInfo}
+	if opts != nil {
+		o = *opts
 	}
+	opts = &o
 	if opts.Writer == nil {
 		opts.Writer = os.Stderr
 	}
 	if opts.NewHandler == nil {
-		opts.NewHandler = defaultNewHandler
+		opts.NewHandler = defaultNewHandler(opts)
 	}
 
 	l := new(logger)
-	l.SetLevel(opts.Level)
-	l.SetOutput(opts.Writer)
-	l.SetHandler(opts.NewHandler(&writer{l}, &slog.HandlerOptions{
-		AddSource:   opts.AddSource,
-		Level:       &leveler{l},
-		ReplaceAttr: opts.ReplaceAttr,
-	}))
+	l.level = new(atomic.Int32)
+	l.out = new(atomic.Pointer[io.Writer])
+	l.errs = &errorReporter{fn: opts.ErrorHandler}
+	l.callers = opts.CallerFilter
+	l.clock = opts.clock()
+	l.skip = opts.DeadlineSkip
+	l.drops = opts.Drops
+	l.dedup = opts.ErrorDedup
+	l.fixedOutput = opts.DisableOutputIndirection
+	l.slogLevel = opts.Leveler
+	if l.slogLevel == nil {
+		l.SetLevel(opts.Level)
+	}
+	l.out.Store(&opts.Writer)
+
+	l.build = func(w io.Writer, level slog.Leveler) slog.Handler {
+		return opts.NewHandler(w, &slog.HandlerOptions{
+			AddSource:   opts.AddSource,
+			Level:       level,
+			ReplaceAttr: opts.ReplaceAttr,
+		})
+	}
+	var w io.Writer = &writer{l: l}
+	if l.fixedOutput {
+		w = opts.Writer
+	}
+	l.setHandler(l.build(w, &leveler{l}))
+	l.checkLevel(w)
+	if opts.Describe {
+		l.describe(opts)
+	}
 
 	return l
 }
 
+// checkLevel warns on os.Stderr, once per logger, when the handler does
+// not follow the logger's level. That happens when a custom NewHandler
+// ignores the Level of the options it is given, in which case SetLevel
+// appears to do nothing.
+func (l *logger) checkLevel(w io.Writer) {
+	if l.Handler() == DiscardHandler || l.Output() == io.Discard {
+		// Disabled at all levels, as the Text handler is then.
+		return
+	}
+	// The probe goes through a handler built for it, with a level of its
+	// own: the level of l may be a Leveler owned by the caller.
+	probe := new(slog.LevelVar)
+	h := l.build(w, probe)
+	ctx := context.Background()
+	for _, p := range []Level{LevelTrace, LevelFatal + 1} {
+		probe.Set(p.Level())
+		for _, lv := range []Level{LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError} {
+			if h.Enabled(ctx, lv.Level()) != (lv >= p) {
+				fmt.Fprintf(os.Stderr, "log: handler %T does not follow the logger level (%s); "+
+					"NewHandler should pass the options it receives to the handler\n", h, l.Level())
+				return
+			}
+		}
+	}
+}
+
 func (l *logger) Output() io.Writer {
-	return l.out.Load().(io.Writer)
+	return *l.out.Load()
 }
 
+// SetOutput changes the writer used by l and by every Logger derived
+// from it with With or WithGroup, since they share one handler chain.
 func (l *logger) SetOutput(w io.Writer) {
-	l.out.Store(w)
+	if l.fixedOutput {
+		fmt.Fprintln(os.Stderr, "log: SetOutput ignored: the handler owns its writer (Options.DisableOutputIndirection)")
+		return
+	}
+	l.out.Store(&w)
 }
 
 // Handler returns l's Handler.
 func (l *logger) Handler() slog.Handler {
-	return l.handler.Load().(slog.Handler)
+	return *l.handler.Load()
 }
 
+// SetHandler replaces the handler of l. The Loggers derived from l
+// afterwards, Component included, derive their handlers from h.
 func (l *logger) SetHandler(h slog.Handler) {
-	l.handler.Store(h)
+	l.setHandler(h)
+	l.custom.Store(true)
+}
+
+// setHandler sets the handler of l, built by New or derived from the
+// handler of another Logger.
+func (l *logger) setHandler(h slog.Handler) {
+	l.handler.Store(&h)
 }
 
 // Level 返回开启的日志等级
 func (l *logger) Level() Level {
+	if l.slogLevel != nil {
+		return FromSlogLevel(l.slogLevel.Level())
+	}
 	return Level(l.level.Load())
 }
 
-// SetLevel 设置开启的日志等级
+// SetLevel 设置开启的日志等级，
+// 由 With 与 WithGroup 派生的 Logger 共享同一个等级。
+// Options.Leveler 不是 *slog.LevelVar 时无效果。
 func (l *logger) SetLevel(level Level) {
-	l.level.Store(int32(level))
+	switch v := l.slogLevel.(type) {
+	case nil:
+		l.level.Store(int32(level))
+	case *slog.LevelVar:
+		v.Set(level.Level())
+	}
 }
 
 // Enabled 判断指定的日志级别是否开启
@@ -111,11 +261,43 @@ func (l *logger) Enabled(ctx context.Context, level Level) bool {
 	return l.Handler().Enabled(ctx, level.Level())
 }
 
+// now returns the time of a record logged now.
+func (l *logger) now() time.Time {
+	if l.clock != nil {
+		return l.clock()
+	}
+	return time.Now()
+}
+
+// clock returns the clock of the logger: Clock if set, a clock stopped at
+// the zero time for Deterministic, and nil for time.Now otherwise.
+func (opts *Options) clock() func() time.Time {
+	switch {
+	case opts.Clock != nil:
+		return opts.Clock
+	case opts.Deterministic:
+		return func() time.Time { return time.Time{} }
+	default:
+		return nil
+	}
+}
+
 func (l *logger) clone(h slog.Handler) *logger {
 	c := new(logger)
-	c.SetLevel(l.Level())
-	c.SetOutput(l.Output())
-	c.SetHandler(h)
+	c.out = l.out
+	c.errs = l.errs
+	c.callers = l.callers
+	c.clock = l.clock
+	c.skip = l.skip
+	c.drops = l.drops
+	c.dedup = l.dedup
+	c.fixedOutput = l.fixedOutput
+	c.level = l.level
+	c.slogLevel = l.slogLevel
+	c.build = l.build
+	c.scope = l.scope
+	c.custom.Store(l.custom.Load())
+	c.setHandler(h)
 	return c
 }
 
@@ -123,44 +305,36 @@ func (l *logger) With(args ...any) Logger {
 	if len(args) == 0 {
 		return l
 	}
-	return l.clone(l.Handler().WithAttrs(argsToAttrSlice(args)))
+	attrs := expandDetails(context.Background(), l.Handler(), argsToAttrSlice(args))
+	c := l.clone(l.Handler().WithAttrs(attrs))
+	c.scope = append(slices.Clip(l.scope), scopeOp{attrs: attrs})
+	return c
 }
 
 func (l *logger) WithGroup(name string) Logger {
 	if name == "" {
 		return l
 	}
-	return l.clone(l.Handler().WithGroup(name))
+	c := l.clone(l.Handler().WithGroup(name))
+	c.scope = append(slices.Clip(l.scope), scopeOp{group: name})
+	return c
 }
 
-func (l *logger) log(ctx context.Context, level Level, msg any, args []any) string {
-	if !l.Enabled(ctx, level) {
-		if level != LevelPanic {
+func (l *logger) log(ctx context.Context, level slog.Level, msg any, args []any) string {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	forced := IsForced(ctx)
+	if !forced && l.skip.skip(ctx, level) {
+		l.drops.Add(DropDeadline, 1)
+		return ""
+	}
+	if !forced && !l.Handler().Enabled(ctx, level) {
+		if level != LevelPanic.Level() {
 			return ""
 		}
-		var sprintArgs []any
-		var format string
-		if _, ok := msg.(Attr); ok {
-			// ignore
-		} else if s, ok := msg.(string); ok {
-			format = s
-		} else {
-			sprintArgs = append(sprintArgs, msg)
-		}
-		if len(args) > 0 {
-			for _, arg := range args {
-				switch arg.(type) {
-				case Attr:
-					// ignore
-				default:
-					sprintArgs = append(sprintArgs, arg)
-				}
-			}
-		}
-		if format == "" {
-			return fmt.Sprint(sprintArgs...)
-		}
-		return fmt.Sprintf(format, sprintArgs...)
+		str, _ := messageAndAttrs(msg, args)
+		return str
 	}
 
 	var pc uintptr
@@ -169,80 +343,146 @@ func (l *logger) log(ctx context.Context, level Level, msg any, args []any) stri
 	runtime.Callers(3, pcs[:])
 	pc = pcs[0]
 
-	r := slog.NewRecord(time.Now(), level.Level(), "", pc)
-
-	var sprintArgs []any
-	var attrs []Attr
-	var format string
-
-	if a, ok := msg.(Attr); ok {
-		attrs = append(attrs, a)
-	} else if s, ok := msg.(string); ok {
-		format = s
-	} else {
-		sprintArgs = append(sprintArgs, msg)
-	}
-
-	if len(args) > 0 {
-		for _, arg := range args {
-			switch v := arg.(type) {
-			case Attr:
-				attrs = append(attrs, v)
-			default:
-				sprintArgs = append(sprintArgs, arg)
-			}
+	// Apply the caller rules now that the PC is known. A dropped Panic
+	// record still needs its message for the panic value.
+	var dropped bool
+	if l.callers != nil {
+		panicking := level == LevelPanic.Level()
+		var keep bool
+		level, keep = l.callers.apply(pc, level)
+		dropped = !keep || !forced && !l.Handler().Enabled(ctx, level)
+		if dropped && !panicking {
+			return ""
 		}
 	}
 
-	if format == "" {
-		r.Message = fmt.Sprint(sprintArgs...)
-	} else {
-		r.Message = fmt.Sprintf(format, sprintArgs...)
-	}
-	str := r.Message
-
+	str, attrs := messageAndAttrs(msg, args)
+	attrs = expandDetails(ctx, l.Handler(), attrs)
+	r := slog.NewRecord(l.now(), level, str, pc)
 	if len(attrs) > 0 {
 		r.AddAttrs(attrs...)
 	}
 
-	if ctx == nil {
-		ctx = context.Background()
+	if dropped {
+		return str
+	}
+	if l.dedup != nil && !forced && level < LevelPanic.Level() {
+		if err := recordError(msg, attrs); err != nil {
+			suppress, repeats := l.dedup.check(err, r.Time)
+			if suppress {
+				l.drops.Add(DropDuplicate, 1)
+				return str
+			}
+			if repeats > 0 {
+				r.AddAttrs(Int64(ErrorRepeatsKey, repeats))
+			}
+		}
+	}
+	if inHook() {
+		writeRaw(FromSlogLevel(level), str)
+		return str
 	}
 
-	_ = l.Handler().Handle(ctx, r)
+	if err := l.handle(ctx, r); err != nil {
+		l.errs.report(err, r)
+	} else {
+		l.errs.ok()
+	}
 
 	return str
 }
 
 func (l *logger) Log(level Level, msg any, args ...any) {
-	l.log(nil, level, msg, args)
+	l.log(nil, level.Level(), msg, args)
+}
+
+// LogSlog is like Log but takes the level as a slog.Level, which is kept
+// as is in the record. Levels between the ones of this package therefore
+// reach the handler without being rounded.
+func (l *logger) LogSlog(ctx context.Context, level slog.Level, msg any, args ...any) {
+	l.log(ctx, level, msg, args)
 }
 
 func (l *logger) Trace(msg any, args ...any) {
-	l.log(nil, LevelTrace, msg, args)
+	l.log(nil, LevelTrace.Level(), msg, args)
 }
 
 func (l *logger) Debug(msg any, args ...any) {
-	l.log(nil, LevelDebug, msg, args)
+	l.log(nil, LevelDebug.Level(), msg, args)
 }
 
 func (l *logger) Info(msg any, args ...any) {
-	l.log(nil, LevelInfo, msg, args)
+	l.log(nil, LevelInfo.Level(), msg, args)
 }
 
 func (l *logger) Warn(msg any, args ...any) {
-	l.log(nil, LevelWarn, msg, args)
+	l.log(nil, LevelWarn.Level(), msg, args)
 }
 
 func (l *logger) Error(msg any, args ...any) {
-	l.log(nil, LevelError, msg, args)
+	l.log(nil, LevelError.Level(), msg, args)
 }
 
+func (l *logger) TraceContext(ctx context.Context, msg any, args ...any) {
+	l.log(ctx, LevelTrace.Level(), msg, args)
+}
+
+func (l *logger) DebugContext(ctx context.Context, msg any, args ...any) {
+	l.log(ctx, LevelDebug.Level(), msg, args)
+}
+
+func (l *logger) InfoContext(ctx context.Context, msg any, args ...any) {
+	l.log(ctx, LevelInfo.Level(), msg, args)
+}
+
+func (l *logger) WarnContext(ctx context.Context, msg any, args ...any) {
+	l.log(ctx, LevelWarn.Level(), msg, args)
+}
+
+func (l *logger) ErrorContext(ctx context.Context, msg any, args ...any) {
+	l.log(ctx, LevelError.Level(), msg, args)
+}
+
+// Panic logs at LevelPanic with the call stack attached under StackKey,
+// flushes the flushers registered with RegisterFlusher, then panics with
+// a *PanicError carrying the message and the stack. The panic happens even
+// if LevelPanic is disabled.
+//
+// If msg or one of args is an error, it is attached under ErrorKey, unless
+// it is already the value of an attribute, along with the types of the
+// errors it wraps, and the PanicError wraps it.
 func (l *logger) Panic(msg any, args ...any) {
-	panic(l.log(nil, LevelPanic, msg, args))
+	stack := captureStack()
+	err, attached := findError(msg, args)
+	args = args[:len(args):len(args)]
+	if err != nil {
+		args = append(args, errorAttrs(err, attached)...)
+	}
+	args = append(args, Any(StackKey, stack))
+	message := l.log(nil, LevelPanic.Level(), msg, args)
+	flushAll(crashFlushTimeout)
+	panic(&PanicError{
+		Message: message,
+		Err:     err,
+		Stack:   stack,
+	})
 }
 
+// Fatal logs at LevelFatal with the call stack attached under StackKey,
+// flushes the flushers registered with RegisterFlusher, runs the hooks
+// registered with RegisterExitHook, then exits the program with status 1.
+//
+// If msg or one of args is an error, it is attached under ErrorKey, unless
+// it is already the value of an attribute, along with the types of the
+// errors it wraps, and passed to the exit hooks.
 func (l *logger) Fatal(msg any, args ...any) {
-	l.log(nil, LevelFatal, msg, args)
-	os.Exit(1)
+	err, attached := findError(msg, args)
+	args = args[:len(args):len(args)]
+	if err != nil {
+		args = append(args, errorAttrs(err, attached)...)
+	}
+	args = append(args, Any(StackKey, captureStack()))
+	l.log(nil, LevelFatal.Level(), msg, args)
+	flushAll(crashFlushTimeout)
+	exit(err)
 }
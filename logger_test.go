@@ -0,0 +1,218 @@
+package log_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"zestack.dev/log"
+)
+
+func TestNewHandlerWriterIndirection(t *testing.T) {
+	var first, second bytes.Buffer
+	var given io.Writer
+	l := log.New(&log.Options{
+		Writer: &first,
+		NewHandler: func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+			given = w
+			return slog.NewTextHandler(w, opts)
+		},
+	})
+	if given == io.Writer(&first) {
+		t.Fatal("NewHandler received Options.Writer rather than the indirection writer")
+	}
+	l.Info("one")
+	l.SetOutput(&second)
+	l.Info("two")
+	l.With("k", "v").Info("three")
+	if got := first.String(); !strings.Contains(got, "msg=one") || strings.Contains(got, "two") {
+		t.Errorf("first output: got %q, want only the first record", got)
+	}
+	if got := second.String(); !strings.Contains(got, "msg=two") || !strings.Contains(got, "msg=three") {
+		t.Errorf("second output: got %q, want the records after SetOutput", got)
+	}
+	if l.Output() != io.Writer(&second) {
+		t.Error("Output doesn't return the writer set with SetOutput")
+	}
+}
+
+func TestDisableOutputIndirection(t *testing.T) {
+	var first, second bytes.Buffer
+	var given io.Writer
+	l := log.New(&log.Options{
+		Writer:                   &first,
+		DisableOutputIndirection: true,
+		NewHandler: func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+			given = w
+			return slog.NewTextHandler(w, opts)
+		},
+	})
+	if given != io.Writer(&first) {
+		t.Fatalf("NewHandler received %T, want Options.Writer", given)
+	}
+	l.SetOutput(&second)
+	l.Info("one")
+	if !strings.Contains(first.String(), "msg=one") || second.Len() != 0 {
+		t.Errorf("got %q and %q, want the record in the handler's own writer", first.String(), second.String())
+	}
+}
+
+func TestSetOutputDefaultHandler(t *testing.T) {
+	var first, second bytes.Buffer
+	l := log.New(&log.Options{Writer: &first, Level: log.LevelInfo, NoColor: true})
+	child := l.WithGroup("g").With("k", 1)
+	l.SetOutput(&second)
+	child.Info("moved")
+	if first.Len() != 0 || !strings.Contains(second.String(), "moved") {
+		t.Errorf("got %q and %q, want the record of the child in the new output", first.String(), second.String())
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	var buf bytes.Buffer
+	l := log.New(&log.Options{Writer: &buf, Deterministic: true, Describe: true, Level: log.LevelError})
+	l.Info("not logged")
+	log.CheckGolden(t, "describe.golden", buf.Bytes())
+}
+
+func TestDescribeRotatingFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	f, err := log.OpenRotatingFile(name, log.RotatingFileOptions{
+		MaxSize:    10 << 20,
+		MaxBackups: 5,
+		MaxAge:     7 * 24 * time.Hour,
+		Schedule:   log.RotateDaily,
+		Compress:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	log.New(&log.Options{
+		Writer:        f,
+		Deterministic: true,
+		Describe:      true,
+		NewHandler: func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+			return log.NewJSONHandler(w, opts)
+		},
+	})
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.CheckGolden(t, "describe_rotating.golden", bytes.ReplaceAll(got, []byte(name), []byte("app.log")))
+}
+
+// deterministicRun logs with a Deterministic logger what a program could,
+// in an order of attributes and of map keys that changes between runs.
+func deterministicRun(addSource bool) []byte {
+	var buf bytes.Buffer
+	l := log.New(&log.Options{Writer: &buf, Deterministic: true, AddSource: addSource, Level: log.LevelDebug})
+	limits := map[string]int{}
+	for i, k := range []string{"cpu", "mem", "disk", "net", "fds", "procs", "threads", "pipes"} {
+		limits[k] = i * 10
+	}
+	l.Info("starting", "version", "1.2.0", "limits", limits, "args", []string{"-v", "serve"})
+	l.With("component", "db").WithGroup("pool").Debug("connected", "size", 4, "addr", "10.0.0.2:5432")
+	l.Warn("slow request", log.Group("req", "path", "/users", "id", 7), "ms", 250, "attempt", 2)
+	l.Error("failed", "err", errors.New("connection reset"), "at", time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	return buf.Bytes()
+}
+
+func TestDeterministic(t *testing.T) {
+	first := deterministicRun(false)
+	for i := 0; i < 10; i++ {
+		if got := deterministicRun(false); !bytes.Equal(got, first) {
+			t.Fatalf("runs differ:\n%s\n%s", first, got)
+		}
+	}
+	log.CheckGolden(t, "deterministic.golden", first)
+}
+
+func TestDeterministicSource(t *testing.T) {
+	first := deterministicRun(true)
+	if got := deterministicRun(true); !bytes.Equal(got, first) {
+		t.Fatalf("runs differ:\n%s\n%s", first, got)
+	}
+	if !bytes.Contains(first, []byte(`/logger_test.go:`)) || bytes.Contains(first, []byte(`source="/`)) {
+		t.Errorf("the source paths aren't short:\n%s", first)
+	}
+}
+
+func TestNewCopiesOptions(t *testing.T) {
+	var first, second bytes.Buffer
+	opts := &log.Options{Writer: &first, Deterministic: true}
+	l1 := log.New(opts)
+	if opts.NewHandler != nil {
+		t.Error("New changed the options given")
+	}
+	opts.Writer = &second
+	opts.Deterministic = false
+	opts.NoColor = true
+	l2 := log.New(opts)
+
+	l1.Info("one")
+	l2.Info("two")
+	if got, want := first.String(), "|  INFO | one \n"; got != want {
+		t.Errorf("the first logger wrote %q, want %q", got, want)
+	}
+	if got := second.String(); !strings.HasSuffix(got, "|  INFO | two \n") || got == "|  INFO | two \n" {
+		t.Errorf("the second logger wrote %q, want a record with its time", got)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// Writers and handlers of different types can be swapped with one
+// another, while logging goes on.
+func TestConcurrentSwap(t *testing.T) {
+	l := log.New(&log.Options{Writer: io.Discard})
+	writers := []io.Writer{io.Discard, new(syncBuffer), log.NewMemorySink(1 << 10), io.MultiWriter(io.Discard, new(syncBuffer))}
+	handlers := []func() slog.Handler{
+		func() slog.Handler { return log.NewTextHandler(new(syncBuffer), nil) },
+		func() slog.Handler { return log.NewJSONHandler(new(syncBuffer), nil) },
+		func() slog.Handler { return slog.NewTextHandler(io.Discard, nil) },
+		func() slog.Handler { return log.NewRingHandler(16) },
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(3)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				l.SetOutput(writers[(i+g)%len(writers)])
+				_ = l.Output()
+			}
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				l.(interface{ SetHandler(slog.Handler) }).SetHandler(handlers[(i+g)%len(handlers)]())
+			}
+		}(g)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				l.Info("swapping", "i", i)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,193 @@
+package logtest
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"zestack.dev/log"
+)
+
+// Captured is a record handled by a CaptureHandler, with its attributes
+// flattened: the keys of the attributes in groups, those added with
+// WithGroup included, are joined by dots, as in "req.id".
+type Captured struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	Attrs   map[string]slog.Value
+}
+
+// CaptureHandler records the records it handles, for tests to make
+// assertions on them instead of parsing the output of a handler. It is
+// safe for concurrent use, as by parallel tests sharing it.
+type CaptureHandler struct {
+	c      *capture
+	level  slog.Leveler // nil for all levels
+	prefix string       // group names from WithGroup, dot-terminated
+	attrs  []flatAttr   // from WithAttrs
+}
+
+// capture holds the records of a CaptureHandler and the handlers derived
+// from it.
+type capture struct {
+	mu      sync.Mutex
+	records []Captured
+}
+
+// flatAttr is an attribute with its dotted key.
+type flatAttr struct {
+	key   string
+	value slog.Value
+}
+
+// NewCaptureHandler returns a CaptureHandler recording the records at
+// level or above, or all records if level is nil.
+func NewCaptureHandler(level slog.Leveler) *CaptureHandler {
+	return &CaptureHandler{c: &capture{}, level: level}
+}
+
+// NewTestLogger returns a Logger at LevelTrace recording its records in
+// the returned CaptureHandler:
+//
+//	l, capture := logtest.NewTestLogger(t)
+//	run(l)
+//	if !capture.Has("request failed", log.Int("status", 500)) {
+//		t.Errorf("no failure logged: %v", capture.Entries())
+//	}
+func NewTestLogger(t testing.TB) (log.Logger, *CaptureHandler) {
+	t.Helper()
+	h := NewCaptureHandler(nil)
+	l := log.New(&log.Options{
+		Level: log.LevelTrace,
+		NewHandler: func(_ io.Writer, opts *slog.HandlerOptions) slog.Handler {
+			// Handlers built again, as for components, share the records.
+			return &CaptureHandler{c: h.c, level: opts.Level}
+		},
+	})
+	return l, h
+}
+
+func (h *CaptureHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.level == nil || level >= h.level.Level()
+}
+
+func (h *CaptureHandler) Handle(_ context.Context, r slog.Record) error {
+	c := Captured{
+		Time:    r.Time,
+		Level:   r.Level,
+		Message: r.Message,
+		Attrs:   make(map[string]slog.Value, len(h.attrs)+r.NumAttrs()),
+	}
+	for _, a := range h.attrs {
+		c.Attrs[a.key] = a.value
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		for _, fa := range flatten(nil, h.prefix, a) {
+			c.Attrs[fa.key] = fa.value
+		}
+		return true
+	})
+	h.c.mu.Lock()
+	defer h.c.mu.Unlock()
+	h.c.records = append(h.c.records, c)
+	return nil
+}
+
+// flatten appends a, in groups under prefix, as attributes with dotted
+// keys. Empty attributes are left out, and so are the keys of groups
+// without one.
+func flatten(attrs []flatAttr, prefix string, a slog.Attr) []flatAttr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		if a.Equal(slog.Attr{}) {
+			return attrs
+		}
+		return append(attrs, flatAttr{prefix + a.Key, a.Value})
+	}
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, ga := range a.Value.Group() {
+		attrs = flatten(attrs, prefix, ga)
+	}
+	return attrs
+}
+
+func (h *CaptureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = slices.Clip(h.attrs)
+	for _, a := range attrs {
+		h2.attrs = flatten(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+func (h *CaptureHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// Entries returns the records recorded, oldest first.
+func (h *CaptureHandler) Entries() []Captured {
+	h.c.mu.Lock()
+	defer h.c.mu.Unlock()
+	return slices.Clone(h.c.records)
+}
+
+// FilterLevel returns the records recorded at level or above, oldest
+// first.
+func (h *CaptureHandler) FilterLevel(level log.Level) []Captured {
+	var records []Captured
+	for _, c := range h.Entries() {
+		if c.Level >= level.Level() {
+			records = append(records, c)
+		}
+	}
+	return records
+}
+
+// Has reports whether a record with message msg, and with attributes
+// equal to attrs, was recorded. The keys of attrs in groups are dotted, as
+// in Captured.Attrs; the record may have other attributes.
+func (h *CaptureHandler) Has(msg string, attrs ...slog.Attr) bool {
+	var want []flatAttr
+	for _, a := range attrs {
+		want = flatten(want, "", a)
+	}
+	for _, c := range h.Entries() {
+		if c.Message == msg && c.matches(want) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether c has the attributes want.
+func (c Captured) matches(want []flatAttr) bool {
+	for _, a := range want {
+		v, ok := c.Attrs[a.key]
+		if !ok || !v.Equal(a.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Reset forgets the records recorded so far.
+func (h *CaptureHandler) Reset() {
+	h.c.mu.Lock()
+	defer h.c.mu.Unlock()
+	h.c.records = nil
+}
@@ -0,0 +1,180 @@
+// Package logtest checks that a handler meets the expectations of
+// zestack.dev/log, for authors of handlers meant for Options.NewHandler,
+// and captures the records of a Logger for the tests of code that logs.
+package logtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/slogtest"
+	"time"
+
+	"zestack.dev/log"
+)
+
+// Entry is a record as parsed from the output of a handler: the keys of
+// its attributes mapped to their values, groups being nested Entries.
+// The level must be parsed as the string the handler wrote.
+type Entry = map[string]any
+
+// TestHandlerConformance checks the handlers returned by newHandler, which
+// takes the same arguments as Options.NewHandler, against the tests of
+// testing/slogtest and the additional expectations of this package:
+//
+//   - levels of this package render as their names, such as "TRACE";
+//   - each record is written with a single call to Write;
+//   - ReplaceAttr receives the groups that contain each attribute;
+//   - attributes added with WithAttrs to a handler don't show up in the
+//     records of its siblings.
+//
+// parse turns the output of a handler into one Entry per record.
+func TestHandlerConformance(t *testing.T, newHandler func(w io.Writer, opts *slog.HandlerOptions) slog.Handler, parse func([]byte) ([]Entry, error)) {
+	t.Helper()
+	t.Run("slogtest", func(t *testing.T) {
+		var buf bytes.Buffer
+		h := newHandler(&buf, nil)
+		err := slogtest.TestHandler(h, func() []map[string]any {
+			entries, err := parse(buf.Bytes())
+			if err != nil {
+				t.Fatalf("parsing output: %v", err)
+			}
+			return entries
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("LevelNames", func(t *testing.T) {
+		levels := []log.Level{log.LevelTrace, log.LevelDebug, log.LevelInfo, log.LevelWarn, log.LevelError, log.LevelPanic, log.LevelFatal}
+		var buf bytes.Buffer
+		h := newHandler(&buf, &slog.HandlerOptions{Level: log.LevelTrace.Level()})
+		for _, level := range levels {
+			handle(t, h, level.Level(), "msg")
+		}
+		entries := mustParse(t, parse, buf.Bytes(), len(levels))
+		for i, level := range levels {
+			if got := entries[i][slog.LevelKey]; got != level.String() {
+				t.Errorf("level %s rendered as %v", level, got)
+			}
+		}
+	})
+	t.Run("OneWritePerRecord", func(t *testing.T) {
+		w := &countingWriter{}
+		h := newHandler(w, nil)
+		h = h.WithAttrs([]slog.Attr{slog.String("a", "b")}).WithGroup("g")
+		const n = 5
+		for i := 0; i < n; i++ {
+			handle(t, h, slog.LevelInfo, "line one\nline two", slog.Int("i", i), slog.Group("h", slog.Int("j", i)))
+		}
+		if w.writes != n {
+			t.Errorf("%d records written with %d calls to Write, want %d", n, w.writes, n)
+		}
+	})
+	t.Run("ReplaceAttrGroups", func(t *testing.T) {
+		var (
+			mu  sync.Mutex
+			got []string
+		)
+		opts := &slog.HandlerOptions{ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && slices.Contains([]string{slog.TimeKey, slog.LevelKey, slog.MessageKey, slog.SourceKey}, a.Key) {
+				return a
+			}
+			mu.Lock()
+			got = append(got, strings.Join(append(slices.Clip(groups), a.Key), "."))
+			mu.Unlock()
+			return a
+		}}
+		h := newHandler(io.Discard, opts)
+		h = h.WithGroup("g").WithAttrs([]slog.Attr{slog.Int("a", 1)}).WithGroup("h")
+		handle(t, h, slog.LevelInfo, "msg", slog.Int("b", 2), slog.Group("i", slog.Int("c", 3)))
+		want := []string{"g.a", "g.h.b", "g.h.i.c"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ReplaceAttr called with %q, want %q", got, want)
+		}
+	})
+	t.Run("WithAttrsIsolation", func(t *testing.T) {
+		var buf bytes.Buffer
+		base := newHandler(&buf, nil).WithAttrs([]slog.Attr{slog.Int("base", 1)})
+		first := base.WithAttrs([]slog.Attr{slog.Int("first", 1)})
+		second := base.WithAttrs([]slog.Attr{slog.Int("second", 2)})
+		handle(t, first, slog.LevelInfo, "first")
+		handle(t, second, slog.LevelInfo, "second")
+		handle(t, base, slog.LevelInfo, "base")
+		entries := mustParse(t, parse, buf.Bytes(), 3)
+		check := func(e Entry, want ...string) {
+			for _, key := range []string{"base", "first", "second"} {
+				_, has := e[key]
+				if has != slices.Contains(want, key) {
+					t.Errorf("record %q: has %q = %t, want %t", e[slog.MessageKey], key, has, !has)
+				}
+			}
+		}
+		check(entries[0], "base", "first")
+		check(entries[1], "base", "second")
+		check(entries[2], "base")
+	})
+}
+
+// handle sends a record to h, failing the test on error.
+func handle(t *testing.T, h slog.Handler, level slog.Level, msg string, attrs ...slog.Attr) {
+	t.Helper()
+	r := slog.NewRecord(time.Now(), level, msg, 0)
+	r.AddAttrs(attrs...)
+	if err := h.Handle(context.Background(), r); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+}
+
+// mustParse parses out, expecting n entries.
+func mustParse(t *testing.T, parse func([]byte) ([]Entry, error), out []byte, n int) []Entry {
+	t.Helper()
+	entries, err := parse(out)
+	if err != nil {
+		t.Fatalf("parsing output: %v", err)
+	}
+	if len(entries) != n {
+		t.Fatalf("parsed %d records, want %d:\n%s", len(entries), n, out)
+	}
+	return entries
+}
+
+type countingWriter struct {
+	mu     sync.Mutex
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.writes++
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+// ParseJSON parses output holding one JSON object per line, as written by
+// slog.JSONHandler.
+func ParseJSON(out []byte) ([]Entry, error) {
+	var entries []Entry
+	s := bufio.NewScanner(bytes.NewReader(out))
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
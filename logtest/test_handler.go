@@ -0,0 +1,128 @@
+package logtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"zestack.dev/log"
+)
+
+// TestOptions are options for a handler of [NewTestHandlerWithOptions].
+// The embedded [slog.HandlerOptions] keep their usual meaning.
+type TestOptions struct {
+	slog.HandlerOptions
+
+	// FailOnError makes the records at LevelError or above fail the test,
+	// being reported with tb.Error instead of tb.Log.
+	FailOnError bool
+}
+
+// NewTestHandler returns a handler reporting the records with tb.Log, so
+// that the output of the code under test shows with the test it belongs
+// to, and only with -v or when the test fails:
+//
+//	l := log.New(&log.Options{NewHandler: func(_ io.Writer, opts *slog.HandlerOptions) slog.Handler {
+//		return logtest.NewTestHandler(t, opts)
+//	}})
+//
+// Each record is a line formatted as by a TextHandler without colors, and
+// without the time, which go test doesn't show either. As tb.Log reports
+// the line of the logging function rather than the one of its caller, the
+// line starts with the file and line of the logging call, if known.
+//
+// The records handled once the test has finished are dropped, rather than
+// making tb.Log panic, as happens with goroutines outliving their test.
+func NewTestHandler(tb testing.TB, opts *slog.HandlerOptions) slog.Handler {
+	var o TestOptions
+	if opts != nil {
+		o.HandlerOptions = *opts
+	}
+	return NewTestHandlerWithOptions(tb, &o)
+}
+
+// NewTestHandlerWithOptions returns a handler as NewTestHandler does, with
+// the other options of TestOptions.
+func NewTestHandlerWithOptions(tb testing.TB, opts *TestOptions) slog.Handler {
+	var o TestOptions
+	if opts != nil {
+		o = *opts
+	}
+	t := &testOutput{tb: tb}
+	tb.Cleanup(func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.done = true
+	})
+	text := log.NewTextHandlerWithOptions(&t.buf, &log.TextOptions{HandlerOptions: o.HandlerOptions, NoColor: true})
+	return &testHandler{t: t, next: text, fail: o.FailOnError}
+}
+
+// testHandler is a handler of NewTestHandler, formatting the records with
+// next into the buffer of t.
+type testHandler struct {
+	t    *testOutput
+	next slog.Handler
+	fail bool
+}
+
+// testOutput is the test and buffer shared by a testHandler and the
+// handlers derived from it.
+type testOutput struct {
+	tb testing.TB
+
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	done bool // whether the test has finished
+}
+
+func (h *testHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *testHandler) Handle(ctx context.Context, r slog.Record) error {
+	t := h.t
+	t.tb.Helper()
+	r.Time = time.Time{}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return nil
+	}
+	t.buf.Reset()
+	if err := h.next.Handle(ctx, r); err != nil {
+		return err
+	}
+	line := strings.TrimRight(t.buf.String(), " \n")
+	if r.PC != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		line = fmt.Sprintf("%s:%d: %s", filepath.Base(f.File), f.Line, line)
+	}
+	if h.fail && r.Level >= slog.LevelError {
+		t.tb.Error(line)
+	} else {
+		t.tb.Log(line)
+	}
+	return nil
+}
+
+func (h *testHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &testHandler{t: h.t, next: h.next.WithAttrs(attrs), fail: h.fail}
+}
+
+func (h *testHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &testHandler{t: h.t, next: h.next.WithGroup(name), fail: h.fail}
+}
@@ -0,0 +1,385 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of LokiOptions.
+const (
+	lokiPushPath      = "/loki/api/v1/push"
+	lokiBatchSize     = 1024
+	lokiQueueSize     = 4096
+	lokiFlushInterval = time.Second
+	lokiMaxRetries    = 5
+	lokiMinBackoff    = 500 * time.Millisecond
+	lokiMaxBackoff    = 30 * time.Second
+)
+
+// LokiOptions are options for a [LokiHandler].
+type LokiOptions struct {
+	HandlerOptions
+
+	// URL is the URL of the Loki server, such as "http://loki:3100". If it
+	// has no path, the records are pushed to /loki/api/v1/push.
+	URL string
+
+	// Headers are added to each request, such as X-Scope-OrgID for the
+	// tenant, or Authorization.
+	Headers map[string]string
+
+	// Labels are the labels of all the streams, such as app or env.
+	Labels map[string]string
+
+	// LabelKeys are the keys of the attributes whose values are also
+	// stream labels, keys in groups being joined by dots, as in
+	// "http.host". The key "level" makes the level a label. Keep them to
+	// attributes with few values: each combination is a stream.
+	LabelKeys []string
+
+	// BatchSize is the largest number of records sent in one request.
+	// If zero, 1024 is used.
+	BatchSize int
+
+	// QueueSize is the number of records the handler holds before they
+	// are sent. If zero, 4096 is used.
+	QueueSize int
+
+	// FlushInterval is how long a record may wait for its batch to fill
+	// up before it is sent anyway. If zero, a second is used.
+	FlushInterval time.Duration
+
+	// MaxRetries is the number of times a batch is sent again after Loki
+	// answered 429 or 5xx, or couldn't be reached, waiting longer each
+	// time, from MinBackoff to MaxBackoff. If zero, 5 is used; if
+	// negative, batches are not sent again.
+	MaxRetries int
+	MinBackoff time.Duration // if zero, half a second
+	MaxBackoff time.Duration // if zero, 30 seconds
+
+	// Block makes Handle wait for room in a full queue, until its context
+	// is done, instead of dropping the record.
+	Block bool
+
+	// Client sends the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Drops, if set, counts the records dropped from a full queue under
+	// DropQueue, and those of the batches given up on under DropFailed.
+	// See [Drops].
+	Drops *Drops
+
+	// OnError, if set, is called with the errors met sending a batch.
+	OnError func(err error)
+}
+
+// LokiHandler pushes records to Grafana Loki, with the push API in JSON.
+// Each record becomes an entry of the stream of its labels: the static
+// Labels, and the values of the attributes of LabelKeys. The line of the
+// entry is the record as written by a JSONHandler, and its timestamp the
+// time of the record in nanoseconds.
+//
+// Records are formatted by Handle and queued, then sent in batches by a
+// background goroutine, when a batch is full or FlushInterval after its
+// first record. Batches Loki rejects with 429 or 5xx are sent again with
+// exponential backoff, then dropped. When the queue is full, records are
+// dropped, or Handle blocks if Block is set. A record at LevelPanic or
+// above is sent at once, with the records queued before it, Handle waiting
+// until they are sent. Close sends the records queued and stops the
+// handler.
+//
+// A LokiHandler is registered with [RegisterFlusher] until closed.
+type LokiHandler struct {
+	h      slog.Handler // formats the lines, writing to e
+	e      *lokiExporter
+	prefix string      // group names from WithGroup, dot-terminated
+	labels []lokiLabel // from WithAttrs
+}
+
+// lokiLabel is a stream label.
+type lokiLabel struct {
+	name, value string
+}
+
+// lokiEntry is a queued record.
+type lokiEntry struct {
+	stream string      // labels in Loki's notation, identifying the stream
+	labels []lokiLabel // sorted by name
+	time   int64
+	line   string
+}
+
+// lokiExporter formats the lines of a LokiHandler and sends them.
+type lokiExporter struct {
+	*batchExporter[lokiEntry]
+	opts *LokiOptions
+	url  string
+
+	fmtMu sync.Mutex // serializes formatting, which writes to line
+	line  []byte
+}
+
+// NewLokiHandler returns a LokiHandler pushing to opts.URL, and starts
+// its sending goroutine.
+func NewLokiHandler(opts LokiOptions) (*LokiHandler, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = lokiPushPath
+	}
+	if opts.Level == nil {
+		opts.Level = slog.LevelInfo
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = lokiBatchSize
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = lokiQueueSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = lokiFlushInterval
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = lokiMaxRetries
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = lokiMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = lokiMaxBackoff
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	e := &lokiExporter{opts: &opts, url: u.String()}
+	e.batchExporter = newBatchExporter(batchOptions{
+		BatchSize:     opts.BatchSize,
+		QueueSize:     opts.QueueSize,
+		FlushInterval: opts.FlushInterval,
+		MaxRetries:    opts.MaxRetries,
+		MinBackoff:    opts.MinBackoff,
+		MaxBackoff:    opts.MaxBackoff,
+		Block:         opts.Block,
+		Drops:         opts.Drops,
+		OnError:       opts.OnError,
+	}, e.send)
+	h := &LokiHandler{h: NewJSONHandlerWithOptions(e, &opts.HandlerOptions), e: e}
+	e.unregister = RegisterFlusher(h)
+	return h, nil
+}
+
+// Write receives the line formatted by the JSONHandler, with fmtMu held.
+func (e *lokiExporter) Write(p []byte) (int, error) {
+	e.line = append(e.line[:0], bytes.TrimRight(p, "\n")...)
+	return len(p), nil
+}
+
+func (h *LokiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.h.Enabled(ctx, level)
+}
+
+func (h *LokiHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.h = h.h.WithGroup(name)
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+func (h *LokiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.h = h.h.WithAttrs(attrs)
+	h2.labels = slices.Clip(h.labels)
+	for _, a := range attrs {
+		h2.labels = h.appendLabels(h2.labels, h.prefix, a)
+	}
+	return &h2
+}
+
+// appendLabels appends the labels of a, in groups under prefix.
+func (h *LokiHandler) appendLabels(labels []lokiLabel, prefix string, a slog.Attr) []lokiLabel {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			labels = h.appendLabels(labels, prefix, ga)
+		}
+		return labels
+	}
+	if key := prefix + a.Key; slices.Contains(h.e.opts.LabelKeys, key) {
+		labels = append(labels, lokiLabel{lokiLabelName(key), a.Value.String()})
+	}
+	return labels
+}
+
+// lokiLabelName returns key as a valid label name, the characters that
+// are not letters, digits or underscores replaced by underscores.
+func lokiLabelName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+func (h *LokiHandler) Handle(ctx context.Context, r slog.Record) error {
+	e := h.e
+	if e.closed.Load() {
+		return net.ErrClosed
+	}
+	labels := slices.Clone(h.labels)
+	if len(e.opts.LabelKeys) > 0 {
+		r.Attrs(func(a slog.Attr) bool {
+			labels = h.appendLabels(labels, h.prefix, a)
+			return true
+		})
+		if slices.Contains(e.opts.LabelKeys, slog.LevelKey) {
+			labels = append(labels, lokiLabel{slog.LevelKey, levelToString(r.Level)})
+		}
+	}
+	for name, value := range e.opts.Labels {
+		labels = append(labels, lokiLabel{name, value})
+	}
+	// The last value of a label wins.
+	slices.SortStableFunc(labels, func(a, b lokiLabel) int { return strings.Compare(a.name, b.name) })
+	n := 0
+	for i, l := range labels {
+		if i+1 < len(labels) && labels[i+1].name == l.name {
+			continue
+		}
+		labels[n] = l
+		n++
+	}
+	labels = labels[:n]
+
+	entry := lokiEntry{labels: labels, time: r.Time.UnixNano()}
+	if r.Time.IsZero() {
+		entry.time = time.Now().UnixNano()
+	}
+	e.fmtMu.Lock()
+	err := h.h.Handle(ctx, r)
+	entry.line = string(e.line)
+	e.fmtMu.Unlock()
+	if err != nil {
+		return err
+	}
+	entry.stream = lokiStream(labels)
+	return e.enqueue(ctx, r.Level, entry)
+}
+
+// lokiStream returns labels in Loki's notation, as in {app="api"}.
+func lokiStream(labels []lokiLabel) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l.value))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// lokiPush is the body of a request to the push API.
+type lokiPush struct {
+	Streams []lokiPushStream `json:"streams"`
+}
+
+type lokiPushStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// send pushes one batch, the entries grouped by stream.
+func (e *lokiExporter) send(ctx context.Context, batch []lokiEntry) (retry bool, err error) {
+	var push lokiPush
+	streams := map[string]int{}
+	for _, entry := range batch {
+		i, ok := streams[entry.stream]
+		if !ok {
+			i = len(push.Streams)
+			streams[entry.stream] = i
+			labels := make(map[string]string, len(entry.labels))
+			for _, l := range entry.labels {
+				labels[l.name] = l.value
+			}
+			push.Streams = append(push.Streams, lokiPushStream{Stream: labels})
+		}
+		s := &push.Streams[i]
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(entry.time, 10), entry.line})
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		return false, err
+	}
+	return e.post(ctx, body)
+}
+
+// post posts one request, and reports whether it may be sent again if it
+// failed.
+func (e *lokiExporter) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+		return retry, fmt.Errorf("log: Loki push: %s", resp.Status)
+	}
+	return false, nil
+}
+
+// Flush sends the records queued, waiting until they are sent or ctx is
+// done.
+func (h *LokiHandler) Flush(ctx context.Context) error {
+	return h.e.flush(ctx)
+}
+
+// Close sends the records queued and stops the handler, waiting until it
+// is done, for 30 seconds at most. Records handled afterwards return
+// net.ErrClosed.
+func (h *LokiHandler) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), batchCloseTimeout)
+	defer cancel()
+	return h.e.close(ctx)
+}
+
+// LogHealth reports the state of the queue and of the last push.
+func (h *LokiHandler) LogHealth() ComponentHealth {
+	return h.e.health("loki")
+}
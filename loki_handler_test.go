@@ -0,0 +1,168 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLoki(t *testing.T, opts LokiOptions) *LokiHandler {
+	t.Helper()
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = time.Hour
+	}
+	if opts.MinBackoff == 0 {
+		opts.MinBackoff = time.Millisecond
+	}
+	h, err := NewLokiHandler(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// lokiStreams returns the streams of each push, as their labels followed by
+// the messages of their entries.
+func lokiStreams(t *testing.T, bodies []string) []string {
+	t.Helper()
+	var streams []string
+	for _, body := range bodies {
+		var push lokiPush
+		if err := json.Unmarshal([]byte(body), &push); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range push.Streams {
+			var lines []string
+			for _, v := range s.Values {
+				var line struct{ Msg string }
+				if err := json.Unmarshal([]byte(v[1]), &line); err != nil {
+					t.Fatal(err)
+				}
+				lines = append(lines, line.Msg)
+			}
+			streams = append(streams, fmt.Sprintf("%v %s", s.Stream, strings.Join(lines, ",")))
+		}
+	}
+	return streams
+}
+
+func TestLokiHandlerStreams(t *testing.T) {
+	s := newBatchServer(t)
+	h := newTestLoki(t, LokiOptions{
+		URL:       s.URL,
+		Headers:   map[string]string{"X-Scope-OrgID": "tenant"},
+		Labels:    map[string]string{"app": "api"},
+		LabelKeys: []string{"http.host", "level"},
+		BatchSize: 4,
+	})
+	l := slog.New(h).WithGroup("http")
+	l.Info("a", "host", "one", "path", "/")
+	l.Info("b", "host", "two")
+	l.With("host", "one").Warn("c")
+	l.Info("d", "host", "one")
+	l.Info("e")
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	bodies, _ := s.received()
+	want := []string{
+		"map[app:api http_host:one level:INFO] a,d",
+		"map[app:api http_host:two level:INFO] b",
+		"map[app:api http_host:one level:WARN] c",
+		"map[app:api level:INFO] e",
+	}
+	if got := lokiStreams(t, bodies); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("streams:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(bodies) != 2 {
+		t.Errorf("%d pushes, want 2", len(bodies))
+	}
+	if s.headers[0].Get("X-Scope-OrgID") != "tenant" || s.headers[0].Get("Content-Type") != "application/json" {
+		t.Errorf("header = %v", s.headers[0])
+	}
+}
+
+func TestLokiHandlerRetry(t *testing.T) {
+	s := newBatchServer(t, http.StatusTooManyRequests, http.StatusBadGateway)
+	drops := new(Drops)
+	h := newTestLoki(t, LokiOptions{URL: s.URL, Drops: drops})
+	slog.New(h).Info("retried")
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if bodies, n := s.received(); n != 3 || len(bodies) != 1 {
+		t.Errorf("%d requests, %d delivered, want 3 and 1", n, len(bodies))
+	}
+
+	// A batch Loki rejects is dropped at once.
+	s.mu.Lock()
+	s.status = []int{http.StatusBadRequest}
+	s.mu.Unlock()
+	slog.New(h).Info("rejected")
+	if err := h.Flush(context.Background()); err == nil {
+		t.Error("Flush: no error")
+	}
+	if _, n := s.received(); n != 4 {
+		t.Errorf("%d requests, want 4", n)
+	}
+	if a, ok := drops.take(); !ok || a.String() != "dropped=[failed=1]" {
+		t.Errorf("drops = %v", a)
+	}
+	if health := h.LogHealth(); health.Name != "loki" || health.Healthy || health.LastError == nil {
+		t.Errorf("health = %+v", health)
+	}
+}
+
+func TestLokiHandlerClose(t *testing.T) {
+	s := newBatchServer(t)
+	h := newTestLoki(t, LokiOptions{URL: s.URL})
+	slog.New(h).Info("queued")
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if bodies, _ := s.received(); fmt.Sprint(lokiStreams(t, bodies)) != "[map[] queued]" {
+		t.Errorf("streams = %v", lokiStreams(t, bodies))
+	}
+	if err := h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "late", 0)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Handle after Close: %v", err)
+	}
+}
+
+func TestLokiHandlerBlock(t *testing.T) {
+	s := newBatchServer(t)
+	s.release = make(chan struct{})
+	h := newTestLoki(t, LokiOptions{URL: s.URL, BatchSize: 1, QueueSize: 1, Block: true})
+	l := slog.New(h)
+	l.Info("sending")
+	s.waitArrived(t, 1)
+	l.Info("queued")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := h.Handle(ctx, slog.NewRecord(time.Now(), slog.LevelInfo, "dropped", 0)); err != nil {
+		t.Errorf("Handle: %v", err)
+	}
+	blocked := make(chan error)
+	go func() {
+		blocked <- h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "blocked", 0))
+	}()
+	closed := make(chan error)
+	go func() { closed <- h.Close() }()
+	if err := <-blocked; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("blocked Handle: %v", err)
+	}
+	close(s.release)
+	if err := <-closed; err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if bodies, _ := s.received(); fmt.Sprint(lokiStreams(t, bodies)) != "[map[] sending map[] queued]" {
+		t.Errorf("streams = %v", lokiStreams(t, bodies))
+	}
+}
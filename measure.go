@@ -0,0 +1,65 @@
+package log
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// TimeRange returns a Group attribute describing the time window from
+// from to to, with "from", "to" and "duration" members:
+//
+//	log.Info("compacted", log.TimeRange("window", start, end))
+//
+// renders as window.from=... window.to=... window.duration=1h0m0s in a
+// TextHandler.
+func TimeRange(key string, from, to time.Time) Attr {
+	return slog.Group(key,
+		slog.Time("from", from),
+		slog.Time("to", to),
+		slog.Duration("duration", to.Sub(from)),
+	)
+}
+
+// RateValue is the value of an attribute returned by [Rate]: Count events
+// per period Per. Text handlers render it as "42/s"; its JSON form keeps
+// the numbers apart, as {"count":42,"per":"1s"}.
+type RateValue struct {
+	Count int64
+	Per   time.Duration
+}
+
+// rateUnits names the periods that render as a unit rather than a duration.
+var rateUnits = map[time.Duration]string{
+	time.Nanosecond:  "ns",
+	time.Microsecond: "µs",
+	time.Millisecond: "ms",
+	time.Second:      "s",
+	time.Minute:      "min",
+	time.Hour:        "h",
+}
+
+func (r RateValue) String() string {
+	unit, ok := rateUnits[r.Per]
+	if !ok {
+		unit = r.Per.String()
+	}
+	return strconv.FormatInt(r.Count, 10) + "/" + unit
+}
+
+func (r RateValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Count int64  `json:"count"`
+		Per   string `json:"per"`
+	}{r.Count, r.Per.String()})
+}
+
+// Rate returns an Attr for count events per period per:
+//
+//	log.Info("ingest", log.Rate("throughput", 42, time.Second))
+//
+// renders as throughput=42/s in a TextHandler.
+func Rate(key string, count int64, per time.Duration) Attr {
+	return slog.Any(key, RateValue{Count: count, Per: per})
+}
@@ -0,0 +1,87 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateString(t *testing.T) {
+	for _, tt := range []struct {
+		r    RateValue
+		want string
+	}{
+		{RateValue{42, time.Second}, "42/s"},
+		{RateValue{3, time.Minute}, "3/min"},
+		{RateValue{0, time.Hour}, "0/h"},
+		{RateValue{7, time.Millisecond}, "7/ms"},
+		{RateValue{5, 15 * time.Minute}, "5/15m0s"},
+	} {
+		if got := tt.r.String(); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestTimeRangeAndRate(t *testing.T) {
+	from := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	attrs := []Attr{
+		TimeRange("window", from, from.Add(90*time.Second)),
+		Rate("throughput", 42, time.Second),
+	}
+	record := func(h slog.Handler) {
+		r := slog.NewRecord(time.Time{}, slog.LevelInfo, "compacted", 0)
+		r.AddAttrs(attrs...)
+		h.Handle(context.Background(), r)
+	}
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		record(NewTextHandlerWithOptions(&buf, &HandlerOptions{NoColor: true}))
+		want := `compacted window.from=2024-06-01T12:00:00Z window.to=2024-06-01T12:01:30Z window.duration=1m30s throughput=42/s`
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("got %q, want it to contain %q", buf.String(), want)
+		}
+	})
+
+	t.Run("indent", func(t *testing.T) {
+		var buf bytes.Buffer
+		record(NewIndentHandler(&buf, nil))
+		want := "window:\n    from: 2024-06-01T12:00:00Z\n    to: 2024-06-01T12:01:30Z\n    duration: 1m30s\nthroughput: 42/s\n"
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("got:\n%s\nwant it to contain:\n%s", buf.String(), want)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		record(NewJSONHandler(&buf, nil).WithGroup("job"))
+		var got struct {
+			Job struct {
+				Window struct {
+					From     time.Time `json:"from"`
+					To       time.Time `json:"to"`
+					Duration int64     `json:"duration"`
+				} `json:"window"`
+				Throughput struct {
+					Count int64  `json:"count"`
+					Per   string `json:"per"`
+				} `json:"throughput"`
+			} `json:"job"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("%v: %s", err, buf.Bytes())
+		}
+		w, r := got.Job.Window, got.Job.Throughput
+		if !w.From.Equal(from) || !w.To.Equal(from.Add(90*time.Second)) || w.Duration != int64(90*time.Second) {
+			t.Errorf("window = %+v", w)
+		}
+		if r.Count != 42 || r.Per != "1s" {
+			t.Errorf("throughput = %+v", r)
+		}
+	})
+}
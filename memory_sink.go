@@ -0,0 +1,111 @@
+package log
+
+import (
+	"io"
+	"sync"
+)
+
+// MemorySink is an io.Writer keeping the most recent records written to
+// it in memory, up to a number of bytes, for example to attach the end of
+// the logs to a crash report. It can be combined with the real output:
+//
+//	sink := log.NewMemorySink(200 << 10)
+//	log.SetOutput(io.MultiWriter(os.Stderr, sink))
+//
+// Each call to Write is taken as one record, as the handlers of this
+// package write them. When the sink is full, the oldest records are
+// dropped whole, so that a snapshot never starts in the middle of one.
+// A MemorySink is safe for concurrent use.
+type MemorySink struct {
+	max int
+
+	mu   sync.Mutex
+	recs [][]byte // oldest first
+	size int      // total length of recs
+}
+
+// NewMemorySink returns a MemorySink keeping at most maxBytes bytes.
+func NewMemorySink(maxBytes int) *MemorySink {
+	return &MemorySink{max: maxBytes}
+}
+
+// Write stores a copy of p as one record, dropping the oldest records to
+// make room for it. A record longer than the sink's size is cut to its
+// last bytes.
+func (s *MemorySink) Write(p []byte) (int, error) {
+	if s.max <= 0 {
+		return len(p), nil
+	}
+	n := len(p)
+	if len(p) > s.max {
+		p = p[len(p)-s.max:]
+	}
+	s.store(append([]byte(nil), p...))
+	return n, nil
+}
+
+// WriteString is like Write, but saves the conversion of str to a
+// byte slice before it is copied.
+func (s *MemorySink) WriteString(str string) (int, error) {
+	if s.max <= 0 {
+		return len(str), nil
+	}
+	n := len(str)
+	if len(str) > s.max {
+		str = str[len(str)-s.max:]
+	}
+	s.store([]byte(str))
+	return n, nil
+}
+
+// store adds rec, which the sink owns, as the newest record.
+func (s *MemorySink) store(rec []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	drop := 0
+	for s.size+len(rec) > s.max {
+		s.size -= len(s.recs[drop])
+		s.recs[drop] = nil
+		drop++
+	}
+	s.recs = append(s.recs[drop:], rec)
+	s.size += len(rec)
+}
+
+// Snapshot returns a copy of the records held by the sink, oldest first.
+func (s *MemorySink) Snapshot() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buf := make([]byte, 0, s.size)
+	for _, rec := range s.recs {
+		buf = append(buf, rec...)
+	}
+	return buf
+}
+
+// WriteTo writes the records held by the sink to w, oldest first.
+// Records written to the sink meanwhile are not included, and don't
+// block on w.
+func (s *MemorySink) WriteTo(w io.Writer) (int64, error) {
+	s.mu.Lock()
+	// Records are never modified once stored, so the slice can be
+	// walked without holding the lock.
+	recs := append([][]byte(nil), s.recs...)
+	s.mu.Unlock()
+	var total int64
+	for _, rec := range recs {
+		n, err := w.Write(rec)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Len returns the number of bytes held by the sink.
+func (s *MemorySink) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
@@ -0,0 +1,157 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMemorySinkEviction(t *testing.T) {
+	s := NewMemorySink(16)
+	for _, rec := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		io.WriteString(s, rec)
+	}
+	if got, want := string(s.Snapshot()), "two\nthree\nfour\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	s.Write([]byte("a longer record\n"))
+	if got, want := string(s.Snapshot()), "a longer record\n"; got != want {
+		t.Errorf("got %q, want %q: the oldest records are dropped whole", got, want)
+	}
+	if got := s.Len(); got != 16 {
+		t.Errorf("Len() = %d, want 16", got)
+	}
+}
+
+func TestMemorySinkOversizedRecord(t *testing.T) {
+	s := NewMemorySink(8)
+	io.WriteString(s, "old\n")
+	n, err := s.Write([]byte("0123456789abcdef\n"))
+	if n != 17 || err != nil {
+		t.Errorf("Write() = %d, %v, want 17, nil", n, err)
+	}
+	if got, want := string(s.Snapshot()), "9abcdef\n"; got != want {
+		t.Errorf("got %q, want the end of the record, %q", got, want)
+	}
+}
+
+func TestMemorySinkDisabled(t *testing.T) {
+	s := NewMemorySink(0)
+	if n, err := io.WriteString(s, "dropped\n"); n != 8 || err != nil {
+		t.Errorf("WriteString() = %d, %v", n, err)
+	}
+	if got := s.Snapshot(); len(got) != 0 {
+		t.Errorf("got %q, want nothing", got)
+	}
+}
+
+func TestMemorySinkWriteTo(t *testing.T) {
+	s := NewMemorySink(1 << 10)
+	io.WriteString(s, "one\n")
+	io.WriteString(s, "two\n")
+	var buf bytes.Buffer
+	n, err := s.WriteTo(&buf)
+	if n != 8 || err != nil || buf.String() != "one\ntwo\n" {
+		t.Errorf("WriteTo() = %d, %v, wrote %q", n, err, buf.String())
+	}
+}
+
+func TestMemorySinkAsLoggerOutput(t *testing.T) {
+	var out bytes.Buffer
+	s := NewMemorySink(1 << 10)
+	l := New(&Options{Writer: io.MultiWriter(&out, s), Deterministic: true})
+	l.Info("started")
+	l.Warn("slow", "ms", 250)
+	if got := string(s.Snapshot()); got != out.String() {
+		t.Errorf("the sink holds %q, the output %q", got, out.String())
+	}
+}
+
+// Snapshots and WriteTo taken while records are written hold whole
+// records only, in order.
+func TestMemorySinkConcurrentSnapshot(t *testing.T) {
+	const writers, records = 4, 500
+	s := NewMemorySink(4 << 10)
+	check := func(b []byte) {
+		last := map[string]int{}
+		for _, line := range strings.SplitAfter(string(b), "\n") {
+			if line == "" {
+				continue
+			}
+			var w string
+			var i int
+			if _, err := fmt.Sscanf(line, "writer=%s record=%d end\n", &w, &i); err != nil {
+				t.Errorf("partial record %q: %v", line, err)
+				return
+			}
+			if prev, ok := last[w]; ok && i <= prev {
+				t.Errorf("writer %s: record %d after %d", w, i, prev)
+			}
+			last[w] = i
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < records; i++ {
+				fmt.Fprintf(s, "writer=%d record=%d end\n", w, i)
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		check(s.Snapshot())
+		var buf bytes.Buffer
+		s.WriteTo(&buf)
+		check(buf.Bytes())
+		if s.Len() > 4<<10 {
+			t.Fatalf("the sink holds %d bytes", s.Len())
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+	}
+}
+
+func TestMemorySinkWriteString(t *testing.T) {
+	a, b := NewMemorySink(16), NewMemorySink(16)
+	for _, rec := range []string{"one\n", "two\n", "a record too long to fit\n", "three\n"} {
+		a.Write([]byte(rec))
+		a.WriteString(rec)
+		b.Write([]byte(rec))
+		b.Write([]byte(rec))
+	}
+	if got, want := a.Snapshot(), b.Snapshot(); !bytes.Equal(got, want) {
+		t.Errorf("WriteString kept %q, Write kept %q", got, want)
+	}
+}
+
+func BenchmarkMemorySink(b *testing.B) {
+	const rec = "2024-06-01 12:00:00 |  INFO | request served status=200 path=\"/login\" \n"
+	b.Run("Write", func(b *testing.B) {
+		s := NewMemorySink(1 << 16)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s.Write([]byte(rec))
+		}
+	})
+	b.Run("WriteString", func(b *testing.B) {
+		s := NewMemorySink(1 << 16)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s.WriteString(rec)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Middleware wraps a handler into another, such as one filtering,
+// enriching or counting the records before passing them on. The handler
+// returned must pass WithAttrs and WithGroup on to the one it wraps and
+// wrap the result again, as the handlers of [HandleMiddleware] do, for the
+// Loggers derived with With and WithGroup to go through it too.
+type Middleware func(next slog.Handler) slog.Handler
+
+// Chain returns h wrapped by mws, the first being the outermost, so that
+// records go through them in order before reaching h:
+//
+//	h := log.Chain(log.NewJSONHandler(os.Stdout, nil),
+//		log.InjectAttrs(requestAttrs),
+//		log.SwallowErrors(nil),
+//	)
+func Chain(h slog.Handler, mws ...Middleware) slog.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// HandleMiddleware returns a Middleware whose handlers call fn for each
+// record, fn passing it on to next, or not, as it sees fit. Enabled is
+// that of next, and WithAttrs and WithGroup apply to next, the result
+// being wrapped again.
+func HandleMiddleware(fn func(ctx context.Context, r slog.Record, next slog.Handler) error) Middleware {
+	return func(next slog.Handler) slog.Handler {
+		return &middlewareHandler{next: next, fn: fn}
+	}
+}
+
+// middlewareHandler is a handler of HandleMiddleware.
+type middlewareHandler struct {
+	next slog.Handler
+	fn   func(ctx context.Context, r slog.Record, next slog.Handler) error
+}
+
+func (h *middlewareHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *middlewareHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.fn(ctx, r, h.next)
+}
+
+func (h *middlewareHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &middlewareHandler{next: h.next.WithAttrs(attrs), fn: h.fn}
+}
+
+func (h *middlewareHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &middlewareHandler{next: h.next.WithGroup(name), fn: h.fn}
+}
+
+// Unwrap returns the handler wrapped by h.
+func (h *middlewareHandler) Unwrap() Handler {
+	return h.next
+}
+
+// InjectAttrs returns a Middleware adding the attributes returned by fn
+// for the context of each record, such as the ids of the request it
+// carries, after those of the record, in the groups of the Logger.
+func InjectAttrs(fn func(ctx context.Context) []slog.Attr) Middleware {
+	return HandleMiddleware(func(ctx context.Context, r slog.Record, next slog.Handler) error {
+		if attrs := fn(ctx); len(attrs) > 0 {
+			r = r.Clone()
+			r.AddAttrs(attrs...)
+		}
+		return next.Handle(ctx, r)
+	})
+}
+
+// RewriteLevel returns a Middleware changing the level of each record to
+// the one returned by fn, such as to demote the errors of a noisy
+// dependency to WARN. A record whose new level next is not enabled for is
+// dropped, unless logged with [Logger.Always]. As Enabled asks next about
+// the level of the logging call, fn can't raise records next would not
+// have been enabled for at first.
+func RewriteLevel(fn func(r slog.Record) slog.Level) Middleware {
+	return HandleMiddleware(func(ctx context.Context, r slog.Record, next slog.Handler) error {
+		r.Level = fn(r)
+		if !IsForced(ctx) && !next.Enabled(ctx, r.Level) {
+			return nil
+		}
+		return next.Handle(ctx, r)
+	})
+}
+
+// SwallowErrors returns a Middleware reporting the errors of next to
+// onError, if not nil, instead of returning them, for handlers, such as
+// the network ones, whose failures the application doesn't want to hear
+// about from each logging call.
+func SwallowErrors(onError func(err error, r slog.Record)) Middleware {
+	return HandleMiddleware(func(ctx context.Context, r slog.Record, next slog.Handler) error {
+		if err := next.Handle(ctx, r); err != nil && onError != nil {
+			onError(err, r)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,86 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The handlers derived with WithAttrs then WithGroup go through all the
+// middlewares of a chain, in order.
+func TestChainDerived(t *testing.T) {
+	var seen []string
+	trace := func(name string) Middleware {
+		return HandleMiddleware(func(ctx context.Context, r slog.Record, next slog.Handler) error {
+			seen = append(seen, fmt.Sprintf("%s:%s:%d", name, r.Level, r.NumAttrs()))
+			return next.Handle(ctx, r)
+		})
+	}
+	var buf bytes.Buffer
+	text := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	h := Chain(text,
+		trace("first"),
+		InjectAttrs(func(context.Context) []slog.Attr { return []slog.Attr{slog.Int("id", 7)} }),
+		RewriteLevel(func(r slog.Record) slog.Level {
+			if r.Level == slog.LevelError {
+				return slog.LevelWarn
+			}
+			return r.Level
+		}),
+		trace("last"),
+	)
+
+	derived := h.WithAttrs([]slog.Attr{slog.String("app", "shop")}).WithGroup("req")
+	depth := 0
+	for next := derived; ; depth++ {
+		m, ok := next.(*middlewareHandler)
+		if !ok {
+			break
+		}
+		next = m.Unwrap()
+	}
+	if depth != 4 {
+		t.Errorf("derived handler %d middlewares deep, want 4", depth)
+	}
+
+	slog.New(derived).Error("failed", "code", 500)
+	slog.New(h).Info("plain")
+	want := "level=WARN msg=failed app=shop req.code=500 req.id=7\n" +
+		"level=INFO msg=plain id=7\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	if got := strings.Join(seen, " "); got != "first:ERROR:1 last:WARN:2 first:INFO:0 last:INFO:1" {
+		t.Errorf("seen %s", got)
+	}
+}
+
+func TestSwallowErrorsDerived(t *testing.T) {
+	errFailed := errors.New("failed")
+	failing := HandleMiddleware(func(context.Context, slog.Record, slog.Handler) error {
+		return errFailed
+	})
+	var errs []error
+	h := Chain(DiscardHandler,
+		SwallowErrors(func(err error, r slog.Record) { errs = append(errs, err) }),
+		failing,
+	).WithAttrs([]slog.Attr{slog.Int("n", 1)}).WithGroup("g")
+	if err := h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "lost", 0)); err != nil {
+		t.Errorf("Handle: %v", err)
+	}
+	if len(errs) != 1 || errs[0] != errFailed {
+		t.Errorf("errors: %v", errs)
+	}
+}
@@ -0,0 +1,478 @@
+package log
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Extension types of the values written by MsgpackHandler: the timestamp
+// type of MessagePack, -1, and durations, in nanoseconds.
+const (
+	msgpackTimeExt     byte = 0xff
+	msgpackDurationExt byte = 1
+)
+
+// msgpackMaxDepth bounds the nesting of the maps the MsgpackDecoder
+// accepts, so that a corrupt stream doesn't exhaust the stack.
+const msgpackMaxDepth = 100
+
+// ErrMsgpackFormat is returned by a [MsgpackDecoder] reading a stream that
+// is not made of the records of a MsgpackHandler.
+var ErrMsgpackFormat = errors.New("log: invalid MessagePack log stream")
+
+// MsgpackHandler writes records in MessagePack, for logs exchanged between
+// programs, more compact than JSON and faster to read back. Each record is
+// a map, written with a single call to Write, of its time, as a timestamp
+// extension, its level, as an integer, its message, its source with
+// AddSource, and its attributes, groups being nested maps:
+//
+//	{"time": 2024-06-01T12:00:00Z, "level": 0, "msg": "started", "http": {"port": 8080}}
+//
+// The keys are those of slog, slog.TimeKey and so on. Durations are an
+// extension of type 1 holding their nanoseconds as a big-endian int64,
+// and the values of kind Any their text, or bytes for a []byte.
+//
+// MessagePack values delimit themselves, so that the records follow each
+// other in the stream without framing, and are read back with a
+// [MsgpackDecoder], or by any MessagePack decoder reading a sequence of
+// values.
+type MsgpackHandler struct {
+	opts   HandlerOptions
+	attrs  []slog.Attr // from WithAttrs, in their groups
+	groups []string    // from WithGroup
+	mu     *sync.Mutex
+	w      io.Writer
+}
+
+// NewMsgpackHandler returns a MsgpackHandler writing to w. Of opts, Level,
+// AddSource and ReplaceAttr are used.
+func NewMsgpackHandler(w io.Writer, opts *slog.HandlerOptions) *MsgpackHandler {
+	h := &MsgpackHandler{opts: *handlerOptions(opts), mu: &sync.Mutex{}, w: w}
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelInfo
+	}
+	return h
+}
+
+func (h *MsgpackHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *MsgpackHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	var fields []slog.Attr
+	for _, a := range attrs {
+		if a, ok := h.opts.field(h.groups, a); ok {
+			fields = append(fields, a)
+		}
+	}
+	h2 := *h
+	h2.attrs = append(slices.Clip(h.attrs), inGroups(h.groups, fields)...)
+	return &h2
+}
+
+func (h *MsgpackHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+func (h *MsgpackHandler) Handle(_ context.Context, r slog.Record) error {
+	var builtin []slog.Attr
+	if !r.Time.IsZero() {
+		builtin = append(builtin, slog.Time(slog.TimeKey, r.Time))
+	}
+	builtin = append(builtin,
+		slog.Int(slog.LevelKey, int(r.Level)),
+		slog.String(slog.MessageKey, r.Message),
+	)
+	if h.opts.AddSource && r.PC != 0 {
+		builtin = append(builtin, slog.String(slog.SourceKey, h.opts.source(r.PC)))
+	}
+	var own []slog.Attr
+	h.opts.recordAttrs(r, func(a slog.Attr) bool {
+		if a, ok := h.opts.field(h.groups, a); ok {
+			own = append(own, a)
+		}
+		return true
+	})
+	// The built-in fields come first, as the decoder expects, and are
+	// kept apart from the attributes, merged so that keys are unique.
+	attrs := fluentFields(nil, append(slices.Clip(h.attrs), inGroups(h.groups, own)...))
+
+	bufp := allocBuf()
+	defer freeBuf(bufp)
+	buf := appendMsgpackHeader(*bufp, len(builtin)+len(attrs), 0x80, 0xdf)
+	for _, a := range append(builtin, attrs...) {
+		buf = appendMsgpackString(buf, a.Key)
+		buf = appendMsgpackAttrValue(buf, a.Value)
+	}
+	*bufp = buf
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf)
+	return err
+}
+
+// appendMsgpackAttrValue appends v in MessagePack as MsgpackHandler
+// writes it: unlike appendMsgpackValue, for Fluentd, it keeps the kinds
+// of times and durations, and writes integers in their shortest form.
+func appendMsgpackAttrValue(buf []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindInt64:
+		return appendMsgpackInt(buf, v.Int64())
+	case slog.KindUint64:
+		return appendMsgpackUint(buf, v.Uint64())
+	case slog.KindDuration:
+		buf = append(buf, 0xd7, msgpackDurationExt)
+		return binary.BigEndian.AppendUint64(buf, uint64(v.Duration()))
+	case slog.KindTime:
+		return appendMsgpackTime(buf, v.Time())
+	case slog.KindGroup:
+		attrs := fluentFields(nil, v.Group())
+		buf = appendMsgpackHeader(buf, len(attrs), 0x80, 0xdf)
+		for _, a := range attrs {
+			buf = appendMsgpackString(buf, a.Key)
+			buf = appendMsgpackAttrValue(buf, a.Value)
+		}
+		return buf
+	}
+	return appendMsgpackValue(buf, v)
+}
+
+// appendMsgpackInt appends n as a signed integer, in its shortest form.
+func appendMsgpackInt(buf []byte, n int64) []byte {
+	switch {
+	case n >= -32 && n <= math.MaxInt8:
+		return append(buf, byte(int8(n)))
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		return append(buf, 0xd0, byte(int8(n)))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(n))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(n))
+	}
+}
+
+// appendMsgpackUint appends n as an unsigned integer, in its shortest
+// form but never a fixint, which the decoder reads as signed.
+func appendMsgpackUint(buf []byte, n uint64) []byte {
+	switch {
+	case n <= math.MaxUint8:
+		return append(buf, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), n)
+	}
+}
+
+// appendMsgpackTime appends t as a timestamp extension, of 64 bits if its
+// seconds fit in 34, of 96 otherwise.
+func appendMsgpackTime(buf []byte, t time.Time) []byte {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	if sec>>34 == 0 {
+		buf = append(buf, 0xd7, msgpackTimeExt)
+		return binary.BigEndian.AppendUint64(buf, nsec<<34|uint64(sec))
+	}
+	buf = append(buf, 0xc7, 12, msgpackTimeExt)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(nsec))
+	return binary.BigEndian.AppendUint64(buf, uint64(sec))
+}
+
+// MsgpackDecoder reads the records written by a [MsgpackHandler]:
+//
+//	dec := log.NewMsgpackDecoder(conn)
+//	for {
+//		r, err := dec.Decode()
+//		if err != nil {
+//			break // io.EOF at the end
+//		}
+//		...
+//	}
+//
+// The first time, level and message fields of a record are its own, the
+// other fields its attributes, maps being groups. The records have no PC:
+// their source, if written, is an attribute. Integers are read back as
+// Int64, but those written unsigned as Uint64, and binary strings as
+// []byte.
+type MsgpackDecoder struct {
+	r *bufio.Reader
+}
+
+// NewMsgpackDecoder returns a MsgpackDecoder reading from r.
+func NewMsgpackDecoder(r io.Reader) *MsgpackDecoder {
+	return &MsgpackDecoder{r: bufio.NewReader(r)}
+}
+
+// Decode returns the next record. At the end of the stream, it returns
+// io.EOF, or io.ErrUnexpectedEOF if the stream ends within a record. A
+// value that is not a map with string keys returns ErrMsgpackFormat.
+func (d *MsgpackDecoder) Decode() (slog.Record, error) {
+	if _, err := d.r.Peek(1); err != nil {
+		return slog.Record{}, err
+	}
+	n, ok, err := d.mapHeader()
+	if err != nil {
+		return slog.Record{}, err
+	}
+	if !ok {
+		return slog.Record{}, ErrMsgpackFormat
+	}
+	var (
+		t                         time.Time
+		level                     slog.Level
+		msg                       string
+		hasTime, hasLevel, hasMsg bool
+		attrs                     []slog.Attr
+	)
+	for ; n > 0; n-- {
+		a, err := d.attr(0)
+		if err != nil {
+			return slog.Record{}, err
+		}
+		switch k := a.Value.Kind(); {
+		case a.Key == slog.TimeKey && k == slog.KindTime && !hasTime:
+			t, hasTime = a.Value.Time(), true
+		case a.Key == slog.LevelKey && k == slog.KindInt64 && !hasLevel:
+			level, hasLevel = slog.Level(a.Value.Int64()), true
+		case a.Key == slog.MessageKey && k == slog.KindString && !hasMsg:
+			msg, hasMsg = a.Value.String(), true
+		default:
+			attrs = append(attrs, a)
+		}
+	}
+	r := slog.NewRecord(t, level, msg, 0)
+	r.AddAttrs(attrs...)
+	return r, nil
+}
+
+// attr reads a key and its value, in a map at depth.
+func (d *MsgpackDecoder) attr(depth int) (slog.Attr, error) {
+	key, err := d.value(depth)
+	if err != nil {
+		return slog.Attr{}, err
+	}
+	if key.Kind() != slog.KindString {
+		return slog.Attr{}, fmt.Errorf("%w: key of kind %s", ErrMsgpackFormat, key.Kind())
+	}
+	v, err := d.value(depth)
+	if err != nil {
+		return slog.Attr{}, err
+	}
+	return slog.Attr{Key: key.String(), Value: v}, nil
+}
+
+// mapHeader reads the header of a map and returns its number of pairs, or
+// false, with nothing read, if the next value isn't a map.
+func (d *MsgpackDecoder) mapHeader() (int, bool, error) {
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return 0, false, unexpectedEOF(err)
+	}
+	switch c := b[0]; {
+	case c&0xf0 == 0x80:
+		d.r.ReadByte()
+		return int(c & 0x0f), true, nil
+	case c == 0xde || c == 0xdf:
+		d.r.ReadByte()
+		n, err := d.length(c == 0xdf)
+		return n, true, err
+	}
+	return 0, false, nil
+}
+
+// length reads the big-endian length of a value, of 32 bits if long, of
+// 16 otherwise.
+func (d *MsgpackDecoder) length(long bool) (int, error) {
+	if long {
+		b, err := d.read(4)
+		if err != nil {
+			return 0, err
+		}
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+	b, err := d.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(b)), nil
+}
+
+// read reads n bytes.
+func (d *MsgpackDecoder) read(n int) ([]byte, error) {
+	if n > binaryMaxRecord {
+		return nil, fmt.Errorf("%w: value of %d bytes", ErrMsgpackFormat, n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+// value reads a value, in a map at depth.
+func (d *MsgpackDecoder) value(depth int) (slog.Value, error) {
+	if depth > msgpackMaxDepth {
+		return slog.Value{}, fmt.Errorf("%w: maps nested too deep", ErrMsgpackFormat)
+	}
+	if n, ok, err := d.mapHeader(); err != nil {
+		return slog.Value{}, err
+	} else if ok {
+		attrs := make([]slog.Attr, 0, min(n, 64))
+		for ; n > 0; n-- {
+			a, err := d.attr(depth + 1)
+			if err != nil {
+				return slog.Value{}, err
+			}
+			attrs = append(attrs, a)
+		}
+		return slog.GroupValue(attrs...), nil
+	}
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return slog.Value{}, unexpectedEOF(err)
+	}
+	// fixed reads the n bytes of a fixed-size value.
+	fixed := func(n int) uint64 {
+		var b []byte
+		if b, err = d.read(n); err != nil {
+			return 0
+		}
+		var x uint64
+		for _, c := range b {
+			x = x<<8 | uint64(c)
+		}
+		return x
+	}
+	var v slog.Value
+	switch {
+	case c <= 0x7f || c >= 0xe0:
+		return slog.Int64Value(int64(int8(c))), nil
+	case c&0xe0 == 0xa0:
+		b, err := d.read(int(c & 0x1f))
+		return slog.StringValue(string(b)), err
+	case c&0xf0 == 0x90 || c == 0xdc || c == 0xdd:
+		n := int(c & 0x0f)
+		if c >= 0xdc {
+			if n, err = d.length(c == 0xdd); err != nil {
+				return slog.Value{}, err
+			}
+		}
+		elems := make([]any, 0, min(n, 64))
+		for ; n > 0; n-- {
+			e, err := d.value(depth + 1)
+			if err != nil {
+				return slog.Value{}, err
+			}
+			elems = append(elems, e.Any())
+		}
+		return slog.AnyValue(elems), nil
+	}
+	switch c {
+	case 0xc0:
+		v = slog.AnyValue(nil)
+	case 0xc2, 0xc3:
+		v = slog.BoolValue(c == 0xc3)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v = slog.Uint64Value(fixed(1 << (c - 0xcc)))
+	case 0xd0:
+		v = slog.Int64Value(int64(int8(fixed(1))))
+	case 0xd1:
+		v = slog.Int64Value(int64(int16(fixed(2))))
+	case 0xd2:
+		v = slog.Int64Value(int64(int32(fixed(4))))
+	case 0xd3:
+		v = slog.Int64Value(int64(fixed(8)))
+	case 0xca:
+		v = slog.Float64Value(float64(math.Float32frombits(uint32(fixed(4)))))
+	case 0xcb:
+		v = slog.Float64Value(math.Float64frombits(fixed(8)))
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6:
+		var n int
+		switch c {
+		case 0xd9, 0xc4:
+			n = int(fixed(1))
+		case 0xda, 0xc5:
+			n = int(fixed(2))
+		default:
+			n = int(fixed(4))
+		}
+		if err != nil {
+			return slog.Value{}, err
+		}
+		b, err := d.read(n)
+		if err != nil {
+			return slog.Value{}, err
+		}
+		if c >= 0xd9 {
+			return slog.StringValue(string(b)), nil
+		}
+		return slog.AnyValue(b), nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n := int(fixed(1 << (c - 0xc7)))
+		if err != nil {
+			return slog.Value{}, err
+		}
+		return d.ext(n)
+	default:
+		return slog.Value{}, fmt.Errorf("%w: type 0x%02x", ErrMsgpackFormat, c)
+	}
+	return v, err
+}
+
+// ext reads an extension of n bytes, after its type. Times and durations
+// are read back as such, other extensions as their bytes.
+func (d *MsgpackDecoder) ext(n int) (slog.Value, error) {
+	typ, err := d.r.ReadByte()
+	if err != nil {
+		return slog.Value{}, unexpectedEOF(err)
+	}
+	b, err := d.read(n)
+	if err != nil {
+		return slog.Value{}, err
+	}
+	switch {
+	case typ == msgpackTimeExt && n == 4:
+		return slog.TimeValue(time.Unix(int64(binary.BigEndian.Uint32(b)), 0)), nil
+	case typ == msgpackTimeExt && n == 8:
+		x := binary.BigEndian.Uint64(b)
+		return slog.TimeValue(time.Unix(int64(x&(1<<34-1)), int64(x>>34))), nil
+	case typ == msgpackTimeExt && n == 12:
+		nsec := binary.BigEndian.Uint32(b)
+		return slog.TimeValue(time.Unix(int64(binary.BigEndian.Uint64(b[4:])), int64(nsec))), nil
+	case typ == msgpackDurationExt && n == 8:
+		return slog.DurationValue(time.Duration(binary.BigEndian.Uint64(b))), nil
+	}
+	return slog.AnyValue(b), nil
+}
+
+// unexpectedEOF returns err, or io.ErrUnexpectedEOF for io.EOF, the stream
+// ending within a record.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// msgpackRecord is a record with a value of each kind, in nested groups.
+func msgpackRecord() slog.Record {
+	r := slog.NewRecord(time.Date(2024, 6, 1, 12, 0, 0, 123456789, time.UTC), LevelWarn.Level(), "disk almost full", 0)
+	r.AddAttrs(
+		slog.String("mount", "/var"),
+		slog.Int("free", -512),
+		slog.Int("big", 1<<40),
+		slog.Uint64("total", 1<<63),
+		slog.Float64("ratio", 0.97),
+		slog.Bool("critical", true),
+		slog.Duration("uptime", 36*time.Hour+time.Nanosecond),
+		slog.Duration("skew", -time.Millisecond),
+		slog.Time("checked", time.Date(2024, 6, 1, 11, 59, 0, 0, time.UTC)),
+		slog.Time("far", time.Date(2600, 1, 1, 0, 0, 0, 1, time.UTC)), // 96-bit timestamp
+		slog.Any("raw", []byte{0, 1, 2}),
+		slog.Any("err", errors.New("quota exceeded")),
+		slog.String("long", strings.Repeat("x", 300)),
+		slog.Group("disk",
+			slog.String("device", "sda1"),
+			slog.Group("io", slog.Duration("wait", 3*time.Millisecond), slog.Int("ops", 12)),
+		),
+	)
+	return r
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewMsgpackHandler(&buf, nil)
+	want := msgpackRecord()
+	if err := h.Handle(context.Background(), want); err != nil {
+		t.Fatal(err)
+	}
+	// Attributes from WithAttrs and WithGroup, merged into the same group.
+	h2 := h.WithAttrs([]slog.Attr{slog.String("host", "db1")}).WithGroup("disk")
+	r := slog.NewRecord(time.Unix(0, 1), slog.LevelInfo, "second", 0)
+	r.AddAttrs(slog.Int("n", 2))
+	if err := h2.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewMsgpackDecoder(&buf)
+	got, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time.Equal(want.Time) || got.Level != want.Level || got.Message != want.Message {
+		t.Errorf("got %v %v %q", got.Time, got.Level, got.Message)
+	}
+	var wantAttrs []slog.Attr
+	want.Attrs(func(a slog.Attr) bool {
+		// Values of kind Any are read back as text, but for []byte.
+		if a.Key == "err" {
+			a.Value = slog.StringValue(a.Value.String())
+		}
+		wantAttrs = append(wantAttrs, a)
+		return true
+	})
+	var gotAttrs []slog.Attr
+	got.Attrs(func(a slog.Attr) bool {
+		gotAttrs = append(gotAttrs, a)
+		return true
+	})
+	if len(gotAttrs) != len(wantAttrs) {
+		t.Fatalf("got %v\nwant %v", gotAttrs, wantAttrs)
+	}
+	for i, a := range gotAttrs {
+		w := wantAttrs[i]
+		if a.Key != w.Key || a.Value.Kind() != w.Value.Kind() || a.Value.String() != w.Value.String() {
+			t.Errorf("attr %d: got %s=%v (%s), want %s=%v (%s)", i, a.Key, a.Value, a.Value.Kind(), w.Key, w.Value, w.Value.Kind())
+		}
+	}
+
+	got, err = dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attrs []string
+	got.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a.String())
+		return true
+	})
+	if s := strings.Join(attrs, " "); s != "host=db1 disk=[n=2]" {
+		t.Errorf("second record: %s", s)
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("at the end: %v, want io.EOF", err)
+	}
+}
+
+// A stream cut anywhere within a record returns io.ErrUnexpectedEOF.
+func TestMsgpackTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	NewMsgpackHandler(&buf, nil).Handle(context.Background(), msgpackRecord())
+	full := buf.Bytes()
+	for n := 1; n < len(full); n++ {
+		if _, err := NewMsgpackDecoder(bytes.NewReader(full[:n])).Decode(); err != io.ErrUnexpectedEOF {
+			t.Errorf("%d bytes of %d: %v", n, len(full), err)
+		}
+	}
+	for _, in := range []string{"\xde", "\xde\x00", "\xdf\x00\x00", "\x81\xa1k\xd7", "\x81\xa1k\xc7\x0c", "\x81\xa1k\xc7\x0c\xff\x00"} {
+		if _, err := NewMsgpackDecoder(strings.NewReader(in)).Decode(); err != io.ErrUnexpectedEOF {
+			t.Errorf("%q: %v", in, err)
+		}
+	}
+}
+
+func TestMsgpackFormatErrors(t *testing.T) {
+	for _, in := range []string{
+		"\x01",          // not a map
+		"\x81\x01\x01",  // key not a string
+		"\x81\xa1k\xc1", // unused type
+		strings.Repeat("\x81\xa1k", msgpackMaxDepth+2) + "\x01",
+		"\x81\xa1k\xdb\xff\xff\xff\xff", // string too long
+	} {
+		if _, err := NewMsgpackDecoder(strings.NewReader(in)).Decode(); !errors.Is(err, ErrMsgpackFormat) {
+			t.Errorf("%q: %v", in, err)
+		}
+	}
+}
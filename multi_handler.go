@@ -0,0 +1,75 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+)
+
+// MultiHandler sends each record to several handlers, such as colored
+// text on the console and JSON in a file:
+//
+//	h := log.NewMultiHandler(
+//		log.NewTextHandler(os.Stderr, nil),
+//		log.NewJSONHandler(file, nil),
+//	)
+//
+// A record goes to the handlers enabled for its level. Attributes and
+// groups added with WithAttrs and WithGroup go to all of them.
+type MultiHandler struct {
+	handlers []slog.Handler
+}
+
+// NewMultiHandler returns a MultiHandler sending records to handlers.
+func NewMultiHandler(handlers ...slog.Handler) *MultiHandler {
+	return &MultiHandler{handlers: handlers}
+}
+
+func (h *MultiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, hh := range h.handlers {
+		if hh.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle sends r to each handler enabled for its level, even if some of
+// them fail, and returns their errors joined.
+func (h *MultiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, hh := range h.handlers {
+		if IsForced(ctx) || hh.Enabled(ctx, r.Level) {
+			errs = append(errs, hh.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *MultiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, hh := range h.handlers {
+		handlers[i] = hh.WithAttrs(attrs)
+	}
+	return &MultiHandler{handlers: handlers}
+}
+
+func (h *MultiHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, hh := range h.handlers {
+		handlers[i] = hh.WithGroup(name)
+	}
+	return &MultiHandler{handlers: handlers}
+}
+
+// Handlers returns the handlers of h.
+func (h *MultiHandler) Handlers() []Handler {
+	return slices.Clone(h.handlers)
+}
@@ -0,0 +1,98 @@
+package log
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// netConn is a connection to a log collector, shared by a network handler
+// and the handlers derived from it. It reconnects when a write fails.
+type netConn struct {
+	name string // of the component, for LogHealth
+	dial func() (net.Conn, error)
+
+	mu         sync.Mutex
+	conn       net.Conn
+	closed     bool
+	reconnects int
+	lastErr    error
+	lastErrAt  time.Time
+}
+
+// newNetConn returns a netConn connected with dial.
+func newNetConn(name string, dial func() (net.Conn, error)) (*netConn, error) {
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	return &netConn{name: name, dial: dial, conn: conn}, nil
+}
+
+// write sends one message with send, reconnecting and trying once more
+// on failure. Calls are serialized, so that the pieces written by send
+// are never interleaved with those of another message.
+func (c *netConn) write(send func(conn net.Conn) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	var err error
+	for try := 0; try < 2; try++ {
+		if c.conn == nil {
+			if c.conn, err = c.dial(); err != nil {
+				c.conn = nil
+				continue
+			}
+			c.reconnects++
+		}
+		if err = send(c.conn); err == nil {
+			c.lastErr = nil
+			return nil
+		}
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.lastErr, c.lastErrAt = err, time.Now()
+	return err
+}
+
+// close closes the connection. Writes fail afterwards with net.ErrClosed.
+func (c *netConn) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func (c *netConn) health() ComponentHealth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ComponentHealth{
+		Name:          c.name,
+		Healthy:       !c.closed && c.conn != nil && c.lastErr == nil,
+		LastError:     c.lastErr,
+		LastErrorTime: c.lastErrAt,
+		Connected:     c.conn != nil,
+		Reconnects:    c.reconnects,
+	}
+}
+
+// isStream reports whether conn carries a byte stream rather than
+// datagrams, so that messages must be delimited.
+func isStream(conn net.Conn) bool {
+	switch conn.RemoteAddr().Network() {
+	case "udp", "udp4", "udp6", "unixgram":
+		return false
+	}
+	return true
+}
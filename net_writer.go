@@ -0,0 +1,324 @@
+package log
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of the NetWriterOptions.
+const (
+	netDialTimeout  = 5 * time.Second
+	netWriteTimeout = 5 * time.Second
+	netMinBackoff   = 100 * time.Millisecond
+	netMaxBackoff   = 30 * time.Second
+)
+
+// netWriterConfig is the configuration of a NetWriter, set by the
+// NetWriterOptions.
+type netWriterConfig struct {
+	buffer       int
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	drops        *Drops
+}
+
+// NetWriterOption configures a writer created by [NewNetWriter].
+type NetWriterOption func(c *netWriterConfig)
+
+// NetBuffer makes the writer hold up to size bytes of records while it is
+// disconnected, the oldest records being dropped to make room, and send
+// them once reconnected. By default, the records written while
+// disconnected are dropped.
+func NetBuffer(size int) NetWriterOption {
+	return func(c *netWriterConfig) { c.buffer = size }
+}
+
+// NetBackoff sets the time waited before redialing after a failure, from
+// min, doubling at each failure up to max. By default it goes from 100ms
+// to 30 seconds.
+func NetBackoff(min, max time.Duration) NetWriterOption {
+	return func(c *netWriterConfig) { c.minBackoff, c.maxBackoff = min, max }
+}
+
+// NetDialTimeout bounds the time spent dialing, five seconds by default.
+func NetDialTimeout(d time.Duration) NetWriterOption {
+	return func(c *netWriterConfig) { c.dialTimeout = d }
+}
+
+// NetWriteTimeout bounds the time spent writing a record, five seconds by
+// default, so that a stuck collector doesn't stall logging. Zero or
+// negative means no bound.
+func NetWriteTimeout(d time.Duration) NetWriterOption {
+	return func(c *netWriterConfig) { c.writeTimeout = d }
+}
+
+// NetDrops counts the records dropped by the writer, while disconnected,
+// in d under DropQueue. See [Drops].
+func NetDrops(d *Drops) NetWriterOption {
+	return func(c *netWriterConfig) { c.drops = d }
+}
+
+// NetWriter writes records to a log collector over TCP, UDP or a unix
+// socket, surviving the collector going away, as an [Options.Writer]:
+//
+//	w := log.NewNetWriter("tcp", "collector:5170", log.NetBuffer(1<<20))
+//	defer w.Close()
+//	log.SetDefault(log.New(&log.Options{Writer: w}))
+//
+// It dials when first written to. When a write fails, the connection is
+// closed and dialed again on a later write, waiting longer after each
+// failure, as set with NetBackoff. Meanwhile, the records are dropped, or
+// held with NetBuffer and sent once reconnected.
+//
+// Each Write is taken as one record, as the handlers of this package write
+// them, and its bytes are written to the connection in one call, so that
+// over udp and unixgram each record is one datagram.
+//
+// A NetWriter is registered with [RegisterFlusher] until closed, so that
+// Logger.Fatal tries once more to send the records held.
+type NetWriter struct {
+	network, addr string
+	cfg           netWriterConfig
+	unregister    func()
+	dropped       atomic.Int64
+
+	mu         sync.Mutex
+	conn       net.Conn
+	closed     bool
+	pending    [][]byte // records held while disconnected, oldest first
+	size       int      // total size of pending
+	backoff    time.Duration
+	nextDial   time.Time
+	dialed     bool // whether a connection was made before
+	reconnects int
+	lastErr    error
+	lastErrAt  time.Time
+}
+
+// NewNetWriter returns a NetWriter to addr on network, "tcp", "tcp4",
+// "tcp6", "udp", "udp4", "udp6", "unix" or "unixgram", as for net.Dial.
+func NewNetWriter(network, addr string, opts ...NetWriterOption) *NetWriter {
+	cfg := netWriterConfig{
+		minBackoff:   netMinBackoff,
+		maxBackoff:   netMaxBackoff,
+		dialTimeout:  netDialTimeout,
+		writeTimeout: netWriteTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.maxBackoff = max(cfg.maxBackoff, cfg.minBackoff)
+	w := &NetWriter{network: network, addr: addr, cfg: cfg}
+	w.unregister = RegisterFlusher(w)
+	return w
+}
+
+// Write writes p, one record, to the connection, dialing first if needed
+// and the backoff has elapsed. If the writer is disconnected, p is held
+// with NetBuffer and Write returns no error; otherwise, p is dropped and
+// the last error is returned.
+func (w *NetWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, net.ErrClosed
+	}
+	if w.connect(false) {
+		err := w.sendPending()
+		if err == nil {
+			if err = w.send(p); err == nil {
+				return len(p), nil
+			}
+		}
+	}
+	if w.hold(p) {
+		return len(p), nil
+	}
+	return 0, w.lastErr
+}
+
+// exchange sends p, as Write does but without holding it, dialing at once
+// if disconnected, then calls reply with the connection to read the
+// answer of the peer. The connection is closed if either fails.
+func (w *NetWriter) exchange(p []byte, reply func(conn net.Conn) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return net.ErrClosed
+	}
+	if !w.connect(true) {
+		return w.lastErr
+	}
+	if err := w.sendPending(); err != nil {
+		return err
+	}
+	if err := w.send(p); err != nil {
+		return err
+	}
+	if err := reply(w.conn); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		w.fail(err)
+		return err
+	}
+	return nil
+}
+
+// connect dials if disconnected, unless within the backoff and not
+// forced, and reports whether the writer is connected. It is called with
+// mu held.
+func (w *NetWriter) connect(force bool) bool {
+	if w.conn != nil {
+		return true
+	}
+	if !force && time.Now().Before(w.nextDial) {
+		return false
+	}
+	conn, err := net.DialTimeout(w.network, w.addr, w.cfg.dialTimeout)
+	if err != nil {
+		w.fail(err)
+		return false
+	}
+	if w.dialed {
+		w.reconnects++
+	}
+	w.conn, w.backoff, w.dialed = conn, 0, true
+	return true
+}
+
+// send writes one record, in one call, closing the connection on failure.
+// It is called with mu held.
+func (w *NetWriter) send(p []byte) error {
+	if w.cfg.writeTimeout > 0 {
+		w.conn.SetWriteDeadline(time.Now().Add(w.cfg.writeTimeout))
+	}
+	if _, err := w.conn.Write(p); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		w.fail(err)
+		return err
+	}
+	w.lastErr = nil
+	return nil
+}
+
+// sendPending sends the records held, oldest first. It is called with mu
+// held.
+func (w *NetWriter) sendPending() error {
+	for len(w.pending) > 0 {
+		if err := w.send(w.pending[0]); err != nil {
+			return err
+		}
+		w.size -= len(w.pending[0])
+		w.pending[0] = nil
+		w.pending = w.pending[1:]
+	}
+	w.pending = nil
+	return nil
+}
+
+// fail records err and sets the time of the next dial. It is called with
+// mu held.
+func (w *NetWriter) fail(err error) {
+	w.lastErr, w.lastErrAt = err, time.Now()
+	if w.backoff == 0 {
+		w.backoff = w.cfg.minBackoff
+	} else {
+		w.backoff = min(2*w.backoff, w.cfg.maxBackoff)
+	}
+	w.nextDial = w.lastErrAt.Add(w.backoff)
+}
+
+// hold keeps a copy of p, dropping the oldest records held to make room,
+// and reports whether it was kept. It is called with mu held.
+func (w *NetWriter) hold(p []byte) bool {
+	if len(p) > w.cfg.buffer {
+		w.drop(1)
+		return false
+	}
+	n := 0
+	for w.size+len(p) > w.cfg.buffer {
+		w.size -= len(w.pending[n])
+		w.pending[n] = nil
+		n++
+	}
+	w.pending = append(w.pending[n:], append([]byte(nil), p...))
+	w.size += len(p)
+	w.drop(n)
+	return true
+}
+
+// drop counts n records as dropped.
+func (w *NetWriter) drop(n int) {
+	if n > 0 {
+		w.dropped.Add(int64(n))
+		w.cfg.drops.Add(DropQueue, int64(n))
+	}
+}
+
+// Flush dials at once if disconnected, whatever the backoff, and sends
+// the records held.
+func (w *NetWriter) Flush(context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || len(w.pending) == 0 {
+		return nil
+	}
+	if !w.connect(true) {
+		return w.lastErr
+	}
+	return w.sendPending()
+}
+
+// Dropped returns the number of records dropped since w was created.
+func (w *NetWriter) Dropped() int64 {
+	return w.dropped.Load()
+}
+
+// Close sends the records held, if connected, and closes the connection.
+// Writes fail afterwards with net.ErrClosed.
+func (w *NetWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.unregister()
+	if w.conn == nil {
+		w.drop(len(w.pending))
+		w.pending, w.size = nil, 0
+		return nil
+	}
+	err := w.sendPending()
+	w.drop(len(w.pending))
+	w.pending, w.size = nil, 0
+	if w.conn != nil {
+		err = w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+// LogHealth reports the state of the connection. QueueDepth and
+// QueueCapacity are the size of the records held and the size of the
+// buffer, in bytes.
+func (w *NetWriter) LogHealth() ComponentHealth {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return ComponentHealth{
+		Name:          "net",
+		Healthy:       !w.closed && w.lastErr == nil,
+		QueueDepth:    w.size,
+		QueueCapacity: w.cfg.buffer,
+		LastError:     w.lastErr,
+		LastErrorTime: w.lastErrAt,
+		Connected:     w.conn != nil,
+		Reconnects:    w.reconnects,
+	}
+}
@@ -0,0 +1,105 @@
+package log
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+)
+
+// NilPolicy controls how handlers render attributes whose value is nil.
+type NilPolicy int
+
+const (
+	// NilRender leaves nil values to the handler's usual formatting,
+	// which prints them as <nil> in the text handlers of this package,
+	// and as null in JSON.
+	NilRender NilPolicy = iota
+	// NilDrop discards attributes whose value is nil, including typed
+	// nil pointers, maps, slices, functions and channels.
+	NilDrop
+	// NilRenderTyped renders typed nil values with their type, as in
+	// "(*User)(nil)", without calling any of their methods.
+	NilRenderTyped
+)
+
+// Whatever the policy, a String or Error method panicking, as on a nil
+// pointer embedded in a value, is recovered by the handlers, which render
+// the value as NilRenderTyped does.
+
+// nilValue is the value of an attribute rewritten by NilRenderTyped.
+// It is not a string so that text handlers don't quote it.
+type nilValue string
+
+func (v nilValue) String() string { return string(v) }
+
+// applyNilPolicy applies the NilPolicy to a before its value is resolved,
+// so that String, Error and LogValue methods are never called on nil
+// receivers. It reports false if the attribute should be discarded.
+func (o *HandlerOptions) applyNilPolicy(a slog.Attr) (slog.Attr, bool) {
+	if o.NilPolicy == NilRender {
+		return a, true
+	}
+	switch a.Value.Kind() {
+	case slog.KindAny, slog.KindLogValuer:
+	default:
+		return a, true
+	}
+	v := a.Value.Any()
+	if !isNil(v) {
+		return a, true
+	}
+	if o.NilPolicy == NilDrop {
+		return slog.Attr{}, false
+	}
+	if v == nil {
+		// Without a type, nil is rendered as with NilRender.
+		return a, true
+	}
+	a.Value = slog.AnyValue(nilValue(typedNil(v)))
+	return a, true
+}
+
+// typedNil returns the rendering of NilRenderTyped for v.
+func typedNil(v any) string {
+	if v == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("(%T)(nil)", v)
+}
+
+// errorText returns err.Error(), or the typed-nil rendering of err if the
+// method panics, as it does on a nil receiver.
+func errorText(err error) (s string) {
+	defer func() {
+		if recover() != nil {
+			s = typedNil(err)
+		}
+	}()
+	return err.Error()
+}
+
+// stringerText is errorText for the String method of v.
+func stringerText(v fmt.Stringer) (s string) {
+	defer func() {
+		if recover() != nil {
+			s = typedNil(v)
+		}
+	}()
+	return v.String()
+}
+
+// isNil reports whether v is nil or holds a nil value of a nillable type.
+// Reflection is only used for values that are not plainly nil.
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func,
+		reflect.Chan, reflect.Interface, reflect.UnsafePointer:
+		return rv.IsNil()
+	default:
+		return false
+	}
+}
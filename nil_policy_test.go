@@ -0,0 +1,156 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+type nilUser struct{ name string }
+
+// String dereferences its receiver, as most String methods do, and so
+// panics for a nil *nilUser.
+func (u *nilUser) String() string { return u.name }
+
+type nilValuer struct{ id int }
+
+func (v *nilValuer) LogValue() slog.Value { return slog.IntValue(v.id) }
+
+func TestNilPolicy(t *testing.T) {
+	values := []struct {
+		name  string
+		value any
+		typed string // rendering of NilRenderTyped
+	}{
+		{"interface", nil, "<nil>"},
+		{"pointer", (*nilUser)(nil), "(*log.nilUser)(nil)"},
+		{"map", map[string]int(nil), "(map[string]int)(nil)"},
+		{"slice", []string(nil), "([]string)(nil)"},
+		{"LogValuer", (*nilValuer)(nil), "(*log.nilValuer)(nil)"},
+	}
+	for _, v := range values {
+		for _, tt := range []struct {
+			policy NilPolicy
+			want   string
+		}{
+			{NilRender, "v=<nil>"},
+			{NilDrop, ""},
+			{NilRenderTyped, "v=" + v.typed},
+		} {
+			var buf bytes.Buffer
+			h := NewTextHandlerWithOptions(&buf, &HandlerOptions{NoColor: true, NilPolicy: tt.policy})
+			r := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+			r.AddAttrs(slog.Any("v", v.value), slog.Int("n", 1))
+			if err := h.Handle(context.Background(), r); err != nil {
+				t.Fatal(err)
+			}
+			got := strings.TrimPrefix(buf.String(), "|  INFO | msg ")
+			got = strings.TrimSuffix(got, "n=1 \n")
+			got = strings.TrimSpace(got)
+			if v.name == "LogValuer" && tt.policy == NilRender {
+				// slog recovers the panic of LogValue and logs it.
+				if !strings.HasPrefix(got, "v=") || !strings.Contains(got, "LogValue panicked") {
+					t.Errorf("%s, policy %d: got %q, want the recovered panic", v.name, tt.policy, got)
+				}
+				continue
+			}
+			if got != tt.want {
+				t.Errorf("%s, policy %d: got %q, want %q", v.name, tt.policy, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestNilPolicyJSON(t *testing.T) {
+	for _, tt := range []struct {
+		policy NilPolicy
+		value  any
+		want   string
+	}{
+		{NilRender, (*nilUser)(nil), `"v":null,"n":1`},
+		{NilDrop, (*nilUser)(nil), `"msg":"msg","n":1`},
+		{NilRenderTyped, (*nilUser)(nil), `"v":"(*log.nilUser)(nil)","n":1`},
+		// Without a type, nil is null whatever the policy but NilDrop.
+		{NilRenderTyped, nil, `"v":null,"n":1`},
+	} {
+		var buf bytes.Buffer
+		h := NewJSONHandlerWithOptions(&buf, &HandlerOptions{NilPolicy: tt.policy})
+		r := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+		r.AddAttrs(slog.Any("v", tt.value), slog.Int("n", 1))
+		h.Handle(context.Background(), r)
+		if got := buf.String(); !strings.Contains(got, tt.want) {
+			t.Errorf("policy %d: got %s, want it to hold %s", tt.policy, got, tt.want)
+		}
+	}
+}
+
+type nilError struct{ msg string }
+
+func (e *nilError) Error() string { return e.msg }
+
+// The methods of the embedded nil pointers are promoted, and panic.
+type (
+	nilUserValue  struct{ *nilUser }
+	nilErrorValue struct{ *nilError }
+)
+
+// A String or Error method panicking on its nil receiver is recovered,
+// the value rendered with its type.
+func TestNilPolicyMethodPanics(t *testing.T) {
+	handlers := map[string]func(w io.Writer) slog.Handler{
+		"text":    func(w io.Writer) slog.Handler { return NewTextHandlerWithOptions(w, &HandlerOptions{NoColor: true}) },
+		"json":    func(w io.Writer) slog.Handler { return NewJSONHandler(w, nil) },
+		"logfmt":  func(w io.Writer) slog.Handler { return NewLogfmtHandler(w, nil) },
+		"ecs":     func(w io.Writer) slog.Handler { return NewECSHandler(w, nil) },
+		"msgpack": func(w io.Writer) slog.Handler { return NewMsgpackHandler(w, nil) },
+	}
+	for name, newHandler := range handlers {
+		for _, v := range []any{(*nilUser)(nil), (*nilError)(nil), nilUserValue{}, nilErrorValue{}} {
+			var buf bytes.Buffer
+			r := slog.NewRecord(time.Time{}, slog.LevelError, "msg", 0)
+			r.AddAttrs(slog.Any("err", v))
+			func() {
+				defer func() {
+					if p := recover(); p != nil {
+						t.Errorf("%s, %T: panic %v", name, v, p)
+					}
+				}()
+				newHandler(&buf).Handle(context.Background(), r)
+			}()
+			// JSON renders the values other than errors as encoding/json does.
+			_, isErr := v.(error)
+			json := name == "json" || name == "ecs"
+			if typed := typedNil(v); !isNil(v) && (isErr || !json) && !strings.Contains(buf.String(), typed) {
+				t.Errorf("%s: got %q, want it to hold %s", name, buf.String(), typed)
+			}
+		}
+	}
+}
+
+func TestIsNil(t *testing.T) {
+	var iface error
+	for _, tt := range []struct {
+		v    any
+		want bool
+	}{
+		{nil, true},
+		{iface, true},
+		{(*int)(nil), true},
+		{map[int]int(nil), true},
+		{[]byte(nil), true},
+		{(func())(nil), true},
+		{(chan int)(nil), true},
+		{0, false},
+		{"", false},
+		{[]byte{}, false},
+		{&nilUser{}, false},
+	} {
+		if got := isNil(tt.v); got != tt.want {
+			t.Errorf("isNil(%#v) = %t, want %t", tt.v, got, tt.want)
+		}
+	}
+}
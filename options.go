@@ -0,0 +1,370 @@
+package log
+
+import (
+	"log/slog"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// HandledAtKey is the key used by the handlers in this package for the
+// time at which a record was processed. See [HandlerOptions.StampHandleTime].
+const HandledAtKey = "handled_at"
+
+// UptimeKey is the key used by the handlers in this package for the time
+// elapsed since the start of the process. See [HandlerOptions.StampUptime].
+const UptimeKey = "uptime"
+
+// processStart is the time the package was initialized. It carries a
+// monotonic clock reading, which time.Since uses.
+var processStart = time.Now()
+
+// HandlerOptions are options for the handlers in this package.
+// The embedded [slog.HandlerOptions] keep their usual meaning.
+type HandlerOptions struct {
+	slog.HandlerOptions
+
+	// ReplaceGroup, if set, is called for each Group attribute before its
+	// contents, which ReplaceAttr never sees as a whole. It can drop the
+	// group by returning the zero Attr, rename it, or replace it with
+	// another value; a non-group result then goes through ReplaceAttr like
+	// any other attribute. The groups argument is as for ReplaceAttr.
+	ReplaceGroup func(groups []string, a slog.Attr) slog.Attr
+
+	// StampHandleTime causes the handler to add a HandledAtKey attribute
+	// holding the time at which it processed the record. Compared with
+	// the record's own time, it makes lag in the logging pipeline visible.
+	StampHandleTime bool
+
+	// StampUptime causes the handler to add an UptimeKey attribute holding
+	// the time elapsed since the start of the process, measured with the
+	// monotonic clock. Unlike the record times, it never goes backwards
+	// when the wall clock is stepped, so deltas computed from it hold.
+	StampUptime bool
+
+	// NilPolicy controls how attributes with nil values are rendered.
+	// The zero value, NilRender, keeps the handler's usual formatting.
+	NilPolicy NilPolicy
+
+	// ColorMessageByLevel renders the message in the color of the record's
+	// level, including continuation lines, instead of the default color.
+	// It is used by TextHandler.
+	ColorMessageByLevel bool
+
+	// TimeLayout sets how the record time is rendered by TextHandler, and
+	// by IndentHandler with CompactHeader. If nil, DefaultTimeLayout is used.
+	TimeLayout *TimeLayout
+
+	// LevelNames, if set, are the labels TextHandler and IndentHandler
+	// write for the levels, such as "WRN" for LevelWarn or "WARNING", in
+	// place of their names. The levels without one, such as FATAL+2,
+	// keep their names. The labels are padded to the width of the
+	// longest, so that the columns stay aligned.
+	LevelNames map[Level]string
+
+	// Icons, if set, are marks TextHandler writes before the labels of the
+	// levels, such as "⚠️" for LevelWarn, or in place of them with
+	// IconsOnly, for the output of command-line tools. The levels without
+	// one keep their labels. Colors disabled, the icons are still written,
+	// and the labels are padded to the width the icons take on terminals,
+	// emoji being twice as wide as letters.
+	Icons     map[Level]string
+	IconsOnly bool
+
+	// TimeLocation, if set, is the time zone TextHandler and IndentHandler
+	// render the record time and the time values of the attributes in,
+	// such as time.UTC, whatever the zone of the host. The times are
+	// converted before ReplaceAttr sees them.
+	TimeLocation *time.Location
+
+	// CompactHeader makes IndentHandler render the time, level and source
+	// of a record on one header line, as in
+	//
+	//	2024-06-01 12:00:00  INFO user.go:42
+	//
+	// rather than one field per line.
+	CompactHeader bool
+
+	// SourceLinkTemplate, if set, turns the source location into an OSC 8
+	// hyperlink when writing to a terminal. The placeholders {path} and
+	// {line} are replaced by the file path and line number, as in
+	// "file://{path}" or "vscode://file/{path}:{line}".
+	// It is used by TextHandler when AddSource is set.
+	SourceLinkTemplate string
+
+	// NoColor disables the colors and other terminal escape sequences of
+	// TextHandler, even when it writes to a terminal.
+	NoColor bool
+
+	// ForceColor makes TextHandler write colors even when it doesn't
+	// write to a terminal, or the NO_COLOR environment variable is set.
+	// With neither NoColor nor ForceColor, colors are written only to
+	// terminals, and only if NO_COLOR is not set.
+	ForceColor bool
+
+	// RawWriter makes TextHandler write to its writer as is, for writers
+	// that deal with terminal escape sequences themselves, instead of
+	// wrapping it in the writer of its Colorizer.
+	RawWriter bool
+
+	// Colorizer renders the styles of TextHandler and FastTextHandler.
+	// If nil, the zestack.dev/color package renders them. See [Colorizer].
+	Colorizer Colorizer
+
+	// Theme, if set, are the colors of TextHandler and FastTextHandler,
+	// written as SGR sequences. It is ignored if Colorizer is set. See
+	// [Theme].
+	Theme *Theme
+
+	// SortAttrs renders the attributes of each record sorted by key, rather
+	// than in the order they were given. Attributes added with WithAttrs
+	// keep their place ahead of them.
+	SortAttrs bool
+
+	// ShortSource renders the source location as the file's directory and
+	// base name, such as "log/logger.go:42", rather than its full path,
+	// which depends on where the program was built.
+	ShortSource bool
+
+	// SourcePath, if set, renders the source location of a record from
+	// its file and line, as FullSourcePath, ShortSourcePath,
+	// ModuleSourcePath and the functions of LastSourceElements do. If nil,
+	// TextHandler and IndentHandler use ShortSourcePath, unless
+	// ShortSource or SourceLinkTemplate is set, and the other handlers
+	// FullSourcePath.
+	SourcePath func(file string, line int) string
+
+	// SourceFunc adds the name of the function to the source location,
+	// after a space, without the path of its package, as in
+	// "http/server.go:412 http.(*Server).Serve". ReplaceAttr receives
+	// them together as the value of the SourceKey attribute.
+	SourceFunc bool
+
+	// Strings overrides the fixed texts the handler adds to the output,
+	// such as the marker of a message spanning several lines.
+	// If nil, DefaultStrings are used.
+	Strings *Strings
+
+	// Clock returns the current time for the values the handler computes
+	// itself, such as HandledAtKey. If nil, time.Now is used. A zero time
+	// from Clock omits those values.
+	Clock func() time.Time
+}
+
+func (o *HandlerOptions) now() time.Time {
+	if o.Clock != nil {
+		return o.Clock()
+	}
+	return time.Now()
+}
+
+// handledAt returns the value of the HandledAtKey attribute, or the zero
+// time if it is not to be added. Like the record time, a zero time means
+// that there is no time to show, never "0001-01-01".
+func (o *HandlerOptions) handledAt() time.Time {
+	if !o.StampHandleTime {
+		return time.Time{}
+	}
+	return o.now()
+}
+
+// uptime returns the value of the UptimeKey attribute, and whether it is
+// to be added.
+func (o *HandlerOptions) uptime() (time.Duration, bool) {
+	if !o.StampUptime {
+		return 0, false
+	}
+	return time.Since(processStart), true
+}
+
+// source returns the source location of pc, as "file:line", or as
+// rendered by SourcePath, followed by the function with SourceFunc.
+func (o *HandlerOptions) source(pc uintptr) string {
+	f := o.frame(pc)
+	var src string
+	if o.SourcePath != nil {
+		src = o.SourcePath(f.File, f.Line)
+	} else {
+		src = FullSourcePath(f.File, f.Line)
+	}
+	if o.SourceFunc && f.Function != "" {
+		src += " " + shortFunction(f.Function)
+	}
+	return src
+}
+
+// shortFunction returns the name of a function without the path of its
+// package, as "http.(*Server).Serve" for "net/http.(*Server).Serve".
+func shortFunction(name string) string {
+	return name[strings.LastIndexByte(name, '/')+1:]
+}
+
+// shortSourceByDefault sets SourcePath to ShortSourcePath, the default of
+// TextHandler and IndentHandler, unless the paths are already shortened
+// or are needed whole for the links of SourceLinkTemplate.
+func (o *HandlerOptions) shortSourceByDefault() {
+	if o.SourcePath == nil && !o.ShortSource && o.SourceLinkTemplate == "" {
+		o.SourcePath = ShortSourcePath
+	}
+}
+
+// frame returns the frame of pc, its file shortened if ShortSource is set.
+func (o *HandlerOptions) frame(pc uintptr) runtime.Frame {
+	f, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	if o.ShortSource {
+		dir, base := path.Split(f.File)
+		f.File = path.Join(path.Base(dir), base)
+	}
+	return f
+}
+
+// levelName returns the label of l: its entry in LevelNames, or its name.
+func (o *HandlerOptions) levelName(l slog.Level) string {
+	level := parseSlogLevel(l)
+	if name, ok := o.LevelNames[level]; ok {
+		return name
+	}
+	return level.String()
+}
+
+// levelLabel returns the label of l with its icon: before it, or in place
+// of it with IconsOnly.
+func (o *HandlerOptions) levelLabel(l slog.Level) string {
+	name := o.levelName(l)
+	icon, ok := o.Icons[parseSlogLevel(l)]
+	switch {
+	case !ok:
+		return name
+	case o.IconsOnly:
+		return icon
+	}
+	return icon + " " + name
+}
+
+// levelWidth returns the width the labels of the levels, as returned by
+// label, are padded to: that of the longest label of the levels of this
+// package.
+func (o *HandlerOptions) levelWidth(label func(slog.Level) string) int {
+	if o.LevelNames == nil && o.Icons == nil {
+		return levelWidth
+	}
+	width := 0
+	for level := LevelTrace; level <= LevelFatal; level++ {
+		width = max(width, displayWidth(label(level.Level())))
+	}
+	return width
+}
+
+// inLocation returns a with its value in TimeLocation, if set and a is a
+// time.
+func (o *HandlerOptions) inLocation(a slog.Attr) slog.Attr {
+	if o.TimeLocation != nil && a.Value.Kind() == slog.KindTime {
+		a.Value = slog.TimeValue(a.Value.Time().In(o.TimeLocation))
+	}
+	return a
+}
+
+// builtin passes a built-in attribute through ReplaceAttr, if any.
+// It reports false if the attribute was removed.
+func (o *HandlerOptions) builtin(a slog.Attr) (slog.Attr, bool) {
+	if o.ReplaceAttr == nil {
+		return a, true
+	}
+	a = o.ReplaceAttr(nil, a)
+	a.Value = a.Value.Resolve()
+	return a, !a.Equal(slog.Attr{})
+}
+
+// recordAttrs calls fn on each attribute of r, sorted by key if
+// SortAttrs is set, until fn returns false.
+func (o *HandlerOptions) recordAttrs(r slog.Record, fn func(slog.Attr) bool) {
+	if !o.SortAttrs || r.NumAttrs() < 2 {
+		r.Attrs(fn)
+		return
+	}
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	slices.SortStableFunc(attrs, func(a, b slog.Attr) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	for _, a := range attrs {
+		if !fn(a) {
+			return
+		}
+	}
+}
+
+// replaceGroup passes a, resolved, through ReplaceGroup if it is a group.
+func (o *HandlerOptions) replaceGroup(groups []string, a slog.Attr) slog.Attr {
+	if o.ReplaceGroup == nil || a.Value.Kind() != slog.KindGroup {
+		return a
+	}
+	a = o.ReplaceGroup(groups, a)
+	a.Value = a.Value.Resolve()
+	return a
+}
+
+// field returns a resolved and passed through the NilPolicy, ReplaceGroup
+// and ReplaceAttr, within groups too, or false if it is left out.
+func (o *HandlerOptions) field(groups []string, a slog.Attr) (slog.Attr, bool) {
+	a, ok := o.applyNilPolicy(a)
+	if !ok {
+		return a, false
+	}
+	a.Value = a.Value.Resolve()
+	a = o.replaceGroup(groups, a)
+	if rep := o.ReplaceAttr; rep != nil && a.Value.Kind() != slog.KindGroup {
+		a = rep(groups, a)
+		a.Value = a.Value.Resolve()
+	}
+	if a.Equal(slog.Attr{}) {
+		return a, false
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(slices.Clip(groups), a.Key)
+		}
+		var members []slog.Attr
+		for _, ga := range a.Value.Group() {
+			if ga, ok := o.field(groups, ga); ok {
+				members = append(members, ga)
+			}
+		}
+		if len(members) == 0 {
+			return a, false
+		}
+		a.Value = slog.GroupValue(members...)
+	}
+	return a, true
+}
+
+// flattenAttr adds each leaf of a, an attribute returned by field, to dst
+// with add, given the keys of the groups around it, each followed by a
+// dot, as prefix. The members of a group without key are inlined.
+func flattenAttr[T any](dst T, prefix string, a slog.Attr, add func(dst T, prefix string, a slog.Attr) T) T {
+	if a.Value.Kind() != slog.KindGroup {
+		return add(dst, prefix, a)
+	}
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, ga := range a.Value.Group() {
+		dst = flattenAttr(dst, prefix, ga, add)
+	}
+	return dst
+}
+
+// handlerOptions converts the slog options accepted by the constructors
+// into the options used by the handlers in this package.
+func handlerOptions(opts *slog.HandlerOptions) *HandlerOptions {
+	o := new(HandlerOptions)
+	if opts != nil {
+		o.HandlerOptions = *opts
+	}
+	return o
+}
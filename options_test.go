@@ -0,0 +1,204 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replaceGroupHandlers are the handlers honoring ReplaceGroup.
+var replaceGroupHandlers = []struct {
+	name string
+	new  func(w io.Writer, opts *HandlerOptions) slog.Handler
+}{
+	{"text", func(w io.Writer, o *HandlerOptions) slog.Handler {
+		o.NoColor = true
+		return NewTextHandlerWithOptions(w, o)
+	}},
+	{"indent", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewIndentHandlerWithOptions(w, o) }},
+	{"json", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewJSONHandlerWithOptions(w, o) }},
+}
+
+func TestReplaceGroup(t *testing.T) {
+	headers := slog.Group("headers", slog.String("cookie", "s3cr3t"), slog.String("accept", "text/html"))
+	for _, tt := range []struct {
+		name    string
+		replace func(groups []string, a slog.Attr) slog.Attr
+		want    map[string]string // by handler
+		absent  []string
+	}{
+		{
+			name: "drop",
+			replace: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == "headers" {
+					return slog.Attr{}
+				}
+				return a
+			},
+			want: map[string]string{
+				"text":   `req.path="/login" `,
+				"indent": "req:\n    path: \"/login\"\n",
+				"json":   `"req":{"path":"/login"}`,
+			},
+			absent: []string{"headers", "cookie", "s3cr3t"},
+		},
+		{
+			name: "rename",
+			replace: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == "headers" {
+					a.Key = "h"
+				}
+				return a
+			},
+			want: map[string]string{
+				"text":   `req.h.cookie="s3cr3t" req.h.accept="text/html"`,
+				"indent": "    h:\n        cookie: \"s3cr3t\"\n        accept: \"text/html\"\n",
+				"json":   `"h":{"cookie":"s3cr3t","accept":"text/html"}`,
+			},
+			absent: []string{"headers"},
+		},
+		{
+			name: "replace with a value",
+			replace: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == "headers" {
+					return slog.Int("headers", len(a.Value.Group()))
+				}
+				return a
+			},
+			want: map[string]string{
+				"text":   "req.headers=2",
+				"indent": "    headers: 2\n",
+				"json":   `"headers":2`,
+			},
+			absent: []string{"cookie"},
+		},
+		{
+			name:    "pass through",
+			replace: func(groups []string, a slog.Attr) slog.Attr { return a },
+			want: map[string]string{
+				"text":   `req.path="/login" req.headers.cookie="s3cr3t" req.headers.accept="text/html"`,
+				"indent": "    headers:\n        cookie: \"s3cr3t\"\n",
+				"json":   `"req":{"path":"/login","headers":{"cookie":"s3cr3t","accept":"text/html"}}`,
+			},
+		},
+	} {
+		for _, h := range replaceGroupHandlers {
+			t.Run(tt.name+"/"+h.name, func(t *testing.T) {
+				var gotGroups [][]string
+				var buf bytes.Buffer
+				handler := h.new(&buf, &HandlerOptions{ReplaceGroup: func(groups []string, a slog.Attr) slog.Attr {
+					gotGroups = append(gotGroups, groups)
+					return tt.replace(groups, a)
+				}})
+				r := slog.NewRecord(time.Time{}, slog.LevelInfo, "request", 0)
+				r.AddAttrs(slog.Group("req", slog.String("path", "/login"), headers))
+				handler.Handle(context.Background(), r)
+				got := buf.String()
+				if !strings.Contains(got, tt.want[h.name]) {
+					t.Errorf("got:\n%s\nwant it to contain:\n%s", got, tt.want[h.name])
+				}
+				for _, s := range tt.absent {
+					if strings.Contains(got, s) {
+						t.Errorf("got %q in:\n%s", s, got)
+					}
+				}
+				if len(gotGroups) != 2 || len(gotGroups[0]) != 0 || strings.Join(gotGroups[1], ".") != "req" {
+					t.Errorf("ReplaceGroup called with the groups %q, want [] then [req]", gotGroups)
+				}
+			})
+		}
+	}
+}
+
+// Groups added by WithAttrs, which handlers format ahead of the records,
+// go through ReplaceGroup too.
+func TestReplaceGroupWithAttrs(t *testing.T) {
+	drop := func(groups []string, a slog.Attr) slog.Attr {
+		if a.Key == "headers" {
+			return slog.Attr{}
+		}
+		return a
+	}
+	for _, h := range replaceGroupHandlers {
+		t.Run(h.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			handler := h.new(&buf, &HandlerOptions{ReplaceGroup: drop}).
+				WithGroup("req").
+				WithAttrs([]slog.Attr{slog.Group("headers", slog.String("cookie", "s3cr3t")), slog.String("path", "/")})
+			handler.Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelInfo, "request", 0))
+			if got := buf.String(); strings.Contains(got, "s3cr3t") || !strings.Contains(got, "path") {
+				t.Errorf("got:\n%s", got)
+			}
+		})
+	}
+}
+
+// ReplaceAttr gets the groups from WithGroup and those of the Group
+// attributes around an attribute, and its key alone.
+func TestReplaceAttrGroups(t *testing.T) {
+	for _, h := range replaceGroupHandlers {
+		t.Run(h.name, func(t *testing.T) {
+			var got []string
+			handler := h.new(io.Discard, &HandlerOptions{HandlerOptions: slog.HandlerOptions{
+				ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+					if len(groups) > 0 {
+						got = append(got, strings.Join(append(groups, a.Key), "/"))
+					}
+					return a
+				},
+			}}).WithGroup("http")
+			r := slog.NewRecord(time.Time{}, slog.LevelInfo, "request", 0)
+			r.AddAttrs(slog.Group("req", slog.String("path", "/"), slog.Group("headers", slog.String("cookie", "c"))))
+			handler.Handle(context.Background(), r)
+			if want := "http/req/path http/req/headers/cookie"; strings.Join(got, " ") != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// The record time and the time values, in groups and from WithAttrs too,
+// are rendered in TimeLocation, with the layout of TimeLayout, and
+// ReplaceAttr sees them converted.
+func TestTimeLocation(t *testing.T) {
+	zone := time.FixedZone("NST", -(3*60+30)*60)
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	want := map[string]string{
+		"text": `2024-06-01 08:30 NST |  INFO | checked started="2024-05-31 20:30 NST" disk.checked="2024-06-01 09:30 NST" ` + "\n",
+		"indent": "2024-06-01 08:30 NST  INFO\nmsg: checked\nstarted: 2024-05-31T20:30:00-03:30\n" +
+			"disk:\n    checked: 2024-06-01T09:30:00-03:30\n---\n",
+	}
+	for _, h := range replaceGroupHandlers[:2] {
+		t.Run(h.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			var zones []string
+			handler := h.new(&buf, &HandlerOptions{
+				HandlerOptions: slog.HandlerOptions{
+					ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+						if a.Value.Kind() == slog.KindTime {
+							name, _ := a.Value.Time().Zone()
+							zones = append(zones, a.Key+":"+name)
+						}
+						return a
+					},
+				},
+				TimeLocation:  zone,
+				TimeLayout:    &TimeLayout{Date: time.DateOnly, Clock: "15:04 MST", Separator: " "},
+				CompactHeader: true,
+			}).WithAttrs([]slog.Attr{slog.Time("started", at.Add(-12*time.Hour))})
+			r := slog.NewRecord(at, slog.LevelInfo, "checked", 0)
+			r.AddAttrs(slog.Group("disk", slog.Time("checked", at.Add(time.Hour))))
+			handler.Handle(context.Background(), r)
+			if buf.String() != want[h.name] {
+				t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want[h.name])
+			}
+			if got := strings.Join(zones, " "); got != "started:NST time:NST checked:NST" {
+				t.Errorf("ReplaceAttr got the zones %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Defaults of OTLPOptions.
+const (
+	otlpBatchSize     = 512
+	otlpQueueSize     = 2048
+	otlpFlushInterval = 5 * time.Second
+	otlpMaxRetries    = 3
+	otlpMinBackoff    = 500 * time.Millisecond
+	otlpMaxBackoff    = 30 * time.Second
+	otlpScopeName     = "zestack.dev/log"
+)
+
+// OTLPOptions are options for an [OTLPHandler].
+type OTLPOptions struct {
+	HandlerOptions
+
+	// Endpoint is the URL the batches are posted to, such as
+	// "http://localhost:4318/v1/logs".
+	Endpoint string
+
+	// Headers are added to each request, for example for authentication.
+	Headers map[string]string
+
+	// Resource are the attributes of the resource the records come from,
+	// such as service.name.
+	Resource []Attr
+
+	// ScopeName is the name of the instrumentation scope of the records.
+	// If empty, "zestack.dev/log" is used.
+	ScopeName string
+
+	// BatchSize is the largest number of records sent in one request.
+	// If zero, 512 is used.
+	BatchSize int
+
+	// QueueSize is the number of records the handler holds before they
+	// are sent. If zero, 2048 is used.
+	QueueSize int
+
+	// FlushInterval is how long a record may wait for its batch to fill
+	// up before it is sent anyway. If zero, five seconds are used.
+	FlushInterval time.Duration
+
+	// MaxRetries is the number of times a batch is sent again after the
+	// collector answered 429 or 5xx, or couldn't be reached, waiting
+	// longer each time, from MinBackoff to MaxBackoff, before it is
+	// dropped. If zero, 3 is used; if negative, batches are not sent
+	// again.
+	MaxRetries int
+	MinBackoff time.Duration // if zero, half a second
+	MaxBackoff time.Duration // if zero, 30 seconds
+
+	// Block makes Handle wait for room in a full queue, until its context
+	// is done, instead of dropping the record.
+	Block bool
+
+	// Client sends the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Drops, if set, counts the records dropped from a full queue under
+	// DropQueue, and those of the batches given up on under DropFailed.
+	// See [Drops].
+	Drops *Drops
+
+	// OnError, if set, is called with the errors met sending a batch.
+	OnError func(err error)
+}
+
+// OTLPHandler exports records to an OpenTelemetry collector as OTLP log
+// records, over HTTP with protobuf encoding. Each record becomes a
+// LogRecord whose body is the message, whose severity is derived from the
+// level, TRACE to FATAL mapping to the OpenTelemetry severities of the
+// same names and PANIC to FATAL, and whose attributes are those of the
+// record, with the keys of groups joined by dots, as in "http.method".
+// A trace stored in the context by [ContextWithTrace] whose last path
+// element is a 32-digit hexadecimal trace ID sets the trace ID.
+//
+// Records are encoded by Handle and queued, then sent in batches by a
+// background goroutine, when a batch is full or FlushInterval after its
+// first record. Batches failing with 429 or 5xx are sent again with
+// exponential backoff, then dropped. When the queue is full, records are
+// dropped, or Handle blocks if Block is set. A record at LevelPanic or
+// above is sent at once, with the records queued before it, Handle waiting
+// until they are sent. Shutdown sends the records queued and stops the
+// handler.
+//
+// gRPC transport is not supported.
+type OTLPHandler struct {
+	opts   OTLPOptions
+	prefix string        // group names from WithGroup, dot-terminated
+	groups []string      // the same, for ReplaceAttr
+	attrs  []byte        // encoded KeyValues from WithAttrs
+	e      *otlpExporter // shared with the handlers derived from this one
+}
+
+// otlpExporter sends the records of an OTLPHandler.
+type otlpExporter struct {
+	*batchExporter[[]byte]
+	opts   *OTLPOptions
+	header []byte // encoded Resource and InstrumentationScope
+}
+
+// NewOTLPHandler returns an OTLPHandler posting to opts.Endpoint, and
+// starts its sending goroutine. It is registered with [RegisterFlusher]
+// until Shutdown.
+func NewOTLPHandler(opts OTLPOptions) *OTLPHandler {
+	if opts.Level == nil {
+		opts.Level = slog.LevelInfo
+	}
+	if opts.ScopeName == "" {
+		opts.ScopeName = otlpScopeName
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = otlpBatchSize
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = otlpQueueSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = otlpFlushInterval
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = otlpMaxRetries
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = otlpMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = otlpMaxBackoff
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	h := &OTLPHandler{opts: opts}
+	e := &otlpExporter{opts: &h.opts}
+	var resource []byte
+	for _, a := range opts.Resource {
+		resource = appendOTLPResourceAttr(resource, "", a)
+	}
+	e.header = appendPBMessage(e.header, 1, resource) // ResourceLogs.resource
+	e.batchExporter = newBatchExporter(batchOptions{
+		BatchSize:     opts.BatchSize,
+		QueueSize:     opts.QueueSize,
+		FlushInterval: opts.FlushInterval,
+		MaxRetries:    opts.MaxRetries,
+		MinBackoff:    opts.MinBackoff,
+		MaxBackoff:    opts.MaxBackoff,
+		Block:         opts.Block,
+		Drops:         opts.Drops,
+		OnError:       opts.OnError,
+	}, e.send)
+	h.e = e
+	e.unregister = RegisterFlusher(h)
+	return h
+}
+
+func (h *OTLPHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *OTLPHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+func (h *OTLPHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = slices.Clip(h.attrs)
+	for _, a := range attrs {
+		h2.attrs = h.appendAttr(h2.attrs, h.prefix, h.groups, a)
+	}
+	return &h2
+}
+
+func (h *OTLPHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.e.closed.Load() {
+		return net.ErrClosed
+	}
+	var rec []byte
+	if !r.Time.IsZero() {
+		rec = appendPBFixed64(rec, 1, uint64(r.Time.UnixNano())) // time_unix_nano
+	}
+	number, text := otlpSeverity(r.Level)
+	rec = appendPBVarint(rec, 2, uint64(number)) // severity_number
+	rec = appendPBString(rec, 3, text)           // severity_text
+	var body []byte
+	body = appendPBString(body, 1, r.Message) // AnyValue.string_value
+	rec = appendPBMessage(rec, 5, body)       // body
+	if h.opts.AddSource {
+		rec = h.appendAttr(rec, "", nil, slog.String("code.source", h.opts.source(r.PC)))
+	}
+	rec = append(rec, h.attrs...)
+	h.opts.recordAttrs(r, func(a slog.Attr) bool {
+		rec = h.appendAttr(rec, h.prefix, h.groups, a)
+		return true
+	})
+	if id := otlpTraceID(TraceFromContext(ctx)); id != nil {
+		rec = appendPBBytes(rec, 9, id) // trace_id
+	}
+	rec = appendPBFixed64(rec, 11, uint64(time.Now().UnixNano())) // observed_time_unix_nano
+	return h.e.enqueue(ctx, r.Level, rec)
+}
+
+// appendAttr appends a, as one KeyValue message per leaf attribute, the
+// keys of groups joined by dots.
+func (h *OTLPHandler) appendAttr(buf []byte, prefix string, groups []string, a slog.Attr) []byte {
+	a, ok := h.opts.field(groups, a)
+	if !ok {
+		return buf
+	}
+	return flattenAttr(buf, prefix, a, func(buf []byte, prefix string, a slog.Attr) []byte {
+		return appendPBMessage(buf, 6, otlpKeyValue(prefix+a.Key, a.Value)) // LogRecord.attributes
+	})
+}
+
+// appendOTLPResourceAttr appends a as the attributes of a Resource, the
+// keys of groups joined by dots.
+func appendOTLPResourceAttr(buf []byte, prefix string, a slog.Attr) []byte {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			buf = appendOTLPResourceAttr(buf, prefix, ga)
+		}
+		return buf
+	}
+	return appendPBMessage(buf, 1, otlpKeyValue(prefix+a.Key, a.Value)) // Resource.attributes
+}
+
+// otlpKeyValue returns the encoded KeyValue of key and v.
+func otlpKeyValue(key string, v slog.Value) []byte {
+	var kv []byte
+	kv = appendPBString(kv, 1, key)
+	return appendPBMessage(kv, 2, otlpAnyValue(v))
+}
+
+// otlpAnyValue returns the encoded AnyValue of v.
+func otlpAnyValue(v slog.Value) []byte {
+	var b []byte
+	switch v.Kind() {
+	case slog.KindString:
+		return appendPBString(b, 1, v.String())
+	case slog.KindBool:
+		b = appendPBTag(b, 2, 0)
+		if v.Bool() {
+			return append(b, 1)
+		}
+		return append(b, 0)
+	case slog.KindInt64:
+		return appendPBVarint(b, 3, uint64(v.Int64()))
+	case slog.KindUint64:
+		if x := v.Uint64(); x <= math.MaxInt64 {
+			return appendPBVarint(b, 3, x)
+		}
+		return appendPBString(b, 1, v.String())
+	case slog.KindFloat64:
+		b = appendPBTag(b, 4, 1)
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(v.Float64()))
+	case slog.KindDuration:
+		return appendPBVarint(b, 3, uint64(v.Duration()))
+	default:
+		if p, ok := v.Any().([]byte); ok {
+			return appendPBBytes(b, 7, p)
+		}
+		return appendPBString(b, 1, string(appendValue(nil, v)))
+	}
+}
+
+// otlpSeverity returns the OpenTelemetry severity number and text of a
+// level.
+func otlpSeverity(l slog.Level) (int, string) {
+	level := parseSlogLevel(l)
+	name := levelToString(l)
+	switch {
+	case level <= LevelTrace:
+		return 1, name
+	case level == LevelDebug:
+		return 5, name
+	case level == LevelInfo:
+		return 9, name
+	case level == LevelWarn:
+		return 13, name
+	case level == LevelError:
+		return 17, name
+	case level == LevelPanic:
+		return 21, name
+	default:
+		return 24, name
+	}
+}
+
+// otlpTraceID returns the trace ID of trace, the 16 bytes written in
+// hexadecimal as its last path element, or nil.
+func otlpTraceID(trace string) []byte {
+	trace = trace[strings.LastIndexByte(trace, '/')+1:]
+	if len(trace) != 32 {
+		return nil
+	}
+	id, err := hex.DecodeString(trace)
+	if err != nil {
+		return nil
+	}
+	return id
+}
+
+// send posts one batch of encoded LogRecords.
+func (e *otlpExporter) send(ctx context.Context, batch [][]byte) (retry bool, err error) {
+	var scope, scopeLogs, resourceLogs, req []byte
+	scope = appendPBString(scope, 1, e.opts.ScopeName)
+	scopeLogs = appendPBMessage(scopeLogs, 1, scope)
+	for _, rec := range batch {
+		scopeLogs = appendPBMessage(scopeLogs, 2, rec)
+	}
+	resourceLogs = append(resourceLogs, e.header...)
+	resourceLogs = appendPBMessage(resourceLogs, 2, scopeLogs)
+	req = appendPBMessage(req, 1, resourceLogs)
+	return e.post(ctx, req)
+}
+
+// post posts one request, and reports whether it may be sent again if it
+// failed.
+func (e *otlpExporter) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+		return retry, fmt.Errorf("log: OTLP export: %s", resp.Status)
+	}
+	return false, nil
+}
+
+// Flush sends the records queued, waiting until they are sent or ctx is
+// done.
+func (h *OTLPHandler) Flush(ctx context.Context) error {
+	return h.e.flush(ctx)
+}
+
+// Shutdown sends the records queued and stops the handler, waiting until
+// it is done or ctx is done, when the batch being sent is abandoned.
+// Records handled afterwards return net.ErrClosed.
+func (h *OTLPHandler) Shutdown(ctx context.Context) error {
+	return h.e.close(ctx)
+}
+
+// LogHealth reports the state of the queue and of the last export.
+func (h *OTLPHandler) LogHealth() ComponentHealth {
+	return h.e.health("otlp")
+}
+
+// Protocol buffer encoding, enough for the messages of OTLP.
+
+func appendPBTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendPBVarint(b []byte, field int, v uint64) []byte {
+	b = appendPBTag(b, field, 0)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendPBFixed64(b []byte, field int, v uint64) []byte {
+	b = appendPBTag(b, field, 1)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+func appendPBBytes(b []byte, field int, p []byte) []byte {
+	b = appendPBTag(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(p)))
+	return append(b, p...)
+}
+
+func appendPBString(b []byte, field int, s string) []byte {
+	b = appendPBTag(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendPBMessage(b []byte, field int, msg []byte) []byte {
+	return appendPBBytes(b, field, msg)
+}
@@ -0,0 +1,216 @@
+package log
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// pbField is a field of a protocol buffer message: its number, and its
+// value, a varint or fixed64 as a uint64 or bytes.
+type pbField struct {
+	num   int
+	x     uint64
+	bytes []byte
+}
+
+// pbFields decodes the fields of msg.
+func pbFields(t *testing.T, msg []byte) []pbField {
+	t.Helper()
+	var fields []pbField
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			t.Fatalf("bad tag in %x", msg)
+		}
+		msg = msg[n:]
+		f := pbField{num: int(tag >> 3)}
+		switch tag & 7 {
+		case 0:
+			f.x, n = binary.Uvarint(msg)
+		case 1:
+			f.x, n = binary.LittleEndian.Uint64(msg), 8
+		case 2:
+			var size uint64
+			size, n = binary.Uvarint(msg)
+			f.bytes = msg[n : n+int(size)]
+			n += int(size)
+		default:
+			t.Fatalf("wire type %d", tag&7)
+		}
+		msg = msg[n:]
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// pbGet returns the fields of msg numbered num.
+func pbGet(t *testing.T, msg []byte, num int) []pbField {
+	t.Helper()
+	var fields []pbField
+	for _, f := range pbFields(t, msg) {
+		if f.num == num {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// otlpBodies returns the bodies of the LogRecords of each request.
+func otlpBodies(t *testing.T, requests []string) [][]string {
+	t.Helper()
+	var batches [][]string
+	for _, req := range requests {
+		var bodies []string
+		for _, rl := range pbGet(t, []byte(req), 1) { // resource_logs
+			for _, sl := range pbGet(t, rl.bytes, 2) { // scope_logs
+				for _, rec := range pbGet(t, sl.bytes, 2) { // log_records
+					for _, body := range pbGet(t, rec.bytes, 5) {
+						bodies = append(bodies, string(pbGet(t, body.bytes, 1)[0].bytes))
+					}
+				}
+			}
+		}
+		batches = append(batches, bodies)
+	}
+	return batches
+}
+
+func newTestOTLP(t *testing.T, opts OTLPOptions) *OTLPHandler {
+	t.Helper()
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = time.Hour
+	}
+	if opts.MinBackoff == 0 {
+		opts.MinBackoff = time.Millisecond
+	}
+	h := NewOTLPHandler(opts)
+	t.Cleanup(func() { h.Shutdown(context.Background()) })
+	return h
+}
+
+func TestOTLPHandlerBatches(t *testing.T) {
+	s := newBatchServer(t)
+	h := newTestOTLP(t, OTLPOptions{
+		Endpoint:  s.URL,
+		Headers:   map[string]string{"Authorization": "Bearer secret"},
+		Resource:  []Attr{slog.String("service.name", "api")},
+		BatchSize: 2,
+	})
+	l := slog.New(h)
+	l.Info("a", "n", 1)
+	l.Warn("b")
+	l.Error("c")
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	bodies, _ := s.received()
+	if got := fmt.Sprint(otlpBodies(t, bodies)); got != "[[a b] [c]]" {
+		t.Errorf("batches = %s", got)
+	}
+	if s.headers[0].Get("Content-Type") != "application/x-protobuf" || s.headers[0].Get("Authorization") != "Bearer secret" {
+		t.Errorf("header = %v", s.headers[0])
+	}
+
+	// The severity and the attributes of the first record.
+	rl := pbGet(t, []byte(bodies[0]), 1)[0].bytes
+	resource := pbGet(t, pbGet(t, rl, 1)[0].bytes, 1)[0].bytes
+	if key := string(pbGet(t, resource, 1)[0].bytes); key != "service.name" {
+		t.Errorf("resource attribute %q", key)
+	}
+	rec := pbGet(t, pbGet(t, rl, 2)[0].bytes, 2)[0].bytes
+	if n := pbGet(t, rec, 2)[0].x; n != 9 {
+		t.Errorf("severity_number = %d, want 9", n)
+	}
+	attr := pbGet(t, rec, 6)[0].bytes
+	if key, value := string(pbGet(t, attr, 1)[0].bytes), pbGet(t, pbGet(t, attr, 2)[0].bytes, 3)[0].x; key != "n" || value != 1 {
+		t.Errorf("attribute %s=%d", key, value)
+	}
+}
+
+func TestOTLPHandlerRetry(t *testing.T) {
+	s := newBatchServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	drops := new(Drops)
+	h := newTestOTLP(t, OTLPOptions{Endpoint: s.URL, MaxRetries: 2, Drops: drops})
+	slog.New(h).Info("retried")
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if bodies, n := s.received(); n != 3 || len(bodies) != 1 {
+		t.Errorf("%d requests, %d delivered, want 3 and 1", n, len(bodies))
+	}
+
+	s.mu.Lock()
+	s.status = []int{http.StatusBadRequest}
+	s.mu.Unlock()
+	slog.New(h).Info("rejected")
+	if err := h.Flush(context.Background()); err == nil {
+		t.Error("Flush: no error")
+	}
+	if _, n := s.received(); n != 4 {
+		t.Errorf("%d requests, want 4", n)
+	}
+	if a, ok := drops.take(); !ok || a.String() != "dropped=[failed=1]" {
+		t.Errorf("drops = %v", a)
+	}
+}
+
+func TestOTLPHandlerShutdown(t *testing.T) {
+	s := newBatchServer(t)
+	h := newTestOTLP(t, OTLPOptions{Endpoint: s.URL})
+	slog.New(h).Info("queued")
+	if err := h.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if bodies, _ := s.received(); fmt.Sprint(otlpBodies(t, bodies)) != "[[queued]]" {
+		t.Errorf("batches = %v", otlpBodies(t, bodies))
+	}
+	if err := h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "late", 0)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Handle after Shutdown: %v", err)
+	}
+
+	// Shutdown gives up on the batch being sent when its context is done.
+	s = newBatchServer(t)
+	s.release = make(chan struct{})
+	defer close(s.release)
+	h = newTestOTLP(t, OTLPOptions{Endpoint: s.URL, BatchSize: 1})
+	slog.New(h).Info("stuck")
+	s.waitArrived(t, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := h.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
+
+func TestOTLPHandlerBlock(t *testing.T) {
+	s := newBatchServer(t)
+	s.release = make(chan struct{})
+	h := newTestOTLP(t, OTLPOptions{Endpoint: s.URL, BatchSize: 1, QueueSize: 1, Block: true})
+	l := slog.New(h)
+	l.Info("sending")
+	s.waitArrived(t, 1)
+	l.Info("queued")
+	blocked := make(chan error)
+	go func() {
+		blocked <- h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "blocked", 0))
+	}()
+	closed := make(chan error)
+	go func() { closed <- h.Shutdown(context.Background()) }()
+	if err := <-blocked; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("blocked Handle: %v", err)
+	}
+	close(s.release)
+	if err := <-closed; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if bodies, _ := s.received(); fmt.Sprint(otlpBodies(t, bodies)) != "[[sending] [queued]]" {
+		t.Errorf("batches = %v", otlpBodies(t, bodies))
+	}
+}
@@ -0,0 +1,227 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimitMessage is the message of the summary records of a
+// RateLimitHandler.
+const rateLimitMessage = "rate limited"
+
+// RateLimitOptions are options for a [RateLimitHandler].
+type RateLimitOptions struct {
+	// Limit is the number of records passed per second, on average.
+	Limit float64
+
+	// Burst is the number of records that may be passed at once, after a
+	// quiet period. If less than one, one is used.
+	Burst int
+
+	// BypassLevel is the level from which records are always passed. If
+	// zero, LevelError is used; to limit all the records, set it above
+	// LevelFatal.
+	BypassLevel Level
+
+	// Interval is the period of the summary records. If zero, ten seconds
+	// are used.
+	Interval time.Duration
+
+	// Drops, if set, counts the records left out under DropThrottled, for
+	// the next record that gets through the logger sharing it, instead of
+	// the summary records.
+	Drops *Drops
+
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+}
+
+// RateLimitHandler caps the number of records passed to a handler per
+// second, whatever their content, to protect a slow sink such as a disk
+// or a network collector. It is a token bucket: Burst records may pass at
+// once, then Limit per second.
+//
+// The records at or above BypassLevel, and those logged with
+// [Logger.Always], are always passed, and don't take tokens. The number
+// of records left out is counted by level, and given every interval by a
+// summary record at LevelWarn:
+//
+//	WARN rate limited dropped_info=123 dropped_debug=4567
+//
+// passed by a goroutine that Close stops. A RateLimitHandler is
+// registered with [RegisterFlusher] until closed.
+type RateLimitHandler struct {
+	next slog.Handler
+	l    *rateLimiter
+}
+
+// rateLimiter is the state shared by a RateLimitHandler and the handlers
+// derived from it.
+type rateLimiter struct {
+	opts       RateLimitOptions
+	root       slog.Handler // wrapped handler without attributes, for summaries
+	stop       chan struct{}
+	done       chan struct{}
+	unregister func()
+	closed     atomic.Bool
+
+	mu     sync.Mutex
+	tokens float64   // tokens in the bucket
+	last   time.Time // when tokens was last updated
+
+	dropped [LevelFatal + 1]atomic.Int64 // records left out, by level
+}
+
+// NewRateLimitHandler returns a RateLimitHandler passing at most limit
+// records per second to next, in bursts of up to burst records, and
+// starts its goroutine.
+func NewRateLimitHandler(next slog.Handler, limit float64, burst int) *RateLimitHandler {
+	return NewRateLimitHandlerWithOptions(next, RateLimitOptions{Limit: limit, Burst: burst})
+}
+
+// NewRateLimitHandlerWithOptions returns a RateLimitHandler passing
+// records to next, and starts its goroutine.
+func NewRateLimitHandlerWithOptions(next slog.Handler, opts RateLimitOptions) *RateLimitHandler {
+	if opts.Burst < 1 {
+		opts.Burst = 1
+	}
+	if opts.BypassLevel == 0 {
+		opts.BypassLevel = LevelError
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	l := &rateLimiter{
+		opts: opts,
+		root: next,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	l.tokens = float64(opts.Burst)
+	l.last = l.now()
+	h := &RateLimitHandler{next: next, l: l}
+	l.unregister = RegisterFlusher(h)
+	go l.run()
+	return h
+}
+
+func (l *rateLimiter) now() time.Time {
+	if l.opts.Clock != nil {
+		return l.opts.Clock()
+	}
+	return time.Now()
+}
+
+// allow takes a token from the bucket, if there is one, and reports
+// whether it did.
+func (l *rateLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.opts.Limit
+		if burst := float64(l.opts.Burst); l.tokens > burst {
+			l.tokens = burst
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+func (h *RateLimitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RateLimitHandler) Handle(ctx context.Context, r slog.Record) error {
+	l := h.l
+	if IsForced(ctx) || r.Level >= l.opts.BypassLevel.Level() || l.allow() {
+		return h.next.Handle(ctx, r)
+	}
+	if l.opts.Drops != nil {
+		l.opts.Drops.Add(DropThrottled, 1)
+		l.opts.Drops.restoreFrom(r)
+		return nil
+	}
+	level := parseSlogLevel(r.Level)
+	level = max(LevelTrace, min(level, LevelFatal))
+	l.dropped[level].Add(1)
+	return nil
+}
+
+// summarize passes the summary of the records left out since the last
+// one, if any.
+func (l *rateLimiter) summarize(ctx context.Context) error {
+	var attrs []slog.Attr
+	for level := LevelFatal; level >= LevelTrace; level-- {
+		if n := l.dropped[level].Swap(0); n > 0 {
+			attrs = append(attrs, Int64("dropped_"+strings.ToLower(level.String()), n))
+		}
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	r := slog.NewRecord(l.now(), LevelWarn.Level(), rateLimitMessage, 0)
+	r.AddAttrs(attrs...)
+	return l.root.Handle(ctx, r)
+}
+
+// run passes the summaries every interval, until the handler is closed.
+func (l *rateLimiter) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.summarize(context.Background())
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// Flush passes the summary of the records left out so far, if any.
+func (h *RateLimitHandler) Flush(ctx context.Context) error {
+	return h.l.summarize(ctx)
+}
+
+// Close passes the summary of the records left out so far, if any, and
+// stops the goroutine of h. Records are still limited afterwards, those
+// left out being summed up only by Flush.
+func (h *RateLimitHandler) Close() error {
+	l := h.l
+	if !l.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	l.unregister()
+	close(l.stop)
+	<-l.done
+	return l.summarize(context.Background())
+}
+
+func (h *RateLimitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &RateLimitHandler{next: h.next.WithAttrs(attrs), l: h.l}
+}
+
+func (h *RateLimitHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &RateLimitHandler{next: h.next.WithGroup(name), l: h.l}
+}
+
+// Unwrap returns the handler wrapped by h.
+func (h *RateLimitHandler) Unwrap() Handler {
+	return h.next
+}
@@ -0,0 +1,72 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Record 引用 slog.Record，方便日后定制
+type Record = slog.Record
+
+// Handler 引用 slog.Handler，方便日后定制
+type Handler = slog.Handler
+
+// NewRecord creates a Record from the given arguments.
+// Use [Record.AddAttrs] to add attributes to the Record.
+// A zero t means that the time is unknown: the handlers of this package
+// then leave the time out rather than print a year-one timestamp.
+//
+// Unlike [slog.NewRecord], the level is given as a [Level] and translated
+// to its slog equivalent, so code building records by hand doesn't need to
+// deal with both level types.
+func NewRecord(t time.Time, level Level, msg string, pc uintptr) Record {
+	return slog.NewRecord(t, level.Level(), msg, pc)
+}
+
+// RecordLevel returns the level of r as a [Level].
+func RecordLevel(r Record) Level {
+	return parseSlogLevel(r.Level)
+}
+
+// Handle sends r to the handler of l if its level is enabled.
+// It is meant for code that produces records itself, such as bridges
+// from other logging packages or tools replaying stored logs.
+func (l *logger) Handle(ctx context.Context, r Record) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if l.callers != nil {
+		level, keep := l.callers.apply(r.PC, r.Level)
+		if !keep {
+			return nil
+		}
+		r.Level = level
+	}
+	if l.skip.skip(ctx, r.Level) {
+		l.drops.Add(DropDeadline, 1)
+		return nil
+	}
+	if !l.Handler().Enabled(ctx, r.Level) {
+		return nil
+	}
+	// r is a copy: clone it so that the attributes added by handle don't
+	// end up in the caller's record.
+	return l.handle(ctx, r.Clone())
+}
+
+// handle sends r to the handler, with the global attributes and the
+// records dropped since the last one that got through.
+func (l *logger) handle(ctx context.Context, r slog.Record) error {
+	addGlobalAttrs(&r)
+	dropped, ok := l.drops.take()
+	if !ok {
+		return l.Handler().Handle(ctx, r)
+	}
+	r.AddAttrs(dropped)
+	err := l.Handler().Handle(ctx, r)
+	if err != nil {
+		l.drops.restore(dropped)
+	}
+	return err
+}
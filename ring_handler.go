@@ -0,0 +1,151 @@
+package log
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"sync/atomic"
+)
+
+// RingHandler keeps the last records it handles in memory, whatever their
+// level, so that a crash handler or an admin endpoint can dump the recent
+// history at a finer level than the one logged. Combined with the real
+// handler in a [MultiHandler], it gets all the records while the real one
+// gets those of its level:
+//
+//	ring := log.NewRingHandler(1000)
+//	h := log.NewMultiHandler(log.NewTextHandler(os.Stderr, nil), ring)
+//	...
+//	ring.Replay(ctx, log.NewJSONHandler(w, nil))
+//
+// The records are stored with the attributes and groups added with
+// WithAttrs and WithGroup folded in, and their values resolved, so that a
+// LogValuer changing later doesn't change the history. Handle takes no
+// lock: the records are stored in a ring of atomic slots.
+type RingHandler struct {
+	r      *ring
+	attrs  []slog.Attr // from WithAttrs, in their groups
+	groups []string    // from WithGroup
+}
+
+// ring is the buffer shared by a RingHandler and the handlers derived from
+// it.
+type ring struct {
+	slots []atomic.Pointer[slog.Record]
+	next  atomic.Uint64 // number of records stored so far
+}
+
+// NewRingHandler returns a RingHandler keeping the last capacity records.
+func NewRingHandler(capacity int) *RingHandler {
+	return &RingHandler{r: &ring{slots: make([]atomic.Pointer[slog.Record], max(capacity, 1))}}
+}
+
+// Enabled reports true for all levels.
+func (h *RingHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *RingHandler) Handle(_ context.Context, r slog.Record) error {
+	rec := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	for _, a := range h.attrs {
+		rec.AddAttrs(a)
+	}
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, resolveAttr(a))
+		return true
+	})
+	rec.AddAttrs(inGroups(h.groups, attrs)...)
+	i := h.r.next.Add(1) - 1
+	h.r.slots[i%uint64(len(h.r.slots))].Store(&rec)
+	return nil
+}
+
+// resolveAttr returns a with its value resolved, within groups too.
+func resolveAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		return a
+	}
+	group := slices.Clone(a.Value.Group())
+	for i, ga := range group {
+		group[i] = resolveAttr(ga)
+	}
+	a.Value = slog.GroupValue(group...)
+	return a
+}
+
+// Records returns the records held, oldest first. Records handled
+// meanwhile may be left out.
+func (h *RingHandler) Records() []slog.Record {
+	r := h.r
+	next := r.next.Load()
+	n := min(next, uint64(len(r.slots)))
+	recs := make([]slog.Record, 0, n)
+	for i := next - n; i < next; i++ {
+		if rec := r.slots[i%uint64(len(r.slots))].Load(); rec != nil {
+			recs = append(recs, rec.Clone())
+		}
+	}
+	return recs
+}
+
+// Replay passes the records held, oldest first, to the handler to, such
+// as a TextHandler writing them out, whatever its level. It stops at the
+// first error of to.
+func (h *RingHandler) Replay(ctx context.Context, to slog.Handler) error {
+	for _, rec := range h.Records() {
+		if err := to.Handle(ctx, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTo writes the records held to w, oldest first, as a TextHandler
+// does.
+func (h *RingHandler) WriteTo(w io.Writer) (int64, error) {
+	cw := &ringCountWriter{w: w}
+	err := h.Replay(context.Background(), NewTextHandler(cw, nil))
+	return cw.n, err
+}
+
+// ringCountWriter counts the bytes written through it.
+type ringCountWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *ringCountWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Len returns the number of records held.
+func (h *RingHandler) Len() int {
+	return int(min(h.r.next.Load(), uint64(len(h.r.slots))))
+}
+
+func (h *RingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	resolved := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		resolved[i] = resolveAttr(a)
+	}
+	h2 := *h
+	h2.attrs = append(slices.Clip(h.attrs), inGroups(h.groups, resolved)...)
+	return &h2
+}
+
+func (h *RingHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
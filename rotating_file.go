@@ -0,0 +1,632 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeLayout is the layout of the time in the names of the backups
+// of a RotatingFile.
+const backupTimeLayout = "2006-01-02T15-04-05"
+
+// RotationSchedule is when a [RotatingFile] starts a new file, whatever
+// its size.
+type RotationSchedule int
+
+const (
+	RotateNever  RotationSchedule = iota // only by size
+	RotateHourly                         // at the top of each hour
+	RotateDaily                          // at midnight
+)
+
+// String returns the name of s: "never", "hourly" or "daily".
+func (s RotationSchedule) String() string {
+	switch s {
+	case RotateHourly:
+		return "hourly"
+	case RotateDaily:
+		return "daily"
+	}
+	return "never"
+}
+
+// layout returns the layout of the periods of s in file names.
+func (s RotationSchedule) layout() string {
+	if s == RotateHourly {
+		return "2006-01-02T15"
+	}
+	return "2006-01-02"
+}
+
+// period returns the start and the end of the period of s holding t, in
+// the location of t.
+func (s RotationSchedule) period(t time.Time) (start, end time.Time) {
+	y, m, d := t.Date()
+	if s == RotateHourly {
+		start = time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location())
+		return start, start.Add(time.Hour)
+	}
+	start = time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
+// RotatingFileOptions are options for a [RotatingFile].
+type RotatingFileOptions struct {
+	// MaxSize is the size in bytes past which the file is rotated. If
+	// zero, it is only rotated by Rotate.
+	MaxSize int64
+
+	// MaxBackups is the number of backups kept. If zero, all are kept.
+	MaxBackups int
+
+	// MaxAge is how long backups are kept, after they were last written
+	// to. If zero, they are kept whatever their age.
+	MaxAge time.Duration
+
+	// Numbered names the backups with numbers, the most recent first,
+	// as in app.1.log, app.2.log, instead of with the time of their
+	// rotation, as in app.2024-06-01T12-00-00.log.
+	Numbered bool
+
+	// Schedule starts a new file every hour or day, in addition to the
+	// rotations by size. The files are named after their period, as in
+	// app-2024-06-01.log, the name of the RotatingFile being a symbolic
+	// link to the current one.
+	Schedule RotationSchedule
+
+	// Compress compresses the backups with gzip, in the background, as
+	// in app.2024-06-01T12-00-00.log.gz.
+	Compress bool
+
+	// OnArchive, if set, is called with the path of each backup once it
+	// is complete, after its compression if any, for example to ship it
+	// to long-term storage. It is called from a background goroutine.
+	OnArchive func(path string)
+
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+}
+
+// RotatingFile is a file that rotates itself: once it would grow past
+// MaxSize, it is renamed to a backup next to it, and a new file is
+// created under its name. Set it as [Options.Writer]:
+//
+//	f, err := log.OpenRotatingFile("/var/log/app/app.log", log.RotatingFileOptions{
+//		MaxSize:    100 << 20,
+//		MaxBackups: 10,
+//		MaxAge:     30 * 24 * time.Hour,
+//	})
+//
+// Each Write is taken to be one record, as the handlers of this package
+// write them, and never spans a rotation: the file is rotated before the
+// write that would make it exceed MaxSize. Backups beyond MaxBackups or
+// older than MaxAge are removed after each rotation.
+//
+// With a Schedule, the records go to the file of the current period, such
+// as app-2024-06-01.log, and app.log links to it for tailing. The end of
+// the period is checked on each write, without a timer: after the process
+// slept across several periods, the next write starts the file of the
+// current one. The files of the past periods count as backups.
+//
+// With Compress, each backup is compressed to a temporary file, renamed to
+// its final name once complete, then the backup itself is removed: the
+// current file is never touched. Compressions interrupted by a crash are
+// done again when the file is next opened, and Close waits for those in
+// progress.
+//
+// A RotatingFile is safe for concurrent use.
+type RotatingFile struct {
+	name string
+	opts RotatingFileOptions
+
+	archiving sync.WaitGroup // compressions and OnArchive calls
+
+	mu        sync.Mutex
+	path      string    // of the current file, name unless scheduled
+	periodEnd time.Time // end of the period of the current file
+	file      *os.File
+	size      int64
+	closed    bool
+
+	errMu     sync.Mutex // also taken by the archiving goroutines
+	lastErr   error
+	lastErrAt time.Time
+}
+
+// OpenRotatingFile opens the file name for appending, creating it and its
+// missing parent directories if needed, and returns it as a RotatingFile.
+//
+// When the process restarts, as after a crash, records are appended to
+// the current file if it is under MaxSize and, with a Schedule, of the
+// current period; otherwise a new file is started. The link to the file
+// is made again, in case it dangles, compressions interrupted by a crash
+// are done again, and backups beyond the limits are removed.
+func OpenRotatingFile(name string, opts RotatingFileOptions) (*RotatingFile, error) {
+	f := &RotatingFile{name: name, opts: opts, path: name}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return nil, err
+	}
+	if opts.Schedule != RotateNever {
+		// A file left under the name of the link, as by a RotatingFile
+		// without schedule, becomes a backup.
+		if info, err := os.Lstat(name); err == nil && info.Mode().IsRegular() {
+			if err := os.Rename(name, f.backupName(name, info.ModTime())); err != nil {
+				return nil, err
+			}
+		}
+		f.path, f.periodEnd = f.periodPath(f.now())
+	}
+	info, err := os.Stat(f.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	case opts.MaxSize > 0 && info.Size() >= opts.MaxSize:
+		if _, err := f.backup(info.ModTime()); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	f.link()
+	f.resumeCompression()
+	f.prune()
+	return f, nil
+}
+
+func (f *RotatingFile) now() time.Time {
+	if f.opts.Clock != nil {
+		return f.opts.Clock()
+	}
+	return time.Now()
+}
+
+// periodPath returns the path of the file of the period holding t, and
+// the end of the period.
+func (f *RotatingFile) periodPath(t time.Time) (string, time.Time) {
+	start, end := f.opts.Schedule.period(t)
+	base, ext := splitExt(f.name)
+	return base + "-" + start.Format(f.opts.Schedule.layout()) + ext, end
+}
+
+// open opens the current file for appending. It is called with mu held.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// link points the link under the name of f to the current file, if
+// scheduled. The link is replaced atomically, so that it never dangles.
+func (f *RotatingFile) link() {
+	if f.opts.Schedule == RotateNever {
+		return
+	}
+	tmp := f.name + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(f.path), tmp); err != nil {
+		f.fail(err)
+		return
+	}
+	if err := os.Rename(tmp, f.name); err != nil {
+		os.Remove(tmp)
+		f.fail(err)
+	}
+}
+
+// Write writes p to the file, first starting the file of a new period if
+// the current one ended, then rotating it if p would make it exceed
+// MaxSize.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.opts.Schedule != RotateNever {
+		if now := f.now(); !now.Before(f.periodEnd) {
+			f.startPeriod(now)
+		}
+	}
+	if f.file == nil {
+		// A rotation failed to create the new file; try again.
+		if err := f.open(); err != nil {
+			return 0, f.fail(err)
+		}
+	}
+	if f.opts.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.opts.MaxSize {
+		if err := f.rotate(); err != nil && f.file == nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return n, f.fail(err)
+	}
+	f.errMu.Lock()
+	f.lastErr = nil
+	f.errMu.Unlock()
+	return n, nil
+}
+
+// startPeriod closes the current file and opens that of the period
+// holding now. It is called with mu held.
+func (f *RotatingFile) startPeriod(now time.Time) {
+	f.closeFile()
+	f.archive(f.path)
+	f.path, f.periodEnd = f.periodPath(now)
+	if err := f.open(); err != nil {
+		f.fail(err)
+		return
+	}
+	f.link()
+	f.prune()
+}
+
+// Rotate rotates the file at once, whatever its size.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// rotate renames the file to a backup and creates a new one. If the
+// rename fails, the file is reopened as it is. It is called with mu held.
+func (f *RotatingFile) rotate() error {
+	f.closeFile()
+	path, err := f.backup(f.now())
+	if err == nil {
+		f.archive(path)
+	}
+	if err2 := f.open(); err2 != nil {
+		err = errors.Join(err, err2)
+	}
+	if err != nil {
+		return f.fail(err)
+	}
+	f.prune()
+	return nil
+}
+
+// closeFile closes the current file. It is called with mu held.
+func (f *RotatingFile) closeFile() {
+	if f.file == nil {
+		return
+	}
+	if err := f.file.Close(); err != nil {
+		f.fail(err)
+	}
+	f.file = nil
+}
+
+// backup renames the current file to the name of its newest backup,
+// rotated at t, and returns that name.
+func (f *RotatingFile) backup(t time.Time) (string, error) {
+	if !f.opts.Numbered {
+		name := f.backupName(f.path, t)
+		return name, os.Rename(f.path, name)
+	}
+	// Shift the numbered backups to make room for the first, once those
+	// being compressed are done.
+	f.archiving.Wait()
+	backups, err := f.backups(f.path)
+	if err != nil {
+		return "", err
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		name := numberedName(f.path, b.number+1)
+		if b.compressed {
+			name += gzipExt
+		}
+		if err := os.Rename(b.path, name); err != nil {
+			return "", err
+		}
+	}
+	name := numberedName(f.path, 1)
+	return name, os.Rename(f.path, name)
+}
+
+// splitExt returns path without its extension, and its extension.
+func splitExt(path string) (base, ext string) {
+	ext = filepath.Ext(path)
+	return strings.TrimSuffix(path, ext), ext
+}
+
+// backupName returns a free name for a backup of path rotated at t.
+func (f *RotatingFile) backupName(path string, t time.Time) string {
+	base, ext := splitExt(path)
+	name := base + "." + t.Format(backupTimeLayout)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(name + ext); errors.Is(err, fs.ErrNotExist) {
+			return name + ext
+		}
+		name = fmt.Sprintf("%s.%s-%d", base, t.Format(backupTimeLayout), i)
+	}
+}
+
+func numberedName(path string, n int) string {
+	base, ext := splitExt(path)
+	return base + "." + strconv.Itoa(n) + ext
+}
+
+// rotatedFile is a backup of a RotatingFile.
+type rotatedFile struct {
+	path       string
+	number     int  // for numbered backups
+	compressed bool // whether path ends with gzipExt
+	modTime    time.Time
+}
+
+// backups returns the backups of path made by rotations, the most recent
+// first.
+func (f *RotatingFile) backups(path string) ([]rotatedFile, error) {
+	base, ext := splitExt(path)
+	return f.listFiles(filepath.Base(base)+".", ext, func(middle string, b *rotatedFile) bool {
+		if f.opts.Numbered {
+			n, err := strconv.Atoi(middle)
+			b.number = n
+			return err == nil && n >= 1
+		}
+		return hasTimePrefix(middle, backupTimeLayout)
+	})
+}
+
+// archives returns the files kept besides the current one, the most
+// recent first: its backups and, if scheduled, the files of the past
+// periods and their backups.
+func (f *RotatingFile) archives() ([]rotatedFile, error) {
+	if f.opts.Schedule == RotateNever {
+		return f.backups(f.name)
+	}
+	base, ext := splitExt(f.name)
+	layout := f.opts.Schedule.layout()
+	return f.listFiles(filepath.Base(base)+"-", ext, func(middle string, b *rotatedFile) bool {
+		return b.path != f.path && hasTimePrefix(middle, layout)
+	})
+}
+
+// listFiles returns the files in the directory of f named prefix, then a
+// middle accepted by match, then ext, possibly followed by gzipExt, the
+// most recent first, or the lowest numbered first for numbered backups.
+func (f *RotatingFile) listFiles(prefix, ext string, match func(middle string, b *rotatedFile) bool) ([]rotatedFile, error) {
+	dir := filepath.Dir(f.name)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []rotatedFile
+	for _, e := range entries {
+		name := e.Name()
+		b := rotatedFile{path: filepath.Join(dir, name)}
+		if strings.HasSuffix(name, gzipExt) {
+			name, b.compressed = strings.TrimSuffix(name, gzipExt), true
+		}
+		if !e.Type().IsRegular() || len(name) < len(prefix)+len(ext) ||
+			!strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		if !match(name[len(prefix):len(name)-len(ext)], &b) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		b.modTime = info.ModTime()
+		files = append(files, b)
+	}
+	slices.SortFunc(files, func(a, b rotatedFile) int {
+		if a.number != b.number {
+			return a.number - b.number
+		}
+		return b.modTime.Compare(a.modTime)
+	})
+	return files, nil
+}
+
+// hasTimePrefix reports whether s starts with a time in layout.
+func hasTimePrefix(s, layout string) bool {
+	if len(s) < len(layout) {
+		return false
+	}
+	_, err := time.Parse(layout, s[:len(layout)])
+	return err == nil
+}
+
+// prune removes the archives beyond MaxBackups or older than MaxAge.
+func (f *RotatingFile) prune() {
+	if f.opts.MaxBackups <= 0 && f.opts.MaxAge <= 0 {
+		return
+	}
+	archives, err := f.archives()
+	if err != nil {
+		f.fail(err)
+		return
+	}
+	cutoff := f.now().Add(-f.opts.MaxAge)
+	for i, b := range archives {
+		if f.opts.MaxBackups > 0 && i >= f.opts.MaxBackups ||
+			f.opts.MaxAge > 0 && b.modTime.Before(cutoff) {
+			if err := os.Remove(b.path); err != nil {
+				f.fail(err)
+			}
+		}
+	}
+}
+
+// fail records err as the last error, and returns it.
+func (f *RotatingFile) fail(err error) error {
+	f.errMu.Lock()
+	f.lastErr, f.lastErrAt = err, f.now()
+	f.errMu.Unlock()
+	return err
+}
+
+// Sync commits the content of the file to stable storage.
+func (f *RotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file, and waits for the compressions in progress.
+// Writes fail afterwards with os.ErrClosed.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+	f.archiving.Wait()
+	return err
+}
+
+// LogHealth reports the path and size of the current file, and the last
+// error met writing or rotating it.
+func (f *RotatingFile) LogHealth() ComponentHealth {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errMu.Lock()
+	defer f.errMu.Unlock()
+	return ComponentHealth{
+		Name:          "file",
+		Healthy:       !f.closed && f.file != nil && f.lastErr == nil,
+		Path:          f.path,
+		Size:          f.size,
+		LastError:     f.lastErr,
+		LastErrorTime: f.lastErrAt,
+	}
+}
+
+// gzipExt and gzipTmpExt are the extensions of the compressed backups of a
+// RotatingFile, and of those being compressed.
+const (
+	gzipExt    = ".gz"
+	gzipTmpExt = ".gz.tmp"
+)
+
+// archive compresses the backup at path if needed, then passes it to
+// OnArchive, in the background.
+func (f *RotatingFile) archive(path string) {
+	if !f.opts.Compress && f.opts.OnArchive == nil {
+		return
+	}
+	f.archiving.Add(1)
+	go func() {
+		defer f.archiving.Done()
+		if f.opts.Compress {
+			var err error
+			if path, err = compressFile(path); err != nil {
+				f.fail(err)
+				return
+			}
+		}
+		if f.opts.OnArchive != nil {
+			f.opts.OnArchive(path)
+		}
+	}()
+}
+
+// compressFile compresses the file at path into path+gzipExt, through a
+// temporary file, removes it, and returns the path of the compressed file.
+// The compressed file keeps the modification time of the original, by
+// which backups are pruned.
+func compressFile(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+	tmp := path + gzipTmpExt
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	err = errors.Join(err, zw.Close(), dst.Close())
+	if err == nil {
+		err = os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+gzipExt)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path + gzipExt, os.Remove(path)
+}
+
+// resumeCompression finishes the compressions interrupted by a crash: the
+// temporary files are removed, the backups already compressed are
+// removed, and those left uncompressed are compressed again.
+func (f *RotatingFile) resumeCompression() {
+	if !f.opts.Compress {
+		return
+	}
+	base, _ := splitExt(f.name)
+	if tmps, err := filepath.Glob(base + "*" + gzipTmpExt); err == nil {
+		for _, tmp := range tmps {
+			os.Remove(tmp)
+		}
+	}
+	archives, err := f.archives()
+	if err != nil {
+		f.fail(err)
+		return
+	}
+	compressed := map[string]bool{}
+	for _, a := range archives {
+		if a.compressed {
+			compressed[strings.TrimSuffix(a.path, gzipExt)] = true
+		}
+	}
+	for _, a := range archives {
+		switch {
+		case a.compressed:
+		case compressed[a.path]:
+			os.Remove(a.path)
+		default:
+			f.archive(a.path)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// seedFile is a file left in the directory of a RotatingFile by the run
+// of the process before a crash.
+type seedFile struct {
+	content string
+	age     time.Duration // before the time of the restart
+	link    string        // target, for a symbolic link
+	gzip    bool          // whether content is written compressed
+}
+
+// seedDir creates files in dir, with their modification times set
+// relative to now.
+func seedDir(t *testing.T, dir string, now time.Time, files map[string]seedFile) {
+	t.Helper()
+	for name, sf := range files {
+		path := filepath.Join(dir, name)
+		if sf.link != "" {
+			if err := os.Symlink(sf.link, path); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		content := []byte(sf.content)
+		if sf.gzip {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write(content)
+			zw.Close()
+			content = buf.Bytes()
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-sf.age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// dirContents returns the files of dir with their contents, decompressed
+// for those ending in gzipExt, and the targets of the links, as "-> target".
+func dirContents(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.Type()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[e.Name()] = "-> " + target
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Ext(path) == gzipExt {
+			zr, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				t.Fatalf("%s: %v", e.Name(), err)
+			}
+			if b, err = io.ReadAll(zr); err != nil {
+				t.Fatalf("%s: %v", e.Name(), err)
+			}
+		}
+		files[e.Name()] = string(b)
+	}
+	return files
+}
+
+// TestOpenRotatingFileRecovery seeds the directory of a RotatingFile as a
+// crash at various points would leave it, opens it again, writes a record
+// and checks the files.
+func TestOpenRotatingFileRecovery(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	backup := func(age time.Duration) string {
+		return "app." + now.Add(-age).Format(backupTimeLayout) + ".log"
+	}
+	tests := []struct {
+		name string
+		opts RotatingFileOptions
+		seed map[string]seedFile
+		want map[string]string
+	}{
+		{
+			name: "fresh start",
+			opts: RotatingFileOptions{MaxSize: 100},
+			want: map[string]string{"app.log": "new\n"},
+		},
+		{
+			name: "append under the size limit",
+			opts: RotatingFileOptions{MaxSize: 100},
+			seed: map[string]seedFile{"app.log": {content: "old\n", age: time.Minute}},
+			want: map[string]string{"app.log": "old\nnew\n"},
+		},
+		{
+			name: "rotate at the size limit",
+			opts: RotatingFileOptions{MaxSize: 8},
+			seed: map[string]seedFile{"app.log": {content: "12345678", age: time.Minute}},
+			want: map[string]string{"app.log": "new\n", backup(time.Minute): "12345678"},
+		},
+		{
+			name: "numbered rotation at the size limit",
+			opts: RotatingFileOptions{MaxSize: 8, Numbered: true},
+			seed: map[string]seedFile{
+				"app.log":   {content: "12345678", age: time.Minute},
+				"app.1.log": {content: "older\n", age: time.Hour},
+			},
+			want: map[string]string{"app.log": "new\n", "app.1.log": "12345678", "app.2.log": "older\n"},
+		},
+		{
+			name: "append in the current period",
+			opts: RotatingFileOptions{Schedule: RotateDaily},
+			seed: map[string]seedFile{
+				"app-2024-06-01.log": {content: "old\n", age: time.Hour},
+				"app.log":            {link: "app-2024-06-01.log"},
+			},
+			want: map[string]string{"app-2024-06-01.log": "old\nnew\n", "app.log": "-> app-2024-06-01.log"},
+		},
+		{
+			name: "new period",
+			opts: RotatingFileOptions{Schedule: RotateDaily},
+			seed: map[string]seedFile{
+				"app-2024-05-31.log": {content: "yesterday\n", age: 13 * time.Hour},
+				"app.log":            {link: "app-2024-05-31.log"},
+			},
+			want: map[string]string{
+				"app-2024-05-31.log": "yesterday\n",
+				"app-2024-06-01.log": "new\n",
+				"app.log":            "-> app-2024-06-01.log",
+			},
+		},
+		{
+			name: "dangling link",
+			opts: RotatingFileOptions{Schedule: RotateDaily},
+			seed: map[string]seedFile{
+				"app.log":     {link: "app-2024-05-20.log"},
+				"app.log.tmp": {link: "app-2024-05-21.log"},
+			},
+			want: map[string]string{"app-2024-06-01.log": "new\n", "app.log": "-> app-2024-06-01.log"},
+		},
+		{
+			name: "regular file under the name of the link",
+			opts: RotatingFileOptions{Schedule: RotateDaily},
+			seed: map[string]seedFile{"app.log": {content: "unscheduled\n", age: time.Hour}},
+			want: map[string]string{
+				backup(time.Hour):    "unscheduled\n",
+				"app-2024-06-01.log": "new\n",
+				"app.log":            "-> app-2024-06-01.log",
+			},
+		},
+		{
+			name: "compression interrupted before the rename",
+			opts: RotatingFileOptions{Compress: true},
+			seed: map[string]seedFile{
+				"app.log":                        {content: "old\n", age: time.Minute},
+				backup(time.Hour):                {content: "backup\n", age: time.Hour},
+				backup(time.Hour) + gzipTmpExt:   {content: "partial", age: time.Hour},
+				backup(2*time.Hour) + gzipTmpExt: {content: "partial", age: 2 * time.Hour},
+			},
+			want: map[string]string{
+				"app.log":                   "old\nnew\n",
+				backup(time.Hour) + gzipExt: "backup\n",
+			},
+		},
+		{
+			name: "compression interrupted before the removal",
+			opts: RotatingFileOptions{Compress: true},
+			seed: map[string]seedFile{
+				backup(time.Hour):           {content: "backup\n", age: time.Hour},
+				backup(time.Hour) + gzipExt: {content: "backup\n", age: time.Hour, gzip: true},
+			},
+			want: map[string]string{
+				"app.log":                   "new\n",
+				backup(time.Hour) + gzipExt: "backup\n",
+			},
+		},
+		{
+			name: "retention by count",
+			opts: RotatingFileOptions{MaxBackups: 2},
+			seed: map[string]seedFile{
+				backup(1 * time.Hour): {content: "1\n", age: 1 * time.Hour},
+				backup(2 * time.Hour): {content: "2\n", age: 2 * time.Hour},
+				backup(3 * time.Hour): {content: "3\n", age: 3 * time.Hour},
+				backup(4 * time.Hour): {content: "4\n", age: 4 * time.Hour},
+			},
+			want: map[string]string{"app.log": "new\n", backup(time.Hour): "1\n", backup(2 * time.Hour): "2\n"},
+		},
+		{
+			name: "retention by age",
+			opts: RotatingFileOptions{MaxAge: 24 * time.Hour},
+			seed: map[string]seedFile{
+				backup(time.Hour):      {content: "recent\n", age: time.Hour},
+				backup(48 * time.Hour): {content: "old\n", age: 48 * time.Hour},
+				"other.log":            {content: "not ours\n", age: 48 * time.Hour},
+			},
+			want: map[string]string{"app.log": "new\n", backup(time.Hour): "recent\n", "other.log": "not ours\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			seedDir(t, dir, now, tt.seed)
+			opts := tt.opts
+			opts.Clock = func() time.Time { return now }
+			f, err := OpenRotatingFile(filepath.Join(dir, "app.log"), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write([]byte("new\n")); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got := dirContents(t, dir)
+			if want := tt.want; !maps.Equal(got, want) {
+				t.Errorf("files:\n%v\nwant:\n%v", sortedFiles(got), sortedFiles(want))
+			}
+		})
+	}
+}
+
+// sortedFiles lists files as name: content lines, sorted, for messages.
+func sortedFiles(files map[string]string) []string {
+	var lines []string
+	for name, content := range files {
+		lines = append(lines, name+": "+content)
+	}
+	slices.Sort(lines)
+	return lines
+}
@@ -0,0 +1,222 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// samplingCounters is the number of counters of a level sampled by
+// message; messages whose hashes collide share a counter.
+const samplingCounters = 1024
+
+// SamplingRule is how a [SamplingHandler] samples the records of a level:
+// in each tick, the First records pass, then one in Thereafter. A zero
+// Thereafter drops all the records past the First.
+type SamplingRule struct {
+	First      int
+	Thereafter int
+}
+
+// SamplingOptions are options for a [SamplingHandler].
+type SamplingOptions struct {
+	// Rules are the sampling rules of the levels of this package. The
+	// records of levels without a rule, and of levels between those of
+	// this package, are not sampled.
+	Rules map[Level]SamplingRule
+
+	// Tick is the period over which records are counted. If zero, a
+	// second is used.
+	Tick time.Duration
+
+	// ByMessage samples the records of each message independently, so
+	// that a frequent message doesn't crowd out the others.
+	ByMessage bool
+
+	// ByEvent samples the records of each event independently, as named
+	// by [Event], which unlike the message doesn't change with the values
+	// formatted into it. Records without an event are sampled by message
+	// if ByMessage is set, and together otherwise.
+	ByEvent bool
+
+	// Drops, if set, counts the records left out under DropSampled, for
+	// the next record that gets through the logger sharing it. If nil,
+	// the handler adds the count to the next record it passes itself.
+	Drops *Drops
+
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+}
+
+// SamplingHandler passes to a handler only a sample of the records of
+// the levels too verbose to log in full, such as DEBUG in production,
+// with the "first N per tick, then one in M" rule of each level:
+//
+//	h := log.NewSamplingHandler(next, log.SamplingOptions{Rules: map[log.Level]log.SamplingRule{
+//		log.LevelTrace: {First: 0, Thereafter: 100},
+//		log.LevelDebug: {First: 100, Thereafter: 100},
+//	}})
+//
+// The number of records left out is added to the next record passed, as
+// a DroppedKey group: dropped.sampled=42. Records logged with
+// [Logger.Always] are not sampled.
+//
+// Handle takes no lock: the records are counted with atomic counters.
+type SamplingHandler struct {
+	next slog.Handler
+	s    *sampler
+}
+
+// sampler is the state shared by a SamplingHandler and the handlers
+// derived from it.
+type sampler struct {
+	opts    SamplingOptions
+	levels  [LevelFatal + 1]*samplingLevel
+	dropped atomic.Int64 // records left out, when opts.Drops is nil
+}
+
+// samplingLevel is the rule and the counters of one level.
+type samplingLevel struct {
+	rule     SamplingRule
+	counters []samplingCounter
+}
+
+// samplingCounter counts the records of one tick.
+type samplingCounter struct {
+	resetAt atomic.Int64 // end of the tick, in Unix nanoseconds
+	n       atomic.Uint64
+}
+
+// inc counts one record at now and returns the number of records of the
+// current tick, this one included.
+func (c *samplingCounter) inc(now, tick int64) uint64 {
+	resetAt := c.resetAt.Load()
+	if now < resetAt {
+		return c.n.Add(1)
+	}
+	// The first record past the tick starts a new one; those racing
+	// with it count in the new tick.
+	c.n.Store(1)
+	if !c.resetAt.CompareAndSwap(resetAt, now+tick) {
+		return c.n.Add(1)
+	}
+	return 1
+}
+
+// NewSamplingHandler returns a SamplingHandler passing records to next.
+func NewSamplingHandler(next slog.Handler, opts SamplingOptions) *SamplingHandler {
+	if opts.Tick <= 0 {
+		opts.Tick = time.Second
+	}
+	s := &sampler{opts: opts}
+	for level, rule := range opts.Rules {
+		if level < LevelTrace || level > LevelFatal {
+			continue
+		}
+		n := 1
+		if opts.ByMessage || opts.ByEvent {
+			n = samplingCounters
+		}
+		s.levels[level] = &samplingLevel{rule: rule, counters: make([]samplingCounter, n)}
+	}
+	return &SamplingHandler{next: next, s: s}
+}
+
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *SamplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	s := h.s
+	if !IsForced(ctx) && !s.sample(r) {
+		if s.opts.Drops != nil {
+			s.opts.Drops.Add(DropSampled, 1)
+			s.opts.Drops.restoreFrom(r)
+		} else {
+			s.dropped.Add(1)
+		}
+		return nil
+	}
+	if s.opts.Drops != nil || s.dropped.Load() == 0 {
+		return h.next.Handle(ctx, r)
+	}
+	n := s.dropped.Swap(0)
+	if n == 0 {
+		return h.next.Handle(ctx, r)
+	}
+	r = r.Clone()
+	r.AddAttrs(slog.Group(DroppedKey, Int64(DropSampled, n)))
+	err := h.next.Handle(ctx, r)
+	if err != nil {
+		s.dropped.Add(n)
+	}
+	return err
+}
+
+// sample reports whether r is passed.
+func (s *sampler) sample(r slog.Record) bool {
+	if r.Level%4 != 0 {
+		return true
+	}
+	level := parseSlogLevel(r.Level)
+	if level < LevelTrace || level > LevelFatal || s.levels[level] == nil {
+		return true
+	}
+	sl := s.levels[level]
+	c := &sl.counters[0]
+	if len(sl.counters) > 1 {
+		c = &sl.counters[messageHash(s.key(r))%uint32(len(sl.counters))]
+	}
+	now := time.Now()
+	if s.opts.Clock != nil {
+		now = s.opts.Clock()
+	}
+	n := c.inc(now.UnixNano(), int64(s.opts.Tick))
+	if n <= uint64(sl.rule.First) {
+		return true
+	}
+	return sl.rule.Thereafter > 0 && (n-uint64(sl.rule.First))%uint64(sl.rule.Thereafter) == 0
+}
+
+// key returns what r is sampled by, when records are not sampled together.
+func (s *sampler) key(r slog.Record) string {
+	if s.opts.ByEvent {
+		if ev, ok := recordEvent(r); ok {
+			return ev.Value.Resolve().String()
+		}
+	}
+	if s.opts.ByMessage {
+		return r.Message
+	}
+	return ""
+}
+
+// messageHash returns the FNV-1a hash of msg, without allocating.
+func messageHash(msg string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(msg); i++ {
+		hash ^= uint32(msg[i])
+		hash *= 16777619
+	}
+	return hash
+}
+
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &SamplingHandler{next: h.next.WithAttrs(attrs), s: h.s}
+}
+
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SamplingHandler{next: h.next.WithGroup(name), s: h.s}
+}
+
+// Unwrap returns the handler wrapped by h.
+func (h *SamplingHandler) Unwrap() Handler {
+	return h.next
+}
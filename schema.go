@@ -0,0 +1,303 @@
+package log
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// AttrsField is the FieldSchema.Name of the attributes of a record, which
+// follow its built-in fields.
+const AttrsField = "attrs"
+
+// Quoting modes of FormatSchema.Quoting.
+const (
+	QuoteGo   = "go"   // quoted and escaped as by strconv.Quote
+	QuoteJSON = "json" // quoted and escaped as JSON strings
+)
+
+// FormatSchema describes the output of a handler in its current
+// configuration, for the programs that parse it: which fields each record
+// has, in which order and under which keys, and how they are separated
+// and quoted. It is meant to be marshaled to JSON:
+//
+//	{"format":"text","fields":[{"name":"time","optional":true,"layout":"2006-01-02 15:04:05"},...],...}
+//
+// The keys are those left by ReplaceAttr when given the built-in
+// attributes, so a schema only holds for records whose built-in
+// attributes ReplaceAttr treats the same way regardless of their values.
+type FormatSchema struct {
+	// Format names the output format: "text", "indent", "json", "ecs" or
+	// "cloud".
+	Format string `json:"format"`
+
+	// Fields are the fields of a record, in order. The last one is
+	// AttrsField.
+	Fields []FieldSchema `json:"fields"`
+
+	// RecordSeparator ends each record.
+	RecordSeparator string `json:"record_separator"`
+
+	// FieldSeparator separates the fields written with their keys, and
+	// KeyValueSeparator a key from its value.
+	FieldSeparator    string `json:"field_separator"`
+	KeyValueSeparator string `json:"key_value_separator"`
+
+	// GroupSeparator joins the key of a group to the keys of its
+	// attributes, as in "req.id". It is empty when groups are nested
+	// instead, as objects or by indentation.
+	GroupSeparator string `json:"group_separator,omitempty"`
+
+	// Quoting is how string values are quoted: QuoteGo or QuoteJSON.
+	Quoting string `json:"quoting"`
+
+	// Escapes reports whether the output holds terminal escape sequences.
+	Escapes bool `json:"escapes,omitempty"`
+
+	// SortedAttrs reports whether the attributes of each record are
+	// sorted by key. See HandlerOptions.SortAttrs.
+	SortedAttrs bool `json:"sorted_attrs,omitempty"`
+}
+
+// FieldSchema describes one field of the records of a handler.
+type FieldSchema struct {
+	// Name identifies the field by the key of its built-in attribute,
+	// such as slog.TimeKey, EventKey or UptimeKey, by the key of a field
+	// proper to the format, such as "ecs.version", or is AttrsField.
+	Name string `json:"name"`
+
+	// Key is the key the field is written with, after ReplaceAttr; keys
+	// of nested JSON objects are joined by dots, as in "log.level". It is
+	// empty for fields known by their place in the record only.
+	Key string `json:"key,omitempty"`
+
+	// Optional reports whether records may leave the field out, as they
+	// do the time when it is zero or the event when there is none.
+	Optional bool `json:"optional,omitempty"`
+
+	// Layout is how the value is written: a time layout for times, as
+	// for time.Time.Format, with the placeholders of TimeLayout.Date; for
+	// other fields, a pattern where LEVEL stands for the level name,
+	// right-aligned on five characters.
+	Layout string `json:"layout,omitempty"`
+
+	// Raw reports whether the value is written as is, neither quoted nor
+	// escaped.
+	Raw bool `json:"raw,omitempty"`
+}
+
+// SchemaReporter is implemented by the handlers that can describe their
+// output. TextHandler, IndentHandler and JSONHandler implement it.
+type SchemaReporter interface {
+	Schema() FormatSchema
+}
+
+// Probe values of the built-in attributes, passed through ReplaceAttr to
+// learn the keys they are written with.
+var (
+	schemaTime  = slog.Time(slog.TimeKey, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	schemaLevel = slog.Any(slog.LevelKey, slog.LevelInfo)
+)
+
+// schemaFields returns the built-in fields handlers write, in the order of
+// names, passed through ReplaceAttr. Fields removed by ReplaceAttr are left
+// out; fields that are not configured are not listed in names.
+func (o *HandlerOptions) schemaFields(names ...string) []schemaProbe {
+	var probes []schemaProbe
+	for _, name := range names {
+		var a slog.Attr
+		switch name {
+		case slog.TimeKey:
+			a = schemaTime
+		case slog.LevelKey:
+			a = schemaLevel
+		case HandledAtKey:
+			a = slog.Time(HandledAtKey, schemaTime.Value.Time())
+		case UptimeKey:
+			a = slog.Duration(UptimeKey, time.Second)
+		default:
+			a = slog.String(name, "")
+		}
+		if a, ok := o.builtin(a); ok {
+			probes = append(probes, schemaProbe{name, a})
+		}
+	}
+	return probes
+}
+
+// schemaProbe is a built-in attribute as left by ReplaceAttr.
+type schemaProbe struct {
+	name string
+	a    slog.Attr
+}
+
+// field returns the field of p written as key and value.
+func (p schemaProbe) field() FieldSchema {
+	f := FieldSchema{
+		Name:     p.name,
+		Key:      p.a.Key,
+		Optional: p.name == slog.TimeKey || p.name == EventKey,
+	}
+	if p.a.Value.Kind() == slog.KindTime {
+		f.Layout = time.RFC3339Nano
+	}
+	return f
+}
+
+// builtinNames returns the built-in fields written by a handler with
+// options o, in order: those of order that are configured, then the
+// stamps.
+func (o *HandlerOptions) builtinNames(order ...string) []string {
+	names := make([]string, 0, len(order)+2)
+	for _, name := range order {
+		if name != slog.SourceKey || o.AddSource {
+			names = append(names, name)
+		}
+	}
+	if o.StampHandleTime {
+		names = append(names, HandledAtKey)
+	}
+	if o.StampUptime {
+		names = append(names, UptimeKey)
+	}
+	return names
+}
+
+// timeLayout returns the time layout of TimeLayout, as one layout string.
+func (o *HandlerOptions) timeLayout() string {
+	l := DefaultTimeLayout
+	if o.TimeLayout != nil {
+		l = *o.TimeLayout
+	}
+	switch {
+	case l.Date == "":
+		return l.Clock
+	case l.Clock == "":
+		return l.Date
+	default:
+		return l.Date + l.Separator + l.Clock
+	}
+}
+
+// Schema describes the output of h. The time, level and message are
+// known by their place; multi-line messages continue on lines of their
+// own, marked as set by HandlerOptions.Strings, and stacks are written as
+// indented blocks below the record line.
+func (h *TextHandler) Schema() FormatSchema {
+	s := FormatSchema{
+		Format:            "text",
+		RecordSeparator:   "\n",
+		FieldSeparator:    " ",
+		KeyValueSeparator: "=",
+		GroupSeparator:    ".",
+		Quoting:           QuoteGo,
+		Escapes:           h.colored(),
+		SortedAttrs:       h.opts.SortAttrs,
+	}
+	for _, p := range h.opts.schemaFields(h.opts.builtinNames(slog.TimeKey, slog.LevelKey, EventKey, slog.MessageKey, slog.SourceKey)...) {
+		f := p.field()
+		switch {
+		case p.a.Key == slog.TimeKey && p.a.Value.Kind() == slog.KindTime:
+			f.Key, f.Layout = "", h.opts.timeLayout()
+			if f.Layout == "" {
+				continue
+			}
+		case p.a.Key == slog.LevelKey && isSlogLevel(p.a.Value):
+			f.Key, f.Layout, f.Raw = "", "| LEVEL |", true
+		case p.a.Key == slog.MessageKey:
+			f.Key, f.Raw = "", true
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	s.Fields = append(s.Fields, FieldSchema{Name: AttrsField})
+	return s
+}
+
+// Schema describes the output of h. Each field is on a line of its own,
+// and groups are nested by indenting their attributes by four spaces;
+// multi-line messages continue on indented lines after ">-". With
+// CompactHeader, the time, level and source are on the first line,
+// separated by spaces and known by their place.
+func (h *IndentHandler) Schema() FormatSchema {
+	s := FormatSchema{
+		Format:            "indent",
+		RecordSeparator:   "---\n",
+		FieldSeparator:    "\n",
+		KeyValueSeparator: ": ",
+		Quoting:           QuoteGo,
+		SortedAttrs:       h.opts.SortAttrs,
+	}
+	for _, p := range h.opts.schemaFields(h.opts.builtinNames(slog.TimeKey, slog.LevelKey, slog.SourceKey, EventKey, slog.MessageKey)...) {
+		f := p.field()
+		header := h.opts.CompactHeader && (p.name == slog.TimeKey || p.name == slog.LevelKey || p.name == slog.SourceKey)
+		switch {
+		case header && p.name == slog.TimeKey && p.a.Value.Kind() == slog.KindTime:
+			f.Key, f.Layout, f.Raw = "", h.opts.timeLayout(), true
+		case header:
+			f.Key, f.Raw = "", true
+		case p.a.Key == slog.LevelKey && isSlogLevel(p.a.Value),
+			p.a.Key == slog.MessageKey, p.a.Key == slog.SourceKey:
+			f.Raw = true
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	s.Fields = append(s.Fields, FieldSchema{Name: AttrsField})
+	return s
+}
+
+// Schema describes the output of h. Groups are nested objects, and the
+// fields of NewECSHandler and NewCloudLoggingHandler are listed under the
+// keys of their layouts.
+func (h *JSONHandler) Schema() FormatSchema {
+	s := FormatSchema{
+		Format:            "json",
+		RecordSeparator:   "\n",
+		FieldSeparator:    ",",
+		KeyValueSeparator: ":",
+		Quoting:           QuoteJSON,
+		SortedAttrs:       h.opts.SortAttrs,
+	}
+	names := h.opts.builtinNames(slog.TimeKey, slog.LevelKey, EventKey, slog.SourceKey, slog.MessageKey)
+	var layoutKeys map[string]string
+	var extra []FieldSchema
+	switch h.layout {
+	case jsonECS:
+		s.Format = "ecs"
+		names = h.opts.builtinNames(slog.TimeKey, slog.LevelKey, slog.SourceKey, EventKey, slog.MessageKey)
+		extra = []FieldSchema{{Name: "ecs.version", Key: "ecs.version"}}
+		layoutKeys = map[string]string{
+			slog.TimeKey:    "@timestamp",
+			slog.LevelKey:   "log.level",
+			slog.SourceKey:  "log.origin.file",
+			EventKey:        "event.action",
+			slog.MessageKey: "message",
+		}
+	case jsonCloud:
+		s.Format = "cloud"
+		names = h.opts.builtinNames(slog.TimeKey, slog.LevelKey, EventKey, slog.MessageKey, slog.SourceKey)
+		extra = []FieldSchema{{Name: "trace", Key: cloudTraceKey, Optional: true}}
+		layoutKeys = map[string]string{
+			slog.TimeKey:    "timestamp",
+			slog.LevelKey:   "severity",
+			slog.SourceKey:  cloudSourceKey,
+			slog.MessageKey: "message",
+		}
+	}
+	for _, p := range h.opts.schemaFields(names...) {
+		f := p.field()
+		if key, ok := layoutKeys[p.name]; ok {
+			f.Key = key
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	// The fields proper to the layout come before the stamps.
+	stamps := len(names) - slices.IndexFunc(names, func(name string) bool {
+		return name == HandledAtKey || name == UptimeKey
+	})
+	if stamps > len(names) {
+		stamps = 0
+	}
+	s.Fields = slices.Insert(s.Fields, len(s.Fields)-stamps, extra...)
+	s.Fields = append(s.Fields, FieldSchema{Name: AttrsField})
+	return s
+}
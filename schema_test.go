@@ -0,0 +1,338 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// schemaRecord returns a record with all the built-in fields, attributes
+// in and out of groups, and the PC of its caller.
+func schemaRecord() slog.Record {
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:])
+	r := slog.NewRecord(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC), slog.LevelWarn, "disk", pcs[0])
+	r.AddAttrs(Event("disk.full"), String("mount", "/var lib"), Group("usage", Int("free", 12), Float64("ratio", 0.98)))
+	return r
+}
+
+func renameMsg(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && a.Key == slog.MessageKey {
+		a.Key = "message"
+	}
+	return a
+}
+
+var schemaHandlers = []struct {
+	name string
+	new  func(io.Writer) slog.Handler
+}{
+	{"text", func(w io.Writer) slog.Handler { return NewTextHandlerWithOptions(w, &HandlerOptions{}) }},
+	{"text with source and stamps", func(w io.Writer) slog.Handler {
+		return NewTextHandlerWithOptions(w, &HandlerOptions{
+			HandlerOptions:  slog.HandlerOptions{AddSource: true},
+			StampHandleTime: true,
+			StampUptime:     true,
+		})
+	}},
+	{"indent", func(w io.Writer) slog.Handler { return NewIndentHandlerWithOptions(w, &HandlerOptions{}) }},
+	{"indent with source and renamed message", func(w io.Writer) slog.Handler {
+		return NewIndentHandlerWithOptions(w, &HandlerOptions{
+			HandlerOptions: slog.HandlerOptions{AddSource: true, ReplaceAttr: renameMsg},
+			StampUptime:    true,
+		})
+	}},
+	{"compact indent", func(w io.Writer) slog.Handler {
+		return NewIndentHandlerWithOptions(w, &HandlerOptions{
+			HandlerOptions: slog.HandlerOptions{AddSource: true},
+			CompactHeader:  true,
+		})
+	}},
+	{"json", func(w io.Writer) slog.Handler { return NewJSONHandlerWithOptions(w, &HandlerOptions{}) }},
+	{"json with source, stamps and renamed message", func(w io.Writer) slog.Handler {
+		return NewJSONHandlerWithOptions(w, &HandlerOptions{
+			HandlerOptions:  slog.HandlerOptions{AddSource: true, ReplaceAttr: renameMsg},
+			StampHandleTime: true,
+			StampUptime:     true,
+		})
+	}},
+	{"ecs", func(w io.Writer) slog.Handler {
+		return NewECSHandlerWithOptions(w, &HandlerOptions{HandlerOptions: slog.HandlerOptions{AddSource: true}})
+	}},
+	{"cloud logging", func(w io.Writer) slog.Handler {
+		return NewCloudLoggingHandlerWithOptions(w, &HandlerOptions{HandlerOptions: slog.HandlerOptions{AddSource: true}})
+	}},
+}
+
+// TestSchemaMatchesOutput writes a record with each handler and checks
+// it against the schema the handler reports.
+func TestSchemaMatchesOutput(t *testing.T) {
+	for _, tt := range schemaHandlers {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := tt.new(&buf)
+			if err := h.Handle(context.Background(), schemaRecord()); err != nil {
+				t.Fatal(err)
+			}
+			s := h.(SchemaReporter).Schema()
+			if _, err := json.Marshal(s); err != nil {
+				t.Fatalf("marshaling the schema: %v", err)
+			}
+			var err error
+			if s.Quoting == QuoteJSON {
+				err = validateJSON(s, buf.String())
+			} else {
+				err = validateKeyValue(s, buf.String())
+			}
+			if err != nil {
+				schema, _ := json.Marshal(s)
+				t.Errorf("%v\noutput: %q\nschema: %s", err, buf.String(), schema)
+			}
+		})
+	}
+}
+
+// TestSchemaValidators checks that the validators reject a schema that
+// doesn't match the output, so that TestSchemaMatchesOutput means something.
+func TestSchemaValidators(t *testing.T) {
+	for _, tt := range schemaHandlers {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := tt.new(&buf)
+			h.Handle(context.Background(), schemaRecord())
+			s := h.(SchemaReporter).Schema()
+			// Swap the level and the message, which are never optional.
+			fields := slices.Clone(s.Fields)
+			i := slices.IndexFunc(fields, func(f FieldSchema) bool { return f.Name == slog.LevelKey })
+			j := slices.IndexFunc(fields, func(f FieldSchema) bool { return f.Name == slog.MessageKey })
+			fields[i], fields[j] = fields[j], fields[i]
+			s.Fields = fields
+			validate := validateKeyValue
+			if s.Quoting == QuoteJSON {
+				validate = validateJSON
+			}
+			if err := validate(s, buf.String()); err == nil {
+				t.Errorf("no error with the level and message swapped")
+			}
+		})
+	}
+}
+
+// validateKeyValue checks rec, written by a text or indent handler, against
+// s: the built-in fields in order, each ended by FieldSeparator, then the
+// attributes, and RecordSeparator.
+func validateKeyValue(s FormatSchema, rec string) error {
+	rest, ok := strings.CutSuffix(rec, s.RecordSeparator)
+	if !ok {
+		return fmt.Errorf("record not ended by %q", s.RecordSeparator)
+	}
+	var fields []FieldSchema
+	for _, f := range s.Fields {
+		if f.Name != AttrsField {
+			fields = append(fields, f)
+		}
+	}
+	// With CompactHeader, the fields known by their place share the first
+	// line, separated by spaces.
+	if s.Format == "indent" {
+		var header []string
+		for len(fields) > 0 && fields[0].Key == "" {
+			header = append(header, fields[0].Name)
+			fields = fields[1:]
+		}
+		if len(header) > 0 {
+			line, more, _ := strings.Cut(rest, "\n")
+			if n := len(strings.Fields(line)); n < len(header) {
+				return fmt.Errorf("header %q: %d fields, want %v", line, n, header)
+			}
+			rest = more
+		}
+	}
+	for _, f := range fields {
+		next, err := matchField(s, f, rest)
+		if err != nil {
+			if f.Optional {
+				continue
+			}
+			return fmt.Errorf("field %s: %v", f.Name, err)
+		}
+		rest = next
+	}
+	return validateAttrs(s, rest)
+}
+
+var levelPattern = `[ A-Z]{4}[A-Z]`
+
+// matchField matches f at the start of rest, followed by the field
+// separator, and returns what follows.
+func matchField(s FormatSchema, f FieldSchema, rest string) (string, error) {
+	if f.Key != "" {
+		prefix := f.Key + s.KeyValueSeparator
+		if !strings.HasPrefix(rest, prefix) {
+			return "", fmt.Errorf("no %q in %q", prefix, rest)
+		}
+		rest = rest[len(prefix):]
+	}
+	var value string
+	switch {
+	case strings.Contains(f.Layout, "LEVEL"):
+		re := regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(f.Layout), "LEVEL", levelPattern))
+		value = re.FindString(rest)
+		if value == "" {
+			return "", fmt.Errorf("no level as %q in %q", f.Layout, rest)
+		}
+	case f.Layout != "" && f.Key == "":
+		// A time known by its place: as long as its layout.
+		n := len(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC).Format(f.Layout))
+		if len(rest) < n {
+			return "", fmt.Errorf("no time in %q", rest)
+		}
+		value = rest[:n]
+	case !f.Raw && strings.HasPrefix(rest, `"`):
+		q, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return "", err
+		}
+		value = q
+	default:
+		value, _, _ = strings.Cut(rest, s.FieldSeparator)
+	}
+	if f.Layout != "" && !strings.Contains(f.Layout, "LEVEL") {
+		if _, err := time.Parse(f.Layout, value); err != nil {
+			return "", err
+		}
+	}
+	rest = rest[len(value):]
+	if !strings.HasPrefix(rest, s.FieldSeparator) {
+		return "", fmt.Errorf("%q not followed by %q", value, s.FieldSeparator)
+	}
+	return rest[len(s.FieldSeparator):], nil
+}
+
+// validateAttrs checks that rest holds only attributes, each ended by the
+// field separator.
+func validateAttrs(s FormatSchema, rest string) error {
+	key := regexp.MustCompile(`^( {4})*[A-Za-z_][A-Za-z0-9_.]*` + regexp.QuoteMeta(s.KeyValueSeparator))
+	group := regexp.MustCompile(`^( {4})*[A-Za-z_][A-Za-z0-9_]*:`)
+	for rest != "" {
+		if s.GroupSeparator == "" {
+			if m := group.FindString(rest); m != "" && strings.HasPrefix(rest[len(m):], s.FieldSeparator) {
+				rest = rest[len(m)+len(s.FieldSeparator):]
+				continue
+			}
+		}
+		m := key.FindString(rest)
+		if m == "" {
+			return fmt.Errorf("no attribute at %q", rest)
+		}
+		next, err := matchField(s, FieldSchema{}, rest[len(m):])
+		if err != nil {
+			return fmt.Errorf("attribute %s: %v", strings.TrimSpace(m), err)
+		}
+		rest = next
+	}
+	return nil
+}
+
+// validateJSON checks rec, written by a JSON handler, against s: the keys
+// of the built-in fields in order, ahead of the attributes.
+func validateJSON(s FormatSchema, rec string) error {
+	line, ok := strings.CutSuffix(rec, s.RecordSeparator)
+	if !ok || strings.Contains(line, "\n") {
+		return fmt.Errorf("record not on one line ended by %q", s.RecordSeparator)
+	}
+	paths, values, err := jsonLeaves(line)
+	if err != nil {
+		return err
+	}
+	last := -1
+	for _, f := range s.Fields {
+		if f.Name == AttrsField {
+			break
+		}
+		// A field may be an object, such as the source of ECS.
+		i, end := -1, -1
+		for j, p := range paths {
+			if p == f.Key || strings.HasPrefix(p, f.Key+".") {
+				if i < 0 {
+					i = j
+				}
+				end = j
+			}
+		}
+		if i < 0 {
+			if f.Optional {
+				continue
+			}
+			return fmt.Errorf("no field %s under %q", f.Name, f.Key)
+		}
+		if i < last {
+			return fmt.Errorf("field %s before the previous field", f.Name)
+		}
+		if f.Layout != "" {
+			v, _ := values[i].(string)
+			if _, err := time.Parse(f.Layout, v); err != nil {
+				return fmt.Errorf("field %s: %v", f.Name, err)
+			}
+		}
+		last = end
+	}
+	if got, want := paths[last+1:], []string{"mount", "usage.free", "usage.ratio"}; !slices.Equal(got, want) {
+		return fmt.Errorf("after the built-in fields: %q, want the attributes %q", got, want)
+	}
+	return nil
+}
+
+// jsonLeaves returns the dotted paths and values of the leaves of the JSON
+// object line, in order.
+func jsonLeaves(line string) ([]string, []any, error) {
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	var paths []string
+	var values []any
+	var walk func(prefix string) error
+	walk = func(prefix string) error {
+		if _, err := dec.Token(); err != nil { // {
+			return err
+		}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key := prefix + tok.(string)
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+			if len(raw) > 0 && raw[0] == '{' {
+				sub := json.NewDecoder(bytes.NewReader(raw))
+				saved := dec
+				dec = sub
+				err := walk(key + ".")
+				dec = saved
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			var v any
+			json.Unmarshal(raw, &v)
+			paths = append(paths, key)
+			values = append(values, v)
+		}
+		_, err := dec.Token() // }
+		return err
+	}
+	return paths, values, walk("")
+}
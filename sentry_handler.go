@@ -0,0 +1,645 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of SentryOptions.
+const (
+	sentryQueueSize      = 100
+	sentryMaxBreadcrumbs = 100
+	sentryRetryAfter     = time.Minute
+	sentryClient         = "zestack.dev/log"
+)
+
+// SentryOptions are options for a [SentryHandler].
+type SentryOptions struct {
+	// DSN is the client key of the Sentry project, as in
+	// "https://key@o1.ingest.sentry.io/42".
+	DSN string
+
+	// Level is the level from which records become Sentry events. If
+	// zero, LevelError is used.
+	Level Level
+
+	// BreadcrumbLevel is the level from which records below Level are kept
+	// as breadcrumbs, attached to the next event. If zero, LevelInfo is
+	// used.
+	BreadcrumbLevel Level
+
+	// MaxBreadcrumbs is the number of breadcrumbs kept, the oldest being
+	// forgotten first. If zero, 100 are; if negative, none are.
+	MaxBreadcrumbs int
+
+	// Environment, Release and ServerName are set on each event.
+	Environment string
+	Release     string
+	ServerName  string
+
+	// Tags are the tags of all the events.
+	Tags map[string]string
+
+	// TagKeys are the keys of the attributes that are tags of the events,
+	// keys in groups being joined by dots, as in "http.method". The other
+	// attributes are extra data.
+	TagKeys []string
+
+	// QueueSize is the number of events the handler holds before they
+	// are sent. If zero, 100 is used.
+	QueueSize int
+
+	// Client sends the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Drops, if set, counts the events dropped from a full queue under
+	// DropQueue, those dropped while Sentry asks for no more under
+	// DropThrottled, and those Sentry failed to take under DropFailed.
+	// See [Drops].
+	Drops *Drops
+
+	// OnError, if set, is called with the errors met sending an event.
+	OnError func(err error)
+}
+
+// SentryHandler captures errors in Sentry without instrumenting each call
+// site. It passes all the records to the handler it wraps and turns those
+// at or above Level into Sentry events:
+//
+//	h, err := log.NewSentryHandler(log.NewJSONHandler(os.Stderr, nil), log.SentryOptions{
+//		DSN:         os.Getenv("SENTRY_DSN"),
+//		Environment: "production",
+//	})
+//
+// An event has the message and level of the record, TRACE and DEBUG
+// mapping to debug, WARN to warning and PANIC and FATAL to fatal, and its
+// attributes as tags, for those of TagKeys, or extra data. If an attribute
+// is an error, the event is an exception of that error. The stack trace of
+// the event is, in order of preference, that of a StackKey attribute, as
+// logged by [Logger.Panic] and [Logger.Fatal], that of the error, if it has
+// a StackTrace method returning program counters, as the errors of
+// github.com/pkg/errors do, or the stack of the call that logged the
+// record, when it is handled on the same goroutine.
+//
+// The records from BreadcrumbLevel to Level are kept as breadcrumbs,
+// attached to the next event.
+//
+// Events are sent in the background, with a bounded queue: they are
+// dropped when it is full, and while Sentry rate limits the project. A
+// SentryHandler is registered with [RegisterFlusher] until closed, so that
+// Logger.Fatal sends the pending events before exiting.
+type SentryHandler struct {
+	next   slog.Handler
+	s      *sentryExporter
+	prefix string       // group names from WithGroup, dot-terminated
+	attrs  []sentryAttr // from WithAttrs
+}
+
+// sentryAttr is an attribute with its dotted key.
+type sentryAttr struct {
+	key   string
+	value slog.Value
+}
+
+// sentryExporter is the state shared by a SentryHandler and the handlers
+// derived from it: the breadcrumbs, and the queue and sending goroutine of
+// the events, as envelopes, one per batch.
+type sentryExporter struct {
+	*batchExporter[[]byte]
+	opts *SentryOptions
+	url  string
+	auth string
+	dsn  string
+
+	crumbMu sync.Mutex
+	crumbs  []sentryBreadcrumb // oldest first
+
+	retryMu    sync.Mutex
+	retryAfter time.Time // Sentry rate limits the project until then
+}
+
+// NewSentryHandler returns a SentryHandler passing records to next and
+// sending events to the project of opts.DSN, and starts its sending
+// goroutine.
+func NewSentryHandler(next slog.Handler, opts SentryOptions) (*SentryHandler, error) {
+	u, err := url.Parse(opts.DSN)
+	if err != nil {
+		return nil, err
+	}
+	key := u.User.Username()
+	project := strings.TrimPrefix(u.Path, "/")
+	if key == "" || project == "" || u.Host == "" {
+		return nil, fmt.Errorf("log: invalid Sentry DSN %q", opts.DSN)
+	}
+	// The project is the last element of the path; those before it, if
+	// any, prefix the API path.
+	var base string
+	if i := strings.LastIndexByte(project, '/'); i >= 0 {
+		base, project = "/"+project[:i], project[i+1:]
+	}
+	if opts.Level == 0 {
+		opts.Level = LevelError
+	}
+	if opts.BreadcrumbLevel == 0 {
+		opts.BreadcrumbLevel = LevelInfo
+	}
+	if opts.MaxBreadcrumbs == 0 {
+		opts.MaxBreadcrumbs = sentryMaxBreadcrumbs
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = sentryQueueSize
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	endpoint := url.URL{Scheme: u.Scheme, Host: u.Host, Path: base + "/api/" + project + "/envelope/"}
+	s := &sentryExporter{
+		opts: &opts,
+		url:  endpoint.String(),
+		auth: "Sentry sentry_version=7, sentry_client=" + sentryClient + ", sentry_key=" + key,
+		dsn:  opts.DSN,
+	}
+	// The events are sent one by one, as they come.
+	s.batchExporter = newBatchExporter(batchOptions{
+		BatchSize:     1,
+		QueueSize:     opts.QueueSize,
+		FlushInterval: time.Second,
+		MaxRetries:    -1,
+		Drops:         opts.Drops,
+		OnError:       opts.OnError,
+	}, s.send)
+	h := &SentryHandler{next: next, s: s}
+	s.unregister = RegisterFlusher(h)
+	return h, nil
+}
+
+func (h *SentryHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	opts := h.s.opts
+	return level >= opts.Level.Level() ||
+		opts.MaxBreadcrumbs > 0 && level >= opts.BreadcrumbLevel.Level() ||
+		h.next.Enabled(ctx, level)
+}
+
+func (h *SentryHandler) Handle(ctx context.Context, r slog.Record) error {
+	s := h.s
+	var err error
+	if IsForced(ctx) || h.next.Enabled(ctx, r.Level) {
+		err = h.next.Handle(ctx, r)
+	}
+	switch {
+	case r.Level >= s.opts.Level.Level():
+		if s.closed.Load() {
+			return errors.Join(err, net.ErrClosed)
+		}
+		if s.throttled() {
+			s.opts.Drops.Add(DropThrottled, 1)
+			return err
+		}
+		if envelope := h.event(r); envelope != nil {
+			err = errors.Join(err, s.enqueue(ctx, r.Level, envelope))
+		}
+	case s.opts.MaxBreadcrumbs > 0 && r.Level >= s.opts.BreadcrumbLevel.Level():
+		s.addBreadcrumb(h.breadcrumb(r))
+	}
+	return err
+}
+
+func (h *SentryHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.next = h.next.WithAttrs(attrs)
+	h2.attrs = slices.Clip(h.attrs)
+	for _, a := range attrs {
+		h2.attrs = appendSentryAttrs(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+func (h *SentryHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.next = h.next.WithGroup(name)
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// appendSentryAttrs appends a, in groups under prefix, as attributes with
+// dotted keys. Empty attributes are left out.
+func appendSentryAttrs(attrs []sentryAttr, prefix string, a slog.Attr) []sentryAttr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		if a.Equal(slog.Attr{}) {
+			return attrs
+		}
+		return append(attrs, sentryAttr{prefix + a.Key, a.Value})
+	}
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, ga := range a.Value.Group() {
+		attrs = appendSentryAttrs(attrs, prefix, ga)
+	}
+	return attrs
+}
+
+// recordAttrs returns the attributes of h and r.
+func (h *SentryHandler) recordAttrs(r slog.Record) []sentryAttr {
+	attrs := slices.Clip(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = appendSentryAttrs(attrs, h.prefix, a)
+		return true
+	})
+	return attrs
+}
+
+// sentryEvent is an event, as sent to Sentry.
+type sentryEvent struct {
+	EventID     string                          `json:"event_id"`
+	Timestamp   string                          `json:"timestamp"`
+	Platform    string                          `json:"platform"`
+	Level       string                          `json:"level"`
+	Logger      string                          `json:"logger"`
+	Message     *sentryMessage                  `json:"message,omitempty"`
+	Environment string                          `json:"environment,omitempty"`
+	Release     string                          `json:"release,omitempty"`
+	ServerName  string                          `json:"server_name,omitempty"`
+	Tags        map[string]string               `json:"tags,omitempty"`
+	Extra       map[string]any                  `json:"extra,omitempty"`
+	Exception   *sentryValues[sentryException]  `json:"exception,omitempty"`
+	Threads     *sentryValues[sentryThread]     `json:"threads,omitempty"`
+	Breadcrumbs *sentryValues[sentryBreadcrumb] `json:"breadcrumbs,omitempty"`
+}
+
+type sentryValues[T any] struct {
+	Values []T `json:"values"`
+}
+
+type sentryMessage struct {
+	Formatted string `json:"formatted"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryThread struct {
+	Current    bool              `json:"current"`
+	Stacktrace *sentryStacktrace `json:"stacktrace"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"` // outermost first
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryBreadcrumb struct {
+	Timestamp string         `json:"timestamp"`
+	Type      string         `json:"type"`
+	Category  string         `json:"category"`
+	Level     string         `json:"level"`
+	Message   string         `json:"message"`
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// sentryLevel returns the Sentry level of l.
+func sentryLevel(l slog.Level) string {
+	switch level := parseSlogLevel(l); {
+	case level <= LevelDebug:
+		return "debug"
+	case level == LevelInfo:
+		return "info"
+	case level == LevelWarn:
+		return "warning"
+	case level == LevelError:
+		return "error"
+	default:
+		return "fatal"
+	}
+}
+
+// sentryTime returns t, or the current time if t is zero, as Sentry
+// expects it.
+func sentryTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// breadcrumb returns r as a breadcrumb.
+func (h *SentryHandler) breadcrumb(r slog.Record) sentryBreadcrumb {
+	b := sentryBreadcrumb{
+		Timestamp: sentryTime(r.Time),
+		Type:      "default",
+		Category:  "log",
+		Level:     sentryLevel(r.Level),
+		Message:   r.Message,
+	}
+	for _, a := range h.recordAttrs(r) {
+		if b.Data == nil {
+			b.Data = map[string]any{}
+		}
+		b.Data[a.key] = sentryValue(a.value)
+	}
+	return b
+}
+
+// addBreadcrumb keeps b, forgetting the oldest breadcrumb if there are
+// too many.
+func (s *sentryExporter) addBreadcrumb(b sentryBreadcrumb) {
+	s.crumbMu.Lock()
+	defer s.crumbMu.Unlock()
+	if len(s.crumbs) == s.opts.MaxBreadcrumbs {
+		s.crumbs[0] = sentryBreadcrumb{}
+		s.crumbs = s.crumbs[1:]
+	}
+	s.crumbs = append(s.crumbs, b)
+}
+
+// takeBreadcrumbs returns the breadcrumbs kept and forgets them.
+func (s *sentryExporter) takeBreadcrumbs() []sentryBreadcrumb {
+	s.crumbMu.Lock()
+	defer s.crumbMu.Unlock()
+	crumbs := s.crumbs
+	s.crumbs = nil
+	return crumbs
+}
+
+// event returns r as an event, in an envelope, or nil if it can't be
+// encoded.
+func (h *SentryHandler) event(r slog.Record) []byte {
+	s := h.s
+	ev := sentryEvent{
+		EventID:     sentryEventID(),
+		Timestamp:   sentryTime(r.Time),
+		Platform:    "go",
+		Level:       sentryLevel(r.Level),
+		Logger:      sentryClient,
+		Message:     &sentryMessage{Formatted: r.Message},
+		Environment: s.opts.Environment,
+		Release:     s.opts.Release,
+		ServerName:  s.opts.ServerName,
+	}
+	for k, v := range s.opts.Tags {
+		if ev.Tags == nil {
+			ev.Tags = map[string]string{}
+		}
+		ev.Tags[k] = v
+	}
+	var stack Stack
+	var err error
+	for _, a := range h.recordAttrs(r) {
+		if v, ok := stackValue(a.value); ok && a.key == h.prefix+StackKey {
+			stack = v
+			continue
+		}
+		if e, ok := a.value.Any().(error); ok && err == nil {
+			err = e
+		}
+		if slices.Contains(s.opts.TagKeys, a.key) {
+			if ev.Tags == nil {
+				ev.Tags = map[string]string{}
+			}
+			ev.Tags[a.key] = a.value.String()
+			continue
+		}
+		if ev.Extra == nil {
+			ev.Extra = map[string]any{}
+		}
+		ev.Extra[a.key] = sentryValue(a.value)
+	}
+	if stack == nil && err != nil {
+		stack = errorStack(err)
+	}
+	if stack == nil && r.PC != 0 {
+		stack = callerStack(r.PC)
+	}
+	var trace *sentryStacktrace
+	if len(stack) > 0 {
+		trace = &sentryStacktrace{Frames: sentryFrames(stack)}
+	}
+	if err != nil {
+		ev.Exception = &sentryValues[sentryException]{Values: []sentryException{{
+			Type:       fmt.Sprintf("%T", err),
+			Value:      errorText(err),
+			Stacktrace: trace,
+		}}}
+	} else if trace != nil {
+		ev.Threads = &sentryValues[sentryThread]{Values: []sentryThread{{Current: true, Stacktrace: trace}}}
+	}
+	if crumbs := s.takeBreadcrumbs(); len(crumbs) > 0 {
+		ev.Breadcrumbs = &sentryValues[sentryBreadcrumb]{Values: crumbs}
+	}
+
+	payload, jerr := json.Marshal(ev)
+	if jerr != nil {
+		s.fail(jerr)
+		return nil
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"event_id":%q,"sent_at":%q,"dsn":%q}`+"\n", ev.EventID, sentryTime(time.Now()), s.dsn)
+	fmt.Fprintf(&b, `{"type":"event","length":%d}`+"\n", len(payload))
+	b.Write(payload)
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// sentryEventID returns a random event id.
+func sentryEventID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// sentryValue returns v as extra data.
+func sentryValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindString, slog.KindInt64, slog.KindUint64, slog.KindFloat64, slog.KindBool:
+		return v.Any()
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return errorText(err)
+		}
+	}
+	return v.String()
+}
+
+// errorStack returns the stack of err, or of the errors it wraps, if one
+// has a StackTrace method returning program counters, of a type whose
+// underlying type is uintptr, as those of github.com/pkg/errors. The
+// deepest error with a stack, closest to the origin, is preferred.
+func errorStack(err error) Stack {
+	var stack Stack
+	for ; err != nil; err = errors.Unwrap(err) {
+		m := reflect.ValueOf(err).MethodByName("StackTrace")
+		if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+			continue
+		}
+		trace := m.Call(nil)[0]
+		if trace.Kind() != reflect.Slice || trace.Type().Elem().Kind() != reflect.Uintptr || trace.Len() == 0 {
+			continue
+		}
+		pcs := make([]uintptr, trace.Len())
+		for i := range pcs {
+			pcs[i] = uintptr(trace.Index(i).Uint())
+		}
+		stack = framesStack(pcs)
+	}
+	return stack
+}
+
+// callerStack returns the stack from the call at pc, if it is on the
+// stack of the calling goroutine, or just the frame of pc otherwise, as
+// for a record handled on another goroutine.
+func callerStack(pc uintptr) Stack {
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(1, pcs[:])
+	if i := slices.Index(pcs[:n], pc); i >= 0 {
+		return framesStack(pcs[i:n])
+	}
+	return framesStack([]uintptr{pc})
+}
+
+// framesStack returns the stack of the return addresses pcs.
+func framesStack(pcs []uintptr) Stack {
+	frames := runtime.CallersFrames(pcs)
+	var stack Stack
+	for {
+		f, more := frames.Next()
+		stack = append(stack, f)
+		if !more {
+			return stack
+		}
+	}
+}
+
+// sentryFrames returns stack as Sentry frames, outermost first.
+func sentryFrames(stack Stack) []sentryFrame {
+	frames := make([]sentryFrame, len(stack))
+	for i, f := range stack {
+		module, function := splitFunction(f.Function)
+		frames[len(stack)-1-i] = sentryFrame{
+			Function: function,
+			Module:   module,
+			Filename: f.File[strings.LastIndexByte(f.File, '/')+1:],
+			AbsPath:  f.File,
+			Lineno:   f.Line,
+			InApp:    module != "runtime" && module != "testing" && !strings.HasPrefix(module, "runtime/"),
+		}
+	}
+	return frames
+}
+
+// splitFunction splits the name of a function, as in
+// "zestack.dev/log.(*logger).Error", into its package path and its name
+// in the package.
+func splitFunction(name string) (pkg, function string) {
+	slash := strings.LastIndexByte(name, '/') + 1
+	if i := strings.IndexByte(name[slash:], '.'); i >= 0 {
+		return name[:slash+i], name[slash+i+1:]
+	}
+	return "", name
+}
+
+// throttled reports whether Sentry asked for no more events for now.
+func (s *sentryExporter) throttled() bool {
+	s.retryMu.Lock()
+	defer s.retryMu.Unlock()
+	return time.Now().Before(s.retryAfter)
+}
+
+// send posts the event of a batch.
+func (s *sentryExporter) send(ctx context.Context, batch [][]byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(batch[0]))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait := sentryRetryAfter
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			wait = time.Duration(secs) * time.Second
+		}
+		s.retryMu.Lock()
+		s.retryAfter = time.Now().Add(wait)
+		s.retryMu.Unlock()
+	}
+	return false, fmt.Errorf("log: Sentry event: %s", resp.Status)
+}
+
+// fail records err, met encoding an event, and reports it to OnError.
+func (s *sentryExporter) fail(err error) {
+	s.mu.Lock()
+	s.lastErr, s.lastErrAt = err, time.Now()
+	s.mu.Unlock()
+	if s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
+
+// Flush sends the events queued, waiting until they are sent or ctx is
+// done.
+func (h *SentryHandler) Flush(ctx context.Context) error {
+	return h.s.flush(ctx)
+}
+
+// Close sends the events queued and stops the handler, waiting until it
+// is done, for 30 seconds at most. Records at or above Level handled
+// afterwards return net.ErrClosed, after being passed to the wrapped
+// handler.
+func (h *SentryHandler) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), batchCloseTimeout)
+	defer cancel()
+	return h.s.close(ctx)
+}
+
+// LogHealth reports the state of the queue and of the last event sent.
+func (h *SentryHandler) LogHealth() ComponentHealth {
+	return h.s.health("sentry")
+}
+
+// Unwrap returns the handler wrapped by h.
+func (h *SentryHandler) Unwrap() Handler {
+	return h.next
+}
@@ -0,0 +1,149 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSentry(t *testing.T, s *batchServer, next slog.Handler, opts SentryOptions) *SentryHandler {
+	t.Helper()
+	opts.DSN = strings.Replace(s.URL, "http://", "http://key@", 1) + "/42"
+	h, err := NewSentryHandler(next, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// sentryEvents returns the events of the envelopes.
+func sentryEvents(t *testing.T, envelopes []string) []sentryEvent {
+	t.Helper()
+	var events []sentryEvent
+	for _, envelope := range envelopes {
+		lines := strings.Split(strings.TrimSuffix(envelope, "\n"), "\n")
+		if len(lines) != 3 || !strings.Contains(lines[1], `"type":"event"`) {
+			t.Fatalf("envelope %q", envelope)
+		}
+		var ev sentryEvent
+		if err := json.Unmarshal([]byte(lines[2]), &ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestSentryHandlerEvents(t *testing.T) {
+	s := newBatchServer(t)
+	var buf bytes.Buffer
+	h := newTestSentry(t, s, slog.NewTextHandler(&buf, nil), SentryOptions{
+		Environment: "test",
+		Tags:        map[string]string{"region": "eu"},
+		TagKeys:     []string{"req.user"},
+	})
+	l := slog.New(h)
+	l.Debug("not kept")
+	l.Info("connecting", "host", "db")
+	l.WithGroup("req").Error("query failed", "user", "bob", "err", errors.New("timeout"), "rows", 3)
+	l.Warn("retrying")
+	l.Error("gave up")
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 4 {
+		t.Errorf("%d records passed to the wrapped handler, want 4", got)
+	}
+	bodies, _ := s.received()
+	events := sentryEvents(t, bodies)
+	if len(events) != 2 {
+		t.Fatalf("%d events, want 2", len(events))
+	}
+	if s.paths[0] != "/api/42/envelope/" || !strings.Contains(s.headers[0].Get("X-Sentry-Auth"), "sentry_key=key") {
+		t.Errorf("path %s, header %v", s.paths[0], s.headers[0])
+	}
+
+	ev := events[0]
+	if ev.Message.Formatted != "query failed" || ev.Level != "error" || ev.Environment != "test" {
+		t.Errorf("event %+v", ev)
+	}
+	if fmt.Sprint(ev.Tags) != "map[region:eu req.user:bob]" || fmt.Sprint(ev.Extra) != "map[req.err:timeout req.rows:3]" {
+		t.Errorf("tags %v, extra %v", ev.Tags, ev.Extra)
+	}
+	if ev.Exception == nil || ev.Exception.Values[0].Value != "timeout" {
+		t.Errorf("exception %+v", ev.Exception)
+	}
+	if ev.Breadcrumbs == nil || len(ev.Breadcrumbs.Values) != 1 || ev.Breadcrumbs.Values[0].Message != "connecting" {
+		t.Errorf("breadcrumbs %+v", ev.Breadcrumbs)
+	}
+	// The breadcrumbs go with one event.
+	if ev := events[1]; ev.Breadcrumbs == nil || len(ev.Breadcrumbs.Values) != 1 || ev.Breadcrumbs.Values[0].Message != "retrying" {
+		t.Errorf("breadcrumbs %+v", ev.Breadcrumbs)
+	}
+}
+
+// The events are dropped while Sentry asks for no more.
+func TestSentryHandlerThrottled(t *testing.T) {
+	s := newBatchServer(t)
+	s.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		s.serve(w, r)
+	})
+	s.status = []int{http.StatusTooManyRequests}
+	drops := new(Drops)
+	var errs []error
+	h := newTestSentry(t, s, DiscardHandler, SentryOptions{Drops: drops, OnError: func(err error) { errs = append(errs, err) }})
+	l := slog.New(h)
+	l.Error("refused")
+	h.Flush(context.Background())
+	l.Error("throttled")
+	h.Flush(context.Background())
+	if _, n := s.received(); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+	if a, ok := drops.take(); !ok || a.String() != "dropped=[failed=1 throttled=1]" {
+		t.Errorf("drops = %v", a)
+	}
+	if len(errs) != 1 {
+		t.Errorf("errors: %v", errs)
+	}
+	if health := h.LogHealth(); health.Name != "sentry" || health.Healthy || health.LastError == nil {
+		t.Errorf("health = %+v", health)
+	}
+}
+
+func TestSentryHandlerClose(t *testing.T) {
+	s := newBatchServer(t)
+	s.release = make(chan struct{})
+	drops := new(Drops)
+	h := newTestSentry(t, s, DiscardHandler, SentryOptions{QueueSize: 1, Drops: drops})
+	l := slog.New(h)
+	l.Error("sending")
+	s.waitArrived(t, 1)
+	l.Error("queued")
+	l.Error("dropped")
+	closed := make(chan error)
+	go func() { closed <- h.Close() }()
+	close(s.release)
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if bodies, _ := s.received(); len(bodies) != 2 {
+		t.Errorf("%d events sent, want 2", len(bodies))
+	}
+	if a, ok := drops.take(); !ok || a.String() != "dropped=[queue=1]" {
+		t.Errorf("drops = %v", a)
+	}
+	if err := h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelError, "late", 0)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Handle after Close: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package log
+
+import (
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FullSourcePath renders a source location with the full path of its
+// file, as "/home/ci/src/app/internal/http/server.go:412". It is a
+// [HandlerOptions.SourcePath].
+func FullSourcePath(file string, line int) string {
+	return file + ":" + strconv.Itoa(line)
+}
+
+// ShortSourcePath renders a source location with the directory and base
+// name of its file, as "http/server.go:412". It is a
+// [HandlerOptions.SourcePath], the default of TextHandler and
+// IndentHandler.
+func ShortSourcePath(file string, line int) string {
+	return LastSourceElements(2)(file, line)
+}
+
+// LastSourceElements returns a [HandlerOptions.SourcePath] rendering a
+// source location with the last n elements of the path of its file, as
+// "internal/http/server.go:412" for 3.
+func LastSourceElements(n int) func(file string, line int) string {
+	return func(file string, line int) string {
+		i := len(file)
+		for k := 0; k < n && i > 0; k++ {
+			i = strings.LastIndexByte(file[:i], '/')
+		}
+		return file[i+1:] + ":" + strconv.Itoa(line)
+	}
+}
+
+// ModuleSourcePath renders a source location with the path of its file
+// within its module, as "internal/http/server.go:412", for the files of
+// the main module, as named by the build information of the program, and
+// with the path and version of the module for those of its dependencies,
+// as "github.com/acme/lib@v1.2.0/client.go:88". The files of the main
+// module are found whether or not the program was built with -trimpath,
+// as long as their path holds the path of the module; the others are
+// rendered as by ShortSourcePath. It is a [HandlerOptions.SourcePath].
+func ModuleSourcePath(file string, line int) string {
+	const modCache = "/pkg/mod/"
+	if i := strings.LastIndex(file, modCache); i >= 0 {
+		return FullSourcePath(file[i+len(modCache):], line)
+	}
+	if mod := mainModule(); mod != "" {
+		if rel, ok := strings.CutPrefix(file, mod+"/"); ok {
+			return FullSourcePath(rel, line)
+		}
+		if i := strings.Index(file, "/"+mod+"/"); i >= 0 {
+			return FullSourcePath(file[i+len(mod)+2:], line)
+		}
+	}
+	return ShortSourcePath(file, line)
+}
+
+// mainModule returns the path of the main module of the program, or ""
+// if it is not known, as in tests.
+var mainModule = sync.OnceValue(func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	return info.Main.Path
+})
@@ -0,0 +1,67 @@
+package log
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	spanDepthKey    = "depth"
+	spanDurationKey = "duration"
+)
+
+// spanKey is the key of the depth of the innermost span in the contexts
+// returned by SpanContext.
+type spanKey struct{}
+
+// noopSpan is returned by Span when LevelTrace is disabled.
+// Returning a top-level function keeps that path free of allocations.
+func noopSpan() {}
+
+func (l *logger) Span(msg string, args ...any) func() {
+	if !l.Enabled(nil, LevelTrace) {
+		return noopSpan
+	}
+	attrs := argsToAttrSlice(args)
+	start := time.Now()
+	l.log(nil, LevelTrace.Level(), literal(msg+" started"), spanArgs(attrs, Int64(spanDepthKey, 1)))
+	return l.endSpan(nil, msg, attrs, 1, start)
+}
+
+func (l *logger) SpanContext(ctx context.Context, msg string, args ...any) (context.Context, func()) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !l.Enabled(ctx, LevelTrace) {
+		return ctx, noopSpan
+	}
+	attrs := argsToAttrSlice(args)
+	depth, _ := ctx.Value(spanKey{}).(int64)
+	depth++
+	start := time.Now()
+	l.log(ctx, LevelTrace.Level(), literal(msg+" started"), spanArgs(attrs, Int64(spanDepthKey, depth)))
+	return context.WithValue(ctx, spanKey{}, depth), l.endSpan(ctx, msg, attrs, depth, start)
+}
+
+// endSpan returns the function logging the end of a span started at
+// start, at the given depth.
+func (l *logger) endSpan(ctx context.Context, msg string, attrs []Attr, depth int64, start time.Time) func() {
+	return func() {
+		l.log(ctx, LevelTrace.Level(), literal(msg+" finished"), spanArgs(attrs,
+			Int64(spanDepthKey, depth),
+			Duration(spanDurationKey, time.Since(start)),
+		))
+	}
+}
+
+// spanArgs returns the attributes of a span record as arguments for log.
+func spanArgs(attrs []Attr, extra ...Attr) []any {
+	args := make([]any, 0, len(attrs)+len(extra))
+	for _, a := range attrs {
+		args = append(args, a)
+	}
+	for _, a := range extra {
+		args = append(args, a)
+	}
+	return args
+}
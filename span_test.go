@@ -0,0 +1,143 @@
+package log_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"zestack.dev/log"
+	"zestack.dev/log/logtest"
+)
+
+func TestSpanContextNesting(t *testing.T) {
+	l, capture := logtest.NewTestLogger(t)
+	ctx, endOuter := l.SpanContext(context.Background(), "outer", "id", 7)
+	ctx2, endInner := l.SpanContext(ctx, "inner")
+	_, endDeepest := l.SpanContext(ctx2, "deepest")
+	endDeepest()
+	endInner()
+	// A sibling of inner is at its depth.
+	_, endSibling := l.SpanContext(ctx, "sibling")
+	endSibling()
+	endOuter()
+
+	want := []struct {
+		msg   string
+		depth int64
+	}{
+		{"outer started", 1},
+		{"inner started", 2},
+		{"deepest started", 3},
+		{"deepest finished", 3},
+		{"inner finished", 2},
+		{"sibling started", 2},
+		{"sibling finished", 2},
+		{"outer finished", 1},
+	}
+	entries := capture.Entries()
+	if len(entries) != len(want) {
+		t.Fatalf("got %d records, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Message != w.msg || e.Attrs["depth"].Int64() != w.depth {
+			t.Errorf("record %d: got %q depth=%v, want %q depth=%d", i, e.Message, e.Attrs["depth"], w.msg, w.depth)
+		}
+		if e.Level != log.LevelTrace.Level() {
+			t.Errorf("record %d: got level %v, want TRACE", i, e.Level)
+		}
+	}
+	if !capture.Has("outer finished", log.Int("id", 7)) {
+		t.Error("the attributes of the span are missing from its end")
+	}
+	if _, ok := entries[len(entries)-1].Attrs["duration"]; !ok {
+		t.Error("no duration on the end of the span")
+	}
+}
+
+func TestSpanDepthPerContext(t *testing.T) {
+	l, capture := logtest.NewTestLogger(t)
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			ctx, end := l.SpanContext(context.Background(), "request")
+			defer end()
+			_, endQuery := l.SpanContext(ctx, "query")
+			endQuery()
+		}()
+	}
+	close(start)
+	wg.Wait()
+	for _, e := range capture.Entries() {
+		want := int64(1)
+		if e.Message == "query started" || e.Message == "query finished" {
+			want = 2
+		}
+		if got := e.Attrs["depth"].Int64(); got != want {
+			t.Errorf("%q: got depth %d, want %d", e.Message, got, want)
+		}
+	}
+}
+
+func TestSpan(t *testing.T) {
+	l, capture := logtest.NewTestLogger(t)
+	end := l.Span("work", "n", 1)
+	l.Span("other")()
+	end()
+	for _, e := range capture.Entries() {
+		if got := e.Attrs["depth"].Int64(); got != 1 {
+			t.Errorf("%q: got depth %d, want 1", e.Message, got)
+		}
+	}
+	if !capture.Has("work finished", log.Int("n", 1)) {
+		t.Errorf("no end of the span: %v", capture.Entries())
+	}
+}
+
+func TestSpanDisabled(t *testing.T) {
+	l, capture := logtest.NewTestLogger(t)
+	l.SetLevel(log.LevelDebug)
+	ctx := context.Background()
+	allocs := testing.AllocsPerRun(100, func() {
+		l.Span("work")()
+		_, end := l.SpanContext(ctx, "work")
+		end()
+	})
+	if allocs != 0 {
+		t.Errorf("disabled spans allocate %v times, want 0", allocs)
+	}
+	if got := l.Span("work"); got == nil {
+		t.Error("Span returned nil")
+	}
+	if got, _ := l.SpanContext(ctx, "work"); got != ctx {
+		t.Error("SpanContext changed the context of a disabled span")
+	}
+	if n := len(capture.Entries()); n != 0 {
+		t.Errorf("got %d records, want none", n)
+	}
+}
+
+// The message of a span is not a format.
+func TestSpanMessagePercent(t *testing.T) {
+	l, capture := logtest.NewTestLogger(t)
+	l.Span("resize 100% done", "n", 1)()
+	_, end := l.SpanContext(context.Background(), "copy %d files")
+	end()
+	entries := capture.Entries()
+	want := []string{"resize 100% done started", "resize 100% done finished", "copy %d files started", "copy %d files finished"}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d records, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.Message != want[i] || e.Attrs["depth"].Int64() != 1 {
+			t.Errorf("record %d: got %q depth=%v, want %q depth=1", i, e.Message, e.Attrs["depth"], want[i])
+		}
+	}
+	if !capture.Has("resize 100% done finished", log.Int("n", 1)) {
+		t.Errorf("attributes lost: %v", entries)
+	}
+}
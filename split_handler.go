@@ -0,0 +1,104 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// Class is where a [SplitHandler] sends a record.
+type Class int
+
+const (
+	// ClassHuman sends the record to the human-readable handler.
+	ClassHuman Class = iota
+	// ClassMachine sends the record to the machine-readable handler.
+	ClassMachine
+	// ClassBoth sends the record to both handlers.
+	ClassBoth
+)
+
+// SplitHandler sends each record to one of two handlers, or both, so that
+// the same logging calls can feed a human-readable stream and a
+// machine-readable one, such as a TextHandler on os.Stderr for progress
+// messages and a slog.JSONHandler on os.Stdout for events:
+//
+//	h := log.NewSplitHandler(
+//		log.NewTextHandler(os.Stderr, nil),
+//		slog.NewJSONHandler(os.Stdout, nil),
+//		nil,
+//	)
+//
+// Attributes and groups added with WithAttrs and WithGroup go to both.
+type SplitHandler struct {
+	human    slog.Handler
+	machine  slog.Handler
+	classify func(r slog.Record) Class
+}
+
+// NewSplitHandler returns a SplitHandler choosing the handler of each
+// record with classify. If classify is nil, records carrying an attribute
+// with key EventKey go to machine, and all others to human. classify only
+// sees the attributes of the record itself, not those added with WithAttrs.
+func NewSplitHandler(human, machine slog.Handler, classify func(r slog.Record) Class) *SplitHandler {
+	if classify == nil {
+		classify = classifyEvent
+	}
+	return &SplitHandler{human: human, machine: machine, classify: classify}
+}
+
+// classifyEvent is the default classifier of SplitHandler.
+func classifyEvent(r slog.Record) Class {
+	class := ClassHuman
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == EventKey {
+			class = ClassMachine
+			return false
+		}
+		return true
+	})
+	return class
+}
+
+func (h *SplitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.human.Enabled(ctx, level) || h.machine.Enabled(ctx, level)
+}
+
+func (h *SplitHandler) Handle(ctx context.Context, r slog.Record) error {
+	class := h.classify(r)
+	var errs []error
+	if class != ClassMachine && (IsForced(ctx) || h.human.Enabled(ctx, r.Level)) {
+		errs = append(errs, h.human.Handle(ctx, r.Clone()))
+	}
+	if class != ClassHuman && (IsForced(ctx) || h.machine.Enabled(ctx, r.Level)) {
+		errs = append(errs, h.machine.Handle(ctx, r.Clone()))
+	}
+	return errors.Join(errs...)
+}
+
+func (h *SplitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &SplitHandler{
+		human:    h.human.WithAttrs(attrs),
+		machine:  h.machine.WithAttrs(attrs),
+		classify: h.classify,
+	}
+}
+
+func (h *SplitHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SplitHandler{
+		human:    h.human.WithGroup(name),
+		machine:  h.machine.WithGroup(name),
+		classify: h.classify,
+	}
+}
+
+// Handlers returns the human and machine handlers of h.
+func (h *SplitHandler) Handlers() []Handler {
+	return []Handler{h.human, h.machine}
+}
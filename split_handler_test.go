@@ -0,0 +1,100 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newSplitLogger returns a Logger sending its records through a
+// SplitHandler with classify to a TextHandler writing to human and a
+// JSONHandler writing to machine, neither with times.
+func newSplitLogger(human, machine io.Writer, humanLevel slog.Level, classify func(slog.Record) Class) Logger {
+	h := NewSplitHandler(
+		NewTextHandlerWithOptions(human, &HandlerOptions{NoColor: true, HandlerOptions: slog.HandlerOptions{Level: humanLevel}}),
+		NewJSONHandler(machine, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		classify,
+	)
+	return New(&Options{
+		Writer:     io.Discard,
+		Clock:      func() time.Time { return time.Time{} },
+		NewHandler: func(io.Writer, *slog.HandlerOptions) slog.Handler { return h },
+	})
+}
+
+func TestSplitHandler(t *testing.T) {
+	var human, machine bytes.Buffer
+	l := newSplitLogger(&human, &machine, slog.LevelInfo, nil)
+	l.Info("downloading", "file", "a.tar")
+	l.Info(Event("download_done"), "file", "a.tar", "bytes", 1024)
+	job := l.With("job", 7).WithGroup("step")
+	job.Warn("retrying", "attempt", 2)
+	job.Info(Event("step_done"), "ms", 30)
+	l.Debug("hidden from the human stream")
+	l.Debug(Event("debug_event"))
+
+	if got, want := splitLines(human.String()), []string{
+		`|  INFO | downloading file="a.tar" `,
+		`|  WARN | retrying job=7 step.attempt=2 `,
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("human stream:\ngot  %q\nwant %q", got, want)
+	}
+	if got, want := splitLines(machine.String()), []string{
+		`{"level":"INFO","event":"download_done","msg":"download_done","file":"a.tar","bytes":1024}`,
+		`{"level":"INFO","event":"step_done","msg":"step_done","job":7,"step":{"ms":30}}`,
+		`{"level":"DEBUG","event":"debug_event","msg":"debug_event"}`,
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("machine stream:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestSplitHandlerClassify(t *testing.T) {
+	var human, machine bytes.Buffer
+	l := newSplitLogger(&human, &machine, slog.LevelInfo, func(r slog.Record) Class {
+		switch {
+		case r.Level >= slog.LevelError:
+			return ClassBoth
+		case r.Level >= slog.LevelWarn:
+			return ClassMachine
+		}
+		return ClassHuman
+	})
+	l.Info("one")
+	l.Warn("two")
+	l.Error("three")
+	if got, want := splitLines(human.String()), []string{"|  INFO | one ", "| ERROR | three "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("human stream: got %q, want %q", got, want)
+	}
+	if got, want := splitLines(machine.String()), []string{
+		`{"level":"WARN","msg":"two"}`,
+		`{"level":"ERROR","msg":"three"}`,
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("machine stream: got %q, want %q", got, want)
+	}
+}
+
+func TestSplitHandlerAlways(t *testing.T) {
+	var human, machine bytes.Buffer
+	l := newSplitLogger(&human, &machine, slog.LevelError, nil)
+	l.Always("starting")
+	if human.String() != "|  INFO | starting \n" || machine.Len() != 0 {
+		t.Errorf("human stream %q, machine stream %q", human.String(), machine.String())
+	}
+	if h := NewSplitHandler(NewRingHandler(1), NewRingHandler(1), nil); !h.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("not enabled when one of the handlers is")
+	}
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range bytes.Split(bytes.TrimSuffix([]byte(s), []byte("\n")), []byte("\n")) {
+		if len(line) > 0 {
+			lines = append(lines, string(line))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,80 @@
+package log
+
+import (
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// StackKey is the key used for the call stack attached to
+// records logged by [Logger.Panic] and [Logger.Fatal].
+const StackKey = "stack"
+
+// maxStackDepth caps the number of frames captured for a stack.
+const maxStackDepth = 32
+
+// Stack is a captured call stack, innermost frame first.
+// Handlers in this package render it as an indented block.
+type Stack []runtime.Frame
+
+// String returns the stack in the layout used by runtime/debug.Stack.
+func (s Stack) String() string {
+	var b strings.Builder
+	for i, f := range s {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(f.Function)
+		b.WriteString("\n\t")
+		b.WriteString(f.File)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(f.Line))
+	}
+	return b.String()
+}
+
+// stackValue returns the Stack held by v, if any. The kind is checked
+// first: Any boxes the values of the other kinds.
+func stackValue(v slog.Value) (Stack, bool) {
+	if v.Kind() != slog.KindAny {
+		return nil, false
+	}
+	st, ok := v.Any().(Stack)
+	return st, ok
+}
+
+// stackWrappers are the functions of this package that sit between the
+// caller and captureStack; they are left out of captured stacks.
+var stackWrappers = map[string]bool{
+	"zestack.dev/log.(*logger).Panic": true,
+	"zestack.dev/log.(*logger).Fatal": true,
+	"zestack.dev/log.Panic":           true,
+	"zestack.dev/log.Fatal":           true,
+}
+
+// captureStack returns the stack of its caller's caller, leaving out the
+// leading frames that belong to the logging wrappers of this package.
+func captureStack() Stack {
+	var pcs [maxStackDepth]uintptr
+	// skip [runtime.Callers, this function]
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack Stack
+	skipping := true
+	for {
+		f, more := frames.Next()
+		if skipping && stackWrappers[f.Function] {
+			if !more {
+				break
+			}
+			continue
+		}
+		skipping = false
+		stack = append(stack, f)
+		if !more {
+			break
+		}
+	}
+	return stack
+}
@@ -0,0 +1,95 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recoverPanic calls fn and returns the *PanicError it panics with.
+func recoverPanic(t *testing.T, fn func()) (pe *PanicError) {
+	t.Helper()
+	defer func() {
+		var ok bool
+		if pe, ok = recover().(*PanicError); !ok {
+			t.Fatalf("got no *PanicError")
+		}
+	}()
+	fn()
+	return nil
+}
+
+func checkStack(t *testing.T, st Stack, caller string) {
+	t.Helper()
+	if len(st) == 0 {
+		t.Fatal("empty stack")
+	}
+	if !strings.HasPrefix(st[0].Function, caller) {
+		t.Errorf("innermost frame is %s, want %s", st[0].Function, caller)
+	}
+	for _, f := range st {
+		if stackWrappers[f.Function] {
+			t.Errorf("the stack holds the wrapper %s", f.Function)
+		}
+	}
+	if len(st) < 2 {
+		t.Errorf("got %d frames, want the whole stack", len(st))
+	}
+}
+
+func TestPanicStack(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&Options{Writer: &buf, NoColor: true})
+	pe := recoverPanic(t, func() { l.Panic("boom") })
+	checkStack(t, pe.Stack, "zestack.dev/log.TestPanicStack")
+	if !strings.Contains(buf.String(), "\n  stack:\n    zestack.dev/log.TestPanicStack") {
+		t.Errorf("the stack isn't rendered as a block:\n%s", buf.String())
+	}
+}
+
+func TestPanicStackDefault(t *testing.T) {
+	defer SetDefault(Default())
+	SetDefault(New(&Options{Writer: &bytes.Buffer{}}))
+	pe := recoverPanic(t, func() { Panic("boom") })
+	checkStack(t, pe.Stack, "zestack.dev/log.TestPanicStackDefault")
+}
+
+func TestIndentHandlerStack(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewIndentHandler(&buf, nil)
+	r := slog.NewRecord(time.Time{}, slog.LevelError, "failed", 0)
+	r.AddAttrs(slog.Any(StackKey, captureStack()))
+	h.Handle(context.Background(), r)
+	if !strings.Contains(buf.String(), "- zestack.dev/log.TestIndentHandlerStack") {
+		t.Errorf("the stack isn't rendered as a list of frames:\n%s", buf.String())
+	}
+}
+
+func TestStackValueAllocs(t *testing.T) {
+	values := []slog.Value{
+		slog.StringValue("text"),
+		slog.IntValue(42),
+		slog.TimeValue(time.Now()),
+		slog.DurationValue(time.Second),
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, v := range values {
+			if _, ok := stackValue(v); ok {
+				t.Fatal("found a stack")
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("stackValue allocates %v times for scalar values, want 0", allocs)
+	}
+	if _, ok := stackValue(slog.AnyValue(Stack{})); !ok {
+		t.Error("stackValue doesn't find a Stack")
+	}
+	if _, ok := stackValue(slog.AnyValue(errors.New("x"))); ok {
+		t.Error("stackValue finds a Stack in an error")
+	}
+}
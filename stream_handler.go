@@ -0,0 +1,231 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// Defaults of StreamOptions.
+const (
+	streamReplay       = 100
+	streamClientBuffer = 256
+)
+
+// StreamOptions are options for a [StreamHandler].
+type StreamOptions struct {
+	HandlerOptions
+
+	// Replay is the number of recent records sent to each client when it
+	// connects. If zero, 100 are; if negative, none are.
+	Replay int
+
+	// ClientBuffer is the number of records held for a client that has
+	// yet to receive them. A client falling further behind is
+	// disconnected. If zero, 256 is used.
+	ClientBuffer int
+}
+
+// StreamHandler streams records to browsers, for live log viewing. It is
+// both a handler, formatting records as a JSONHandler does, and an
+// http.Handler serving them as Server-Sent Events, one event per record:
+//
+//	stream := log.NewStreamHandler(nil)
+//	log.SetDefault(log.New(&log.Options{NewHandler: func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+//		return log.NewMultiHandler(log.NewTextHandler(w, opts), stream)
+//	}}))
+//	http.Handle("/logs", stream)
+//
+// and in the browser:
+//
+//	new EventSource("/logs").onmessage = e => console.log(JSON.parse(e.data))
+//
+// A client connecting is first sent the most recent records. Handle never
+// waits for the clients: each has a bounded buffer, and a client that
+// falls behind is disconnected, EventSource reconnecting it by itself.
+type StreamHandler struct {
+	h slog.Handler
+	s *stream
+}
+
+// stream is the writer of the JSONHandler of a StreamHandler, which
+// broadcasts each record written to the clients. It is shared by the
+// handlers derived from it.
+type stream struct {
+	opts StreamOptions
+
+	mu      sync.Mutex
+	recent  [][]byte // oldest first
+	clients map[*streamClient]struct{}
+	closed  bool
+}
+
+// streamClient is a connected client.
+type streamClient struct {
+	events chan []byte
+	gone   chan struct{} // closed when disconnected by the stream
+}
+
+// NewStreamHandler returns a StreamHandler formatting records with opts.
+func NewStreamHandler(opts *slog.HandlerOptions) *StreamHandler {
+	return NewStreamHandlerWithOptions(&StreamOptions{HandlerOptions: *handlerOptions(opts)})
+}
+
+// NewStreamHandlerWithOptions is like [NewStreamHandler] but accepts the
+// extended options of this package.
+func NewStreamHandlerWithOptions(opts *StreamOptions) *StreamHandler {
+	s := &stream{clients: make(map[*streamClient]struct{})}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.Replay == 0 {
+		s.opts.Replay = streamReplay
+	}
+	if s.opts.ClientBuffer <= 0 {
+		s.opts.ClientBuffer = streamClientBuffer
+	}
+	return &StreamHandler{h: NewJSONHandlerWithOptions(s, &s.opts.HandlerOptions), s: s}
+}
+
+// Write broadcasts one record, as written by the JSONHandler.
+func (s *stream) Write(p []byte) (int, error) {
+	event := append([]byte("data: "), bytes.TrimRight(p, "\n")...)
+	event = append(event, "\n\n"...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opts.Replay > 0 {
+		if len(s.recent) == s.opts.Replay {
+			s.recent[0] = nil
+			s.recent = s.recent[1:]
+		}
+		s.recent = append(s.recent, event)
+	}
+	for c := range s.clients {
+		select {
+		case c.events <- event:
+		default:
+			s.disconnect(c)
+		}
+	}
+	return len(p), nil
+}
+
+// disconnect forgets c. It is called with mu held.
+func (s *stream) disconnect(c *streamClient) {
+	delete(s.clients, c)
+	close(c.gone)
+}
+
+func (h *StreamHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.h.Enabled(ctx, level)
+}
+
+func (h *StreamHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.h.Handle(ctx, r)
+}
+
+func (h *StreamHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &StreamHandler{h: h.h.WithAttrs(attrs), s: h.s}
+}
+
+func (h *StreamHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &StreamHandler{h: h.h.WithGroup(name), s: h.s}
+}
+
+// ServeHTTP streams the records to the client, as Server-Sent Events,
+// until it goes away, falls behind, or the handler is closed.
+func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	s := h.s
+	c := &streamClient{
+		events: make(chan []byte, s.opts.ClientBuffer),
+		gone:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		http.Error(w, "stream closed", http.StatusServiceUnavailable)
+		return
+	}
+	// The recent records are taken with the client registered, so that
+	// none is missed or sent twice.
+	recent := slices.Clone(s.recent)
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if _, ok := s.clients[c]; ok {
+			s.disconnect(c)
+		}
+		s.mu.Unlock()
+	}()
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range recent {
+		if _, err := w.Write(event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	for {
+		select {
+		case event := <-c.events:
+			if _, err := w.Write(event); err != nil {
+				return
+			}
+			// Write what else is pending before flushing.
+			for n := len(c.events); n > 0; n-- {
+				if _, err := w.Write(<-c.events); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		case <-c.gone:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Clients returns the number of clients connected.
+func (h *StreamHandler) Clients() int {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	return len(h.s.clients)
+}
+
+// Close disconnects the clients. Clients connecting afterwards are
+// refused.
+func (h *StreamHandler) Close() error {
+	s := h.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for c := range s.clients {
+		s.disconnect(c)
+	}
+	return nil
+}
+
+// Unwrap returns the JSONHandler formatting the records of h.
+func (h *StreamHandler) Unwrap() Handler {
+	return h.h
+}
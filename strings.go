@@ -0,0 +1,47 @@
+package log
+
+// Strings are the fixed texts the handlers of this package add to the
+// output, so that they can be translated or kept to ASCII. Empty fields
+// fall back to the ones of DefaultStrings.
+type Strings struct {
+	// WrapMarker ends the first line of a message spanning several lines.
+	WrapMarker string
+	// Continuation starts the following lines of such a message.
+	Continuation string
+	// Repeated stands for the RepeatedKey attribute of the summary of a
+	// run of identical records passed by a DedupHandler, with %d standing
+	// for the number of records left out.
+	Repeated string
+}
+
+// DefaultStrings are the texts used when HandlerOptions.Strings is nil.
+var DefaultStrings = Strings{
+	WrapMarker:   "↲",
+	Continuation: "> ",
+	Repeated:     "last message repeated %d times",
+}
+
+// ASCIIStrings are texts equivalent to DefaultStrings using ASCII only.
+var ASCIIStrings = Strings{
+	WrapMarker:   "\\",
+	Continuation: "> ",
+	Repeated:     "last message repeated %d times",
+}
+
+// resolve returns a copy of s with its empty fields set from
+// DefaultStrings. A nil s yields DefaultStrings.
+func (s *Strings) resolve() *Strings {
+	r := DefaultStrings
+	if s == nil {
+		return &r
+	}
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&r.WrapMarker, s.WrapMarker)
+	set(&r.Continuation, s.Continuation)
+	set(&r.Repeated, s.Repeated)
+	return &r
+}
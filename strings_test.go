@@ -0,0 +1,76 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+)
+
+// stringsRecords handles with h a message of several lines, then a run of
+// repeated records collapsed by a DedupHandler.
+func stringsRecords(t *testing.T, h slog.Handler) {
+	t.Helper()
+	clock := newFakeClock()
+	d := NewDedupHandler(h, DedupOptions{Window: time.Hour, Clock: clock.now})
+	defer d.Close()
+	ctx := context.Background()
+	d.Handle(ctx, slog.NewRecord(clock.now(), slog.LevelError, "sync failed:\nconnection reset", 0))
+	for i := 0; i < 4; i++ {
+		clock.advance(time.Second)
+		d.Handle(ctx, slog.NewRecord(clock.now(), slog.LevelError, "connection refused", 0))
+	}
+	if err := d.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStringsOverride(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewTextHandlerWithOptions(&buf, &HandlerOptions{NoColor: true}, WithStrings(Strings{
+		WrapMarker:   "[more]",
+		Continuation: "| ",
+		Repeated:     "(%dx)",
+	}))
+	stringsRecords(t, h)
+	got := buf.String()
+	for _, want := range []string{"[more]", "| connection reset", "connection refused (3x)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("the output lacks %q:\n%s", want, got)
+		}
+	}
+	for _, def := range []string{DefaultStrings.WrapMarker, DefaultStrings.Continuation, "repeated"} {
+		if strings.Contains(got, def) {
+			t.Errorf("the default %q leaks into the output:\n%s", def, got)
+		}
+	}
+}
+
+func TestStringsDefault(t *testing.T) {
+	var buf bytes.Buffer
+	stringsRecords(t, NewTextHandlerWithOptions(&buf, &HandlerOptions{NoColor: true}))
+	if !strings.Contains(buf.String(), "connection refused last message repeated 3 times") {
+		t.Errorf("no summary of the repeats:\n%s", buf.String())
+	}
+}
+
+func TestASCIIStrings(t *testing.T) {
+	var buf bytes.Buffer
+	stringsRecords(t, NewTextHandlerWithOptions(&buf, &HandlerOptions{NoColor: true}, WithStrings(ASCIIStrings)))
+	for _, r := range buf.String() {
+		if r > unicode.MaxASCII {
+			t.Fatalf("non-ASCII %q in the output:\n%s", r, buf.String())
+		}
+	}
+}
+
+func TestRepeatsInJSON(t *testing.T) {
+	var buf bytes.Buffer
+	stringsRecords(t, NewJSONHandler(&buf, nil))
+	if !strings.Contains(buf.String(), `"msg":"connection refused","repeated":3}`) {
+		t.Errorf("the repeats aren't a number:\n%s", buf.String())
+	}
+}
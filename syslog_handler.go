@@ -0,0 +1,323 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Facility is a syslog facility, which tells the syslog daemon what kind
+// of program sent a message.
+type Facility int
+
+// The facilities of RFC 5424, except the kernel's, which programs
+// can't use.
+const (
+	FacilityUser     Facility = 1
+	FacilityMail     Facility = 2
+	FacilityDaemon   Facility = 3
+	FacilityAuth     Facility = 4
+	FacilitySyslog   Facility = 5
+	FacilityLPR      Facility = 6
+	FacilityNews     Facility = 7
+	FacilityUUCP     Facility = 8
+	FacilityCron     Facility = 9
+	FacilityAuthPriv Facility = 10
+	FacilityFTP      Facility = 11
+	FacilityLocal0   Facility = 16
+	FacilityLocal1   Facility = 17
+	FacilityLocal2   Facility = 18
+	FacilityLocal3   Facility = 19
+	FacilityLocal4   Facility = 20
+	FacilityLocal5   Facility = 21
+	FacilityLocal6   Facility = 22
+	FacilityLocal7   Facility = 23
+)
+
+// syslogAttrsID is the SD-ID of the attributes outside of any group.
+const syslogAttrsID = "attrs"
+
+// syslogTimeFormat is the RFC 5424 timestamp, which allows at most six
+// digits of fractional seconds.
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// SyslogOptions are options for a [SyslogHandler].
+type SyslogOptions struct {
+	HandlerOptions
+
+	// Facility is the facility of the messages. If zero, FacilityUser
+	// is used.
+	Facility Facility
+
+	// AppName is the APP-NAME of the messages. If empty, the base name
+	// of the program is used.
+	AppName string
+
+	// Hostname is the HOSTNAME of the messages. If empty, the name
+	// reported by os.Hostname is used.
+	Hostname string
+
+	// EnterpriseID, if set, is appended to the SD-IDs after an "@", as
+	// RFC 5424 requires of the SD-IDs that are not registered with IANA.
+	EnterpriseID string
+}
+
+// SyslogHandler sends records to a syslog daemon in the format of
+// RFC 5424:
+//
+//	<14>1 2024-06-01T12:00:00.000000Z host app 1234 - [attrs user="alice"][req id="42"] hello
+//
+// The levels of this package map to the syslog severities: TRACE and
+// DEBUG to debug, INFO to info, WARN to warning, ERROR to err, PANIC to
+// crit and FATAL to alert. The attributes of a record become the
+// STRUCTURED-DATA of the message: those outside of any group go into an
+// element with SD-ID "attrs", and those of a group into an element named
+// after the dot-joined names of the group and its parents.
+//
+// When writing a message fails, the handler reconnects and tries once
+// more. Close releases the connection; to close it when the program
+// exits through Logger.Fatal, register Close with [RegisterExitHook].
+type SyslogHandler struct {
+	opts   SyslogOptions
+	conn   *netConn
+	header string      // HOSTNAME APP-NAME PROCID MSGID, with spaces
+	elems  []sdElement // data from WithAttrs, one element per group
+	groups []string
+}
+
+// sdElement is an SD-ELEMENT under construction.
+type sdElement struct {
+	id     string
+	params []byte // ` name="value"` for each SD-PARAM
+}
+
+// NewSyslogHandler connects to the syslog daemon listening on addr, with
+// network "udp", "tcp", "unix" or "unixgram", and returns a SyslogHandler
+// sending records to it. If network is empty, it connects to the local
+// daemon through its usual Unix socket. If opts is nil, the default
+// options are used.
+func NewSyslogHandler(network, addr string, opts *SyslogOptions) (*SyslogHandler, error) {
+	h := &SyslogHandler{}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelInfo
+	}
+	if h.opts.Facility == 0 {
+		h.opts.Facility = FacilityUser
+	}
+	if h.opts.AppName == "" && len(os.Args) > 0 {
+		h.opts.AppName = os.Args[0][strings.LastIndexAny(os.Args[0], `/\`)+1:]
+	}
+	if h.opts.Hostname == "" {
+		h.opts.Hostname, _ = os.Hostname()
+	}
+	h.header = syslogName(h.opts.Hostname, 255) + " " +
+		syslogName(h.opts.AppName, 48) + " " +
+		strconv.Itoa(os.Getpid()) + " - "
+	conn, err := newNetConn("syslog", func() (net.Conn, error) {
+		return dialSyslog(network, addr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	h.conn = conn
+	return h, nil
+}
+
+// dialSyslog connects to the syslog daemon listening on addr, or to the
+// local one if network is empty.
+func dialSyslog(network, addr string) (net.Conn, error) {
+	if network != "" {
+		return net.Dial(network, addr)
+	}
+	var err error
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+			var conn net.Conn
+			if conn, err = net.Dial(network, path); err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, errors.New("log: no local syslog daemon found: " + err.Error())
+}
+
+func (h *SyslogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *SyslogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+func (h *SyslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.elems = slices.Clone(h.elems)
+	for _, a := range attrs {
+		h2.elems = h.appendAttr(h2.elems, h.groups, a)
+	}
+	return &h2
+}
+
+func (h *SyslogHandler) Handle(_ context.Context, r slog.Record) error {
+	elems := slices.Clone(h.elems)
+	h.opts.recordAttrs(r, func(a slog.Attr) bool {
+		elems = h.appendAttr(elems, h.groups, a)
+		return true
+	})
+
+	bufp := allocBuf()
+	buf := *bufp
+	defer func() {
+		*bufp = buf
+		freeBuf(bufp)
+	}()
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(h.opts.Facility)*8+int64(syslogSeverity(r.Level)), 10)
+	buf = append(buf, ">1 "...)
+	if r.Time.IsZero() {
+		buf = append(buf, '-')
+	} else {
+		buf = r.Time.AppendFormat(buf, syslogTimeFormat)
+	}
+	buf = append(buf, ' ')
+	buf = append(buf, h.header...)
+	if len(elems) == 0 {
+		buf = append(buf, '-')
+	}
+	for _, e := range elems {
+		buf = append(buf, '[')
+		buf = append(buf, e.id...)
+		if h.opts.EnterpriseID != "" {
+			buf = append(buf, '@')
+			buf = append(buf, h.opts.EnterpriseID...)
+		}
+		buf = append(buf, e.params...)
+		buf = append(buf, ']')
+	}
+	if r.Message != "" {
+		buf = append(buf, ' ')
+		buf = append(buf, r.Message...)
+	}
+	return h.conn.write(func(conn net.Conn) error {
+		msg := buf
+		if isStream(conn) {
+			// Frame the message by its length, as RFC 6587 describes.
+			msg = strconv.AppendInt(nil, int64(len(buf)), 10)
+			msg = append(msg, ' ')
+			msg = append(msg, buf...)
+		}
+		_, err := conn.Write(msg)
+		return err
+	})
+}
+
+// appendAttr adds a to the element of its group in elems, which it may
+// modify but whose params it must not.
+func (h *SyslogHandler) appendAttr(elems []sdElement, groups []string, a slog.Attr) []sdElement {
+	a, ok := h.opts.field(groups, a)
+	if !ok {
+		return elems
+	}
+	var prefix string
+	if len(groups) > 0 {
+		prefix = strings.Join(groups, ".") + "."
+	}
+	return flattenAttr(elems, prefix, a, appendSDParam)
+}
+
+// appendSDParam adds a to the element of the groups of prefix in elems.
+func appendSDParam(elems []sdElement, prefix string, a slog.Attr) []sdElement {
+	id := syslogAttrsID
+	if prefix != "" {
+		id = syslogName(strings.TrimSuffix(prefix, "."), 32)
+	}
+	i := slices.IndexFunc(elems, func(e sdElement) bool { return e.id == id })
+	if i < 0 {
+		elems = append(elems, sdElement{id: id})
+		i = len(elems) - 1
+	}
+	params := slices.Clip(elems[i].params)
+	params = append(params, ' ')
+	params = append(params, syslogName(a.Key, 32)...)
+	params = append(params, `="`...)
+	var value string
+	if a.Value.Kind() == slog.KindString {
+		value = a.Value.String()
+	} else {
+		value = string(appendValue(nil, a.Value))
+	}
+	for _, r := range value {
+		if r == '"' || r == '\\' || r == ']' {
+			params = append(params, '\\')
+		}
+		params = utf8.AppendRune(params, r)
+	}
+	params = append(params, '"')
+	elems[i].params = params
+	return elems
+}
+
+// syslogSeverity returns the syslog severity of a level.
+func syslogSeverity(l slog.Level) int {
+	switch level := parseSlogLevel(l); {
+	case level <= LevelDebug:
+		return 7 // debug
+	case level == LevelInfo:
+		return 6 // info
+	case level == LevelWarn:
+		return 4 // warning
+	case level == LevelError:
+		return 3 // err
+	case level == LevelPanic:
+		return 2 // crit
+	default:
+		return 1 // alert
+	}
+}
+
+// syslogName makes s a valid name of the header or STRUCTURED-DATA,
+// made of at most max printable ASCII characters other than '=', ']',
+// '"' and space, which are replaced by underscores. An empty name is
+// the nil value "-".
+func syslogName(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	b := make([]byte, 0, min(len(s), max))
+	for i := 0; i < len(s) && len(b) < max; i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// Close closes the connection to the syslog daemon. Records handled
+// afterwards return net.ErrClosed.
+func (h *SyslogHandler) Close() error {
+	return h.conn.close()
+}
+
+// LogHealth reports the state of the connection to the syslog daemon.
+func (h *SyslogHandler) LogHealth() ComponentHealth {
+	return h.conn.health()
+}
@@ -0,0 +1,134 @@
+package log
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var syslogTime = time.Date(2024, 6, 1, 12, 0, 0, 123456789, time.UTC)
+
+// logSyslogRecords logs records through h, and returns the messages they
+// are expected to be sent as.
+func logSyslogRecords(t *testing.T, h slog.Handler) []string {
+	t.Helper()
+	header := " host app " + strconv.Itoa(os.Getpid()) + " - "
+	h = h.WithAttrs([]slog.Attr{slog.String("app", "shop")}).WithGroup("req")
+	for _, r := range []slog.Record{
+		slog.NewRecord(syslogTime, slog.LevelInfo, "hello", 0),
+		slog.NewRecord(time.Time{}, LevelFatal.Level(), "", 0),
+		slog.NewRecord(syslogTime, slog.LevelDebug, "quoted", 0),
+	} {
+		switch r.Message {
+		case "hello":
+			r.AddAttrs(slog.Int("id", 42), slog.Group("user", slog.String("name", "ann")))
+		case "quoted":
+			r.AddAttrs(slog.String("q", `a "b" [c] \d`), slog.Any("nil", nil))
+		}
+		if err := h.Handle(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The element of the group from WithGroup and that of a group of
+	// the record are apart, after the element of the attributes outside
+	// of any group.
+	return []string{
+		`<134>1 2024-06-01T12:00:00.123456Z` + header +
+			`[attrs@32473 app="shop"][req@32473 id="42"][req.user@32473 name="ann"] hello`,
+		`<129>1 -` + header + `[attrs@32473 app="shop"]`,
+		`<135>1 2024-06-01T12:00:00.123456Z` + header +
+			`[attrs@32473 app="shop"][req@32473 q="a \"b\" [c\] \\d" nil="<nil>"] quoted`,
+	}
+}
+
+func newTestSyslog(t *testing.T, network, addr string) *SyslogHandler {
+	t.Helper()
+	h, err := NewSyslogHandler(network, addr, &SyslogOptions{
+		HandlerOptions: HandlerOptions{HandlerOptions: slog.HandlerOptions{Level: LevelTrace}},
+		Facility:       FacilityLocal0,
+		AppName:        "app",
+		Hostname:       "host",
+		EnterpriseID:   "32473",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// Over UDP, each message is a datagram of its own.
+func TestSyslogHandlerUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	want := logSyslogRecords(t, newTestSyslog(t, "udp", pc.LocalAddr().String()))
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64<<10)
+	for i, w := range want {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != w {
+			t.Errorf("message %d:\ngot  %s\nwant %s", i, got, w)
+		}
+	}
+}
+
+// Over TCP, the messages are framed by their length, as in RFC 6587.
+func TestSyslogHandlerTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	want := logSyslogRecords(t, newTestSyslog(t, "tcp", ln.Addr().String()))
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	for i, w := range want {
+		length, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil {
+			t.Fatalf("message %d: length %q", i, length)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(msg); got != w {
+			t.Errorf("message %d:\ngot  %s\nwant %s", i, got, w)
+		}
+	}
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	for _, tt := range []struct {
+		level Level
+		want  int
+	}{
+		{LevelTrace, 7}, {LevelDebug, 7}, {LevelInfo, 6}, {LevelWarn, 4},
+		{LevelError, 3}, {LevelPanic, 2}, {LevelFatal, 1},
+	} {
+		if got := syslogSeverity(tt.level.Level()); got != tt.want {
+			t.Errorf("%v: severity %d, want %d", tt.level, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// ReplayedKey is the key of the attribute marking the records a
+// [TailSamplingHandler] passes late, when an error comes.
+const ReplayedKey = "replayed"
+
+// Defaults of TailSamplingOptions.
+const (
+	tailSamplingRecords = 100
+	tailSamplingBytes   = 64 << 10
+)
+
+// TailSamplingOptions are options for a [TailSamplingHandler].
+type TailSamplingOptions struct {
+	// PassLevel is the level from which records are passed at once. The
+	// records below it are held. If zero, LevelInfo is used.
+	PassLevel Level
+
+	// TriggerLevel is the level from which a record first passes the
+	// records held. If zero, LevelError is used.
+	TriggerLevel Level
+
+	// Records is the number of records held. If zero, 100 are.
+	Records int
+
+	// Bytes bounds the size of the records held, as estimated from their
+	// messages and attributes. If zero, 64 KiB is used.
+	Bytes int
+}
+
+// TailSamplingHandler holds the last records below a level, such as DEBUG,
+// instead of passing them, and passes them only when a record at a higher
+// level, such as ERROR, comes: the context of an error is then logged,
+// without logging DEBUG records all the time. The records held are passed
+// oldest first, before the record triggering them, with a ReplayedKey
+// attribute:
+//
+//	DEBUG connecting addr=db:5432 replayed=true
+//	DEBUG retrying attempt=2 replayed=true
+//	ERROR connection failed
+//
+// The records at or above PassLevel, and those logged with
+// [Logger.Always], are passed at once. The records held are the last ones
+// of all goroutines, within the number and size bounds of the options.
+//
+// Enabled reports true for the levels below PassLevel, whatever the
+// wrapped handler, which is passed the records held even if it isn't
+// enabled for their level.
+type TailSamplingHandler struct {
+	next slog.Handler
+	t    *tailSampler
+}
+
+// tailSampler is the state shared by a TailSamplingHandler and the
+// handlers derived from it.
+type tailSampler struct {
+	opts TailSamplingOptions
+
+	mu    sync.Mutex
+	held  []heldRecord // oldest first
+	bytes int          // total size of held
+}
+
+// heldRecord is a record held, with the handler to pass it to.
+type heldRecord struct {
+	h    slog.Handler
+	r    slog.Record
+	size int
+}
+
+// NewTailSamplingHandler returns a TailSamplingHandler passing records to
+// next.
+func NewTailSamplingHandler(next slog.Handler, opts TailSamplingOptions) *TailSamplingHandler {
+	if opts.PassLevel == 0 {
+		opts.PassLevel = LevelInfo
+	}
+	if opts.TriggerLevel == 0 {
+		opts.TriggerLevel = LevelError
+	}
+	if opts.Records <= 0 {
+		opts.Records = tailSamplingRecords
+	}
+	if opts.Bytes <= 0 {
+		opts.Bytes = tailSamplingBytes
+	}
+	return &TailSamplingHandler{next: next, t: &tailSampler{opts: opts}}
+}
+
+func (h *TailSamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level < h.t.opts.PassLevel.Level() || h.next.Enabled(ctx, level)
+}
+
+func (h *TailSamplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	t := h.t
+	if IsForced(ctx) || r.Level >= t.opts.PassLevel.Level() {
+		if r.Level < t.opts.TriggerLevel.Level() {
+			return h.next.Handle(ctx, r)
+		}
+		err := t.replay(ctx)
+		return errors.Join(err, h.next.Handle(ctx, r))
+	}
+	t.hold(h.next, r)
+	return nil
+}
+
+// hold keeps r, dropping the oldest records held to stay within bounds.
+func (t *tailSampler) hold(h slog.Handler, r slog.Record) {
+	size := len(r.Message) + len(recordKey(r))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.held = append(t.held, heldRecord{h: h, r: r.Clone(), size: size})
+	t.bytes += size
+	drop := 0
+	for len(t.held)-drop > t.opts.Records || t.bytes > t.opts.Bytes && drop < len(t.held)-1 {
+		t.bytes -= t.held[drop].size
+		t.held[drop] = heldRecord{}
+		drop++
+	}
+	t.held = t.held[drop:]
+}
+
+// replay passes the records held, oldest first, and forgets them.
+func (t *tailSampler) replay(ctx context.Context) error {
+	t.mu.Lock()
+	held := t.held
+	t.held, t.bytes = nil, 0
+	t.mu.Unlock()
+	var errs []error
+	for _, hr := range held {
+		hr.r.AddAttrs(slog.Bool(ReplayedKey, true))
+		errs = append(errs, hr.h.Handle(ctx, hr.r))
+	}
+	return errors.Join(errs...)
+}
+
+func (h *TailSamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &TailSamplingHandler{next: h.next.WithAttrs(attrs), t: h.t}
+}
+
+func (h *TailSamplingHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &TailSamplingHandler{next: h.next.WithGroup(name), t: h.t}
+}
+
+// Unwrap returns the handler wrapped by h.
+func (h *TailSamplingHandler) Unwrap() Handler {
+	return h.next
+}
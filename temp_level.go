@@ -0,0 +1,113 @@
+package log
+
+import (
+	"sync"
+)
+
+// components holds the loggers registered with RegisterComponent.
+var components sync.Map // string -> Logger
+
+// RegisterComponent registers l under name, so that its level can be
+// changed by name, as with TempComponentLevel. Registering another
+// Logger under the same name replaces the previous one.
+func RegisterComponent(name string, l Logger) {
+	components.Store(name, l)
+}
+
+// ComponentLogger returns the Logger registered under name, if any.
+func ComponentLogger(name string) (Logger, bool) {
+	l, ok := components.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return l.(Logger), true
+}
+
+// levelStack tracks the temporary levels of one Logger.
+type levelStack struct {
+	base    Level    // level to restore once all changes are undone
+	applied Level    // level last set by the stack
+	entries []*Level // temporary levels, innermost last
+}
+
+var (
+	tempMu     sync.Mutex
+	tempLevels = map[any]*levelStack{}
+)
+
+// levelKey identifies the level of l; loggers derived from one another
+// share their level, and so their temporary changes.
+func levelKey(l Logger) any {
+	if ll, ok := l.(*logger); ok {
+		return ll.level
+	}
+	return l
+}
+
+// TempLevel sets the level of the default Logger to level and returns a
+// function that undoes the change:
+//
+//	undo := log.TempLevel(log.LevelTrace)
+//	defer undo()
+//
+// Temporary changes stack: undoing one restores the level set by the
+// innermost change still in effect, or the original level once all are
+// undone, whatever the order in which they are undone. If SetLevel is
+// called while a temporary change is in effect, SetLevel wins: its level
+// is the one restored once all the changes are undone.
+func TempLevel(level Level) (undo func()) {
+	return tempLevel(Default(), level)
+}
+
+// TempComponentLevel is like TempLevel for the Logger registered under
+// name with RegisterComponent. If there is none, it does nothing.
+// Changes to different components don't affect each other.
+func TempComponentLevel(name string, level Level) (undo func()) {
+	l, ok := ComponentLogger(name)
+	if !ok {
+		return func() {}
+	}
+	return tempLevel(l, level)
+}
+
+func tempLevel(l Logger, level Level) (undo func()) {
+	key := levelKey(l)
+	tempMu.Lock()
+	defer tempMu.Unlock()
+	st := tempLevels[key]
+	if st == nil {
+		st = &levelStack{base: l.Level()}
+		tempLevels[key] = st
+	} else if cur := l.Level(); cur != st.applied {
+		// SetLevel was called in the meantime.
+		st.base = cur
+	}
+	entry := &level
+	st.entries = append(st.entries, entry)
+	st.applied = level
+	l.SetLevel(level)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			tempMu.Lock()
+			defer tempMu.Unlock()
+			if cur := l.Level(); cur != st.applied {
+				st.base = cur
+			}
+			for i, e := range st.entries {
+				if e == entry {
+					st.entries = append(st.entries[:i], st.entries[i+1:]...)
+					break
+				}
+			}
+			if len(st.entries) == 0 {
+				delete(tempLevels, key)
+				l.SetLevel(st.base)
+				return
+			}
+			st.applied = *st.entries[len(st.entries)-1]
+			l.SetLevel(st.applied)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestTempLevelNesting(t *testing.T) {
+	l := New(&Options{Writer: io.Discard, Level: LevelInfo})
+	undoDebug := tempLevel(l, LevelDebug)
+	undoTrace := tempLevel(l, LevelTrace)
+	if got := l.Level(); got != LevelTrace {
+		t.Fatalf("level = %v, want TRACE", got)
+	}
+	undoTrace()
+	if got := l.Level(); got != LevelDebug {
+		t.Errorf("after undoing the inner change, level = %v, want DEBUG", got)
+	}
+	undoTrace() // a second call does nothing
+	if got := l.Level(); got != LevelDebug {
+		t.Errorf("after undoing the inner change twice, level = %v, want DEBUG", got)
+	}
+	undoDebug()
+	if got := l.Level(); got != LevelInfo {
+		t.Errorf("after undoing all changes, level = %v, want INFO", got)
+	}
+}
+
+func TestTempLevelUndoOutOfOrder(t *testing.T) {
+	l := New(&Options{Writer: io.Discard, Level: LevelWarn})
+	undoDebug := tempLevel(l, LevelDebug)
+	undoTrace := tempLevel(l, LevelTrace)
+	undoDebug()
+	if got := l.Level(); got != LevelTrace {
+		t.Errorf("after undoing the outer change, level = %v, want TRACE", got)
+	}
+	undoTrace()
+	if got := l.Level(); got != LevelWarn {
+		t.Errorf("after undoing all changes, level = %v, want WARN", got)
+	}
+}
+
+func TestTempLevelDerivedLogger(t *testing.T) {
+	l := New(&Options{Writer: io.Discard, Level: LevelInfo})
+	child := l.With("component", "db")
+	undo := tempLevel(child, LevelTrace)
+	undoParent := tempLevel(l, LevelDebug)
+	undo()
+	if got := l.Level(); got != LevelDebug {
+		t.Errorf("level = %v, want DEBUG, as the loggers share their level", got)
+	}
+	undoParent()
+	if got := child.Level(); got != LevelInfo {
+		t.Errorf("level = %v, want INFO", got)
+	}
+}
+
+// SetLevel called while a temporary change is in effect wins: its level is
+// restored once all the changes are undone.
+func TestTempLevelSetLevelWins(t *testing.T) {
+	l := New(&Options{Writer: io.Discard, Level: LevelInfo})
+	undoDebug := tempLevel(l, LevelDebug)
+	l.SetLevel(LevelError)
+	undoTrace := tempLevel(l, LevelTrace)
+	undoTrace()
+	if got := l.Level(); got != LevelDebug {
+		t.Errorf("after undoing the inner change, level = %v, want DEBUG", got)
+	}
+	undoDebug()
+	if got := l.Level(); got != LevelError {
+		t.Errorf("after undoing all changes, level = %v, want ERROR set by SetLevel", got)
+	}
+
+	undo := tempLevel(l, LevelTrace)
+	l.SetLevel(LevelWarn)
+	undo()
+	if got := l.Level(); got != LevelWarn {
+		t.Errorf("after SetLevel then undo, level = %v, want WARN set by SetLevel", got)
+	}
+}
+
+func TestTempLevelDefault(t *testing.T) {
+	before := Default().Level()
+	undo := TempLevel(LevelTrace)
+	if got := Default().Level(); got != LevelTrace {
+		t.Errorf("level = %v, want TRACE", got)
+	}
+	undo()
+	if got := Default().Level(); got != before {
+		t.Errorf("level = %v, want %v", got, before)
+	}
+}
+
+func TestTempComponentLevel(t *testing.T) {
+	if undo := TempComponentLevel("test.none", LevelTrace); undo == nil {
+		t.Fatal("no undo for an unknown component")
+	} else {
+		undo()
+	}
+
+	const n = 8
+	loggers := make([]Logger, n)
+	for i := range loggers {
+		loggers[i] = New(&Options{Writer: io.Discard, Level: LevelInfo})
+		RegisterComponent(fmt.Sprintf("test.temp%d", i), loggers[i])
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("test.temp%d", i)
+			for j := 0; j < 100; j++ {
+				undoDebug := TempComponentLevel(name, LevelDebug)
+				undoTrace := TempComponentLevel(name, LevelTrace)
+				if got := loggers[i].Level(); got != LevelTrace {
+					t.Errorf("%s: level = %v, want TRACE", name, got)
+				}
+				undoTrace()
+				if got := loggers[i].Level(); got != LevelDebug {
+					t.Errorf("%s: level = %v, want DEBUG", name, got)
+				}
+				undoDebug()
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, l := range loggers {
+		if got := l.Level(); got != LevelInfo {
+			t.Errorf("test.temp%d: level = %v, want INFO", i, got)
+		}
+	}
+}
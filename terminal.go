@@ -0,0 +1,39 @@
+package log
+
+import (
+	"io"
+	"os"
+)
+
+// isTerminal reports whether w writes to a terminal. Besides *os.File,
+// it recognizes writers exposing the descriptor of the process's
+// standard output or standard error through an Fd method, and asks the
+// writer handed to handlers by New about the current output.
+func isTerminal(w io.Writer) bool {
+	var f *os.File
+	switch x := w.(type) {
+	case interface{ terminal() bool }:
+		return x.terminal()
+	case *os.File:
+		f = x
+	case interface{ Fd() uintptr }:
+		switch fd := x.Fd(); fd {
+		case os.Stdout.Fd():
+			f = os.Stdout
+		case os.Stderr.Fd():
+			f = os.Stderr
+		}
+	}
+	if f == nil {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// noColorEnv reports whether the NO_COLOR environment variable asks for
+// output without colors, being set and not empty, as described at
+// https://no-color.org.
+func noColorEnv() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
@@ -1,54 +1,173 @@
 package log
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log/slog"
-	"runtime"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
-
-	"zestack.dev/color"
 )
 
 type TextHandler struct {
-	opts         slog.HandlerOptions
-	preformatted []byte   // data from WithGroup and WithAttrs
-	groups       []string // all groups started from WithGroup
+	opts         HandlerOptions
+	preformatted []byte      // data from WithGroup and WithAttrs
+	preColored   bool        // whether preformatted was rendered in color
+	withAttrs    []textAttrs // the attributes of preformatted, to render them without or in color
+	groups       []string    // all groups started from WithGroup
 	mu           *sync.Mutex
-	out          color.Writer
+	out          io.Writer
+	raw          io.Writer   // out as given to the constructor, for probing
+	terminal     func() bool // whether raw writes to a terminal
+	noColorEnv   bool        // whether NO_COLOR was set when h was created
+	msgStyle     []byte      // style of the message being handled, if not StyleDefault
+	colors       Colorizer
+	children     *attrCache
 }
 
+// NewTextHandler creates a TextHandler that writes to out,
+// using the given options. If opts is nil, the default options are used.
 func NewTextHandler(out io.Writer, opts *slog.HandlerOptions) *TextHandler {
-	w, ok := out.(color.Writer)
-	if !ok {
-		w = color.NewWriter(out)
-	}
-	h := &TextHandler{out: w, mu: &sync.Mutex{}}
+	return NewTextHandlerWithOptions(out, handlerOptions(opts))
+}
+
+// TextOptions are the options of a TextHandler: the [slog.HandlerOptions]
+// and the formatting options of this package.
+type TextOptions = HandlerOptions
+
+// TextOption sets one of the [TextOptions], for use with
+// [NewTextHandlerWithOptions].
+type TextOption func(o *TextOptions)
+
+// WithLevel sets the minimum level of the records handled.
+func WithLevel(level slog.Leveler) TextOption {
+	return func(o *TextOptions) { o.Level = level }
+}
+
+// WithSource adds the source location of the logging calls.
+func WithSource() TextOption {
+	return func(o *TextOptions) { o.AddSource = true }
+}
+
+// WithReplaceAttr sets the function rewriting or removing attributes.
+func WithReplaceAttr(fn func(groups []string, a slog.Attr) slog.Attr) TextOption {
+	return func(o *TextOptions) { o.ReplaceAttr = fn }
+}
+
+// WithTimeFormat sets how the record time is rendered.
+func WithTimeFormat(layout TimeLayout) TextOption {
+	return func(o *TextOptions) { o.TimeLayout = &layout }
+}
+
+// WithNoColor disables colors and other terminal escape sequences.
+func WithNoColor() TextOption {
+	return func(o *TextOptions) { o.NoColor = true }
+}
+
+// WithForceColor writes colors even when not writing to a terminal.
+func WithForceColor() TextOption {
+	return func(o *TextOptions) { o.ForceColor = true }
+}
+
+// WithTimeLocation renders times in the time zone loc.
+func WithTimeLocation(loc *time.Location) TextOption {
+	return func(o *TextOptions) { o.TimeLocation = loc }
+}
+
+// WithLevelNames sets the labels of the levels.
+func WithLevelNames(names map[Level]string) TextOption {
+	return func(o *TextOptions) { o.LevelNames = names }
+}
+
+// WithIcons writes icons before the labels of the levels, or in place of
+// them if only is true.
+func WithIcons(icons map[Level]string, only bool) TextOption {
+	return func(o *TextOptions) { o.Icons, o.IconsOnly = icons, only }
+}
+
+// WithSourcePath sets how source locations are rendered, such as with
+// FullSourcePath for the full paths of the files.
+func WithSourcePath(fn func(file string, line int) string) TextOption {
+	return func(o *TextOptions) { o.SourcePath = fn }
+}
+
+// WithSourceFunc adds the name of the function to source locations.
+func WithSourceFunc() TextOption {
+	return func(o *TextOptions) { o.SourceFunc = true }
+}
+
+// WithSortAttrs renders the attributes of each record sorted by key.
+func WithSortAttrs() TextOption {
+	return func(o *TextOptions) { o.SortAttrs = true }
+}
+
+// WithShortSource renders source locations as directory and file name.
+func WithShortSource() TextOption {
+	return func(o *TextOptions) { o.ShortSource = true }
+}
+
+// WithColorizer sets how the styles are rendered.
+func WithColorizer(c Colorizer) TextOption {
+	return func(o *TextOptions) { o.Colorizer = c }
+}
+
+// WithStrings sets the fixed texts added to the output.
+func WithStrings(s Strings) TextOption {
+	return func(o *TextOptions) { o.Strings = &s }
+}
+
+// NewTextHandlerWithOptions is like [NewTextHandler] but accepts the
+// extended options of this package, then changed by each of with:
+//
+//	h := log.NewTextHandlerWithOptions(os.Stderr, nil, log.WithSource(), log.WithNoColor())
+//
+// opts itself is left unchanged, and may be nil.
+func NewTextHandlerWithOptions(out io.Writer, opts *TextOptions, with ...TextOption) *TextHandler {
+	h := &TextHandler{raw: out, mu: &sync.Mutex{}, children: new(attrCache)}
 	if opts != nil {
 		h.opts = *opts
 	}
+	for _, fn := range with {
+		fn(&h.opts)
+	}
+	h.colors = h.opts.colorizer()
+	// A logger's output may change, the others are asked about once.
+	h.terminal = sync.OnceValue(func() bool { return isTerminal(out) })
+	if t, ok := out.(interface{ terminal() bool }); ok {
+		h.terminal = t.terminal
+	}
+	h.noColorEnv = noColorEnv()
+	h.out = out
+	if !h.opts.RawWriter {
+		h.out = newTextWriter(out, h.colors)
+	}
 	if h.opts.Level == nil {
 		h.opts.Level = slog.LevelInfo
 	}
+	h.opts.shortSourceByDefault()
+	h.opts.Strings = h.opts.Strings.resolve()
 	return h
 }
 
+// clone returns a copy of h, with all its options, for a handler derived
+// from it.
 func (h *TextHandler) clone() TextHandler {
-	return TextHandler{
-		opts:         h.opts,
-		preformatted: h.preformatted[:],
-		groups:       h.groups[:],
-		mu:           h.mu,
-		out:          h.out,
-	}
+	h2 := *h
+	h2.msgStyle = nil
+	h2.children = new(attrCache)
+	return h2
 }
 
+// Enabled reports whether level is at least the minimum level of h, and
+// its output, such as a Logger's set with SetOutput, isn't io.Discard.
 func (h *TextHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if discards(h.raw) {
+		return false
+	}
 	minLevel := slog.LevelInfo
 	if h.opts.Level != nil {
 		minLevel = h.opts.Level.Level()
@@ -73,14 +192,24 @@ func (h *TextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 		return h
 	}
 	h2 := *h
-	// Force an append to copy the underlying array.
-	h2.preformatted = slices.Clip(h.preformatted)
+	h2.children = new(attrCache)
 	h2.groups = slices.Clip(h.groups)
-	// Pre-format the attributes.
+	h2.withAttrs = append(slices.Clip(h.withAttrs), textAttrs{h2.groups, attrs})
+	// Pre-format the attributes, in the palette of the moment, those of h
+	// again if they were rendered in the other one.
+	colored := h.colored()
+	if colored == h.preColored {
+		// Force an append to copy the underlying array.
+		h2.preformatted = slices.Clip(h.preformatted)
+	} else {
+		h2.preformatted = h.palette(colored).appendWithAttrs(nil)
+	}
+	h2.preColored = colored
+	r := h2.palette(colored)
 	for _, a := range attrs {
-		h2.preformatted = h2.appendAttr(h2.preformatted, a)
+		h2.preformatted = r.appendAttr(h2.preformatted, a)
 	}
-	return &h2
+	return h.children.intern(h2.preformatted, &h2)
 }
 
 func (h *TextHandler) Handle(_ context.Context, r slog.Record) error {
@@ -90,38 +219,50 @@ func (h *TextHandler) Handle(_ context.Context, r slog.Record) error {
 		*bufp = buf
 		freeBuf(bufp)
 	}()
+	colored := h.colored()
+	h = h.palette(colored)
+	if h.opts.ColorMessageByLevel {
+		h2 := *h
+		h2.msgStyle = h.colors.Start(levelStyle(parseSlogLevel(r.Level)))
+		h = &h2
+	}
 	if !r.Time.IsZero() {
-		buf = h.appendAttr(buf, slog.Time(slog.TimeKey, r.Time))
-	}
-	buf = h.appendAttr(buf, slog.Any(slog.LevelKey, r.Level))
-	buf = h.appendAttr(buf, slog.String(slog.MessageKey, r.Message))
-	if h.opts.AddSource {
-		fs := runtime.CallersFrames([]uintptr{r.PC})
-		f, _ := fs.Next()
-		// Optimize to minimize allocation.
-		srcbufp := allocBuf()
-		defer freeBuf(srcbufp)
-		*srcbufp = append(*srcbufp, f.File...)
-		*srcbufp = append(*srcbufp, ':')
-		*srcbufp = strconv.AppendInt(*srcbufp, int64(f.Line), 10)
+		buf = h.appendBuiltinAttr(buf, slog.Time(slog.TimeKey, r.Time))
+	}
+	buf = h.appendBuiltinAttr(buf, slog.Any(slog.LevelKey, r.Level))
+	if ev, ok := recordEvent(r); ok {
+		buf = h.appendBuiltinAttr(buf, ev)
+	}
+	buf = h.appendBuiltinAttr(buf, slog.String(slog.MessageKey, r.Message))
+	if h.opts.AddSource && r.PC != 0 {
 		if strings.Contains(r.Message, "\n") {
 			buf = append(buf, ' ')
 		}
-		buf = h.appendAttr(buf, slog.String(slog.SourceKey, string(*srcbufp)))
+		buf = h.appendBuiltinAttr(buf, slog.String(slog.SourceKey, h.opts.source(r.PC)))
+	}
+	if t := h.opts.handledAt(); !t.IsZero() {
+		buf = h.appendBuiltinAttr(buf, slog.Time(HandledAtKey, t))
 	}
-	if h.opts.AddSource && strings.Contains(r.Message, "\n") {
+	if d, ok := h.opts.uptime(); ok {
+		buf = h.appendBuiltinAttr(buf, slog.Duration(UptimeKey, d))
+	}
+	if h.opts.AddSource && r.PC != 0 && strings.Contains(r.Message, "\n") {
 		buf = append(buf, "\n  "...)
 	}
-	buf = append(buf, sDim...)
+	buf = append(buf, h.colors.Start(StyleDim)...)
 	// Insert preformatted attributes just after built-in ones.
-	buf = append(buf, h.preformatted...)
+	if colored == h.preColored {
+		buf = append(buf, h.preformatted...)
+	} else {
+		buf = h.appendWithAttrs(buf)
+	}
 	if r.NumAttrs() > 0 {
-		r.Attrs(func(a slog.Attr) bool {
+		h.opts.attrsAfterEvent(r, func(a slog.Attr) bool {
 			buf = h.appendAttr(buf, a)
 			return true
 		})
 	}
-	buf = append(buf, cReset...)
+	buf = append(buf, h.colors.Start(StyleReset)...)
 	buf = append(buf, "\n"...)
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -129,25 +270,79 @@ func (h *TextHandler) Handle(_ context.Context, r slog.Record) error {
 	return err
 }
 
-var (
-	cHour    = color.New(color.FgBlue)
-	cYear    = color.New(color.FgMagenta)
-	cDim     = color.New(color.FgHiBlack)
-	sDefault = color.Bytes(color.FgHiWhite)
-	sDim     = color.Bytes(color.FgHiBlack)
-	cReset   = color.Bytes(color.Reset)
-)
+// colored reports whether h writes colors and other escape sequences:
+// with NoColor, never, with ForceColor, always, and otherwise when writing
+// to a terminal, unless NO_COLOR is set.
+func (h *TextHandler) colored() bool {
+	switch {
+	case h.opts.NoColor:
+		return false
+	case h.opts.ForceColor:
+		return true
+	}
+	return !h.noColorEnv && h.terminal()
+}
+
+// palette returns h, or if colored is false, a copy of h writing no
+// colors or other escape sequences.
+func (h *TextHandler) palette(colored bool) *TextHandler {
+	if colored {
+		return h
+	}
+	h2 := *h
+	h2.colors = PlainColorizer{}
+	return &h2
+}
+
+// textAttrs are the attributes of a call to WithAttrs, and the groups
+// they are in.
+type textAttrs struct {
+	groups []string
+	attrs  []slog.Attr
+}
+
+// appendWithAttrs renders again the attributes from WithAttrs, for the
+// output to change from color to none, or back, after they were
+// preformatted.
+func (h *TextHandler) appendWithAttrs(buf []byte) []byte {
+	h2 := *h
+	for _, c := range h.withAttrs {
+		h2.groups = c.groups
+		for _, a := range c.attrs {
+			buf = h2.appendAttr(buf, a)
+		}
+	}
+	return buf
+}
+
+// appendBuiltinAttr appends an attribute that belongs to the record itself
+// rather than to any of the groups opened by WithGroup. Only such
+// attributes get the special rendering of the built-in keys, so that an
+// attribute of the user named "msg", say, is rendered like any other.
+func (h *TextHandler) appendBuiltinAttr(buf []byte, a slog.Attr) []byte {
+	return h.appendAttrOf(buf, a, nil, true)
+}
 
 func (h *TextHandler) appendAttr(buf []byte, a slog.Attr) []byte {
+	return h.appendAttrOf(buf, a, h.groups, false)
+}
+
+// appendAttrOf appends a, within groups, the groups from WithGroup and
+// those of the Group attributes around it. The key is rendered with the
+// groups as a dotted prefix.
+func (h *TextHandler) appendAttrOf(buf []byte, a slog.Attr, groups []string, builtin bool) []byte {
+	// Deal with nil values before resolving them calls any of their methods.
+	a, ok := h.opts.applyNilPolicy(a)
+	if !ok {
+		return buf
+	}
 	// Resolve the Attr's value before doing anything else.
 	a.Value = a.Value.Resolve()
+	a = h.opts.inLocation(a)
+	a = h.opts.replaceGroup(groups, a)
 	if rep := h.opts.ReplaceAttr; rep != nil && a.Value.Kind() != slog.KindGroup {
-		var gs []string
-		if h.groups != nil {
-			gs = h.groups[:]
-		}
 		// a.Value is resolved before calling ReplaceAttr, so the user doesn't have to.
-		a = rep(gs, a)
+		a = rep(groups, a)
 		// The ReplaceAttr function may return an unresolved Attr.
 		a.Value = a.Value.Resolve()
 	}
@@ -155,28 +350,45 @@ func (h *TextHandler) appendAttr(buf []byte, a slog.Attr) []byte {
 	if a.Equal(slog.Attr{}) {
 		return buf
 	}
-	switch a.Key {
-	case slog.TimeKey:
-		ts := strings.SplitN(a.Value.Time().Format(time.DateTime), " ", 2)
-		buf = fmt.Appendf(buf, "%s %s", cYear.Wrap(ts[0]), cHour.Wrap(ts[1]))
-		buf = append(buf, ' ')
-		return buf
-	case slog.LevelKey:
-		level, prepend := levelToColor(a.Value.Any().(slog.Level))
-		buf = fmt.Appendf(buf, "%s %s%s %s", cDim.Wrap("|"), prepend, level, cDim.Wrap("|"))
+	if n, ok := repeatsValue(a.Value); ok && !builtin {
+		buf = append(buf, h.colors.Wrap(StyleDim, fmt.Sprintf(h.opts.Strings.Repeated, n))...)
+		return append(buf, ' ')
+	}
+	switch key := a.Key; {
+	case !builtin:
+		if a.Value.Kind() != slog.KindGroup {
+			buf = append(buf, h.colors.Start(StyleKey)...)
+			for _, g := range groups {
+				buf = fmt.Appendf(buf, "%s.", g)
+			}
+		}
+	case key == slog.TimeKey && a.Value.Kind() == slog.KindTime:
+		return h.appendTime(buf, a.Value.Time())
+	case key == slog.LevelKey && isSlogLevel(a.Value):
+		l := a.Value.Any().(slog.Level)
+		level, prepend := levelToColor(h.colors, l, h.opts.levelLabel(l), h.opts.levelWidth(h.opts.levelLabel))
+		bar := h.colors.Wrap(StyleDim, "|")
+		buf = fmt.Appendf(buf, "%s %s%s %s", bar, prepend, level, bar)
 		buf = append(buf, ' ')
 		return buf
-	case slog.MessageKey:
+	case key == slog.MessageKey:
 		msgbufp := allocBuf()
 		defer freeBuf(msgbufp)
 		var prepend []byte
 		var lines int
 		msg := a.Value.String()
-		buf = append(buf, sDefault...)
+		if h.msgStyle != nil {
+			buf = append(buf, h.msgStyle...)
+		} else {
+			buf = append(buf, h.colors.Start(StyleDefault)...)
+		}
 		for {
 			if lines == 1 {
-				buf = fmt.Appendf(buf, "%s\n", cDim.Wrap("↲"))
-				prepend = append(append(sDim, []byte("  > ")...), cReset...)
+				buf = fmt.Appendf(buf, "%s\n", h.colors.Wrap(StyleDim, h.opts.Strings.WrapMarker))
+				prepend = append(slices.Clip(h.colors.Start(StyleDim)), "  "+h.opts.Strings.Continuation...)
+				prepend = append(prepend, h.colors.Start(StyleReset)...)
+				// Keep continuation lines in the message style.
+				prepend = append(prepend, h.msgStyle...)
 				*msgbufp = append(prepend, *msgbufp...)
 			}
 			*msgbufp = append(*msgbufp, prepend...)
@@ -200,57 +412,163 @@ func (h *TextHandler) appendAttr(buf []byte, a slog.Attr) []byte {
 			lines++
 		}
 		buf = append(buf, *msgbufp...)
-		buf = append(buf, cReset...)
+		buf = append(buf, h.colors.Start(StyleReset)...)
 		return buf
-	case slog.SourceKey:
-		buf = append(buf, cDim.Wrap(a.Key+"=\"").Bytes()...)
-		buf = append(buf, color.Namespace(a.Value.String()).Bytes()...)
-		buf = append(buf, cDim.Wrap("\"").Bytes()...)
+	case key == slog.SourceKey:
+		src := a.Value.String()
+		link := h.sourceLink(src)
+		buf = append(buf, h.colors.Wrap(StyleDim, a.Key+"=\"")...)
+		if link != "" {
+			buf = appendLinkStart(buf, link)
+		}
+		buf = append(buf, h.colors.Wrap(StyleSource, src)...)
+		if link != "" {
+			buf = appendLinkEnd(buf)
+		}
+		buf = append(buf, h.colors.Wrap(StyleDim, "\"")...)
 		buf = append(buf, ' ')
 		return buf
-	default:
-		if a.Value.Kind() != slog.KindGroup {
-			for _, g := range h.groups {
-				buf = fmt.Appendf(buf, "%s.", g)
-			}
-		}
+	}
+	if st, ok := stackValue(a.Value); ok {
+		return h.appendStack(buf, a.Key, st)
 	}
 	switch a.Value.Kind() {
-	case slog.KindString:
-		// Quote string values, to make them easy to parse.
-		buf = append(buf, a.Key...)
-		buf = append(buf, "="...)
-		buf = strconv.AppendQuote(buf, a.Value.String())
-		buf = append(buf, ' ')
-	case slog.KindTime:
-		// Write times in a standard way, without the monotonic time.
-		buf = append(buf, a.Key...)
-		buf = append(buf, "="...)
-		buf = a.Value.Time().AppendFormat(buf, time.RFC3339Nano)
-		buf = append(buf, ' ')
 	case slog.KindGroup:
 		attrs := a.Value.Group()
 		// Ignore empty groups.
 		if len(attrs) == 0 {
 			return buf
 		}
-		// If the key is non-empty, write it out and indent the rest of the attrs.
+		// If the key is non-empty, it prefixes the keys of the attrs.
 		// Otherwise, inline the attrs.
-		prefix := a.Key
 		if a.Key != "" {
-			prefix += "."
+			groups = append(slices.Clip(groups), a.Key)
 		}
 		for _, ga := range attrs {
-			buf = h.appendAttr(buf, slog.Attr{
-				Key:   prefix + ga.Key,
-				Value: ga.Value,
-			})
+			buf = h.appendAttrOf(buf, ga, groups, false)
 		}
+	case slog.KindTime:
+		buf = append(buf, a.Key...)
+		buf = h.appendEquals(buf)
+		buf = h.appendTimeValue(buf, a.Value.Time())
+		buf = h.endValue(buf)
+		buf = append(buf, ' ')
 	default:
 		buf = append(buf, a.Key...)
-		buf = append(buf, "="...)
-		buf = append(buf, a.Value.String()...)
+		buf = h.appendEquals(buf)
+		buf = appendValue(buf, a.Value)
+		buf = h.endValue(buf)
 		buf = append(buf, ' ')
 	}
 	return buf
 }
+
+// keyValueStyled reports whether the colorizer of h sets the keys or the
+// values of the attributes apart from the rest of them.
+func (h *TextHandler) keyValueStyled() bool {
+	return h.colors.Start(StyleKey) != nil || h.colors.Start(StyleValue) != nil
+}
+
+// appendEquals appends the "=" between the key and the value of an
+// attribute, going from the style of the key to that of the value.
+func (h *TextHandler) appendEquals(buf []byte) []byte {
+	if !h.keyValueStyled() {
+		return append(buf, '=')
+	}
+	buf = append(buf, h.colors.Start(StyleReset)...)
+	buf = append(buf, h.colors.Start(StyleDim)...)
+	buf = append(buf, '=')
+	return append(buf, h.colors.Start(StyleValue)...)
+}
+
+// endValue returns to the style of the attributes after a value.
+func (h *TextHandler) endValue(buf []byte) []byte {
+	if !h.keyValueStyled() {
+		return buf
+	}
+	buf = append(buf, h.colors.Start(StyleReset)...)
+	return append(buf, h.colors.Start(StyleDim)...)
+}
+
+// appendTimeValue appends t, the value of an attribute, in the TimeLayout
+// of h if one is set, so that it reads like the record time, quoted if it
+// holds spaces. Otherwise, or if the layout leaves the time out, it is
+// appended as by appendValue.
+func (h *TextHandler) appendTimeValue(buf []byte, t time.Time) []byte {
+	l := h.opts.TimeLayout
+	if l == nil || l.Date == "" && l.Clock == "" {
+		return appendValue(buf, slog.TimeValue(t))
+	}
+	s := l.format(t)
+	if strings.ContainsAny(s, " \"=") {
+		return strconv.AppendQuote(buf, s)
+	}
+	return append(buf, s...)
+}
+
+// appendStack renders a stack as an indented block below the record line.
+func (h *TextHandler) appendStack(buf []byte, key string, st Stack) []byte {
+	buf = append(bytes.TrimRight(buf, " "), '\n')
+	buf = append(buf, h.colors.Start(StyleDim)...)
+	buf = fmt.Appendf(buf, "  %s:", key)
+	for _, f := range st {
+		buf = fmt.Appendf(buf, "\n    %s\n      %s:%d", f.Function, f.File, f.Line)
+	}
+	buf = append(buf, h.colors.Start(StyleReset)...)
+	return buf
+}
+
+// sourceLink returns the target of the hyperlink for the source location
+// src, in the "file:line" form, or "" if no link should be rendered.
+// Links are only rendered to terminals, where they are invisible.
+func (h *TextHandler) sourceLink(src string) string {
+	tmpl := h.opts.SourceLinkTemplate
+	if tmpl == "" || !h.colored() || !h.terminal() {
+		return ""
+	}
+	i := strings.LastIndexByte(src, ':')
+	if i < 0 {
+		return ""
+	}
+	path, line := src[:i], src[i+1:]
+	line, _, _ = strings.Cut(line, " ") // the function, with SourceFunc
+	if _, err := strconv.Atoi(line); err != nil {
+		return ""
+	}
+	return strings.NewReplacer("{path}", path, "{line}", line).Replace(tmpl)
+}
+
+// appendLinkStart opens an OSC 8 hyperlink to url. The sequence takes no
+// room on screen.
+func appendLinkStart(buf []byte, url string) []byte {
+	buf = append(buf, "\x1b]8;;"...)
+	buf = append(buf, url...)
+	return append(buf, "\x1b\\"...)
+}
+
+// appendLinkEnd closes the hyperlink opened by appendLinkStart.
+func appendLinkEnd(buf []byte) []byte {
+	return append(buf, "\x1b]8;;\x1b\\"...)
+}
+
+// appendTime renders the record time as laid out by the TimeLayout option,
+// the date and the clock each in their own color.
+func (h *TextHandler) appendTime(buf []byte, t time.Time) []byte {
+	layout := DefaultTimeLayout
+	if h.opts.TimeLayout != nil {
+		layout = *h.opts.TimeLayout
+	}
+	if layout.Date == "" && layout.Clock == "" {
+		return buf
+	}
+	if layout.Date != "" {
+		buf = append(buf, h.colors.Wrap(StyleDate, formatDate(t, layout.Date))...)
+	}
+	if layout.Date != "" && layout.Clock != "" {
+		buf = append(buf, layout.Separator...)
+	}
+	if layout.Clock != "" {
+		buf = append(buf, h.colors.Wrap(StyleClock, t.Format(layout.Clock))...)
+	}
+	return append(buf, ' ')
+}
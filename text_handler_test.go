@@ -0,0 +1,340 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"zestack.dev/log"
+	"zestack.dev/log/logtest"
+)
+
+var textTestTime = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// textRecords handles with h a Warn record and an Error record with a
+// message of several lines, both with attributes.
+func textRecords(h slog.Handler) {
+	ctx := context.Background()
+	r := slog.NewRecord(textTestTime, slog.LevelWarn, "disk almost full", 0)
+	r.AddAttrs(slog.String("mount", "/var"), slog.Int("free_mb", 512))
+	h.Handle(ctx, r)
+	r = slog.NewRecord(textTestTime, slog.LevelError, "sync failed:\nconnection reset\nretrying later", 0)
+	r.AddAttrs(slog.String("peer", "10.0.0.2"))
+	h.Handle(ctx, r)
+}
+
+func TestTextHandlerColorMessageByLevel(t *testing.T) {
+	var buf bytes.Buffer
+	textRecords(log.NewTextHandlerWithOptions(&buf, &log.HandlerOptions{
+		ColorMessageByLevel: true,
+		Colorizer:           log.BasicANSIColorizer{},
+		ForceColor:          true,
+	}))
+	log.CheckGolden(t, "color_message_by_level.golden", buf.Bytes())
+}
+
+func TestTextHandlerMessageDefaultColor(t *testing.T) {
+	var buf bytes.Buffer
+	textRecords(log.NewTextHandlerWithOptions(&buf, &log.HandlerOptions{Colorizer: log.BasicANSIColorizer{}, ForceColor: true}))
+	if !bytes.Contains(buf.Bytes(), []byte("\x1b[97mdisk almost full")) {
+		t.Errorf("the message isn't in the default style without ColorMessageByLevel:\n%q", buf.Bytes())
+	}
+}
+
+// emptyGroupCases are handlers derived with groups that end up empty for
+// the record handled, which must then leave no trace of them.
+var emptyGroupCases = []struct {
+	name   string
+	derive func(h slog.Handler) slog.Handler
+}{
+	{"WithGroup then no attrs", func(h slog.Handler) slog.Handler {
+		return h.WithGroup("req")
+	}},
+	{"WithGroup then With empty", func(h slog.Handler) slog.Handler {
+		return h.WithGroup("req").WithAttrs(nil).WithAttrs([]slog.Attr{})
+	}},
+	{"WithGroup then an empty group", func(h slog.Handler) slog.Handler {
+		return h.WithGroup("req").WithAttrs([]slog.Attr{slog.Group("inner")})
+	}},
+	{"nested WithGroup", func(h slog.Handler) slog.Handler {
+		return h.WithGroup("req").WithGroup("inner")
+	}},
+}
+
+func TestTextHandlerEmptyGroups(t *testing.T) {
+	for _, tt := range emptyGroupCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := tt.derive(log.NewTextHandlerWithOptions(&buf, &log.HandlerOptions{NoColor: true}))
+			h.Handle(context.Background(), slog.NewRecord(textTestTime, slog.LevelInfo, "msg", 0))
+			if got, want := buf.String(), "2024-06-01 12:00:00 |  INFO | msg \n"; got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// sourceLinkRecord handles with a handler with opts writing to out a
+// record from "/src/app/main.go:42".
+func sourceLinkRecord(out io.Writer, opts log.HandlerOptions) {
+	opts.AddSource = true
+	opts.SourcePath = func(file string, line int) string { return "/src/app/main.go:42" }
+	opts.Colorizer = log.BasicANSIColorizer{}
+	var pcs [1]uintptr
+	runtime.Callers(1, pcs[:])
+	log.NewTextHandlerWithOptions(out, &opts).Handle(context.Background(),
+		slog.NewRecord(textTestTime, slog.LevelInfo, "started", pcs[0]))
+}
+
+func TestTextHandlerSourceLink(t *testing.T) {
+	// The links are written in color only.
+	t.Setenv("NO_COLOR", "")
+	for _, tt := range []struct {
+		name string
+		tmpl string
+		want string
+	}{
+		{"file", "file://{path}", "\x1b]8;;file:///src/app/main.go\x1b\\"},
+		{"vscode", "vscode://file/{path}:{line}", "\x1b]8;;vscode://file//src/app/main.go:42\x1b\\"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out log.Terminal
+			sourceLinkRecord(&out, log.HandlerOptions{SourceLinkTemplate: tt.tmpl})
+			want := tt.want + "\x1b[36m/src/app/main.go:42\x1b[0m\x1b]8;;\x1b\\"
+			if got := out.String(); !strings.Contains(got, want) {
+				t.Errorf("got %q, want the source rendered as %q", got, want)
+			}
+		})
+	}
+}
+
+func TestTextHandlerSourceLinkPlain(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		out  interface {
+			io.Writer
+			String() string
+		}
+		opts log.HandlerOptions
+	}{
+		{"not a terminal", new(bytes.Buffer), log.HandlerOptions{ForceColor: true}},
+		{"NoColor", new(log.Terminal), log.HandlerOptions{NoColor: true}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.SourceLinkTemplate = "file://{path}"
+			sourceLinkRecord(tt.out, tt.opts)
+			got := tt.out.String()
+			if strings.Contains(got, "\x1b]8;") {
+				t.Errorf("got a hyperlink: %q", got)
+			}
+			if !strings.Contains(got, "/src/app/main.go:42") {
+				t.Errorf("no source location: %q", got)
+			}
+		})
+	}
+}
+
+func TestTextHandlerTimeLayout(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		layout log.TimeLayout
+	}{
+		{"iso_week", log.TimeLayout{Date: log.ISOWeekDate, Clock: "15:04:05", Separator: "T"}},
+		{"ordinal", log.TimeLayout{Date: log.OrdinalDate, Clock: time.Kitchen, Separator: " @ "}},
+		{"compact", log.TimeLayout{Date: log.CompactDate, Clock: "150405", Separator: "-"}},
+		{"month_day", log.TimeLayout{Date: log.MonthDayDate, Clock: "15:04", Separator: " "}},
+		{"date_only", log.TimeLayout{Date: log.CompactDate}},
+		{"clock_only", log.TimeLayout{Clock: time.StampMilli, Separator: "T"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := log.NewTextHandlerWithOptions(&buf, &log.HandlerOptions{
+				TimeLayout: &tt.layout,
+				Colorizer:  log.BasicANSIColorizer{},
+				ForceColor: true,
+			})
+			r := slog.NewRecord(textTestTime, slog.LevelInfo, "started", 0)
+			r.AddAttrs(slog.Time("since", textTestTime.Add(-time.Hour)))
+			h.Handle(context.Background(), r)
+			log.CheckGolden(t, "time_layout_"+tt.name+".golden", buf.Bytes())
+		})
+	}
+}
+
+func TestTextHandlerConformance(t *testing.T) {
+	logtest.TestHandlerConformance(t, func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+		return log.NewTextHandler(w, opts)
+	}, parseText)
+}
+
+// parseText parses the output of a TextHandler without colors: an optional
+// time, the level between bars, the message, then key=value pairs whose
+// dotted keys are turned back into nested groups.
+func parseText(out []byte) ([]logtest.Entry, error) {
+	var entries []logtest.Entry
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if cont, ok := strings.CutPrefix(line, "  > "); ok {
+			if len(entries) == 0 {
+				return nil, fmt.Errorf("continuation line %q without a record", line)
+			}
+			e := entries[len(entries)-1]
+			msg := strings.TrimSuffix(e[slog.MessageKey].(string), "↲")
+			if msg != "" {
+				msg += "\n"
+			}
+			e[slog.MessageKey] = msg + strings.TrimSuffix(cont, " ")
+			continue
+		}
+		e := logtest.Entry{}
+		head, rest, ok := strings.Cut(line, "| ")
+		if !ok {
+			return nil, fmt.Errorf("no level in %q", line)
+		}
+		if head = strings.TrimSuffix(head, " "); head != "" {
+			e[slog.TimeKey] = head
+		}
+		level, rest, ok := strings.Cut(rest, " | ")
+		if !ok {
+			return nil, fmt.Errorf("no level in %q", line)
+		}
+		e[slog.LevelKey] = strings.TrimSpace(level)
+		msg, err := parseTextAttrs(e, strings.TrimSuffix(rest, " "))
+		if err != nil {
+			return nil, fmt.Errorf("%w in %q", err, line)
+		}
+		e[slog.MessageKey] = msg
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseTextAttrs adds to e the attributes of s, and returns the message
+// they follow.
+func parseTextAttrs(e logtest.Entry, s string) (string, error) {
+	isKey := func(s string) (string, bool) {
+		tok, _, _ := strings.Cut(s, " ")
+		key, _, ok := strings.Cut(tok, "=")
+		return key, ok && key != "" && !strings.ContainsAny(key, `"`)
+	}
+	var msg []string
+	for s != "" {
+		key, ok := isKey(s)
+		if !ok {
+			var word string
+			word, s, _ = strings.Cut(s, " ")
+			msg = append(msg, word)
+			continue
+		}
+		s = s[len(key)+1:]
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			q, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return "", err
+			}
+			val, _ = strconv.Unquote(q)
+			s = strings.TrimPrefix(s[len(q):], " ")
+		} else {
+			val, s, _ = strings.Cut(s, " ")
+		}
+		setPath(e, strings.Split(key, "."), val)
+	}
+	return strings.Join(msg, " "), nil
+}
+
+// setPath sets the value at path in e, creating the groups on the way.
+func setPath(e logtest.Entry, path []string, v any) {
+	for _, g := range path[:len(path)-1] {
+		sub, ok := e[g].(logtest.Entry)
+		if !ok {
+			sub = logtest.Entry{}
+			e[g] = sub
+		}
+		e = sub
+	}
+	e[path[len(path)-1]] = v
+}
+
+// legacyRecords handles with h records covering what the options of
+// slog.HandlerOptions change: levels, source, groups, attributes added
+// with WithAttrs and ReplaceAttr.
+func legacyRecords(h slog.Handler) {
+	ctx := context.Background()
+	var pcs [1]uintptr
+	runtime.Callers(1, pcs[:])
+	for _, level := range []slog.Level{slog.LevelDebug - 4, slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+		r := slog.NewRecord(textTestTime, level, "level "+level.String(), pcs[0])
+		r.AddAttrs(slog.Int("n", 1), slog.String("s", "a b"))
+		h.Handle(ctx, r)
+	}
+	g := h.WithAttrs([]slog.Attr{slog.String("service", "api")}).WithGroup("req")
+	r := slog.NewRecord(textTestTime, slog.LevelInfo, "grouped", pcs[0])
+	r.AddAttrs(slog.String("path", "/login"), slog.Group("user", slog.Int("id", 7), slog.Bool("admin", false)))
+	g.Handle(ctx, r)
+	r = slog.NewRecord(textTestTime, slog.LevelError, "several\nlines", pcs[0])
+	r.AddAttrs(slog.String("secret", "hunter2"), slog.Duration("took", 1500*time.Millisecond))
+	h.Handle(ctx, r)
+}
+
+// TestTextHandlerLegacyConstructor checks that NewTextHandler writes what it
+// did before TextOptions, and the same as the constructors taking them.
+func TestTextHandlerLegacyConstructor(t *testing.T) {
+	replace := func(groups []string, a slog.Attr) slog.Attr {
+		switch {
+		case len(groups) == 0 && a.Key == slog.SourceKey:
+			return slog.String(slog.SourceKey, "main.go:42")
+		case a.Key == "secret":
+			return slog.String("secret", "***")
+		}
+		return a
+	}
+	opts := &slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug, ReplaceAttr: replace}
+
+	var legacy bytes.Buffer
+	legacyRecords(log.NewTextHandler(&legacy, opts))
+	log.CheckGolden(t, "text_handler_legacy.golden", legacy.Bytes())
+
+	constructors := map[string]func(io.Writer) slog.Handler{
+		"options": func(w io.Writer) slog.Handler {
+			return log.NewTextHandlerWithOptions(w, &log.TextOptions{HandlerOptions: *opts})
+		},
+		"functional options": func(w io.Writer) slog.Handler {
+			return log.NewTextHandlerWithOptions(w, nil, log.WithSource(), log.WithLevel(slog.LevelDebug), log.WithReplaceAttr(replace))
+		},
+	}
+	for name, newHandler := range constructors {
+		var buf bytes.Buffer
+		legacyRecords(newHandler(&buf))
+		if !bytes.Equal(buf.Bytes(), legacy.Bytes()) {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, buf.Bytes(), legacy.Bytes())
+		}
+	}
+}
+
+// TestTextHandlerOptionsCarried checks that the handlers derived with
+// WithAttrs and WithGroup keep the options of TextOptions.
+func TestTextHandlerOptionsCarried(t *testing.T) {
+	var buf bytes.Buffer
+	h := log.NewTextHandlerWithOptions(&buf, nil,
+		log.WithTimeFormat(log.TimeLayout{Date: log.CompactDate}),
+		log.WithLevelNames(map[log.Level]string{log.LevelInfo: "NOTE"}),
+		log.WithSortAttrs(),
+	)
+	d := h.WithAttrs([]slog.Attr{slog.Int("z", 1)}).WithGroup("g")
+	r := slog.NewRecord(textTestTime, slog.LevelInfo, "msg", 0)
+	r.AddAttrs(slog.Int("b", 2), slog.Int("a", 1))
+	d.Handle(context.Background(), r)
+	if got, want := buf.String(), "20240601 |  NOTE | msg z=1 g.a=1 g.b=2 \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
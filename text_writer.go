@@ -0,0 +1,64 @@
+package log
+
+import "io"
+
+// textWriter is the writer of a TextHandler: the writer of its Colorizer
+// wrapping the writer given to the handler, whose Fd, Flush and Close
+// methods it forwards so that wrapping doesn't hide them.
+type textWriter struct {
+	io.Writer
+	raw io.Writer
+}
+
+// newTextWriter wraps out for a TextHandler with the writer of c. Writers
+// already wrapped by this function are returned as is.
+func newTextWriter(out io.Writer, c Colorizer) io.Writer {
+	if _, ok := out.(*textWriter); ok {
+		return out
+	}
+	return &textWriter{Writer: c.Writer(out), raw: out}
+}
+
+// Unwrap returns the writer wrapped by w.
+func (w *textWriter) Unwrap() io.Writer {
+	return w.raw
+}
+
+// Fd returns the file descriptor of the wrapped writer, or 0 if it has
+// none, as the writer handed to handlers by New does.
+func (w *textWriter) Fd() uintptr {
+	if f, ok := w.raw.(interface{ Fd() uintptr }); ok {
+		return f.Fd()
+	}
+	return 0
+}
+
+// terminal reports whether the wrapped writer writes to a terminal.
+func (w *textWriter) terminal() bool {
+	return isTerminal(w.raw)
+}
+
+// Flush flushes the wrapped writer, if it can be flushed.
+func (w *textWriter) Flush() error {
+	switch f := w.raw.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return nil
+}
+
+// Close closes the wrapped writer, if it can be closed.
+func (w *textWriter) Close() error {
+	if c, ok := w.raw.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// ReadFrom copies r through the colorizer's writer, so that the wrapped
+// writer's own ReadFrom can't bypass it.
+func (w *textWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(w.Writer, r)
+}
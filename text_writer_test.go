@@ -0,0 +1,127 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fileLike is a writer with the methods of an *os.File that textWriter
+// forwards.
+type fileLike struct {
+	bytes.Buffer
+	fd      uintptr
+	flushes int
+	closed  bool
+}
+
+func (f *fileLike) Fd() uintptr  { return f.fd }
+func (f *fileLike) Flush() error { f.flushes++; return nil }
+func (f *fileLike) Close() error { f.closed = true; return nil }
+
+func TestTextWriterForwards(t *testing.T) {
+	raw := &fileLike{fd: 42}
+	h := NewTextHandlerWithOptions(raw, &HandlerOptions{NoColor: true})
+	out := h.out
+	if fd, ok := out.(interface{ Fd() uintptr }); !ok || fd.Fd() != 42 {
+		t.Errorf("Fd isn't reachable through %T", out)
+	}
+	if f, ok := out.(interface{ Flush() error }); !ok || f.Flush() != nil || raw.flushes != 1 {
+		t.Errorf("Flush isn't reachable through %T", out)
+	}
+	if c, ok := out.(io.Closer); !ok || c.Close() != nil || !raw.closed {
+		t.Errorf("Close isn't reachable through %T", out)
+	}
+	if u, ok := out.(interface{ Unwrap() io.Writer }); !ok || u.Unwrap() != raw {
+		t.Errorf("the writer given isn't reachable through %T", out)
+	}
+}
+
+func TestTextWriterNoMethods(t *testing.T) {
+	var buf bytes.Buffer
+	w := newTextWriter(&buf, PlainColorizer{}).(*textWriter)
+	if fd := w.Fd(); fd != 0 {
+		t.Errorf("Fd() = %d, want 0", fd)
+	}
+	if err := w.Flush(); err != nil {
+		t.Errorf("Flush() = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+	if n, err := w.ReadFrom(strings.NewReader("copied\n")); n != 7 || err != nil || buf.String() != "copied\n" {
+		t.Errorf("ReadFrom() = %d, %v, wrote %q", n, err, buf.String())
+	}
+}
+
+func TestTextWriterIdempotent(t *testing.T) {
+	raw := &fileLike{fd: 3}
+	h1 := NewTextHandlerWithOptions(raw, &HandlerOptions{NoColor: true})
+	h2 := NewTextHandlerWithOptions(h1.out, &HandlerOptions{NoColor: true})
+	if h2.out != h1.out {
+		t.Error("a wrapped writer is wrapped again")
+	}
+}
+
+func TestTextWriterRaw(t *testing.T) {
+	raw := &fileLike{fd: 3}
+	h := NewTextHandlerWithOptions(raw, &HandlerOptions{NoColor: true, RawWriter: true})
+	if h.out != io.Writer(raw) {
+		t.Errorf("RawWriter: the handler writes to %T", h.out)
+	}
+	h.Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelInfo, "direct", 0))
+	if !strings.Contains(raw.String(), "direct") {
+		t.Errorf("got %q", raw.String())
+	}
+}
+
+// stringWriter counts the calls to its Write and WriteString methods.
+type stringWriter struct {
+	strings.Builder
+	writes, writeStrings int
+}
+
+func (w *stringWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Builder.Write(p)
+}
+
+func (w *stringWriter) WriteString(s string) (int, error) {
+	w.writeStrings++
+	return w.Builder.WriteString(s)
+}
+
+func TestLoggerWriterWriteString(t *testing.T) {
+	out := new(stringWriter)
+	l := New(&Options{Writer: out}).(*logger)
+	w := &writer{l: l}
+	io.WriteString(w, "banner\n")
+	if out.writeStrings != 1 || out.writes != 0 || out.String() != "banner\n" {
+		t.Errorf("got %q with %d calls to WriteString and %d to Write, want one to WriteString",
+			out.String(), out.writeStrings, out.writes)
+	}
+}
+
+func BenchmarkLoggerWriter(b *testing.B) {
+	const line = "2024-06-01 12:00:00 |  INFO | request served status=200 path=\"/login\" \n"
+	var out strings.Builder
+	w := &writer{l: New(&Options{Writer: &out}).(*logger)}
+	b.Run("Write", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			out.Reset()
+			w.Write([]byte(line))
+		}
+	})
+	b.Run("WriteString", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			out.Reset()
+			w.WriteString(line)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package log
+
+import "io"
+
+// Theme is a palette of the styles of TextHandler, for handlers of one
+// process in different colors, or for terminals with a light background.
+// Set it as [HandlerOptions.Theme], or with [WithTheme]:
+//
+//	t := log.DefaultTheme()
+//	t.Levels[log.LevelInfo] = "32" // green, not bold
+//	h := log.NewTextHandlerWithOptions(os.Stderr, nil, log.WithTheme(t))
+//
+// Each color is the parameters of an SGR escape sequence, such as "34"
+// for blue or "91;1" for bold bright red. An empty color leaves the text
+// in the style around it.
+type Theme struct {
+	// Levels are the colors of the labels of the levels. The levels
+	// below LevelTrace take its color, those above LevelFatal that of
+	// LevelPanic.
+	Levels map[Level]string
+
+	Date    string // the date of the record time
+	Clock   string // the clock of the record time
+	Message string // the message
+	Source  string // the source location
+
+	// Separator is the color of the bars around the level and of the
+	// other separators, and of the attributes, unless Key or Value is
+	// set.
+	Separator string
+
+	// Key and Value are the colors of the keys and of the values of the
+	// attributes.
+	Key   string
+	Value string
+}
+
+// DefaultTheme returns the colors TextHandler writes by default.
+func DefaultTheme() Theme {
+	return Theme{
+		Levels: map[Level]string{
+			LevelTrace: "96;1",
+			LevelDebug: "96;1",
+			LevelInfo:  "92;1",
+			LevelWarn:  "93;1",
+			LevelError: "91;1",
+			LevelPanic: "95;1",
+			LevelFatal: "94;1",
+		},
+		Date:      "35",
+		Clock:     "34",
+		Message:   "97",
+		Source:    "36",
+		Separator: "90",
+	}
+}
+
+// LightTheme returns colors for terminals with a light background: the
+// bright colors of DefaultTheme, hard to read on white, are replaced with
+// their darker variants.
+func LightTheme() Theme {
+	return Theme{
+		Levels: map[Level]string{
+			LevelTrace: "36;1",
+			LevelDebug: "36;1",
+			LevelInfo:  "32;1",
+			LevelWarn:  "33;1",
+			LevelError: "31;1",
+			LevelPanic: "35;1",
+			LevelFatal: "34;1",
+		},
+		Date:      "35",
+		Clock:     "34",
+		Message:   "30",
+		Source:    "36",
+		Separator: "37",
+	}
+}
+
+// WithTheme sets the colors of the handler.
+func WithTheme(t Theme) TextOption {
+	return func(o *TextOptions) { o.Theme = &t }
+}
+
+// themeColorizer is the Colorizer of a Theme: the escape sequences of its
+// colors, computed once, so that changing the Theme afterwards doesn't
+// change the handler.
+type themeColorizer struct {
+	starts [StyleValue + 1][]byte
+}
+
+// newThemeColorizer returns the Colorizer of t.
+func newThemeColorizer(t Theme) *themeColorizer {
+	c := new(themeColorizer)
+	sgr := func(s Style, params string) {
+		if params != "" {
+			c.starts[s] = []byte("\x1b[" + params + "m")
+		}
+	}
+	sgr(StyleReset, "0")
+	sgr(StyleDefault, t.Message)
+	sgr(StyleDim, t.Separator)
+	sgr(StyleDate, t.Date)
+	sgr(StyleClock, t.Clock)
+	sgr(StyleSource, t.Source)
+	for level, params := range t.Levels {
+		if level >= LevelTrace && level <= LevelFatal {
+			sgr(levelStyle(level), params)
+		}
+	}
+	sgr(StyleKey, t.Key)
+	sgr(StyleValue, t.Value)
+	return c
+}
+
+func (c *themeColorizer) Start(s Style) []byte {
+	if s < 0 || int(s) >= len(c.starts) {
+		return nil
+	}
+	return c.starts[s]
+}
+
+func (c *themeColorizer) Wrap(s Style, text string) string {
+	start := c.Start(s)
+	if start == nil {
+		return text
+	}
+	return string(start) + text + string(c.starts[StyleReset])
+}
+
+func (*themeColorizer) Writer(out io.Writer) io.Writer { return out }
@@ -0,0 +1,98 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Placeholders for the ISO 8601 week date, which time layouts cannot
+// express, usable in TimeLayout.Date.
+const (
+	ISOYear = "{isoyear}" // year of the ISO week, as in "2024"
+	ISOWeek = "{isoweek}" // ISO week number, as in "07"
+)
+
+// Date layouts for TimeLayout.Date besides those of the time package.
+const (
+	CompactDate  = "20060102"               // 20240601
+	OrdinalDate  = "2006-002"               // 2024-153
+	ISOWeekDate  = ISOYear + "-W" + ISOWeek // 2024-W22
+	MonthDayDate = "01-02"                  // 06-01
+)
+
+// TimeLayout describes how TextHandler, and IndentHandler with
+// CompactHeader, render the record time. The date
+// and the clock are formatted separately, each in its own color, and
+// joined by Separator. An empty Date or Clock leaves that part out, and
+// the separator with it. TextHandler renders the time values of the
+// attributes in the same layout, without colors, if one is set.
+type TimeLayout struct {
+	Date      string
+	Clock     string
+	Separator string
+}
+
+// DefaultTimeLayout renders times as "2006-01-02 15:04:05".
+var DefaultTimeLayout = TimeLayout{
+	Date:      time.DateOnly,
+	Clock:     time.TimeOnly,
+	Separator: " ",
+}
+
+// TimeFormat returns the TimeLayout of a layout of the time package, as in
+// "2006-01-02 15:04:05.000": the date is the part before its first space,
+// the clock the part after it. A layout without a space is rendered whole,
+// in the color of the clock, as "15:04:05.000", and an empty layout leaves
+// the time out.
+func TimeFormat(layout string) TimeLayout {
+	date, clock, ok := strings.Cut(layout, " ")
+	if !ok {
+		return TimeLayout{Clock: layout}
+	}
+	return TimeLayout{Date: date, Clock: clock, Separator: " "}
+}
+
+// format renders t without colors, as used in IndentHandler headers.
+func (l *TimeLayout) format(t time.Time) string {
+	switch {
+	case l.Date == "":
+		return t.Format(l.Clock)
+	case l.Clock == "":
+		return formatDate(t, l.Date)
+	default:
+		return formatDate(t, l.Date) + l.Separator + t.Format(l.Clock)
+	}
+}
+
+// formatDate formats t with layout, expanding the ISO week placeholders.
+// The text around them is formatted on its own, so that the digits they
+// expand to are not taken for layout elements.
+func formatDate(t time.Time, layout string) string {
+	if !strings.Contains(layout, "{") {
+		return t.Format(layout)
+	}
+	year, week := t.ISOWeek()
+	var b strings.Builder
+	for layout != "" {
+		i := strings.IndexByte(layout, '{')
+		if i < 0 {
+			b.WriteString(t.Format(layout))
+			break
+		}
+		b.WriteString(t.Format(layout[:i]))
+		layout = layout[i:]
+		switch {
+		case strings.HasPrefix(layout, ISOYear):
+			fmt.Fprintf(&b, "%04d", year)
+			layout = layout[len(ISOYear):]
+		case strings.HasPrefix(layout, ISOWeek):
+			fmt.Fprintf(&b, "%02d", week)
+			layout = layout[len(ISOWeek):]
+		default:
+			b.WriteByte('{')
+			layout = layout[1:]
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var uptimeHandlers = []struct {
+	name string
+	new  func(io.Writer, *HandlerOptions) slog.Handler
+}{
+	{"text", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewTextHandlerWithOptions(w, o) }},
+	{"fast text", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewFastTextHandlerWithOptions(w, o) }},
+	{"indent", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewIndentHandlerWithOptions(w, o) }},
+	{"json", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewJSONHandlerWithOptions(w, o) }},
+	{"logfmt", func(w io.Writer, o *HandlerOptions) slog.Handler { return NewLogfmtHandlerWithOptions(w, o) }},
+}
+
+// uptimeRE matches the uptime of a record, as a duration or, in JSON, as a
+// number of nanoseconds.
+var uptimeRE = regexp.MustCompile(`uptime(?:=|: |":)([0-9.]+[a-zµ]*)`)
+
+// parseUptimes returns the uptimes found in out, in order.
+func parseUptimes(t *testing.T, out []byte) []time.Duration {
+	t.Helper()
+	var ds []time.Duration
+	for _, m := range uptimeRE.FindAllSubmatch(out, -1) {
+		s := string(m[1])
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			ns, nerr := strconv.ParseInt(s, 10, 64)
+			if nerr != nil {
+				t.Fatalf("uptime %q: %v", s, err)
+			}
+			d = time.Duration(ns)
+		}
+		ds = append(ds, d)
+	}
+	return ds
+}
+
+func TestStampUptime(t *testing.T) {
+	// Records go backwards in wall-clock time, as after a clock step.
+	wall := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range uptimeHandlers {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := tt.new(&buf, &HandlerOptions{StampUptime: true})
+			const n = 50
+			for i := 0; i < n; i++ {
+				r := slog.NewRecord(wall.Add(-time.Duration(i)*time.Minute), slog.LevelInfo, "msg", 0)
+				if err := h.Handle(context.Background(), r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ds := parseUptimes(t, buf.Bytes())
+			if len(ds) != n {
+				t.Fatalf("found %d uptimes, want %d:\n%s", len(ds), n, buf.Bytes())
+			}
+			for i, d := range ds {
+				if d <= 0 {
+					t.Errorf("record %d: uptime %v, want > 0", i, d)
+				}
+				if i > 0 && d < ds[i-1] {
+					t.Errorf("record %d: uptime %v after %v", i, d, ds[i-1])
+				}
+			}
+		})
+	}
+}
+
+func TestStampUptimeOff(t *testing.T) {
+	for _, tt := range uptimeHandlers {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := tt.new(&buf, &HandlerOptions{})
+			h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "msg", 0))
+			if bytes.Contains(buf.Bytes(), []byte(UptimeKey)) {
+				t.Errorf("uptime without StampUptime: %s", buf.Bytes())
+			}
+		})
+	}
+}
@@ -2,48 +2,113 @@ package log
 
 import (
 	"log/slog"
+	"slices"
+	"strings"
 	"sync"
-
-	"zestack.dev/color"
+	"unicode"
 )
 
-var (
-	cError = color.New(color.FgHiRed, color.Bold)
-	cInfo  = color.New(color.FgHiGreen, color.Bold)
-	cWarn  = color.New(color.FgHiYellow, color.Bold)
-	cFatal = color.New(color.FgHiBlue, color.Bold)
-	cPanic = color.New(color.FgHiMagenta, color.Bold)
-	cDebug = color.New(color.FgHiCyan, color.Bold)
-	cTrace = color.New(color.FgHiCyan, color.Bold)
-)
+// isSlogLevel reports whether v holds a slog.Level, as the level
+// attribute does unless ReplaceAttr changed it.
+func isSlogLevel(v slog.Value) bool {
+	if v.Kind() != slog.KindAny {
+		return false
+	}
+	_, ok := v.Any().(slog.Level)
+	return ok
+}
 
 func levelToString(l slog.Level) string {
 	return parseSlogLevel(l).String()
 }
 
-func levelToColor(l slog.Level) (*color.Value, string) {
-	switch level := parseSlogLevel(l); level {
-	case LevelTrace:
-		return cTrace.Wrap(level), ""
-	case LevelDebug:
-		return cDebug.Wrap(level), ""
-	case LevelInfo:
-		return cInfo.Wrap(level.String()), " "
-	case LevelWarn:
-		return cWarn.Wrap(level.String()), " "
-	case LevelError:
-		return cError.Wrap(level.String()), ""
-	case LevelPanic:
-		return cPanic.Wrap(level.String()), ""
-	case LevelFatal:
-		return cFatal.Wrap(level.String()), ""
-	default:
-		if level < LevelTrace {
-			return cTrace.Wrap(level.String()), ""
-		} else {
-			return cPanic.Wrap(level.String()), ""
+// levelWidth is the width of the longest name of a level of this
+// package, to which the handlers pad the others.
+const levelWidth = 5
+
+// padLevel right-aligns a level name on width columns.
+func padLevel(name string, width int) string {
+	if n := displayWidth(name); n < width {
+		return strings.Repeat(" ", width-n) + name
+	}
+	return name
+}
+
+// levelToColor returns the label of a level, named name, in its style,
+// and the spaces right-aligning it on width columns.
+func levelToColor(c Colorizer, l slog.Level, name string, width int) (string, string) {
+	label := c.Wrap(levelStyle(parseSlogLevel(l)), name)
+	if n := displayWidth(name); n < width {
+		return label, strings.Repeat(" ", width-n)
+	}
+	return label, ""
+}
+
+// displayWidth returns the number of columns s takes in a terminal, wide
+// characters such as emoji and CJK ideographs taking two, and joiners,
+// variation selectors and combining marks none. A character followed by
+// the emoji variation selector, as "ℹ️", is shown as a wide emoji.
+func displayWidth(s string) int {
+	width, last := 0, 0
+	for _, r := range s {
+		switch {
+		case r == 0xfe0f:
+			if last == 1 {
+				width++
+				last = 2
+			}
+			continue
+		case r == 0x200d || r >= 0xfe00 && r <= 0xfe0e || unicode.In(r, unicode.Mn, unicode.Me):
+			last = 0
+			continue
+		case isWide(r):
+			last = 2
+		default:
+			last = 1
+		}
+		width += last
+	}
+	return width
+}
+
+// isWide reports whether r takes two columns: emoji, and the characters of
+// the wide blocks of East Asian scripts.
+func isWide(r rune) bool {
+	for _, wr := range wideRanges {
+		if r >= wr[0] && r <= wr[1] {
+			return true
 		}
 	}
+	return slices.Contains(wideSymbols, r)
+}
+
+// wideRanges are the blocks of characters taking two columns.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f},   // Hangul Jamo
+	{0x2e80, 0x303e},   // CJK radicals, symbols and punctuation
+	{0x3041, 0xa4cf},   // kana, CJK ideographs, Yi
+	{0xac00, 0xd7a3},   // Hangul syllables
+	{0xf900, 0xfaff},   // CJK compatibility ideographs
+	{0xfe30, 0xfe4f},   // CJK compatibility forms
+	{0xff00, 0xff60},   // fullwidth forms
+	{0xffe0, 0xffe6},   // fullwidth signs
+	{0x1f300, 0x1f64f}, // pictographs and emoticons
+	{0x1f680, 0x1f6ff}, // transport and map symbols
+	{0x1f900, 0x1faff}, // supplemental pictographs
+	{0x20000, 0x3fffd}, // CJK extensions
+}
+
+// wideSymbols are the characters below the emoji blocks shown as emoji
+// by default, as "✅" and "❌".
+var wideSymbols = []rune{
+	0x231a, 0x231b, 0x23e9, 0x23ea, 0x23eb, 0x23ec, 0x23f0, 0x23f3,
+	0x25fd, 0x25fe, 0x2614, 0x2615, 0x2648, 0x2649, 0x264a, 0x264b,
+	0x264c, 0x264d, 0x264e, 0x264f, 0x2650, 0x2651, 0x2652, 0x2653,
+	0x267f, 0x2693, 0x26a1, 0x26aa, 0x26ab, 0x26bd, 0x26be, 0x26c4,
+	0x26c5, 0x26ce, 0x26d4, 0x26ea, 0x26f2, 0x26f3, 0x26f5, 0x26fa,
+	0x26fd, 0x2705, 0x270a, 0x270b, 0x2728, 0x274c, 0x274e, 0x2753,
+	0x2754, 0x2755, 0x2757, 0x2795, 0x2796, 0x2797, 0x27b0, 0x27bf,
+	0x2b1b, 0x2b1c, 0x2b50, 0x2b55,
 }
 
 var bufPool = sync.Pool{
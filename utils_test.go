@@ -0,0 +1,145 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// attrValue returns the value of the attribute of r with the given key,
+// looked up at the top level of the record.
+func attrValue(r slog.Record, key string) (slog.Value, bool) {
+	var v slog.Value
+	var found bool
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == key {
+			v, found = a.Value, true
+			return false
+		}
+		return true
+	})
+	return v, found
+}
+
+// fakeClock is a clock for the Clock options, moved forward by the tests.
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// checkGolden compares got with the golden file testdata/name, rewriting
+// the file instead with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run the tests with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\ngot  %q\nwant %q", path, got, want)
+	}
+}
+
+// captureStderr returns what fn writes to os.Stderr.
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+	done := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- b
+	}()
+	fn()
+	w.Close()
+	return string(<-done)
+}
+
+// warnFromUtils logs msg at LevelWarn from a helper of this file, for the
+// tests telling records apart by the function that logged them.
+func warnFromUtils(l Logger, msg string) {
+	l.Warn(msg)
+}
+
+// newRingLogger returns a Logger at level whose records are kept by the
+// returned RingHandler.
+func newRingLogger(opts *Options) (Logger, *RingHandler) {
+	ring := NewRingHandler(100)
+	opts.NewHandler = func(_ io.Writer, o *slog.HandlerOptions) slog.Handler {
+		return &levelHandler{Handler: ring, level: o.Level}
+	}
+	return New(opts), ring
+}
+
+// messages returns the records of ring as their level and message, each
+// followed by " key=value" for those of its attributes named by keys.
+func messages(ring *RingHandler, keys ...string) []string {
+	var msgs []string
+	for _, r := range ring.Records() {
+		msg := RecordLevel(r).String() + " " + r.Message
+		r.Attrs(func(a slog.Attr) bool {
+			if slices.Contains(keys, a.Key) {
+				msg += " " + a.String()
+			}
+			return true
+		})
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func checkMessages(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+// levelHandler is a handler filtering the records with level.
+type levelHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
@@ -0,0 +1,57 @@
+package log
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// appendValue appends the text form of a resolved, non-group value. It is
+// shared by the text-oriented handlers of this package so that a value
+// looks the same in all of them:
+//
+//	strings          quoted, as by strconv.Quote: "", "a b"
+//	booleans         true, false
+//	numbers          as by strconv: 42, -1.5, NaN
+//	durations        as by time.Duration.String: 1.5s
+//	times            RFC 3339 with nanoseconds: 2024-06-01T12:00:00Z
+//	nil              <nil>, for nil interfaces, pointers, slices and maps
+//	other values     as by fmt.Sprint, so through their String method
+//
+// JSONHandler follows the same table within the rules of JSON: nil is
+// null, empty strings are "", and an empty but non-nil slice is [];
+// durations are numbers of nanoseconds, as with slog.JSONHandler, and NaN
+// and the infinities are strings.
+func appendValue(buf []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindString:
+		return strconv.AppendQuote(buf, v.String())
+	case slog.KindInt64:
+		return strconv.AppendInt(buf, v.Int64(), 10)
+	case slog.KindUint64:
+		return strconv.AppendUint(buf, v.Uint64(), 10)
+	case slog.KindFloat64:
+		return strconv.AppendFloat(buf, v.Float64(), 'g', -1, 64)
+	case slog.KindBool:
+		return strconv.AppendBool(buf, v.Bool())
+	case slog.KindDuration:
+		return append(buf, v.Duration().String()...)
+	case slog.KindTime:
+		// Write times in a standard way, without the monotonic time.
+		return v.Time().AppendFormat(buf, time.RFC3339Nano)
+	default:
+		x := v.Any()
+		if isNil(x) {
+			return append(buf, "<nil>"...)
+		}
+		switch x := x.(type) {
+		case fmt.Formatter:
+		case error:
+			return append(buf, errorText(x)...)
+		case fmt.Stringer:
+			return append(buf, stringerText(x)...)
+		}
+		return fmt.Append(buf, x)
+	}
+}
@@ -0,0 +1,89 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math"
+	"testing"
+	"time"
+)
+
+// tortureAttrs are the values whose rendering downstream parsers depend
+// on, one attribute each.
+var tortureAttrs = []slog.Attr{
+	slog.String("empty", ""),
+	slog.String("spaced", `a "b" c`),
+	slog.Bool("yes", true),
+	slog.Bool("no", false),
+	slog.Int("int", -42),
+	slog.Uint64("uint", 42),
+	slog.Float64("float", 1.5),
+	slog.Float64("nan", math.NaN()),
+	slog.Duration("dur", 1500*time.Millisecond),
+	slog.Time("at", time.Date(2024, 6, 1, 12, 0, 0, 5, time.UTC)),
+	slog.Any("nil", nil),
+	slog.Any("nil_slice", []string(nil)),
+	slog.Any("empty_slice", []string{}),
+	slog.Any("nil_map", map[string]int(nil)),
+	slog.Any("nil_ptr", (*int)(nil)),
+	slog.Any("nil_error", error(nil)),
+}
+
+// TestTortureRecord logs the same record through the text, indent and JSON
+// handlers and checks each value against the table of appendValue.
+func TestTortureRecord(t *testing.T) {
+	noTime := func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && a.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return a
+	}
+	opts := &slog.HandlerOptions{ReplaceAttr: noTime}
+	tests := []struct {
+		name string
+		h    func(*bytes.Buffer) slog.Handler
+		want string
+	}{
+		{"text", func(b *bytes.Buffer) slog.Handler { return NewTextHandler(b, opts) },
+			`|  INFO | torture empty="" spaced="a \"b\" c" yes=true no=false int=-42 uint=42 float=1.5 nan=NaN ` +
+				`dur=1.5s at=2024-06-01T12:00:00.000000005Z nil=<nil> nil_slice=<nil> empty_slice=[] nil_map=<nil> nil_ptr=<nil> nil_error=<nil> ` + "\n"},
+		{"indent", func(b *bytes.Buffer) slog.Handler { return NewIndentHandler(b, opts) },
+			`level: INFO
+msg: torture
+empty: ""
+spaced: "a \"b\" c"
+yes: true
+no: false
+int: -42
+uint: 42
+float: 1.5
+nan: NaN
+dur: 1.5s
+at: 2024-06-01T12:00:00.000000005Z
+nil: <nil>
+nil_slice: <nil>
+empty_slice: []
+nil_map: <nil>
+nil_ptr: <nil>
+nil_error: <nil>
+---
+`},
+		{"json", func(b *bytes.Buffer) slog.Handler { return NewJSONHandler(b, opts) },
+			`{"level":"INFO","msg":"torture","empty":"","spaced":"a \"b\" c","yes":true,"no":false,"int":-42,"uint":42,"float":1.5,"nan":"NaN",` +
+				`"dur":1500000000,"at":"2024-06-01T12:00:00.000000005Z","nil":null,"nil_slice":null,"empty_slice":[],"nil_map":null,"nil_ptr":null,"nil_error":null}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			r := slog.NewRecord(time.Time{}, slog.LevelInfo, "torture", 0)
+			r.AddAttrs(tortureAttrs...)
+			if err := tt.h(&buf).Handle(context.Background(), r); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults of WebhookOptions.
+const (
+	webhookBatchSize     = 100
+	webhookQueueSize     = 1000
+	webhookFlushInterval = time.Second
+	webhookGzipThreshold = 4 << 10
+	webhookMaxRetries    = 3
+	webhookMinBackoff    = 500 * time.Millisecond
+	webhookMaxBackoff    = 30 * time.Second
+)
+
+// WebhookOptions are options for a [WebhookHandler].
+type WebhookOptions struct {
+	HandlerOptions
+
+	// URL is the URL the batches are posted to.
+	URL string
+
+	// Headers are added to each request, for example for authentication.
+	Headers map[string]string
+
+	// BatchSize is the largest number of records sent in one request.
+	// If zero, 100 is used.
+	BatchSize int
+
+	// QueueSize is the number of records the handler holds before they
+	// are sent. If zero, 1000 is used.
+	QueueSize int
+
+	// FlushInterval is how long a record may wait for its batch to fill
+	// up before it is sent anyway. If zero, a second is used.
+	FlushInterval time.Duration
+
+	// GzipThreshold is the size of a batch from which it is sent
+	// gzipped. If zero, 4 KiB is used; if negative, batches are never
+	// gzipped.
+	GzipThreshold int
+
+	// MaxRetries is the number of times a batch is sent again after the
+	// server answered 408, 429 or 5xx, or couldn't be reached, waiting
+	// longer each time, from MinBackoff to MaxBackoff, before it is
+	// dropped. If zero, 3 is used; if negative, batches are not sent
+	// again.
+	MaxRetries int
+	MinBackoff time.Duration // if zero, half a second
+	MaxBackoff time.Duration // if zero, 30 seconds
+
+	// Block makes Handle wait for room in a full queue, until its context
+	// is done, instead of dropping the record.
+	Block bool
+
+	// Client sends the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Drops, if set, counts the records dropped from a full queue under
+	// DropQueue, and those of the batches given up on under DropFailed.
+	// See [Drops].
+	Drops *Drops
+
+	// OnError, if set, is called with the errors met sending a batch.
+	OnError func(err error)
+}
+
+// WebhookHandler posts records to a URL as newline-delimited JSON, for
+// lightweight integrations such as an internal collector or a chat relay.
+// Each line of a request is a record as written by a JSONHandler, and the
+// request has the Content-Type application/x-ndjson, its body being
+// gzipped from GzipThreshold.
+//
+// Records are formatted by Handle and queued, then sent in batches by a
+// background goroutine, when a batch is full or FlushInterval after its
+// first record. Batches failing with 408, 429 or 5xx are sent again with
+// exponential backoff, then dropped. When the queue is full, records are
+// dropped, or Handle blocks if Block is set. A record at LevelPanic or
+// above is sent at once, with the records queued before it, Handle waiting
+// until they are sent. Close sends the records queued and stops the
+// handler.
+//
+// A WebhookHandler is registered with [RegisterFlusher] until closed.
+type WebhookHandler struct {
+	h slog.Handler // formats the lines, writing to e
+	e *webhookExporter
+}
+
+// webhookExporter formats the lines of a WebhookHandler and sends them.
+type webhookExporter struct {
+	*batchExporter[[]byte]
+	opts *WebhookOptions
+
+	fmtMu sync.Mutex // serializes formatting, which writes to line
+	line  []byte
+}
+
+// NewWebhookHandler returns a WebhookHandler posting to opts.URL, and
+// starts its sending goroutine.
+func NewWebhookHandler(opts WebhookOptions) (*WebhookHandler, error) {
+	if _, err := http.NewRequest(http.MethodPost, opts.URL, nil); err != nil {
+		return nil, err
+	}
+	if opts.Level == nil {
+		opts.Level = slog.LevelInfo
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = webhookBatchSize
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = webhookQueueSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = webhookFlushInterval
+	}
+	if opts.GzipThreshold == 0 {
+		opts.GzipThreshold = webhookGzipThreshold
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = webhookMaxRetries
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = webhookMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = webhookMaxBackoff
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	e := &webhookExporter{opts: &opts}
+	e.batchExporter = newBatchExporter(batchOptions{
+		BatchSize:     opts.BatchSize,
+		QueueSize:     opts.QueueSize,
+		FlushInterval: opts.FlushInterval,
+		MaxRetries:    opts.MaxRetries,
+		MinBackoff:    opts.MinBackoff,
+		MaxBackoff:    opts.MaxBackoff,
+		Block:         opts.Block,
+		Drops:         opts.Drops,
+		OnError:       opts.OnError,
+	}, e.send)
+	h := &WebhookHandler{h: NewJSONHandlerWithOptions(e, &opts.HandlerOptions), e: e}
+	e.unregister = RegisterFlusher(h)
+	return h, nil
+}
+
+// Write receives the line formatted by the JSONHandler, with fmtMu held.
+func (e *webhookExporter) Write(p []byte) (int, error) {
+	e.line = append(e.line[:0], p...)
+	return len(p), nil
+}
+
+func (h *WebhookHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.h.Enabled(ctx, level)
+}
+
+func (h *WebhookHandler) Handle(ctx context.Context, r slog.Record) error {
+	e := h.e
+	if e.closed.Load() {
+		return net.ErrClosed
+	}
+	e.fmtMu.Lock()
+	err := h.h.Handle(ctx, r)
+	line := bytes.Clone(e.line)
+	e.fmtMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return e.enqueue(ctx, r.Level, line)
+}
+
+func (h *WebhookHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &WebhookHandler{h: h.h.WithAttrs(attrs), e: h.e}
+}
+
+func (h *WebhookHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &WebhookHandler{h: h.h.WithGroup(name), e: h.e}
+}
+
+// send posts one batch, gzipped from GzipThreshold.
+func (e *webhookExporter) send(ctx context.Context, batch [][]byte) (retry bool, err error) {
+	body := bytes.Join(batch, nil)
+	gzipped := false
+	if e.opts.GzipThreshold > 0 && len(body) >= e.opts.GzipThreshold {
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		zw.Write(body)
+		zw.Close()
+		body, gzipped = b.Bytes(), true
+	}
+	return e.post(ctx, body, gzipped)
+}
+
+// post posts one request, and reports whether it may be sent again if it
+// failed.
+func (e *webhookExporter) post(ctx context.Context, body []byte, gzipped bool) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range e.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		retry := resp.StatusCode == http.StatusRequestTimeout ||
+			resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+		return retry, fmt.Errorf("log: webhook: %s", resp.Status)
+	}
+	return false, nil
+}
+
+// Dropped returns the number of records dropped, from the full queue or
+// with the batches given up on, since h was created.
+func (h *WebhookHandler) Dropped() int64 {
+	return h.e.dropped.Load()
+}
+
+// Flush sends the records queued, waiting until they are sent or ctx is
+// done.
+func (h *WebhookHandler) Flush(ctx context.Context) error {
+	return h.e.flush(ctx)
+}
+
+// Close sends the records queued and stops the handler, waiting until it
+// is done, for 30 seconds at most. Records handled afterwards return
+// net.ErrClosed.
+func (h *WebhookHandler) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), batchCloseTimeout)
+	defer cancel()
+	return h.e.close(ctx)
+}
+
+// LogHealth reports the state of the queue and of the last batch sent.
+func (h *WebhookHandler) LogHealth() ComponentHealth {
+	return h.e.health("webhook")
+}
+
+// Unwrap returns the JSONHandler formatting the records of h.
+func (h *WebhookHandler) Unwrap() Handler {
+	return h.h
+}
@@ -0,0 +1,330 @@
+package log
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchServer is an HTTP server recording the requests posted to it. It
+// answers with the statuses of status in turn, then with 200.
+type batchServer struct {
+	*httptest.Server
+	status  []int
+	release chan struct{} // if set, requests wait until it is closed
+
+	mu       sync.Mutex
+	arrived  int // requests received, answered or not
+	bodies   []string
+	paths    []string
+	headers  []http.Header
+	requests int
+}
+
+func newBatchServer(t *testing.T, status ...int) *batchServer {
+	s := &batchServer{status: status}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *batchServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.arrived++
+	s.mu.Unlock()
+	if s.release != nil {
+		select {
+		case <-s.release:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	b, _ := io.ReadAll(body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if len(s.status) > 0 {
+		code := s.status[0]
+		s.status = s.status[1:]
+		if code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+	}
+	s.bodies = append(s.bodies, string(b))
+	s.paths = append(s.paths, r.URL.Path)
+	s.headers = append(s.headers, r.Header.Clone())
+}
+
+// received returns the bodies of the requests answered with 200, and the
+// number of requests.
+func (s *batchServer) received() ([]string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...), s.requests
+}
+
+// waitArrived waits until n requests have been received.
+func (s *batchServer) waitArrived(t *testing.T, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		s.mu.Lock()
+		arrived := s.arrived
+		s.mu.Unlock()
+		if arrived >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests received, want %d", arrived, n)
+		}
+	}
+}
+
+// webhookMessages returns the messages of the records of each body.
+func webhookMessages(bodies []string) [][]string {
+	var batches [][]string
+	for _, body := range bodies {
+		var msgs []string
+		for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+			_, msg, _ := strings.Cut(line, `"msg":"`)
+			msg, _, _ = strings.Cut(msg, `"`)
+			msgs = append(msgs, msg)
+		}
+		batches = append(batches, msgs)
+	}
+	return batches
+}
+
+func newTestWebhook(t *testing.T, opts WebhookOptions) *WebhookHandler {
+	t.Helper()
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = time.Hour
+	}
+	if opts.MinBackoff == 0 {
+		opts.MinBackoff = time.Millisecond
+	}
+	h, err := NewWebhookHandler(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestWebhookHandlerBatches(t *testing.T) {
+	s := newBatchServer(t)
+	h := newTestWebhook(t, WebhookOptions{
+		URL:           s.URL,
+		Headers:       map[string]string{"Authorization": "Bearer secret"},
+		BatchSize:     3,
+		GzipThreshold: -1,
+	})
+	l := slog.New(h)
+	for _, msg := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		l.Info(msg)
+	}
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	bodies, _ := s.received()
+	if got := fmt.Sprint(webhookMessages(bodies)); got != "[[a b c] [d e f] [g]]" {
+		t.Errorf("batches = %s", got)
+	}
+	for _, header := range s.headers {
+		if header.Get("Content-Type") != "application/x-ndjson" || header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("header = %v", header)
+		}
+	}
+}
+
+func TestWebhookHandlerGzip(t *testing.T) {
+	s := newBatchServer(t)
+	h := newTestWebhook(t, WebhookOptions{URL: s.URL, GzipThreshold: 1})
+	slog.New(h).Info("zipped")
+	h.Flush(context.Background())
+	bodies, _ := s.received()
+	if got := fmt.Sprint(webhookMessages(bodies)); got != "[[zipped]]" || s.headers[0].Get("Content-Encoding") != "gzip" {
+		t.Errorf("batches = %s, header %v", got, s.headers[0])
+	}
+}
+
+// A batch failing with a retryable status is sent again, then dropped.
+func TestWebhookHandlerRetry(t *testing.T) {
+	s := newBatchServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	drops := new(Drops)
+	h := newTestWebhook(t, WebhookOptions{URL: s.URL, MaxRetries: 2, Drops: drops})
+	slog.New(h).Info("retried")
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if bodies, n := s.received(); n != 3 || len(bodies) != 1 {
+		t.Errorf("%d requests, %d delivered, want 3 and 1", n, len(bodies))
+	}
+
+	s.mu.Lock()
+	s.status = []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusBadRequest}
+	s.mu.Unlock()
+	slog.New(h).Info("lost")
+	if err := h.Flush(context.Background()); err == nil {
+		t.Error("Flush: no error")
+	}
+	if _, n := s.received(); n != 6 {
+		t.Errorf("%d requests, want 6", n)
+	}
+	if h.Dropped() != 1 {
+		t.Errorf("Dropped = %d", h.Dropped())
+	}
+	if a, ok := drops.take(); !ok || a.String() != "dropped=[failed=1]" {
+		t.Errorf("drops = %v", a)
+	}
+	if health := h.LogHealth(); health.Healthy || health.LastError == nil {
+		t.Errorf("health = %+v", health)
+	}
+
+	// A status that is not retryable is not sent again.
+	slog.New(h).Info("rejected")
+	h.Flush(context.Background())
+	if _, n := s.received(); n != 7 {
+		t.Errorf("%d requests, want 7", n)
+	}
+}
+
+// Close sends the records queued, and stops waiting for a batch to be sent
+// again.
+func TestWebhookHandlerCloseDrains(t *testing.T) {
+	s := newBatchServer(t)
+	h := newTestWebhook(t, WebhookOptions{URL: s.URL, BatchSize: 2})
+	l := slog.New(h)
+	for _, msg := range []string{"a", "b", "c"} {
+		l.Info(msg)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bodies, _ := s.received()
+	if got := fmt.Sprint(webhookMessages(bodies)); got != "[[a b] [c]]" {
+		t.Errorf("batches = %s", got)
+	}
+	if err := h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "late", 0)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Handle after Close: %v", err)
+	}
+	if err := h.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+
+	// The backoff before sending a batch again ends with Close.
+	s = newBatchServer(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	h = newTestWebhook(t, WebhookOptions{URL: s.URL, MinBackoff: time.Hour})
+	slog.New(h).Info("failing")
+	go h.Flush(context.Background())
+	s.waitArrived(t, 1)
+	start := time.Now()
+	if err := h.Close(); err == nil {
+		t.Error("Close: no error")
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("Close took %v", d)
+	}
+
+	// Close abandons the batch being sent when its context is done.
+	s = newBatchServer(t)
+	s.release = make(chan struct{})
+	defer close(s.release)
+	h = newTestWebhook(t, WebhookOptions{URL: s.URL, BatchSize: 1})
+	slog.New(h).Info("stuck")
+	s.waitArrived(t, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := h.e.close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("close: %v", err)
+	}
+	select {
+	case <-h.e.done:
+	case <-time.After(5 * time.Second):
+		t.Error("the batch being sent was not abandoned")
+	}
+}
+
+// With Block, Handle waits for room in the queue, and returns
+// net.ErrClosed if the handler is closed meanwhile.
+func TestWebhookHandlerBlock(t *testing.T) {
+	s := newBatchServer(t)
+	s.release = make(chan struct{})
+	h := newTestWebhook(t, WebhookOptions{URL: s.URL, BatchSize: 1, QueueSize: 1, Block: true})
+	l := slog.New(h)
+	l.Info("sending")
+	s.waitArrived(t, 1)
+	l.Info("queued")
+	blocked := make(chan error)
+	go func() {
+		blocked <- h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "blocked", 0))
+	}()
+	select {
+	case err := <-blocked:
+		t.Fatalf("Handle returned %v with a full queue", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	closed := make(chan error)
+	go func() { closed <- h.Close() }()
+	if err := <-blocked; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("blocked Handle: %v", err)
+	}
+	close(s.release)
+	if err := <-closed; err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	bodies, _ := s.received()
+	if got := fmt.Sprint(webhookMessages(bodies)); got != "[[sending] [queued]]" {
+		t.Errorf("batches = %s", got)
+	}
+}
+
+// Without Block, the records are dropped from a full queue.
+func TestWebhookHandlerDrop(t *testing.T) {
+	s := newBatchServer(t)
+	s.release = make(chan struct{})
+	h := newTestWebhook(t, WebhookOptions{URL: s.URL, BatchSize: 1, QueueSize: 1})
+	l := slog.New(h)
+	for i := 0; i < 10; i++ {
+		l.Info("record")
+	}
+	close(s.release)
+	h.Close()
+	bodies, _ := s.received()
+	if n := int64(len(bodies)); n < 1 || n > 2 || n+h.Dropped() != 10 {
+		t.Errorf("%d sent, %d dropped", n, h.Dropped())
+	}
+}
+
+// A record at LevelPanic is sent before Handle returns.
+func TestWebhookHandlerPanicFlush(t *testing.T) {
+	s := newBatchServer(t)
+	h := newTestWebhook(t, WebhookOptions{URL: s.URL})
+	l := slog.New(h)
+	l.Info("before")
+	l.Log(context.Background(), LevelPanic.Level(), "crash")
+	bodies, _ := s.received()
+	if got := fmt.Sprint(webhookMessages(bodies)); got != "[[before crash]]" {
+		t.Errorf("batches = %s", got)
+	}
+}
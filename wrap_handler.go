@@ -0,0 +1,117 @@
+package log
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+// LevelNameKey is the key of the attribute carrying the name of the level
+// of a record passed to a handler wrapped with [WrapHandler], when its
+// level isn't one of slog.
+const LevelNameKey = "level_name"
+
+// WrapHandler returns a handler passing records to h, a handler that
+// knows only the levels of slog, such as one of another package. The
+// levels of this package that slog doesn't have, TRACE, PANIC and FATAL,
+// would otherwise show as "DEBUG-4", "ERROR+4" and "ERROR+8": they are
+// passed to h as the nearest level of slog, DEBUG or ERROR, with a
+// LevelNameKey attribute carrying their name:
+//
+//	time=... level=ERROR msg="out of memory" level_name=FATAL
+//
+// Enabled asks h about the nearest level of slog too. Attributes and
+// groups are passed to h unchanged.
+//
+// In Options.NewHandler, use [WrapNewHandler] instead, so that the level
+// of the logger is followed exactly.
+func WrapHandler(h slog.Handler) slog.Handler {
+	return &slogLevelHandler{next: h}
+}
+
+// WrapNewHandler returns a NewHandler for [Options] wrapping the handlers
+// of newHandler as [WrapHandler] does:
+//
+//	log.New(&log.Options{NewHandler: log.WrapNewHandler(func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+//		return tint.NewHandler(w, &tint.Options{Level: opts.Level, AddSource: opts.AddSource})
+//	})})
+//
+// The Level of the options newHandler receives is the level of the logger
+// as the nearest level of slog, and the handler returned checks the level
+// of the logger itself, so that, for example, a logger at PANIC doesn't
+// pass ERROR records although h sees both as ERROR.
+func WrapNewHandler(newHandler func(w io.Writer, opts *slog.HandlerOptions) slog.Handler) func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	return func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+		if opts == nil || opts.Level == nil {
+			return WrapHandler(newHandler(w, opts))
+		}
+		o := *opts
+		o.Level = slogLeveler{opts.Level}
+		return &slogLevelHandler{next: newHandler(w, &o), level: opts.Level}
+	}
+}
+
+// slogLevelHandler is the handler returned by WrapHandler.
+type slogLevelHandler struct {
+	next  slog.Handler
+	level slog.Leveler // of the logger, if known
+}
+
+// slogLeveler is a level of this package as the nearest level of slog.
+type slogLeveler struct {
+	l slog.Leveler
+}
+
+func (l slogLeveler) Level() slog.Level {
+	return slogLevel(l.l.Level())
+}
+
+// slogLevel returns the level of slog nearest to l.
+func slogLevel(l slog.Level) slog.Level {
+	switch level := parseSlogLevel(l); {
+	case level <= LevelDebug:
+		return slog.LevelDebug
+	case level == LevelInfo:
+		return slog.LevelInfo
+	case level == LevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+func (h *slogLevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.level != nil && level < h.level.Level() {
+		return false
+	}
+	return h.next.Enabled(ctx, slogLevel(level))
+}
+
+func (h *slogLevelHandler) Handle(ctx context.Context, r slog.Record) error {
+	if level := slogLevel(r.Level); level != r.Level {
+		name := levelToString(r.Level)
+		r = r.Clone()
+		r.Level = level
+		r.AddAttrs(slog.String(LevelNameKey, name))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *slogLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &slogLevelHandler{next: h.next.WithAttrs(attrs), level: h.level}
+}
+
+func (h *slogLevelHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogLevelHandler{next: h.next.WithGroup(name), level: h.level}
+}
+
+// Unwrap returns the handler wrapped by h.
+func (h *slogLevelHandler) Unwrap() Handler {
+	return h.next
+}
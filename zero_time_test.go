@@ -0,0 +1,115 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zeroTimeHandlers are the handlers of this package writing to a
+// writer, with a decoder for those with binary output.
+var zeroTimeHandlers = []struct {
+	name   string
+	new    func(w io.Writer, opts *HandlerOptions) slog.Handler
+	decode func(b []byte) (slog.Record, error)
+}{
+	{name: "text", new: func(w io.Writer, o *HandlerOptions) slog.Handler { return NewTextHandlerWithOptions(w, o) }},
+	{name: "fast text", new: func(w io.Writer, o *HandlerOptions) slog.Handler { return NewFastTextHandlerWithOptions(w, o) }},
+	{name: "indent", new: func(w io.Writer, o *HandlerOptions) slog.Handler { return NewIndentHandlerWithOptions(w, o) }},
+	{name: "compact indent", new: func(w io.Writer, o *HandlerOptions) slog.Handler {
+		o.CompactHeader = true
+		return NewIndentHandlerWithOptions(w, o)
+	}},
+	{name: "json", new: func(w io.Writer, o *HandlerOptions) slog.Handler { return NewJSONHandlerWithOptions(w, o) }},
+	{name: "logfmt", new: func(w io.Writer, o *HandlerOptions) slog.Handler { return NewLogfmtHandlerWithOptions(w, o) }},
+	{name: "cloud logging", new: func(w io.Writer, o *HandlerOptions) slog.Handler { return NewCloudLoggingHandlerWithOptions(w, o) }},
+	{name: "ecs", new: func(w io.Writer, o *HandlerOptions) slog.Handler { return NewECSHandlerWithOptions(w, o) }},
+	{name: "csv", new: func(w io.Writer, o *HandlerOptions) slog.Handler {
+		return NewCSVHandler(w, &CSVOptions{HandlerOptions: *o, Extra: true})
+	}},
+	{
+		name: "binary",
+		new:  func(w io.Writer, o *HandlerOptions) slog.Handler { return NewBinaryHandler(w, &o.HandlerOptions) },
+		decode: func(b []byte) (slog.Record, error) {
+			return NewDecoder(bytes.NewReader(b)).Decode()
+		},
+	},
+	{
+		name: "msgpack",
+		new:  func(w io.Writer, o *HandlerOptions) slog.Handler { return NewMsgpackHandler(w, &o.HandlerOptions) },
+		decode: func(b []byte) (slog.Record, error) {
+			return NewMsgpackDecoder(bytes.NewReader(b)).Decode()
+		},
+	},
+}
+
+// yearOne are renderings of the zero time.Time that must not appear in
+// the output of a record without a time.
+var yearOne = []string{"0001-01-01", "00010101", "-62135596800", "Jan  1 00:00:00"}
+
+// checkNoZeroTime fails if b, the output of handler name for a record
+// with the zero time, shows a time.
+func checkNoZeroTime(t *testing.T, name string, b []byte, decode func([]byte) (slog.Record, error)) {
+	t.Helper()
+	if decode != nil {
+		r, err := decode(b)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !r.Time.IsZero() {
+			t.Errorf("%s: the record decodes with the time %v", name, r.Time)
+		}
+		return
+	}
+	for _, s := range yearOne {
+		if bytes.Contains(b, []byte(s)) {
+			t.Errorf("%s: the output has a year-one time:\n%s", name, b)
+		}
+	}
+}
+
+func TestZeroTime(t *testing.T) {
+	for _, tt := range zeroTimeHandlers {
+		for _, opts := range []struct {
+			name string
+			opts HandlerOptions
+		}{
+			{"default", HandlerOptions{}},
+			{"layout", HandlerOptions{TimeLayout: &TimeLayout{Date: CompactDate, Clock: time.StampMilli}}},
+			{"uptime", HandlerOptions{StampUptime: true}},
+		} {
+			t.Run(tt.name+"/"+opts.name, func(t *testing.T) {
+				var buf bytes.Buffer
+				o := opts.opts
+				o.NoColor = true
+				h := tt.new(&buf, &o)
+				r := slog.NewRecord(time.Time{}, slog.LevelInfo, "no time", 0)
+				r.AddAttrs(slog.Int("n", 1))
+				if err := h.Handle(context.Background(), r); err != nil {
+					t.Fatal(err)
+				}
+				if buf.Len() == 0 {
+					t.Fatal("no output")
+				}
+				checkNoZeroTime(t, tt.name, buf.Bytes(), tt.decode)
+				if tt.decode == nil && !strings.Contains(buf.String(), "no time") {
+					t.Errorf("the message is missing:\n%s", buf.Bytes())
+				}
+			})
+		}
+	}
+}
+
+func TestZeroTimeThroughLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&Options{Writer: &buf, NoColor: true, Clock: func() time.Time { return time.Time{} }})
+	l.Info("no time")
+	checkNoZeroTime(t, "logger", buf.Bytes(), nil)
+	if got, want := buf.String(), "|  INFO | no time \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}